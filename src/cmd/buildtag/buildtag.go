@@ -0,0 +1,215 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Buildtag converts build constraints between the // +build form
+// and the //go:build expression form.  See doc.go for more information.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	to    = flag.String("to", "go", "form to convert to: go or plus")
+	list  = flag.Bool("l", false, "list files whose constraints would change")
+	write = flag.Bool("w", false, "write result to (source) file instead of stdout")
+)
+
+var exitCode = 0
+
+// Usage is a replacement usage function for the flags package.
+func Usage() {
+	fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\tgo tool buildtag [-to=go|plus] [-l] [-w] [path ...]\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = Usage
+	flag.Parse()
+
+	if *to != "go" && *to != "plus" {
+		fmt.Fprintf(os.Stderr, "buildtag: unknown -to %q\n", *to)
+		os.Exit(2)
+	}
+
+	if flag.NArg() == 0 {
+		if *write {
+			fmt.Fprintf(os.Stderr, "buildtag: cannot use -w with standard input\n")
+			os.Exit(2)
+		}
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			report(err)
+		} else {
+			processData("<standard input>", data)
+		}
+		os.Exit(exitCode)
+	}
+
+	for _, path := range flag.Args() {
+		fi, err := os.Stat(path)
+		switch {
+		case err != nil:
+			report(err)
+		case fi.IsDir():
+			filepath.Walk(path, visit)
+		default:
+			processFile(path)
+		}
+	}
+	os.Exit(exitCode)
+}
+
+func report(err error) {
+	fmt.Fprintf(os.Stderr, "buildtag: %v\n", err)
+	exitCode = 2
+}
+
+func visit(path string, fi os.FileInfo, err error) error {
+	if err != nil {
+		report(err)
+		return nil
+	}
+	if !fi.IsDir() {
+		switch filepath.Ext(path) {
+		case ".go", ".c", ".h", ".s":
+			processFile(path)
+		}
+	}
+	return nil
+}
+
+func processFile(name string) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		report(err)
+		return
+	}
+	processData(name, data)
+}
+
+func processData(name string, data []byte) {
+	out, err := convert(data, *to)
+	if err != nil {
+		report(fmt.Errorf("%s: %v", name, err))
+		return
+	}
+	changed := !bytes.Equal(data, out)
+	if *list {
+		if changed {
+			fmt.Println(name)
+		}
+		return
+	}
+	if *write {
+		if changed {
+			if err := ioutil.WriteFile(name, out, 0666); err != nil {
+				report(err)
+			}
+		}
+		return
+	}
+	os.Stdout.Write(out)
+}
+
+// convert returns data with its build constraint lines converted to
+// the given form, "go" or "plus".
+func convert(data []byte, form string) ([]byte, error) {
+	lines := strings.SplitAfter(string(data), "\n")
+
+	// Like go/build, consider only the leading run of // comments
+	// and blank lines, up to the last blank line in it.
+	end := 0
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			end = i + 1
+			continue
+		}
+		if !strings.HasPrefix(line, "//") {
+			break
+		}
+	}
+	var goBuild, plusBuild []int
+	for i := 0; i < end; i++ {
+		switch {
+		case build.IsGoBuild(lines[i]):
+			goBuild = append(goBuild, i)
+		case build.IsPlusBuild(lines[i]):
+			plusBuild = append(plusBuild, i)
+		}
+	}
+
+	var old []int // lines to replace
+	var repl []string
+	switch form {
+	case "go":
+		if len(plusBuild) == 0 || len(goBuild) > 0 {
+			return data, nil
+		}
+		c, err := parse(lines, plusBuild)
+		if err != nil {
+			return nil, err
+		}
+		old, repl = plusBuild, []string{"//go:build " + c.String()}
+	case "plus":
+		if len(goBuild) == 0 {
+			return data, nil
+		}
+		c, err := parse(lines, goBuild)
+		if err != nil {
+			return nil, err
+		}
+		plus, err := build.PlusBuildLines(c)
+		if err != nil {
+			return nil, err
+		}
+		// The old +build lines give way to the new ones.
+		old, repl = append(goBuild, plusBuild...), plus
+	}
+
+	// Put the new lines where the first old one was.
+	first := old[0]
+	drop := map[int]bool{}
+	for _, i := range old {
+		drop[i] = true
+		if i < first {
+			first = i
+		}
+	}
+	var b bytes.Buffer
+	for i, line := range lines {
+		if i == first {
+			for _, r := range repl {
+				b.WriteString(r + "\n")
+			}
+		}
+		if !drop[i] {
+			b.WriteString(line)
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// parse parses the constraint given by the numbered lines.
+func parse(lines []string, index []int) (build.Constraint, error) {
+	var text []string
+	for _, i := range index {
+		text = append(text, lines[i])
+	}
+	c, err := build.ParseConstraint(text...)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %v", index[0]+1, err)
+	}
+	return c, nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+)
+
+var convertTests = []struct {
+	form, in, out string
+}{
+	{
+		"go",
+		"// Copyright\n\n// +build linux darwin\n// +build !cgo\n\npackage p\n",
+		"// Copyright\n\n//go:build (linux || darwin) && !cgo\n\npackage p\n",
+	},
+	{
+		"plus",
+		"// Copyright\n\n//go:build (linux || darwin) && !cgo\n\npackage p\n",
+		"// Copyright\n\n// +build linux darwin\n// +build !cgo\n\npackage p\n",
+	},
+	{
+		"plus",
+		"//go:build !(linux && 386)\n// +build ignore\n\npackage p\n",
+		"// +build !linux !386\n\npackage p\n",
+	},
+	// A file already in the requested form is unchanged.
+	{
+		"go",
+		"//go:build linux\n// +build linux\n\npackage p\n",
+		"//go:build linux\n// +build linux\n\npackage p\n",
+	},
+	// Lines go/build ignores are left alone.
+	{
+		"go",
+		"// +build linux\npackage p\n\n// +build darwin\n",
+		"// +build linux\npackage p\n\n// +build darwin\n",
+	},
+}
+
+func TestConvert(t *testing.T) {
+	for _, tt := range convertTests {
+		out, err := convert([]byte(tt.in), tt.form)
+		if err != nil {
+			t.Errorf("convert(%q, %s): %v", tt.in, tt.form, err)
+			continue
+		}
+		if string(out) != tt.out {
+			t.Errorf("convert(%q, %s) = %q, want %q", tt.in, tt.form, out, tt.out)
+		}
+	}
+
+	if _, err := convert([]byte("// +build !!linux\n\npackage p\n"), "go"); err == nil {
+		t.Errorf("convert of malformed +build line succeeded")
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+
+Buildtag converts the build constraints of source files between the
+two forms described in the documentation of package go/build: the
+older // +build lines and the //go:build expression.
+
+With -to=go, the default, the // +build lines of a file are replaced
+by a single equivalent //go:build line.  With -to=plus, the //go:build
+line of a file is replaced by equivalent // +build lines; a constraint
+too complex to write that way is an error.  A file that has no
+constraint lines of the form being converted is left alone, as is one
+with a //go:build line when converting to it.  Only the constraint
+lines that go/build honors, in the leading run of comments and blank
+lines, are converted.
+
+Usage:
+
+	go tool buildtag [-to=go|plus] [-l] [-w] [path ...]
+
+With no paths, buildtag converts standard input.  A directory is
+converted recursively, for its .go, .c, .h and .s files.  By default,
+buildtag prints the converted files to standard output.
+
+The flags are:
+	-to
+		The form to convert to: go or plus.
+	-l
+		List the files whose constraints would change,
+		instead of printing them.
+	-w
+		Write the converted files back in place,
+		instead of printing them.
+
+*/
+package documentation
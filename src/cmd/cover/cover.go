@@ -0,0 +1,530 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Cover rewrites Go source files to count the execution of their
+// statements, and reports on the coverage profiles of the rewritten
+// programs.  See doc.go for more information.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+var (
+	mode    = flag.String("mode", "set", "coverage mode: set, count, atomic")
+	varVar  = flag.String("var", "GoCover", "name of coverage variable to generate")
+	output  = flag.String("o", "", "file for output; default: stdout")
+	funcOut = flag.String("func", "", "output coverage profile information for each function")
+	htmlOut = flag.String("html", "", "generate HTML representation of coverage profile")
+)
+
+// Usage is a replacement usage function for the flags package.
+func Usage() {
+	fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\tgo tool cover [-mode=set|count|atomic] [-var=name] [-o out.go] file.go\n")
+	fmt.Fprintf(os.Stderr, "\tgo tool cover -func=c.out [-o out.txt]\n")
+	fmt.Fprintf(os.Stderr, "\tgo tool cover -html=c.out [-o out.html]\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = Usage
+	flag.Parse()
+
+	var err error
+	switch {
+	case *funcOut != "":
+		if flag.NArg() != 0 {
+			flag.Usage()
+		}
+		err = funcOutput(*funcOut, *output)
+	case *htmlOut != "":
+		if flag.NArg() != 0 {
+			flag.Usage()
+		}
+		err = htmlOutput(*htmlOut, *output)
+	default:
+		if flag.NArg() != 1 {
+			flag.Usage()
+		}
+		switch *mode {
+		case "set", "count", "atomic":
+		default:
+			fmt.Fprintf(os.Stderr, "cover: unknown -mode %q\n", *mode)
+			os.Exit(2)
+		}
+		err = annotate(flag.Arg(0), *output)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cover: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// create returns the named file for writing, or standard output if
+// name is empty.
+func create(name string) (io.WriteCloser, error) {
+	if name == "" {
+		return nopCloser{os.Stdout}, nil
+	}
+	return os.Create(name)
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// atomicPackageName is the name under which an annotated file imports
+// sync/atomic in atomic mode, chosen not to collide with its own names.
+const atomicPackageName = "_cover_atomic_"
+
+// A block is a basic block of the source: a run of statements that
+// execute together, which a single counter counts.
+type block struct {
+	start, end token.Position
+	numStmt    int
+}
+
+// File is a wrapper for the state of a file being annotated.
+type File struct {
+	fset    *token.FileSet
+	name    string // Name of file.
+	astFile *ast.File
+	blocks  []block
+}
+
+// annotate rewrites the Go source file named name with a counter for
+// each basic block and writes the result to the file named out.
+func annotate(name, out string) error {
+	fset := token.NewFileSet()
+	content, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	parsedFile, err := parser.ParseFile(fset, name, content, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+	file := &File{
+		fset:    fset,
+		name:    name,
+		astFile: parsedFile,
+	}
+	if *mode == "atomic" {
+		file.addImport("sync/atomic", atomicPackageName)
+	}
+	ast.Walk(file, file.astFile)
+
+	var buf bytes.Buffer
+	cfg := &printer.Config{Mode: printer.SourcePos | printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	if err := cfg.Fprint(&buf, fset, file.astFile); err != nil {
+		return err
+	}
+	file.addVariables(&buf)
+
+	w, err := create(out)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Visit implements the ast.Visitor interface.  It adds counters to
+// the statement lists of blocks, case clauses and select clauses,
+// including those of function literals, as the walk reaches them.
+func (f *File) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case *ast.BlockStmt:
+		// If it's a switch or select, the body is a list of case clauses; don't tag the block itself.
+		if len(n.List) > 0 {
+			switch n.List[0].(type) {
+			case *ast.CaseClause, *ast.CommClause:
+				for _, s := range n.List {
+					ast.Walk(f, s)
+				}
+				return nil
+			}
+		}
+		n.List = f.addCounters(n.Lbrace, n.Rbrace+1, n.List, true)
+	case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+		// A counter in the body of a switch or select without cases
+		// would not be in a clause, which doesn't compile.
+		if f.emptyBody(n) {
+			return nil
+		}
+	case *ast.CaseClause:
+		n.Body = f.addCounters(n.Colon+1, f.clauseEnd(n), n.Body, false)
+	case *ast.CommClause:
+		n.Body = f.addCounters(n.Colon+1, f.clauseEnd(n), n.Body, false)
+	case *ast.IfStmt:
+		// An else if is a statement of its own, not in a list, so
+		// put it in a block to give it a counter of its own.
+		if elseIf, ok := n.Else.(*ast.IfStmt); ok {
+			n.Else = &ast.BlockStmt{
+				Lbrace: elseIf.If,
+				List:   []ast.Stmt{elseIf},
+				Rbrace: elseIf.End() - 1,
+			}
+		}
+	case *ast.FuncDecl:
+		// Functions without bodies are implemented elsewhere, in assembly.
+		if n.Body == nil {
+			return nil
+		}
+	}
+	return f
+}
+
+// emptyBody reports whether the switch or select statement n has no
+// clauses, after walking the rest of it.
+func (f *File) emptyBody(n ast.Node) bool {
+	var body *ast.BlockStmt
+	var rest []ast.Node
+	switch n := n.(type) {
+	case *ast.SwitchStmt:
+		body, rest = n.Body, []ast.Node{n.Init, n.Tag}
+	case *ast.TypeSwitchStmt:
+		body, rest = n.Body, []ast.Node{n.Init, n.Assign}
+	case *ast.SelectStmt:
+		body = n.Body
+	}
+	if len(body.List) > 0 {
+		return false
+	}
+	for _, x := range rest {
+		if x != nil {
+			ast.Walk(f, x)
+		}
+	}
+	return true
+}
+
+// clauseEnd returns the end of the body of a case or select clause,
+// which is where the statements of the clause end or, if there are
+// none, the colon.
+func (f *File) clauseEnd(n ast.Node) token.Pos {
+	var body []ast.Stmt
+	var colon token.Pos
+	switch n := n.(type) {
+	case *ast.CaseClause:
+		body, colon = n.Body, n.Colon
+	case *ast.CommClause:
+		body, colon = n.Body, n.Colon
+	}
+	if len(body) == 0 {
+		return colon + 1
+	}
+	return body[len(body)-1].End()
+}
+
+// addCounters takes a list of statements and adds counters to the
+// beginning of each basic block, where a block ends at a statement
+// that affects the flow of control.  The block from pos to blockEnd
+// contains the list.  If extendToClosingBrace is set, the last basic
+// block extends to blockEnd, the closing brace of a block statement.
+func (f *File) addCounters(pos, blockEnd token.Pos, list []ast.Stmt, extendToClosingBrace bool) []ast.Stmt {
+	// Special case: make sure we add a counter to an empty block.
+	// Can't do this below (add to an empty list) because then
+	// the counter would precede nothing and count nothing.
+	if len(list) == 0 {
+		return []ast.Stmt{f.newCounter(pos, blockEnd, pos, 0)}
+	}
+	var newList []ast.Stmt
+	for {
+		// Find first statement that affects flow of control (break, continue, if, etc.).
+		// It will be the last statement of this basic block.
+		var last int
+		end := blockEnd
+		extend := extendToClosingBrace
+		for last = 0; last < len(list); last++ {
+			// A label can be jumped to, so it starts a basic block.
+			if _, ok := list[last].(*ast.LabeledStmt); ok && last > 0 {
+				end = list[last].Pos()
+				extend = false
+				break
+			}
+			end = f.statementBoundary(list[last])
+			if f.endsBasicSourceBlock(list[last]) {
+				extend = false
+				last++
+				break
+			}
+		}
+		if extend {
+			end = blockEnd
+		}
+		counter := f.newCounter(pos, end, list[0].Pos(), last)
+		if l, ok := list[0].(*ast.LabeledStmt); ok && !isLoopOrSwitch(l.Stmt) {
+			// Move the label to the counter, so that a goto
+			// counts the block.  A label on a loop or switch,
+			// the target of a break or continue, must stay.
+			newList = append(newList, &ast.LabeledStmt{Label: l.Label, Colon: l.Colon, Stmt: counter}, l.Stmt)
+			newList = append(newList, list[1:last]...)
+		} else {
+			newList = append(newList, counter)
+			newList = append(newList, list[0:last]...)
+		}
+		list = list[last:]
+		if len(list) == 0 {
+			break
+		}
+		pos = list[0].Pos()
+	}
+	return newList
+}
+
+// isLoopOrSwitch reports whether s can be the target of a labeled
+// break or continue.
+func isLoopOrSwitch(s ast.Stmt) bool {
+	switch s.(type) {
+	case *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+		return true
+	}
+	return false
+}
+
+// statementBoundary finds the location in s that terminates the
+// current basic block in the source: for a statement with a body,
+// where the body begins.
+func (f *File) statementBoundary(s ast.Stmt) token.Pos {
+	// Control flow statements are easy.
+	switch s := s.(type) {
+	case *ast.BlockStmt:
+		// Treat blocks like basic blocks to avoid overlapping counters.
+		return s.Lbrace
+	case *ast.IfStmt:
+		return s.Body.Lbrace
+	case *ast.ForStmt:
+		return s.Body.Lbrace
+	case *ast.LabeledStmt:
+		return f.statementBoundary(s.Stmt)
+	case *ast.RangeStmt:
+		return s.Body.Lbrace
+	case *ast.SwitchStmt:
+		return s.Body.Lbrace
+	case *ast.SelectStmt:
+		return s.Body.Lbrace
+	case *ast.TypeSwitchStmt:
+		return s.Body.Lbrace
+	}
+	// If not a control flow statement, it is a declaration, expression, call, etc. and it may have a function literal.
+	// If it does, that's tricky because we want to exclude the body of the function from this block.
+	// Draw a line at the start of the body of the first function literal we find.
+	found, pos := hasFuncLiteral(s)
+	if found {
+		return pos
+	}
+	return s.End()
+}
+
+// endsBasicSourceBlock reports whether s changes the flow of control
+// or contains a body, and so ends the current basic block.
+func (f *File) endsBasicSourceBlock(s ast.Stmt) bool {
+	switch s := s.(type) {
+	case *ast.BlockStmt:
+		// Treat blocks like basic blocks to avoid overlapping counters.
+		return true
+	case *ast.BranchStmt:
+		return true
+	case *ast.ForStmt:
+		return true
+	case *ast.IfStmt:
+		return true
+	case *ast.LabeledStmt:
+		return f.endsBasicSourceBlock(s.Stmt)
+	case *ast.RangeStmt:
+		return true
+	case *ast.SwitchStmt:
+		return true
+	case *ast.SelectStmt:
+		return true
+	case *ast.TypeSwitchStmt:
+		return true
+	case *ast.ReturnStmt:
+		return true
+	case *ast.ExprStmt:
+		// Calls to panic change the flow.
+		if call, ok := s.X.(*ast.CallExpr); ok {
+			if ident, ok := call.Fun.(*ast.Ident); ok && ident.Name == "panic" && len(call.Args) == 1 {
+				return true
+			}
+		}
+	}
+	found, _ := hasFuncLiteral(s)
+	return found
+}
+
+// funcLitFinder implements the ast.Visitor pattern to find the
+// location of the body of the first function literal in a statement.
+type funcLitFinder token.Pos
+
+func (f *funcLitFinder) Visit(node ast.Node) ast.Visitor {
+	if f.found() {
+		return nil // Prune search.
+	}
+	switch n := node.(type) {
+	case *ast.FuncLit:
+		*f = funcLitFinder(n.Body.Lbrace)
+		return nil // Prune search.
+	}
+	return f
+}
+
+func (f *funcLitFinder) found() bool {
+	return token.Pos(*f) != token.NoPos
+}
+
+// hasFuncLiteral reports the existence and position of the first
+// function literal in the node, if any.
+func hasFuncLiteral(n ast.Node) (bool, token.Pos) {
+	if n == nil {
+		return false, 0
+	}
+	var literal funcLitFinder
+	ast.Walk(&literal, n)
+	return literal.found(), token.Pos(literal)
+}
+
+// newCounter creates a new counter expression of the appropriate
+// form for the basic block from start to end containing numStmt
+// statements, and records the block.  The counter is placed at the
+// position at, that of the first statement of the block, so that the
+// printer keeps it on the line of that statement.
+func (f *File) newCounter(start, end, at token.Pos, numStmt int) ast.Stmt {
+	counter := &ast.IndexExpr{
+		X: &ast.SelectorExpr{
+			X:   &ast.Ident{NamePos: at, Name: *varVar},
+			Sel: &ast.Ident{NamePos: at, Name: "Count"},
+		},
+		Lbrack: at,
+		Index: &ast.BasicLit{
+			ValuePos: at,
+			Kind:     token.INT,
+			Value:    strconv.Itoa(len(f.blocks)),
+		},
+		Rbrack: at,
+	}
+	f.blocks = append(f.blocks, block{
+		start:   f.fset.Position(start),
+		end:     f.fset.Position(end),
+		numStmt: numStmt,
+	})
+	switch *mode {
+	case "set":
+		return &ast.AssignStmt{
+			Lhs:    []ast.Expr{counter},
+			TokPos: at,
+			Tok:    token.ASSIGN,
+			Rhs:    []ast.Expr{&ast.BasicLit{ValuePos: at, Kind: token.INT, Value: "1"}},
+		}
+	case "count":
+		return &ast.IncDecStmt{
+			X:      counter,
+			TokPos: at,
+			Tok:    token.INC,
+		}
+	case "atomic":
+		return &ast.AssignStmt{
+			Lhs:    []ast.Expr{&ast.Ident{NamePos: at, Name: "_"}},
+			TokPos: at,
+			Tok:    token.ASSIGN,
+			Rhs: []ast.Expr{&ast.CallExpr{
+				Fun: &ast.SelectorExpr{
+					X:   &ast.Ident{NamePos: at, Name: atomicPackageName},
+					Sel: &ast.Ident{NamePos: at, Name: "AddUint32"},
+				},
+				Lparen: at,
+				Args: []ast.Expr{
+					&ast.UnaryExpr{
+						OpPos: at,
+						Op:    token.AND,
+						X:     counter,
+					},
+					&ast.BasicLit{ValuePos: at, Kind: token.INT, Value: "1"},
+				},
+				Rparen: at,
+			}},
+		}
+	}
+	panic("unreachable")
+}
+
+// addImport adds an import of path under name to the file.
+func (f *File) addImport(path, name string) {
+	spec := &ast.ImportSpec{
+		Name: ast.NewIdent(name),
+		Path: &ast.BasicLit{
+			Kind:  token.STRING,
+			Value: strconv.Quote(path),
+		},
+	}
+	decl := &ast.GenDecl{
+		Tok:   token.IMPORT,
+		Specs: []ast.Spec{spec},
+	}
+	f.astFile.Decls = append([]ast.Decl{decl}, f.astFile.Decls...)
+	f.astFile.Imports = append(f.astFile.Imports, spec)
+
+	// Make sure the import is used even if the file has no blocks.
+	f.astFile.Decls = append(f.astFile.Decls, &ast.GenDecl{
+		Tok: token.VAR,
+		Specs: []ast.Spec{&ast.ValueSpec{
+			Names: []*ast.Ident{ast.NewIdent("_")},
+			Values: []ast.Expr{&ast.SelectorExpr{
+				X:   ast.NewIdent(name),
+				Sel: ast.NewIdent("LoadUint32"),
+			}},
+		}},
+	})
+}
+
+// addVariables adds to the end of the file the declaration of the
+// coverage variable, which holds the counters and, for the report, the
+// positions and statement counts of the blocks.
+func (f *File) addVariables(w io.Writer) {
+	n := len(f.blocks)
+	fmt.Fprintf(w, "\nvar %s = struct {\n", *varVar)
+	fmt.Fprintf(w, "\tCount     [%d]uint32\n", n)
+	fmt.Fprintf(w, "\tPos       [3 * %d]uint32\n", n)
+	fmt.Fprintf(w, "\tNumStmt   [%d]uint16\n", n)
+	fmt.Fprintf(w, "} {\n")
+
+	// The positions of each block: start line, end line, and the
+	// start and end columns packed into a single word.
+	fmt.Fprintf(w, "\tPos: [3 * %d]uint32{\n", n)
+	for i, b := range f.blocks {
+		fmt.Fprintf(w, "\t\t%d, %d, %#x, // [%d]\n",
+			b.start.Line, b.end.Line, (b.end.Column&0xFFFF)<<16|(b.start.Column&0xFFFF), i)
+	}
+	fmt.Fprintf(w, "\t},\n")
+
+	// The number of statements in each block.
+	fmt.Fprintf(w, "\tNumStmt: [%d]uint16{\n", n)
+	for i, b := range f.blocks {
+		// A block with more statements than fit in a uint16 is
+		// unlikely, but report it as the largest possible.
+		numStmt := b.numStmt
+		if numStmt > 1<<16-1 {
+			numStmt = 1<<16 - 1
+		}
+		fmt.Fprintf(w, "\t\t%d, // %d\n", numStmt, i)
+	}
+	fmt.Fprintf(w, "\t},\n")
+	fmt.Fprintf(w, "}\n")
+}
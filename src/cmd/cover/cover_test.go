@@ -0,0 +1,109 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testdata = "testdata/test.go"
+
+// The number of basic blocks in testdata/test.go.
+const numBlocks = 23
+
+func TestAnnotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cover")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(m string) { *mode = m }(*mode)
+	for _, m := range []string{"set", "count", "atomic"} {
+		*mode = m
+		out := filepath.Join(dir, m+".go")
+		if err := annotate(testdata, out); err != nil {
+			t.Errorf("%s: %v", m, err)
+			continue
+		}
+		src, err := ioutil.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := parser.ParseFile(token.NewFileSet(), out, src, 0); err != nil {
+			t.Errorf("%s: annotated source does not parse: %v", m, err)
+			continue
+		}
+		if n := strings.Count(string(src), *varVar+".Count["); n != numBlocks {
+			t.Errorf("%s: %d counters, want %d", m, n, numBlocks)
+		}
+		if want := fmt.Sprintf("[3 * %d]uint32", numBlocks); !strings.Contains(string(src), want) {
+			t.Errorf("%s: no declaration of %d positions", m, numBlocks)
+		}
+		if imp := strings.Contains(string(src), `"sync/atomic"`); imp != (m == "atomic") {
+			t.Errorf("%s: imports sync/atomic = %v", m, imp)
+		}
+	}
+}
+
+const testProfile = `mode: count
+cover/testdata/test.go:14.26,15.11 1 3
+cover/testdata/test.go:22.2,22.25 1 3
+cover/testdata/test.go:15.11,16.15 1 0
+cover/testdata/test.go:50.11,50.12 0 0
+`
+
+func TestParseProfiles(t *testing.T) {
+	profiles, err := parseProfiles(strings.NewReader(testProfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 1 {
+		t.Fatalf("got %d profiles, want 1", len(profiles))
+	}
+	p := profiles[0]
+	if p.Mode != "count" || p.FileName != "cover/testdata/test.go" || len(p.Blocks) != 4 {
+		t.Fatalf("got mode %q, file %q, %d blocks", p.Mode, p.FileName, len(p.Blocks))
+	}
+	want := ProfileBlock{StartLine: 15, StartCol: 11, EndLine: 16, EndCol: 15, NumStmt: 1, Count: 0}
+	if p.Blocks[1] != want {
+		t.Errorf("blocks not sorted: second is %+v, want %+v", p.Blocks[1], want)
+	}
+
+	for _, bad := range []string{"", "count\n", "mode: set\nfile.go:1.1,2 1 1\n"} {
+		if _, err := parseProfiles(strings.NewReader(bad)); err == nil {
+			t.Errorf("parsing %q: no error", bad)
+		}
+	}
+}
+
+func TestFuncCoverage(t *testing.T) {
+	profiles, err := parseProfiles(strings.NewReader(testProfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	funcs, err := findFuncs(testdata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][2]int64{
+		"F": {2, 3},
+		"G": {0, 1},
+		"H": {0, 1},
+	}
+	for _, f := range funcs {
+		c, n := f.coverage(profiles[0])
+		if w := want[f.name]; c != w[0] || n != w[1] {
+			t.Errorf("%s: coverage %d/%d, want %d/%d", f.name, c, n, w[0], w[1])
+		}
+	}
+}
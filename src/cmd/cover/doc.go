@@ -0,0 +1,53 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+
+Cover is a program for analyzing the coverage profiles generated by
+'go test -coverprofile=cover.out'.
+
+Cover is also used by 'go test -cover' to rewrite the source code with
+annotations to track which parts of each function are executed.
+It operates on one Go source file at a time, computing approximate
+basic block information by studying the source.  It inserts a counter
+at the start of each basic block and declares a variable holding the
+counters, the positions of the blocks and their numbers of statements.
+The file is rewritten with go/ast and printed with go/printer, with
+//line comments that keep the positions of the original source.
+
+Usage:
+
+	go tool cover [-mode=set|count|atomic] [-var=name] [-o out.go] file.go
+	go tool cover -func=c.out [-o out.txt]
+	go tool cover -html=c.out [-o out.html]
+
+The flags are:
+	-mode
+		The counting mode of the annotated source:
+			set	a counter records whether its block ran (the default)
+			count	a counter records how many times its block ran
+			atomic	like count, but safe for tests that run blocks
+				concurrently, at some cost in speed
+	-var
+		The name of the coverage variable to declare, GoCover by default.
+		The go test command names a variable for each file of a package.
+	-func
+		Print the coverage of each function in the profile, and in
+		total, as percentages of their statements.
+	-html
+		Write an HTML page showing the source of each file in the
+		profile, colored by coverage: red for statements that did not
+		run and green, brighter the more often it ran, for those that did.
+	-o
+		The file to write the output to; standard output by default.
+
+The profile written by the testing package with -test.coverprofile
+begins with a line giving the mode,
+	mode: set
+followed by a line for each block,
+	import/path/file.go:line.column,line.column numberOfStatements count
+where the positions are those of the start and end of the block.
+
+*/
+package documentation
@@ -0,0 +1,236 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"go/build"
+	"io"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Profile represents the profiling data for a specific file.
+type Profile struct {
+	FileName string
+	Mode     string
+	Blocks   []ProfileBlock
+}
+
+// ProfileBlock represents a single block of profiling data.
+type ProfileBlock struct {
+	StartLine, StartCol int
+	EndLine, EndCol     int
+	NumStmt, Count      int
+}
+
+type byFileName []*Profile
+
+func (p byFileName) Len() int           { return len(p) }
+func (p byFileName) Less(i, j int) bool { return p[i].FileName < p[j].FileName }
+func (p byFileName) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+type blocksByStart []ProfileBlock
+
+func (b blocksByStart) Len() int      { return len(b) }
+func (b blocksByStart) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b blocksByStart) Less(i, j int) bool {
+	bi, bj := b[i], b[j]
+	return bi.StartLine < bj.StartLine || bi.StartLine == bj.StartLine && bi.StartCol < bj.StartCol
+}
+
+// lineRe matches a line of a profile after the mode line:
+//
+//	name.go:line.column,line.column numberOfStatements count
+var lineRe = regexp.MustCompile(`^(.+):([0-9]+)\.([0-9]+),([0-9]+)\.([0-9]+) ([0-9]+) ([0-9]+)$`)
+
+// ParseProfiles parses the profile data in the named file and returns
+// a Profile for each source file described therein, sorted by name,
+// with the blocks of each sorted by position.
+func ParseProfiles(fileName string) ([]*Profile, error) {
+	pf, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer pf.Close()
+	profiles, err := parseProfiles(pf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fileName, err)
+	}
+	return profiles, nil
+}
+
+func parseProfiles(r io.Reader) ([]*Profile, error) {
+	files := make(map[string]*Profile)
+	buf := bufio.NewReader(r)
+	mode := ""
+	for n := 1; ; n++ {
+		line, err := buf.ReadString('\n')
+		if err == io.EOF {
+			if line == "" {
+				break
+			}
+		} else if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if n == 1 {
+			if !strings.HasPrefix(line, "mode: ") {
+				return nil, fmt.Errorf("line %d: missing mode line", n)
+			}
+			mode = line[len("mode: "):]
+			continue
+		}
+		if line == "" {
+			continue
+		}
+		m := lineRe.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("line %d: malformed profile line %q", n, line)
+		}
+		fn := m[1]
+		p := files[fn]
+		if p == nil {
+			p = &Profile{
+				FileName: fn,
+				Mode:     mode,
+			}
+			files[fn] = p
+		}
+		p.Blocks = append(p.Blocks, ProfileBlock{
+			StartLine: toInt(m[2]),
+			StartCol:  toInt(m[3]),
+			EndLine:   toInt(m[4]),
+			EndCol:    toInt(m[5]),
+			NumStmt:   toInt(m[6]),
+			Count:     toInt(m[7]),
+		})
+	}
+	if mode == "" {
+		return nil, fmt.Errorf("empty profile")
+	}
+	var profiles []*Profile
+	for _, p := range files {
+		sort.Sort(blocksByStart(p.Blocks))
+		profiles = append(profiles, p)
+	}
+	sort.Sort(byFileName(profiles))
+	return profiles, nil
+}
+
+func toInt(s string) int {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		// The regexp admits only digits, so the number is too large.
+		return 1<<31 - 1
+	}
+	return i
+}
+
+// Boundary represents the position in a source file of the beginning
+// or end of a block as reported by the coverage profile.
+type Boundary struct {
+	Offset int     // Location as a byte offset in the source file.
+	Start  bool    // Is this the start of a block?
+	Count  int     // Event count from the cover profile.
+	Norm   float64 // Count normalized to [0..1].
+}
+
+// Boundaries returns a Profile as a set of Boundary objects within the
+// provided src, sorted by offset.
+func (p *Profile) Boundaries(src []byte) (boundaries []Boundary) {
+	// Find maximum count.
+	max := 0
+	for _, b := range p.Blocks {
+		if b.Count > max {
+			max = b.Count
+		}
+	}
+	// Divisor for normalization: counts are shown on a logarithmic
+	// scale, so that a hot loop doesn't wash out the rest.
+	divisor := math.Log(float64(max))
+
+	// boundary returns a Boundary, populating the Norm field with a normalized Count.
+	boundary := func(offset int, start bool, count int) Boundary {
+		b := Boundary{Offset: offset, Start: start, Count: count}
+		if !start || count == 0 {
+			return b
+		}
+		if max <= 1 {
+			b.Norm = 0.8 // Profile is in "set" mode; we want a heat map. Use cov8 in the CSS.
+		} else if count > 0 {
+			b.Norm = math.Log(float64(count)) / divisor
+		}
+		return b
+	}
+
+	line, col := 1, 1
+	for si, bi := 0, 0; si < len(src) && bi < len(p.Blocks); {
+		b := p.Blocks[bi]
+		if b.StartLine == b.EndLine && b.StartCol == b.EndCol {
+			// An empty block, such as an empty case clause, has nothing to show.
+			bi++
+			continue
+		}
+		if b.StartLine == line && b.StartCol == col {
+			boundaries = append(boundaries, boundary(si, true, b.Count))
+		}
+		if b.EndLine == line && b.EndCol == col || line > b.EndLine {
+			boundaries = append(boundaries, boundary(si, false, 0))
+			bi++
+			continue // Don't advance through src; maybe the next block starts here.
+		}
+		if src[si] == '\n' {
+			line++
+			col = 0
+		}
+		col++
+		si++
+	}
+	sort.Sort(boundariesByPos(boundaries))
+	return
+}
+
+type boundariesByPos []Boundary
+
+func (b boundariesByPos) Len() int      { return len(b) }
+func (b boundariesByPos) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b boundariesByPos) Less(i, j int) bool {
+	if b[i].Offset == b[j].Offset {
+		return !b[i].Start && b[j].Start
+	}
+	return b[i].Offset < b[j].Offset
+}
+
+// findFile finds the location of the named file in the Go trees.  The
+// name is the import path of the package joined with the file name,
+// as the go test command records it in the profile.
+func findFile(file string) (string, error) {
+	if filepath.IsAbs(file) {
+		return file, nil
+	}
+	dir, base := path.Split(file)
+	if dir != "" {
+		dir = dir[:len(dir)-1] // Drop the trailing slash.
+	}
+	ctxt := build.DefaultContext
+	ctxt.Project, _ = ctxt.FindProject(".") // ignore errors
+	t, pkg, err := ctxt.FindTree(dir)
+	if err == nil {
+		return filepath.Join(t.PkgSrcDir(pkg), base), nil
+	}
+	// Commands in the Go root are found by their directories.
+	if goroot := build.Path[0]; strings.HasPrefix(dir, "cmd/") {
+		return filepath.Join(goroot.Path, "src", filepath.FromSlash(dir), base), nil
+	}
+	return "", fmt.Errorf("can't find %q: %v", file, err)
+}
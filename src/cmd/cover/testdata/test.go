@@ -0,0 +1,60 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This program is processed by the cover command, and then the
+// result is parsed by cover_test.go to check the annotations.
+
+package p
+
+import "fmt"
+
+// F has most kinds of blocks: if and else if, loops, switch and
+// select cases, a function literal and labels.
+func F(x int) (s string) {
+	if x < 0 {
+		return "neg" // negative
+	} else if x == 0 {
+		s = "zero"
+	} else {
+		s = "pos"
+	}
+	for i := 0; i < x; i++ {
+		switch {
+		case i%2 == 0:
+			s += "e"
+		case i == 3:
+		default:
+			s += "o"
+		}
+	}
+	f := func() int { return 1 }
+	_ = f
+L:
+	x--
+	if x > 5 {
+		goto L
+	}
+outer:
+	for {
+		select {
+		default:
+			break outer
+		}
+	}
+	fmt.Sprint()
+	return
+}
+
+// G has an empty body.
+func G() {}
+
+// H has switches and a select without cases, whose bodies must stay
+// empty.
+func H(x interface{}) {
+	switch y := 1; y {
+	}
+	switch x.(type) {
+	}
+	select {}
+}
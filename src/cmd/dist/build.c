@@ -1103,6 +1103,9 @@ static char *buildorder[] = {
 	"pkg/math",
 	"pkg/strings",
 	"pkg/strconv",
+	"pkg/hash",
+	"pkg/crypto",
+	"pkg/crypto/sha1",
 	"pkg/bufio",
 	"pkg/sort",
 	"pkg/container/heap",
@@ -1164,6 +1167,8 @@ static char *cleantab[] = {
 	"pkg/bufio",
 	"pkg/bytes",
 	"pkg/container/heap",
+	"pkg/crypto",
+	"pkg/crypto/sha1",
 	"pkg/encoding/base64",
 	"pkg/encoding/json",
 	"pkg/errors",
@@ -1175,6 +1180,7 @@ static char *cleantab[] = {
 	"pkg/go/parser",
 	"pkg/go/scanner",
 	"pkg/go/token",
+	"pkg/hash",
 	"pkg/io",
 	"pkg/io/ioutil",
 	"pkg/log",
@@ -105,6 +105,12 @@ char *runtimeimport =
 	"func @\"\".int64tofloat64(? int64) (? float64)\n"
 	"func @\"\".uint64tofloat64(? uint64) (? float64)\n"
 	"func @\"\".complex128div(@\"\".num complex128, @\"\".den complex128) (@\"\".quo complex128)\n"
+	"func @\"\".racefuncenter(? uintptr)\n"
+	"func @\"\".racefuncexit()\n"
+	"func @\"\".raceread(? uintptr)\n"
+	"func @\"\".racewrite(? uintptr)\n"
+	"func @\"\".racereadrange(@\"\".addr uintptr, @\"\".size uintptr)\n"
+	"func @\"\".racewriterange(@\"\".addr uintptr, @\"\".size uintptr)\n"
 	"\n"
 	"$$\n";
 char *unsafeimport =
@@ -50,6 +50,9 @@ Flags:
 		disallow importing packages not marked as safe
 	-V
 		print the compiler version
+	-b
+		instrument memory accesses for the race detector and import
+		packages from the $GOROOT/pkg/$GOOS_$GOARCH_race directory
 
 There are also a number of debugging flags; run the command with no arguments
 to get a usage message.
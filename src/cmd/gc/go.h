@@ -842,6 +842,7 @@ EXTERN	int32	thunk;
 EXTERN	int	funcdepth;
 EXTERN	int	typecheckok;
 EXTERN	int	compiling_runtime;
+EXTERN	int	flag_race;
 
 /*
  *	y.tab.c
@@ -1099,6 +1100,11 @@ Sym*	stringsym(char*, int);
  */
 void	order(Node *fn);
 
+/*
+ *	racewalk.c
+ */
+void	racewalk(Node *fn);
+
 /*
  *	range.c
  */
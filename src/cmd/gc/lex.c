@@ -154,6 +154,7 @@ usage(void)
 	print("  -S print the assembly language\n");
 	print("  -V print the compiler version\n");
 	print("  -W print the parse tree after typing\n");
+	print("  -b enable race detection\n");
 	print("  -d print declarations\n");
 	print("  -e no limit on number of errors printed\n");
 	print("  -f print stack frame structure\n");
@@ -267,6 +268,10 @@ main(int argc, char *argv[])
 	// special flag to detect compilation of package runtime
 	compiling_runtime = debug['+'];
 
+	// -b instruments memory accesses for the race detector
+	// and uses packages built for race detection.
+	flag_race = debug['b'];
+
 	pathname = mal(1000);
 	if(getwd(pathname, 999) == 0)
 		strcpy(pathname, "/???");
@@ -525,7 +530,7 @@ static int
 findpkg(Strlit *name)
 {
 	Idir *p;
-	char *q;
+	char *q, *suffix;
 
 	if(islocalname(name)) {
 		if(safemode)
@@ -563,10 +568,13 @@ findpkg(Strlit *name)
 			return 1;
 	}
 	if(goroot != nil) {
-		snprint(namebuf, sizeof(namebuf), "%s/pkg/%s_%s/%Z.a", goroot, goos, goarch, name);
+		suffix = "";
+		if(flag_race)
+			suffix = "_race";
+		snprint(namebuf, sizeof(namebuf), "%s/pkg/%s_%s%s/%Z.a", goroot, goos, goarch, suffix, name);
 		if(access(namebuf, 0) >= 0)
 			return 1;
-		snprint(namebuf, sizeof(namebuf), "%s/pkg/%s_%s/%Z.%c", goroot, goos, goarch, name, thechar);
+		snprint(namebuf, sizeof(namebuf), "%s/pkg/%s_%s%s/%Z.%c", goroot, goos, goarch, suffix, name, thechar);
 		if(access(namebuf, 0) >= 0)
 			return 1;
 	}
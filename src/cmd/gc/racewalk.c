@@ -0,0 +1,395 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The racewalk pass modifies the code tree for the function as follows:
+//
+// 1. It inserts a call to racefuncenter at the beginning of each function.
+// 2. It inserts a call to racefuncexit at the end of each function.
+// 3. It inserts a call to raceread before each memory read.
+// 4. It inserts a call to racewrite before each memory write.
+//
+// The calls go to the init list of the enclosing statement,
+// so they run just before the statement that makes the access.
+// Only memory that another goroutine can see is instrumented:
+// global and heap variables and anything reached through a
+// pointer, slice or closure reference.  Accesses whose address
+// cannot be computed again without repeating a function call
+// are not instrumented.
+
+#include <u.h>
+#include <libc.h>
+#include "go.h"
+
+static void racewalklist(NodeList *l, NodeList **init);
+static void racewalknode(Node **np, NodeList **init, int wr, int skip);
+static int callinstr(Node *n, NodeList **init, int wr, int skip);
+static Node* uintptraddr(Node *n);
+static Node* basenod(Node *n);
+static int isartificial(Node *n);
+
+// Do not instrument the following packages at all,
+// at best instrumentation would cause infinite recursion.
+static char *omit_pkgs[] = {"runtime", "runtime/race", "runtime/cgo"};
+// Only insert racefuncenter/racefuncexit into the following packages.
+// Memory accesses in the packages are either uninteresting or
+// would cause false positives: they implement synchronization
+// and report it to the race runtime themselves.
+static char *noinst_pkgs[] = {"sync", "sync/atomic"};
+
+static int
+ispkgin(char **pkgs, int n)
+{
+	int i;
+
+	if(myimportpath) {
+		for(i=0; i<n; i++) {
+			if(strcmp(myimportpath, pkgs[i]) == 0)
+				return 1;
+		}
+	}
+	return 0;
+}
+
+void
+racewalk(Node *fn)
+{
+	Node *nd;
+	Node *nodpc;
+	char s[1024];
+
+	if(compiling_runtime || ispkgin(omit_pkgs, nelem(omit_pkgs)))
+		return;
+
+	if(!ispkgin(noinst_pkgs, nelem(noinst_pkgs))) {
+		racewalklist(fn->nbody, nil);
+		// nothing interesting for race detector in fn->enter
+		racewalklist(fn->exit, nil);
+	}
+
+	// nodpc is the PC of the caller as extracted by
+	// getcallerpc.  We use -widthptr(FP) for x86.
+	// BUG: this will not work on arm.
+	nodpc = nod(OXXX, nil, nil);
+	*nodpc = *nodfp;
+	nodpc->type = types[TUINTPTR];
+	nodpc->xoffset = -widthptr;
+	nd = mkcall("racefuncenter", T, nil, nodpc);
+	fn->enter = concat(list1(nd), fn->enter);
+	nd = mkcall("racefuncexit", T, nil);
+	fn->exit = list(fn->exit, nd);
+
+	if(debug['W']) {
+		snprint(s, sizeof(s), "after racewalk %S", fn->nname->sym);
+		dumplist(s, fn->nbody);
+		snprint(s, sizeof(s), "exit %S", fn->nname->sym);
+		dumplist(s, fn->exit);
+	}
+}
+
+// racewalklist instruments the statements in l.
+// If init is nil, the instrumentation of each statement
+// goes to the statement's own init list.
+static void
+racewalklist(NodeList *l, NodeList **init)
+{
+	NodeList *instr;
+
+	for(; l; l = l->next) {
+		instr = nil;
+		racewalknode(&l->n, &instr, 0, 0);
+		if(init == nil)
+			l->n->ninit = concat(l->n->ninit, instr);
+		else
+			*init = concat(*init, instr);
+	}
+}
+
+// racewalknode is walkexpr and walkstmt combined:
+// it walks the tree and adds calls to the instrumentation
+// code to *init, which belongs to the enclosing statement.
+// wr reports whether n is being written, and skip whether
+// n itself must not be instrumented, such as the operand of &.
+static void
+racewalknode(Node **np, NodeList **init, int wr, int skip)
+{
+	Node *n;
+	NodeList *fini;
+
+	n = *np;
+	if(n == N)
+		return;
+
+	if(debug['w'] > 1)
+		dump("racewalk-before", n);
+	setlineno(n);
+
+	racewalklist(n->ninit, nil);
+
+	switch(n->op) {
+	default:
+		// Not an access of interest; look only at
+		// the statements it contains.
+		break;
+
+	case OAS:
+	case OASOP:
+		racewalknode(&n->left, init, 1, 0);
+		racewalknode(&n->right, init, 0, 0);
+		break;
+
+	case OBLOCK:
+		if(n->list == nil)
+			break;
+		switch(n->list->n->op) {
+		case OCALLFUNC:
+		case OCALLMETH:
+		case OCALLINTER:
+			// Blocks are used for multiple return function calls.
+			// x, y := f() becomes BLOCK{CALL f, AS x [SP+0], AS y [SP+n]}
+			// We don't want to instrument between the statements because it will
+			// smash the results.
+			racewalknode(&n->list->n, &n->list->n->ninit, 0, 0);
+			fini = nil;
+			racewalklist(n->list->next, &fini);
+			n->list = concat(n->list, fini);
+			break;
+
+		default:
+			// Ordinary block, for loop initialization or inlined bodies.
+			racewalklist(n->list, nil);
+			break;
+		}
+		break;
+
+	case OCALLFUNC:
+	case OCALLMETH:
+	case OCALLINTER:
+		racewalknode(&n->left, init, 0, 0);
+		// The arguments are assignments to the outgoing
+		// argument area; only their values are accesses.
+		racewalklist(n->list, init);
+		break;
+
+	case ODEFER:
+	case OPROC:
+		racewalknode(&n->left, init, 0, 0);
+		break;
+
+	case ONOT:
+	case OMINUS:
+	case OPLUS:
+	case OREAL:
+	case OIMAG:
+	case OCOM:
+	case OCONV:
+	case OCONVNOP:
+	case OLEN:
+	case OCAP:
+	case OITAB:
+	case ODOTINTER:
+	case ODOTMETH:
+		racewalknode(&n->left, init, 0, 0);
+		break;
+
+	case OLSH:
+	case ORSH:
+	case OAND:
+	case OANDNOT:
+	case OOR:
+	case OXOR:
+	case OSUB:
+	case OMUL:
+	case ODIV:
+	case OMOD:
+	case OEQ:
+	case ONE:
+	case OLT:
+	case OLE:
+	case OGE:
+	case OGT:
+	case OADD:
+	case OCOMPLEX:
+		racewalknode(&n->left, init, 0, 0);
+		racewalknode(&n->right, init, 0, 0);
+		break;
+
+	case OANDAND:
+	case OOROR:
+		racewalknode(&n->left, init, 0, 0);
+		// n->right may not be executed,
+		// so instrumentation goes to n->right->ninit, not init.
+		fini = nil;
+		racewalknode(&n->right, &fini, 0, 0);
+		addinit(&n->right, fini);
+		break;
+
+	case ONAME:
+		callinstr(n, init, wr, skip);
+		break;
+
+	case ODOT:
+		// The access is to the field, not the whole struct.
+		racewalknode(&n->left, init, 0, 1);
+		callinstr(n, init, wr, skip);
+		break;
+
+	case ODOTPTR:
+	case OIND:
+		racewalknode(&n->left, init, 0, 0);
+		callinstr(n, init, wr, skip);
+		break;
+
+	case OINDEX:
+		if(istype(n->left->type, TSTRING)) {
+			// Strings are immutable.
+			racewalknode(&n->left, init, 0, 0);
+			racewalknode(&n->right, init, 0, 0);
+			break;
+		}
+		if(isfixedarray(n->left->type))
+			racewalknode(&n->left, init, 0, 1);
+		else
+			racewalknode(&n->left, init, 0, 0);
+		racewalknode(&n->right, init, 0, 0);
+		callinstr(n, init, wr, skip);
+		break;
+
+	case OADDR:
+		racewalknode(&n->left, init, 0, 1);
+		break;
+
+	case OPARAM:
+		// Copies heap parameters back on return;
+		// the function's own accesses are instrumented.
+		break;
+
+	case OFOR:
+		if(n->ntest != N) {
+			fini = nil;
+			racewalknode(&n->ntest, &fini, 0, 0);
+			addinit(&n->ntest, fini);
+		}
+		if(n->nincr != N)
+			racewalklist(list1(n->nincr), nil);
+		racewalklist(n->nbody, nil);
+		break;
+
+	case OIF:
+		if(n->ntest != N)
+			racewalknode(&n->ntest, init, 0, 0);
+		racewalklist(n->nbody, nil);
+		racewalklist(n->nelse, nil);
+		break;
+
+	case ORETURN:
+		racewalklist(n->list, init);
+		break;
+
+	case OSWITCH:
+	case OSELECT:
+		// Walk has rewritten the cases into the body.
+		racewalklist(n->list, nil);
+		racewalklist(n->nbody, nil);
+		break;
+	}
+
+	*np = n;
+}
+
+// callinstr adds to *init a call that reports the access to n.
+// It reports whether it did.
+static int
+callinstr(Node *n, NodeList **init, int wr, int skip)
+{
+	Node *f, *b;
+	Type *t;
+	char *name;
+
+	if(skip || n->type == T || n->type->etype >= TIDEAL)
+		return 0;
+	t = n->type;
+	if(t->width == 0 || isartificial(n))
+		return 0;
+
+	b = basenod(n);
+	if(isartificial(b))
+		return 0;
+	switch(b->op) {
+	default:
+		return 0;
+	case ONAME:
+		// Other goroutines cannot see variables on the stack.
+		if(!(b->class&PHEAP) && b->class != PEXTERN && b->class != PPARAMREF)
+			return 0;
+		break;
+	case OIND:
+	case ODOTPTR:
+	case OINDEX:	// of a slice
+		break;
+	}
+
+	// Computing the address again must not repeat a call.
+	ullmancalc(n);
+	if(n->ullman >= UINF)
+		return 0;
+
+	n = treecopy(n);
+	if(t->width <= widthptr) {
+		name = wr ? "racewrite" : "raceread";
+		f = mkcall(name, T, init, uintptraddr(n));
+	} else {
+		name = wr ? "racewriterange" : "racereadrange";
+		f = mkcall(name, T, init, uintptraddr(n), nodintconst(t->width));
+	}
+	*init = list(*init, f);
+	return 1;
+}
+
+static Node*
+uintptraddr(Node *n)
+{
+	Node *r;
+
+	r = nod(OADDR, n, N);
+	r = conv(r, types[TUNSAFEPTR]);
+	r = conv(r, types[TUINTPTR]);
+	return r;
+}
+
+// basenod returns the variable or indirection
+// whose memory holds n.
+static Node*
+basenod(Node *n)
+{
+	for(;;) {
+		if(n->op == ODOT || n->op == OCONVNOP || n->op == OCONV || n->op == OPAREN) {
+			n = n->left;
+			continue;
+		}
+		if(n->op == OINDEX && isfixedarray(n->left->type)) {
+			n = n->left;
+			continue;
+		}
+		break;
+	}
+	return n;
+}
+
+// isartificial reports whether n is a compiler-generated
+// variable that cannot take part in a race.
+static int
+isartificial(Node *n)
+{
+	if(n->op == ONAME && n->sym != S && n->sym->name != nil) {
+		if(strcmp(n->sym->name, "_") == 0)
+			return 1;
+		// autotmp's are always local
+		if(strncmp(n->sym->name, "autotmp_", sizeof("autotmp_")-1) == 0)
+			return 1;
+		// statictmp's are read-only
+		if(strncmp(n->sym->name, "statictmp_", sizeof("statictmp_")-1) == 0)
+			return 1;
+	}
+	return 0;
+}
@@ -23,7 +23,7 @@ import (
 )
 
 var cmdBuild = &Command{
-	UsageLine: "build [-a] [-n] [-o output] [-p n] [-v] [-x] [-work] [importpath... | gofiles...]",
+	UsageLine: "build [-a] [-n] [-o output] [-p n] [-race] [-v] [-x] [-work] [importpath... | gofiles...]",
 	Short:     "compile packages and dependencies",
 	Long: `
 Build compiles the packages named by the import paths,
@@ -48,6 +48,17 @@ It is an error to use -o when the command line specifies multiple packages.
 The -p flag specifies the number of builds that can be run in parallel.
 The default is the number of CPUs available.
 
+The -race flag enables data race detection.  It is supported only
+on linux/amd64, darwin/amd64 and windows/amd64, and needs cgo.
+Packages built with -race are installed in a separate directory,
+$GOPATH/pkg/$GOOS_$GOARCH_race.
+
+To build for another operating system or architecture, set $GOOS and
+$GOARCH.  The first build for a new target builds its compilers, linker
+and standard library using 'go tool dist' and installs them in $GOROOT
+for later builds.  Cgo is disabled when cross-compiling unless
+CGO_ENABLED=1 is set.
+
 The -work flag causes build to print the name of the temporary work
 directory and not delete it when exiting.
 
@@ -74,6 +85,7 @@ var buildV bool               // -v flag
 var buildX bool               // -x flag
 var buildO = cmdBuild.Flag.String("o", "", "output file")
 var buildWork bool // -work flag
+var buildRace bool // -race flag
 
 var buildContext = build.DefaultContext
 
@@ -85,6 +97,7 @@ func addBuildFlags(cmd *Command) {
 	cmd.Flag.BoolVar(&buildV, "v", false, "")
 	cmd.Flag.BoolVar(&buildX, "x", false, "")
 	cmd.Flag.BoolVar(&buildWork, "work", false, "")
+	cmd.Flag.BoolVar(&buildRace, "race", false, "")
 
 	// TODO(rsc): This -t flag is used by buildscript.sh but
 	// not documented.  Should be documented but the
@@ -106,7 +119,38 @@ func (v *stringsFlag) String() string {
 	return "<stringsFlag>"
 }
 
+// raceInit checks that race detection is possible on the
+// target and, if -race is set, arranges for it.
+func raceInit() {
+	if !buildRace {
+		return
+	}
+	goos, goarch := buildContext.GOOS, buildContext.GOARCH
+	if goarch != "amd64" || goos != "linux" && goos != "darwin" && goos != "windows" {
+		fatalf("go %s: -race is only supported on linux/amd64, darwin/amd64 and windows/amd64", os.Args[1])
+	}
+	if !buildContext.CgoEnabled {
+		fatalf("go %s: -race requires cgo; enable cgo by setting CGO_ENABLED=1", os.Args[1])
+	}
+	syso := filepath.Join(goroot, "src/pkg/runtime/race", "race_"+goos+"_"+goarch+".syso")
+	if _, err := os.Stat(syso); err != nil {
+		fatalf("go %s: -race requires the race detector runtime %s; see $GOROOT/src/pkg/runtime/race/README", os.Args[1], syso)
+	}
+	buildContext.BuildTags = append(buildContext.BuildTags, "race")
+}
+
+// pkgDir returns the directory of tree t holding installed packages.
+// Packages built with -race are kept apart from the others.
+func pkgDir(t *build.Tree) string {
+	if buildRace {
+		return t.PkgDir() + "_race"
+	}
+	return t.PkgDir()
+}
+
 func runBuild(cmd *Command, args []string) {
+	raceInit()
+	crossInit()
 	var b builder
 	b.init()
 
@@ -145,7 +189,7 @@ func runBuild(cmd *Command, args []string) {
 }
 
 var cmdInstall = &Command{
-	UsageLine: "install [-a] [-n] [-p n] [-v] [-x] [-work] [importpath...]",
+	UsageLine: "install [-a] [-n] [-p n] [-race] [-v] [-x] [-work] [importpath...]",
 	Short:     "compile and install packages and dependencies",
 	Long: `
 Install compiles and installs the packages named by the import paths,
@@ -159,6 +203,8 @@ The -x flag prints the commands.
 The -p flag specifies the number of builds that can be run in parallel.
 The default is the number of CPUs available.
 
+The -race flag enables data race detection, as in 'go build'.
+
 The -work flag causes build to print the name of the temporary work
 directory and not delete it when exiting.
 
@@ -169,6 +215,8 @@ See also: go build, go get, go clean.
 }
 
 func runInstall(cmd *Command, args []string) {
+	raceInit()
+	crossInit()
 	pkgs := packagesForBuild(args)
 
 	var b builder
@@ -210,6 +258,7 @@ type action struct {
 	cgo        *action       // action for cgo binary if needed
 	args       []string      // additional args for runProgram
 	testOutput *bytes.Buffer // test output buffer
+	buildID    string        // hash of the inputs to the action, see buildID
 
 	f          func(*builder, *action) error // the action itself (nil = no-op)
 	ignoreFail bool                          // whether to run f even if dependencies fail
@@ -346,7 +395,7 @@ func (b *builder) action(mode buildMode, depMode buildMode, p *Package) *action
 		return a
 	}
 
-	a = &action{p: p, pkgdir: p.t.PkgDir()}
+	a = &action{p: p, pkgdir: pkgDir(p.t), buildID: buildID(p)}
 	if p.pkgdir != "" { // overrides p.t
 		a.pkgdir = p.pkgdir
 	}
@@ -361,8 +410,10 @@ func (b *builder) action(mode buildMode, depMode buildMode, p *Package) *action
 	// generate for cgo as a dependency of the build of any package
 	// using cgo, to make sure we do not overwrite the binary while
 	// a package is using it.  If this is a cross-build, then the cgo we
-	// are writing is not the cgo we need to use.
-	if b.goos == runtime.GOOS && b.goarch == runtime.GOARCH {
+	// are writing is not the cgo we need to use.  Nor is it in race
+	// mode, where building cmd/cgo would depend on runtime/race,
+	// which uses cgo itself.
+	if b.goos == runtime.GOOS && b.goarch == runtime.GOARCH && !buildRace {
 		if len(p.CgoFiles) > 0 || p.Standard && p.ImportPath == "runtime/cgo" {
 			var stk importStack
 			p1 := loadPackage("cmd/cgo", &stk)
@@ -399,6 +450,13 @@ func (b *builder) action(mode buildMode, depMode buildMode, p *Package) *action
 	a.objpkg = buildToolchain.pkgpath(b.work, a.p)
 	a.link = p.Name == "main"
 
+	// Importers of a vendored package look first in the
+	// directory it installs to; when it is only being built,
+	// they must find the new archive in the work directory.
+	if p.Vendored && mode == modeBuild {
+		a.pkgdir = b.work
+	}
+
 	switch mode {
 	case modeInstall:
 		a.f = (*builder).install
@@ -553,11 +611,46 @@ func (b *builder) build(a *action) error {
 		return err
 	}
 
+	// Reuse the output of an earlier build with the same inputs.
+	// The packages go test synthesizes are left out: the test main
+	// package is built in the work directory, whose name is part of
+	// its ID and differs from run to run, so their entries would
+	// never be reused.
+	c := cache()
+	if a.p.fake {
+		c = nil
+	}
+	if c != nil && !buildA && !buildN {
+		if file, _, ok := c.get(a.buildID); ok {
+			perm := os.FileMode(0666)
+			if a.link {
+				perm = 0777
+			}
+			return b.copyFile(a.target, file, perm)
+		}
+	}
+
 	var gofiles, cfiles, sfiles, objects, cgoObjects []string
 	gofiles = append(gofiles, a.p.GoFiles...)
 	cfiles = append(cfiles, a.p.CFiles...)
 	sfiles = append(sfiles, a.p.SFiles...)
 
+	// If we're doing coverage, annotate the Go files and compile
+	// the copies in the build directory instead.
+	if a.p.coverMode != "" {
+		for i, file := range gofiles {
+			cover := a.p.coverVars[file]
+			if cover == nil {
+				continue // Not a file to annotate, such as a test file.
+			}
+			coverFile := obj + file
+			if err := b.cover(a, coverFile, file, cover.Var); err != nil {
+				return err
+			}
+			gofiles[i] = coverFile
+		}
+	}
+
 	// Run cgo.
 	if len(a.p.CgoFiles) > 0 {
 		// In a package using cgo, cgo compiles the C and assembly files with gcc.  
@@ -657,6 +750,11 @@ func (b *builder) build(a *action) error {
 	// http://golang.org/issue/2601
 	objects = append(objects, cgoObjects...)
 
+	// Add system object files.
+	for _, syso := range a.p.SysoFiles {
+		objects = append(objects, filepath.Join(a.p.Dir, syso))
+	}
+
 	// Pack into archive in obj directory
 	if err := buildToolchain.pack(b, a.p, obj, a.objpkg, objects); err != nil {
 		return err
@@ -673,9 +771,26 @@ func (b *builder) build(a *action) error {
 		}
 	}
 
+	// Save the output for later builds.  The cache is only an
+	// optimization, so failing to write it is not an error.
+	if c != nil && !buildN {
+		c.put(a.buildID, a.target)
+	}
+
 	return nil
 }
 
+// cover runs, in effect,
+//	go tool cover -mode=a.p.coverMode -var=varName -o dst.go src.go
+func (b *builder) cover(a *action, dst, src, varName string) error {
+	return b.run(a.objdir, "cover "+a.p.ImportPath,
+		tool("cover"),
+		"-mode", a.p.coverMode,
+		"-var", varName,
+		"-o", dst,
+		filepath.Join(a.p.Dir, src))
+}
+
 // install is the action for installing a single package or executable.
 func (b *builder) install(a *action) error {
 	a1 := a.deps[0]
@@ -709,16 +824,16 @@ func (b *builder) install(a *action) error {
 func (b *builder) includeArgs(flag string, all []*action) []string {
 	inc := []string{}
 	incMap := map[string]bool{
-		b.work:                 true, // handled later
-		build.Path[0].PkgDir(): true, // goroot
-		"":                     true, // ignore empty strings
+		b.work:                true, // handled later
+		pkgDir(build.Path[0]): true, // goroot
+		"":                    true, // ignore empty strings
 	}
 
 	// Look in the temporary space for results of test-specific actions.
 	// This is the $WORK/my/package/_test directory for the
 	// package being built, so there are few of these.
 	for _, a1 := range all {
-		if dir := a1.pkgdir; dir != a1.p.t.PkgDir() && !incMap[dir] {
+		if dir := a1.pkgdir; dir != pkgDir(a1.p.t) && !incMap[dir] {
 			incMap[dir] = true
 			inc = append(inc, flag, dir)
 		}
@@ -730,7 +845,7 @@ func (b *builder) includeArgs(flag string, all []*action) []string {
 
 	// Finally, look in the installed package directories for each action.
 	for _, a1 := range all {
-		if dir := a1.pkgdir; dir == a1.p.t.PkgDir() && !incMap[dir] {
+		if dir := a1.pkgdir; dir == pkgDir(a1.p.t) && !incMap[dir] {
 			if _, ok := buildToolchain.(gccgoToolchain); ok {
 				dir = filepath.Join(filepath.Dir(dir), "gccgo", filepath.Base(dir))
 			}
@@ -1048,6 +1163,9 @@ func (goToolchain) gc(b *builder, p *Package, obj string, importArgs []string, g
 		// additional reflect type data.
 		gcargs = append(gcargs, "-+")
 	}
+	if buildRace {
+		gcargs = append(gcargs, "-b")
+	}
 
 	args := stringList(tool(b.arch+"g"), "-o", ofile, b.gcflags, gcargs, importArgs)
 	for _, f := range gofiles {
@@ -1075,15 +1193,23 @@ func (goToolchain) pack(b *builder, p *Package, objDir, afile string, ofiles []s
 
 func (goToolchain) ld(b *builder, p *Package, out string, allactions []*action, mainpkg string, ofiles []string) error {
 	importArgs := b.includeArgs("-L", allactions)
-	return b.run(p.Dir, p.ImportPath, tool(b.arch+"l"), "-o", out, importArgs, mainpkg)
+	ldargs := []string{}
+	if buildRace {
+		ldargs = append(ldargs, "-b")
+	}
+	return b.run(p.Dir, p.ImportPath, tool(b.arch+"l"), "-o", out, importArgs, ldargs, mainpkg)
 }
 
 func (goToolchain) cc(b *builder, p *Package, objdir, ofile, cfile string) error {
 	inc := filepath.Join(goroot, "pkg", fmt.Sprintf("%s_%s", b.goos, b.goarch))
 	cfile = mkAbs(p.Dir, cfile)
-	return b.run(p.Dir, p.ImportPath, tool(b.arch+"c"), "-FVw",
+	args := stringList(tool(b.arch+"c"), "-FVw",
 		"-I", objdir, "-I", inc, "-o", ofile,
-		"-DGOOS_"+b.goos, "-DGOARCH_"+b.goarch, cfile)
+		"-DGOOS_"+b.goos, "-DGOARCH_"+b.goarch)
+	if buildRace {
+		args = append(args, "-DRACE")
+	}
+	return b.run(p.Dir, p.ImportPath, args, cfile)
 }
 
 // The Gccgo toolchain.
@@ -1246,6 +1372,11 @@ func (b *builder) cgo(p *Package, cgoExe, obj string, gccfiles []string) (outGo,
 	if p.Standard && p.ImportPath == "runtime/cgo" {
 		cgoflags = append(cgoflags, "-import_runtime_cgo=false")
 	}
+	// runtime/race is imported by syscall in race mode,
+	// so neither it nor runtime/cgo can import syscall.
+	if p.Standard && (p.ImportPath == "runtime/race" || p.ImportPath == "runtime/cgo") {
+		cgoflags = append(cgoflags, "-import_syscall=false")
+	}
 	if _, ok := buildToolchain.(gccgoToolchain); ok {
 		cgoflags = append(cgoflags, "-gccgo")
 	}
@@ -0,0 +1,418 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var helpCache = &Command{
+	UsageLine: "cache",
+	Short:     "build caching",
+	Long: `
+The go command caches build outputs for reuse in future builds.
+The default location for cache data is a subdirectory named go-build
+in the standard user cache directory for the current operating system:
+$XDG_CACHE_HOME or $HOME/.cache on Unix systems, $HOME/Library/Caches
+on OS X, and %LocalAppData% on Windows.  Setting the GOCACHE
+environment variable overrides this default, and setting GOCACHE=off
+disables the cache.
+
+An output is filed in the cache under a hash of everything that went
+into making it: the contents of the source files, the compiler flags
+and build tags, the toolchain, and the hashes of the packages it
+imports.  A package is therefore up-to-date exactly when its installed
+archive or binary is the output the cache holds for its current inputs,
+whatever the modification times of the files involved, and switching
+between branches or GOPATH entries rebuilds only what really changed.
+When the cache is disabled, or holds no output for a package's current
+inputs, as for the standard library installed by make.bash, the go
+command falls back on comparing modification times.  Test binaries,
+and packages recompiled with their tests, are not cached.
+
+The go command periodically deletes cached data that has not been
+used recently.  Running 'go clean -cache' deletes all cached data.
+	`,
+}
+
+// The cache directory holds two kinds of entries, spread over 256
+// subdirectories named by the first byte of their hash:
+//
+//	xx/ID-a    the hash of the output of the action with the given ID
+//	xx/HASH-d  the output with the given hash
+//
+// Outputs are stored by content, so actions producing identical
+// results share an entry.  The modification times of the entries
+// record when they were last used.
+type buildCache struct {
+	dir string
+}
+
+const (
+	cacheVersion   = "go build cache v1"
+	cacheTrimFile  = "trim.txt"
+	cacheTrimEvery = 24 * time.Hour     // how often to look for unused entries
+	cacheTrimAge   = 5 * 24 * time.Hour // how long an entry may go unused
+	cacheUseEvery  = time.Hour          // granularity of recorded use times
+)
+
+var (
+	theCache     *buildCache
+	theCacheOnce sync.Once
+)
+
+// cache returns the build cache, or nil if caching is disabled
+// or the cache directory cannot be used.
+func cache() *buildCache {
+	theCacheOnce.Do(func() {
+		dir := cacheDir()
+		if dir == "" {
+			return
+		}
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			fmt.Fprintf(os.Stderr, "go: disabling build cache: %v\n", err)
+			return
+		}
+		theCache = &buildCache{dir}
+		theCache.trim()
+	})
+	return theCache
+}
+
+// cacheDir returns the directory of the build cache,
+// or the empty string if caching is disabled.
+func cacheDir() string {
+	dir := os.Getenv("GOCACHE")
+	if dir == "off" {
+		return ""
+	}
+	if dir != "" {
+		return dir
+	}
+	switch runtime.GOOS {
+	case "windows":
+		dir = os.Getenv("LocalAppData")
+	case "darwin":
+		if home := os.Getenv("HOME"); home != "" {
+			dir = filepath.Join(home, "Library", "Caches")
+		}
+	case "plan9":
+		if home := os.Getenv("home"); home != "" {
+			dir = filepath.Join(home, "lib", "cache")
+		}
+	default:
+		dir = os.Getenv("XDG_CACHE_HOME")
+		if dir == "" {
+			if home := os.Getenv("HOME"); home != "" {
+				dir = filepath.Join(home, ".cache")
+			}
+		}
+	}
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "go-build")
+}
+
+// file returns the name of the entry with the given hash and suffix.
+func (c *buildCache) file(hash, suffix string) string {
+	return filepath.Join(c.dir, hash[:2], hash+"-"+suffix)
+}
+
+// get returns the name of the cached output of the action with
+// the given ID and the hash of that output.
+func (c *buildCache) get(id string) (file, hash string, ok bool) {
+	data, err := ioutil.ReadFile(c.file(id, "a"))
+	if err != nil {
+		return "", "", false
+	}
+	hash = strings.TrimSpace(string(data))
+	if len(hash) != 2*sha1.Size {
+		return "", "", false
+	}
+	file = c.file(hash, "d")
+	if _, err := os.Stat(file); err != nil {
+		return "", "", false
+	}
+	c.used(c.file(id, "a"))
+	c.used(file)
+	return file, hash, true
+}
+
+// put records file as the output of the action with the given ID.
+func (c *buildCache) put(id, file string) error {
+	hash, err := hashContents(file)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(c.dir, hash[:2])
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	if data := c.file(hash, "d"); !exists(data) {
+		if err := c.copy(data, file); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(c.dir, id[:2]), 0777); err != nil {
+		return err
+	}
+	return c.write(c.file(id, "a"), strings.NewReader(hash+"\n"))
+}
+
+// upToDate reports whether the cache holds an output for the
+// action with the given ID and, if so, whether file is that output.
+func (c *buildCache) upToDate(id, file string) (ok, cached bool) {
+	_, hash, cached := c.get(id)
+	if !cached {
+		return false, false
+	}
+	h, err := hashContents(file)
+	return err == nil && h == hash, true
+}
+
+// copy copies src into the cache as the entry dst.
+func (c *buildCache) copy(dst, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.write(dst, f)
+}
+
+// write writes the data from r to the entry named by file.
+// Concurrent go commands may share the cache, so the data is
+// written to a temporary file that is then renamed into place:
+// an entry is either complete or absent.
+func (c *buildCache) write(file string, r io.Reader) error {
+	f, err := ioutil.TempFile(filepath.Dir(file), "tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), file)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// used records that the entry named by file was just used.
+// To save work, the time is updated only once per cacheUseEvery.
+func (c *buildCache) used(file string) {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	if now.Sub(fi.ModTime()) < cacheUseEvery {
+		return
+	}
+	os.Chtimes(file, now, now)
+}
+
+// trim removes the entries that have not been used for cacheTrimAge.
+// The time of the last trim is kept in the modification time of
+// the file trim.txt, so that the work is done at most once per
+// cacheTrimEvery.
+func (c *buildCache) trim() {
+	now := time.Now()
+	marker := filepath.Join(c.dir, cacheTrimFile)
+	if fi, err := os.Stat(marker); err == nil && now.Sub(fi.ModTime()) < cacheTrimEvery {
+		return
+	}
+	cutoff := now.Add(-cacheTrimAge)
+	for i := 0; i < 256; i++ {
+		dir := filepath.Join(c.dir, fmt.Sprintf("%02x", i))
+		fis, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, fi := range fis {
+			if fi.ModTime().Before(cutoff) {
+				os.Remove(filepath.Join(dir, fi.Name()))
+			}
+		}
+	}
+	ioutil.WriteFile(marker, []byte(cacheVersion+"\n"), 0666)
+}
+
+// clean removes all the entries in the cache.
+func (c *buildCache) clean() error {
+	fis, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		if name := fi.Name(); fi.IsDir() && len(name) == 2 || name == cacheTrimFile {
+			if err := os.RemoveAll(filepath.Join(c.dir, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func exists(file string) bool {
+	_, err := os.Stat(file)
+	return err == nil
+}
+
+var (
+	fileHashMu    sync.Mutex
+	fileHashCache = map[string]string{}
+)
+
+// hashFile returns the SHA-1 hash of the contents of the named
+// source file.  Source files do not change during a run of the go
+// command, so each is hashed at most once.
+func hashFile(file string) (string, error) {
+	fileHashMu.Lock()
+	hash, ok := fileHashCache[file]
+	fileHashMu.Unlock()
+	if ok {
+		return hash, nil
+	}
+	hash, err := hashContents(file)
+	if err != nil {
+		return "", err
+	}
+	fileHashMu.Lock()
+	fileHashCache[file] = hash
+	fileHashMu.Unlock()
+	return hash, nil
+}
+
+// hashContents returns the SHA-1 hash of the contents of the named file.
+func hashContents(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha1.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// buildIDs records the computed build IDs.  The test command copies
+// packages to make variants of them, so the IDs are kept here, by
+// package, rather than in a field that the copy would inherit.
+var buildIDs = map[*Package]string{}
+
+// buildID returns the build ID of p: a hash of all the inputs to
+// building p, including the build IDs of the packages it imports.
+// Two builds of packages with the same ID produce the same output.
+// buildID is called only from the main goroutine, while loading
+// packages and planning actions.
+func buildID(p *Package) string {
+	if id, ok := buildIDs[p]; ok {
+		if id == "" {
+			// An import cycle, which has been reported
+			// elsewhere; any ID that is never reused will do.
+			return fmt.Sprintf("cycle %p", p)
+		}
+		return id
+	}
+	buildIDs[p] = "" // in progress
+
+	h := sha1.New()
+	fmt.Fprintf(h, "%s\n", cacheVersion)
+	fmt.Fprintf(h, "toolchain %s\n", toolchainID())
+	fmt.Fprintf(h, "goos %s goarch %s\n", buildContext.GOOS, buildContext.GOARCH)
+	fmt.Fprintf(h, "tags %q\n", buildContext.BuildTags)
+	fmt.Fprintf(h, "gcflags %q\n", envList("GCFLAGS"))
+	if buildRace {
+		fmt.Fprintf(h, "race\n")
+	}
+	fmt.Fprintf(h, "package %q %q %q\n", p.ImportPath, p.Name, p.Dir)
+	if len(p.CgoFiles) > 0 {
+		fmt.Fprintf(h, "cgo %q %q\n", p.CgoCFLAGS, p.CgoLDFLAGS)
+		for _, key := range []string{"CC", "CGO_CFLAGS", "CGO_LDFLAGS"} {
+			fmt.Fprintf(h, "env %s=%q\n", key, os.Getenv(key))
+		}
+	}
+	if p.coverMode != "" {
+		fmt.Fprintf(h, "cover %s\n", p.coverMode)
+		var files []string
+		for file := range p.coverVars {
+			files = append(files, file)
+		}
+		sort.Strings(files)
+		for _, file := range files {
+			fmt.Fprintf(h, "cover %s %s\n", file, p.coverVars[file].Var)
+		}
+	}
+	for _, files := range [][]string{p.GoFiles, p.CgoFiles, p.CFiles, p.HFiles, p.SFiles, p.SysoFiles} {
+		for _, file := range files {
+			hash, err := hashFile(mkAbs(p.Dir, file))
+			if err != nil {
+				// The build will report the error.
+				hash = "error"
+			}
+			fmt.Fprintf(h, "file %s %s\n", file, hash)
+		}
+	}
+	for _, p1 := range p.imports {
+		fmt.Fprintf(h, "import %s %s\n", p1.ImportPath, buildID(p1))
+	}
+
+	id := fmt.Sprintf("%x", h.Sum(nil))
+	buildIDs[p] = id
+	return id
+}
+
+var (
+	toolchainIDOnce  sync.Once
+	toolchainIDValue string
+)
+
+// toolchainID returns a string identifying the toolchain that
+// compiles and links packages.  The tools are identified by the size
+// and modification time of their binaries, which change whenever
+// the toolchain is rebuilt.
+func toolchainID() string {
+	toolchainIDOnce.Do(func() {
+		id := fmt.Sprintf("%T %s", buildToolchain, runtime.Version())
+		var tools []string
+		if _, ok := buildToolchain.(gccgoToolchain); ok {
+			if gccgo, err := exec.LookPath("gccgo"); err == nil {
+				tools = append(tools, gccgo)
+			}
+		} else if arch, err := build.ArchChar(buildContext.GOARCH); err == nil {
+			for _, name := range []string{arch + "g", arch + "c", arch + "a", arch + "l", "pack"} {
+				tools = append(tools, tool(name))
+			}
+		}
+		tools = append(tools, tool("cgo"), tool("cover"))
+		for _, file := range tools {
+			if fi, err := os.Stat(file); err == nil {
+				id += fmt.Sprintf(" %s:%d:%d", filepath.Base(file), fi.Size(), fi.ModTime().UnixNano())
+			}
+		}
+		toolchainIDValue = id
+	})
+	return toolchainIDValue
+}
@@ -0,0 +1,45 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCacheUpToDate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := &buildCache{filepath.Join(dir, "cache")}
+	target := filepath.Join(dir, "x.a")
+	if err := ioutil.WriteFile(target, []byte("archive"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	const id = "0123456789abcdef0123456789abcdef01234567"
+
+	// A target built without the cache has no entry to be judged by.
+	if ok, cached := c.upToDate(id, target); ok || cached {
+		t.Errorf("before put: upToDate = %v, %v, want false, false", ok, cached)
+	}
+
+	if err := c.put(id, target); err != nil {
+		t.Fatal(err)
+	}
+	if ok, cached := c.upToDate(id, target); !ok || !cached {
+		t.Errorf("after put: upToDate = %v, %v, want true, true", ok, cached)
+	}
+
+	if err := ioutil.WriteFile(target, []byte("other archive"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if ok, cached := c.upToDate(id, target); ok || !cached {
+		t.Errorf("after rewrite: upToDate = %v, %v, want false, true", ok, cached)
+	}
+}
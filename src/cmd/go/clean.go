@@ -13,7 +13,7 @@ import (
 )
 
 var cmdClean = &Command{
-	UsageLine: "clean [-i] [-r] [-n] [-x] [importpath...]",
+	UsageLine: "clean [-i] [-r] [-n] [-x] [-cache] [importpath...]",
 	Short:     "remove object files",
 	Long: `
 Clean removes object files from package source directories.
@@ -50,18 +50,23 @@ The -r flag causes clean to be applied recursively to all the
 dependencies of the packages named by the import paths.
 
 The -x flag causes clean to print remove commands as it executes them.
+
+The -cache flag causes clean to remove the entire build cache.
+Without import paths, it cleans nothing else.  See 'go help cache'.
 	`,
 }
 
-var cleanI bool // clean -i flag
-var cleanN bool // clean -n flag
-var cleanR bool // clean -r flag
-var cleanX bool // clean -x flag
+var cleanCache bool // clean -cache flag
+var cleanI bool     // clean -i flag
+var cleanN bool     // clean -n flag
+var cleanR bool     // clean -r flag
+var cleanX bool     // clean -x flag
 
 func init() {
 	// break init cycle
 	cmdClean.Run = runClean
 
+	cmdClean.Flag.BoolVar(&cleanCache, "cache", false, "")
 	cmdClean.Flag.BoolVar(&cleanI, "i", false, "")
 	cmdClean.Flag.BoolVar(&cleanN, "n", false, "")
 	cmdClean.Flag.BoolVar(&cleanR, "r", false, "")
@@ -69,6 +74,23 @@ func init() {
 }
 
 func runClean(cmd *Command, args []string) {
+	if cleanCache {
+		if dir := cacheDir(); dir != "" {
+			if cleanN || cleanX {
+				var b builder
+				b.print = fmt.Print
+				b.showcmd("", "rm -r %s", filepath.Join(dir, "*"))
+			}
+			if !cleanN {
+				if err := (&buildCache{dir}).clean(); err != nil && !os.IsNotExist(err) {
+					errorf("go clean -cache: %v", err)
+				}
+			}
+		}
+		if len(args) == 0 {
+			return
+		}
+	}
 	for _, pkg := range packagesAndErrors(args) {
 		clean(pkg)
 	}
@@ -0,0 +1,98 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"go/build"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// crossInit makes sure that, when cross-compiling, the compilers and
+// linker for the target architecture and the target's standard library
+// are installed, building them the first time they are needed.  It does
+// the work of running make.bash for the target: the tools and the
+// runtime are built by cmd/dist, and the rest of the standard library
+// by the go command itself, all kept in $GOROOT for later builds.
+func crossInit() {
+	goos, goarch := buildContext.GOOS, buildContext.GOARCH
+	if goos == toolGOOS && goarch == toolGOARCH {
+		return
+	}
+	if _, ok := buildToolchain.(gccgoToolchain); ok {
+		return
+	}
+	// Cgo would need a C compiler for the target.
+	if os.Getenv("CGO_ENABLED") != "1" {
+		buildContext.CgoEnabled = false
+	}
+	archChar, err := build.ArchChar(goarch)
+	if err != nil {
+		fatalf("go %s: %v", os.Args[1], err)
+	}
+
+	// The tools run on this machine, so they are built for it.
+	// The linker must come first; the others use its enam.c.
+	var missing []string
+	for _, name := range []string{"l", "a", "c", "g"} {
+		if _, err := os.Stat(tool(archChar + name)); err != nil {
+			missing = append(missing, "cmd/"+archChar+name)
+		}
+	}
+	if len(missing) > 0 {
+		runDist(toolGOOS, toolGOARCH, stringList("install", missing)...)
+	}
+
+	// The runtime needs files generated by cmd/dist.
+	// Once it is there, install the rest of the library.
+	if _, err := os.Stat(filepath.Join(build.Path[0].PkgDir(), "runtime.a")); err == nil {
+		return
+	}
+	runDist(goos, goarch, "install", "pkg/runtime")
+
+	var b builder
+	b.init()
+	a := &action{}
+	for _, name := range allPackages("std") {
+		// Commands are not needed to build for the target.
+		if strings.HasPrefix(name, "cmd/") {
+			continue
+		}
+		var stk importStack
+		p := loadPackage(name, &stk)
+		if p.Error != nil {
+			fatalf("go %s: %s", os.Args[1], p.Error)
+		}
+		a.deps = append(a.deps, b.action(modeInstall, modeInstall, p))
+	}
+	b.do(a)
+	exitIfErrors()
+
+	// Forget the standard library's stale state,
+	// so that the build proper loads it afresh.
+	packageCache = map[string]*Package{}
+}
+
+// runDist runs go tool dist with the given arguments,
+// building for the given operating system and architecture.
+func runDist(goos, goarch string, args ...string) {
+	cmdline := stringList(tool("dist"), args)
+	if buildN || buildX {
+		fmt.Fprintf(os.Stderr, "GOOS=%s GOARCH=%s %s\n", goos, goarch, strings.Join(cmdline, " "))
+		if buildN {
+			return
+		}
+	}
+	cmd := exec.Command(cmdline[0], cmdline[1:]...)
+	cmd.Env = mergeEnv(os.Environ(), []string{"GOOS=" + goos, "GOARCH=" + goarch})
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fatalf("go %s: building the %s/%s toolchain: %v", os.Args[1], goos, goarch, err)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// crossTree lays out a GOROOT whose standard library is two packages.
+var crossTree = map[string]string{
+	"src/pkg/runtime/runtime.go": "package runtime\n",
+	"src/pkg/errors/errors.go":   "package errors\n",
+}
+
+// makeTree writes the files of tree, keyed by slash-separated name,
+// into a new temporary directory and returns the directory.
+func makeTree(t *testing.T, tree map[string]string) string {
+	dir, err := ioutil.TempDir("", "gotree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range tree {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// captureOutput returns what f writes to standard output and
+// standard error.
+func captureOutput(t *testing.T, f func()) (stdout, stderr string) {
+	var files [2]*os.File
+	for i := range files {
+		file, err := ioutil.TempFile("", "gooutput")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(file.Name())
+		defer file.Close()
+		files[i] = file
+	}
+	func() {
+		defer func(stdout, stderr *os.File) { os.Stdout, os.Stderr = stdout, stderr }(os.Stdout, os.Stderr)
+		os.Stdout, os.Stderr = files[0], files[1]
+		f()
+	}()
+	var out [2]string
+	for i, file := range files {
+		data, err := ioutil.ReadFile(file.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		out[i] = string(data)
+	}
+	return out[0], out[1]
+}
+
+func TestCrossInitN(t *testing.T) {
+	goroot := makeTree(t, crossTree)
+	defer os.RemoveAll(goroot)
+
+	// Build for a target that is not this machine,
+	// with none of its tools or packages installed.
+	goos, goarch, arch := "linux", "386", "8"
+	if toolGOOS == goos {
+		goos = "freebsd"
+	}
+	if toolGOARCH == goarch {
+		goarch, arch = "amd64", "6"
+	}
+	defer func(path []*build.Tree) { build.Path = path }(build.Path)
+	build.Path = []*build.Tree{{Path: goroot, Goroot: true}}
+	defer func(dir string) { toolDir = dir }(toolDir)
+	toolDir = filepath.Join(goroot, "pkg", "tool")
+	defer func(ctxt build.Context) { buildContext = ctxt }(buildContext)
+	buildContext.GOOS, buildContext.GOARCH = goos, goarch
+	for _, kv := range [][2]string{{"GOOS", goos}, {"GOARCH", goarch}, {"CGO_ENABLED", ""}} {
+		defer os.Setenv(kv[0], os.Getenv(kv[0]))
+		os.Setenv(kv[0], kv[1])
+	}
+	defer func(n bool) { buildN = n }(buildN)
+	buildN = true
+	defer func(cache map[string]*Package) { packageCache = cache }(packageCache)
+	packageCache = map[string]*Package{}
+
+	stdout, stderr := captureOutput(t, crossInit)
+
+	dist := filepath.Join(toolDir, "dist")
+	want := "GOOS=" + toolGOOS + " GOARCH=" + toolGOARCH + " " + dist + " install cmd/" + arch + "l cmd/" + arch + "a cmd/" + arch + "c cmd/" + arch + "g\n" +
+		"GOOS=" + goos + " GOARCH=" + goarch + " " + dist + " install pkg/runtime\n"
+	if stderr != want {
+		t.Errorf("go build -n for %s/%s printed:\n%s\nwant:\n%s", goos, goarch, stderr, want)
+	}
+	// The rest of the library is installed by the go command itself.
+	if !strings.Contains(stdout, filepath.Join(goroot, "pkg", goos+"_"+goarch, "errors.a")) {
+		t.Errorf("go build -n for %s/%s does not install errors:\n%s", goos, goarch, stdout)
+	}
+	if buildContext.CgoEnabled {
+		t.Errorf("cgo enabled for a cross build without CGO_ENABLED=1")
+	}
+}
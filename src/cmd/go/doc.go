@@ -14,9 +14,11 @@ The commands are:
     doc         run godoc on package sources
     fix         run go tool fix on packages
     fmt         run gofmt on package sources
+    generate    generate Go files by processing source
     get         download and install packages and dependencies
     install     compile and install packages and dependencies
     list        list packages
+    pin         record the revisions of downloaded packages
     run         compile and run Go program
     test        test packages
     tool        run specified go tool
@@ -27,6 +29,7 @@ Use "go help [command]" for more information about a command.
 
 Additional help topics:
 
+    cache       build caching
     gopath      GOPATH environment variable
     importpath  description of import paths
     remote      remote import path syntax
@@ -40,7 +43,7 @@ Compile packages and dependencies
 
 Usage:
 
-	go build [-a] [-n] [-o output] [-p n] [-v] [-x] [importpath... | gofiles...]
+	go build [-a] [-n] [-o output] [-p n] [-race] [-v] [-x] [importpath... | gofiles...]
 
 Build compiles the packages named by the import paths,
 along with their dependencies, but it does not install the results.
@@ -64,6 +67,17 @@ It is an error to use -o when the command line specifies multiple packages.
 The -p flag specifies the number of builds that can be run in parallel.
 The default is the number of CPUs available.
 
+The -race flag enables data race detection.  It is supported only
+on linux/amd64, darwin/amd64 and windows/amd64, and needs cgo.
+Packages built with -race are installed in a separate directory,
+$GOPATH/pkg/$GOOS_$GOARCH_race.
+
+To build for another operating system or architecture, set $GOOS and
+$GOARCH.  The first build for a new target builds its compilers, linker
+and standard library using 'go tool dist' and installs them in $GOROOT
+for later builds.  Cgo is disabled when cross-compiling unless
+CGO_ENABLED=1 is set.
+
 For more about import paths, see 'go help importpath'.
 
 See also: go install, go get, go clean.
@@ -73,7 +87,7 @@ Remove object files
 
 Usage:
 
-	go clean [-i] [-r] [-n] [-x] [importpath...]
+	go clean [-i] [-r] [-n] [-x] [-cache] [importpath...]
 
 Clean removes object files from package source directories.
 The go command builds most objects in a temporary directory,
@@ -110,6 +124,9 @@ dependencies of the packages named by the import paths.
 
 The -x flag causes clean to print remove commands as it executes them.
 
+The -cache flag causes clean to remove the entire build cache.
+Without import paths, it cleans nothing else.  See 'go help cache'.
+
 
 Run godoc on package sources
 
@@ -161,17 +178,104 @@ To run gofmt with specific options, run gofmt itself.
 See also: go doc, go fix, go vet.
 
 
+Generate Go files by processing source
+
+Usage:
+
+	go generate [-run regexp] [-n] [-v] [-x] [importpath... | gofiles...]
+
+Generate runs commands described by directives within existing
+files.  Those commands can run any process but the intent is to
+create or update Go source files, for instance by running yacc.
+
+Go generate is never run automatically by go build, go get, go test,
+and so on.  It must be run explicitly.
+
+Go generate scans the package's Go files for directives, which
+are lines of the form
+
+	//go:generate command argument...
+
+(note: no leading spaces and no space in "//go") where command
+is the generator to be run, corresponding to an executable file
+that can be run locally.  It must either be in the shell path
+(gofmt), a fully qualified path (/usr/you/bin/mytool), or a
+command alias, described below.
+
+The arguments to the directive are space-separated tokens or
+double-quoted strings passed to the generator as individual
+arguments when it is run.  Quoted strings use Go syntax and are
+evaluated before execution; a quoted string appears as a single
+argument to the generator.
+
+Go generate sets several variables when it runs the generator:
+
+	$GOARCH
+		The execution architecture (arm, amd64, etc.)
+	$GOOS
+		The execution operating system (linux, windows, etc.)
+	$GOFILE
+		The base name of the file.
+	$GOLINE
+		The line number of the directive in the source file.
+	$GOPACKAGE
+		The name of the package of the file containing the directive.
+	$DOLLAR
+		A dollar sign.
+
+Other than variable substitution and quoted-string evaluation, no
+special processing such as "globbing" is performed on the command
+line.  As a last step before running the command, any invocations
+of any environment variables with alphanumeric names, such as
+$GOFILE or $HOME, are expanded throughout the command line.
+
+A directive of the form
+
+	//go:generate -command xxx args...
+
+specifies, for the remainder of this source file only, that the
+string xxx represents the command identified by the arguments.
+This can be used to create aliases or to handle multiword
+generators.  For example,
+
+	//go:generate -command yacc go tool yacc
+
+specifies that the command "yacc" represents the generator
+"go tool yacc".
+
+Generate processes packages in the order given on the command line,
+one at a time.  If the command line lists .go files, they are treated
+as a single package.  Within a package, generate processes the source
+files in file name order, one at a time.  Within a source file,
+generate runs generators in the order they appear in the file, one at
+a time.  The generators run in the directory of the source file.
+
+If any generator returns an error exit status, generate skips
+all further processing for that package.
+
+The -run flag specifies a regular expression to select directives
+whose full original source text (excluding any trailing spaces and
+final newline) matches the expression.
+
+The -n flag prints the commands that would be executed but does
+not run them.  The -v flag prints the names of packages and files
+as they are processed.  The -x flag prints the commands as they
+are executed.
+
+For more about import paths, see 'go help importpath'.
+
+
 Download and install packages and dependencies
 
 Usage:
 
-	go get [-a] [-d] [-fix] [-n] [-p n] [-u] [-v] [-x] [importpath...]
+	go get [-a] [-d] [-fix] [-n] [-p n] [-race] [-u] [-v] [-x] [importpath...]
 
 Get downloads and installs the packages named by the import paths,
 along with their dependencies.
 
-The -a, -n, -v, -x, and -p flags have the same meaning as in 'go build'
-and 'go install'.  See 'go help install'.
+The -a, -n, -race, -v, -x, and -p flags have the same meaning as in
+'go build' and 'go install'.  See 'go help install'.
 
 The -d flag instructs get to stop after downloading the packages; that is,
 it instructs get not to install the packages.
@@ -183,6 +287,10 @@ The -u flag instructs get to use the network to update the named packages
 and their dependencies.  By default, get uses the network to check out 
 missing packages but does not use it to look for updates to existing packages.
 
+If a pin file is present, get checks out the pinned revision of each
+repository instead, downloading updates as needed to find it.
+See 'go help pin'.
+
 TODO: Explain versions better.
 
 For more about import paths, see 'go help importpath'.
@@ -197,7 +305,7 @@ Compile and install packages and dependencies
 
 Usage:
 
-	go install [-a] [-n] [-p n] [-v] [-x] [importpath...]
+	go install [-a] [-n] [-p n] [-race] [-v] [-x] [importpath...]
 
 Install compiles and installs the packages named by the import paths,
 along with their dependencies.
@@ -210,6 +318,8 @@ The -x flag prints the commands.
 The -p flag specifies the number of builds that can be run in parallel.
 The default is the number of CPUs available.
 
+The -race flag enables data race detection, as in 'go build'.
+
 For more about import paths, see 'go help importpath'.
 
 See also: go build, go get, go clean.
@@ -219,7 +329,7 @@ List packages
 
 Usage:
 
-	go list [-e] [-f format] [-json] [importpath...]
+	go list [-e] [-f format] [-json] [-graph] [importpath...]
 
 List lists the packages named by the import paths, one per line.
 
@@ -235,12 +345,14 @@ is equivalent to -f '{{.ImportPath}}'.  The struct
 being passed to the template is:
 
     type Package struct {
-        Name       string // package name
-        Doc        string // package documentation string
-        ImportPath string // import path of package in dir
-        Dir        string // directory containing package sources
-        Version    string // version of installed package (TODO)
-        Stale      bool   // would 'go install' do anything for this package?
+        Name        string // package name
+        Doc         string // package documentation string
+        ImportPath  string // import path of package in dir
+        Dir         string // directory containing package sources
+        Version     string // version of installed package (TODO)
+        Stale       bool   // would 'go install' do anything for this package?
+        StaleReason string // why is Stale true?
+        Vendored    bool   // was the package found in a vendor directory?
 
         // Source files
         GoFiles      []string // .go source files (excluding CgoFiles, TestGoFiles, and XTestGoFiles)
@@ -250,10 +362,14 @@ being passed to the template is:
         HFiles       []string // .h source files
         SFiles       []string // .s source files
         CgoFiles     []string // .go sources files that import "C"
+        SysoFiles    []string // .syso object files to add to archive
 
         // Dependency information
-        Imports []string // import paths used by this package
-        Deps    []string // all (recursively) imported dependencies
+        Imports     []string          // import paths used by this package
+        ImportDirs  map[string]string // directory of each imported package, by import path
+        Deps        []string          // all (recursively) imported dependencies
+        TestImports []string          // import paths used by TestGoFiles and XTestGoFiles
+        TestDeps    []string          // Deps plus the dependencies of the tests
 
         // Error information
         Incomplete bool            // this package or a dependency has an error
@@ -261,9 +377,19 @@ being passed to the template is:
         DepsErrors []*PackageError // errors loading dependencies
     }
 
+StaleReason is a short explanation such as "newer source file x.go"
+or "stale dependency fmt".  ImportDirs records where each import was
+found, which for a vendored package is its vendor directory.
+
 The -json flag causes the package data to be printed in JSON format
 instead of using the template format.
 
+The -graph flag causes list to print the import graph of the named
+packages and all their dependencies instead, one edge per line:
+the import path of the importing package, a space, and the import
+path of the imported package.  The edges include the implicit
+imports, such as runtime, and are sorted.
+
 The -e flag changes the handling of erroneous packages, those that
 cannot be found or are malformed.  By default, the list command
 prints an error to standard error for each erroneous package and
@@ -277,16 +403,57 @@ a non-nil Error field; other information may or may not be missing
 For more about import paths, see 'go help importpath'.
 
 
+Record the revisions of downloaded packages
+
+Usage:
+
+	go pin [-u] [-verify] [importpath...]
+
+Pin records, in the pin file, the revision checked out in each
+repository holding the packages named by the import paths or their
+dependencies.  Packages in the standard library are never pinned.
+
+The pin file is the file named go.pin in the current directory or the
+nearest parent directory that has one.  If there is none, pin creates
+it in the current directory.  Each line of the file pins one repository:
+
+	code.google.com/p/go.net hg 7b1cb8fa3ed4a5b1b3b2d0d7bb3a5e1b7a5c8d6e
+	example.com/lib git 3f9c2a... file:///home/user/mirror/lib
+
+The fields are the import path of the root of the repository, the
+version control system, the revision, and, optionally, the repository
+to download from instead of the one named by the import path.  Blank
+lines and lines beginning with # are ignored.
+
+When a pin file is present, 'go get' checks out the pinned revision of
+each repository it downloads, even with -u, and 'go build', 'go install'
+and 'go test' refuse to build packages from a repository that is not
+checked out at its pinned revision.
+
+The -u flag causes pin to download updates for the repositories and
+check out the same revisions 'go get' would for unpinned repositories
+before recording them.
+
+The -verify flag causes pin to check, instead of record, the revisions:
+it reports each repository that is not checked out at its pinned
+revision.  With no import paths, it checks every repository in the file.
+
+For more about import paths, see 'go help importpath'.
+
+See also: go get.
+
+
 Compile and run Go program
 
 Usage:
 
-	go run [-a] [-n] [-x] gofiles... [arguments...]
+	go run [-a] [-n] [-race] [-x] gofiles... [arguments...]
 
 Run compiles and runs the main package comprising the named Go source files.
 
 The -a flag forces reinstallation of packages that are already up-to-date.
 The -n flag prints the commands but does not run them.
+The -race flag enables data race detection, as in 'go build'.
 The -x flag prints the commands.
 
 See also: go build.
@@ -296,7 +463,7 @@ Test packages
 
 Usage:
 
-	go test [-c] [-file a.go -file b.go ...] [-i] [-p n] [-x] [importpath...] [flags for test binary]
+	go test [-c] [-file a.go -file b.go ...] [-i] [-cover] [-covermode mode] [-json] [-p n] [-race] [-x] [importpath...] [flags for test binary]
 
 'Go test' automates testing the packages named by the import paths.
 It prints a summary of the test results in the format:
@@ -366,6 +533,32 @@ To run the vet tool with specific options, run 'go tool vet'.
 See also: go fmt, go fix.
 
 
+Build caching
+
+The go command caches build outputs for reuse in future builds.
+The default location for cache data is a subdirectory named go-build
+in the standard user cache directory for the current operating system:
+$XDG_CACHE_HOME or $HOME/.cache on Unix systems, $HOME/Library/Caches
+on OS X, and %LocalAppData% on Windows.  Setting the GOCACHE
+environment variable overrides this default, and setting GOCACHE=off
+disables the cache.
+
+An output is filed in the cache under a hash of everything that went
+into making it: the contents of the source files, the compiler flags
+and build tags, the toolchain, and the hashes of the packages it
+imports.  A package is therefore up-to-date exactly when its installed
+archive or binary is the output the cache holds for its current inputs,
+whatever the modification times of the files involved, and switching
+between branches or GOPATH entries rebuilds only what really changed.
+When the cache is disabled, or holds no output for a package's current
+inputs, as for the standard library installed by make.bash, the go
+command falls back on comparing modification times.  Test binaries,
+and packages recompiled with their tests, are not cached.
+
+The go command periodically deletes cached data that has not been
+used recently.  Running 'go clean -cache' deletes all cached data.
+
+
 GOPATH environment variable
 
 The GOPATH environment variable lists places to look for Go code.
@@ -374,7 +567,7 @@ On Windows, the value is a semicolon-separated string.
 On Plan 9, the value is a list.
 
 GOPATH must be set to build and install packages outside the
-standard Go tree.
+standard Go tree, unless they are in a project tree (see below).
 
 Each directory listed in GOPATH must have a prescribed structure:
 
@@ -420,6 +613,40 @@ Go searches each directory listed in GOPATH to find source code,
 but new packages are always downloaded into the first directory 
 in the list.
 
+A package can ship its own copies of the packages it imports in a
+directory named vendor.  Code below the directory containing vendor
+imports the package with source in vendor/x/y as "x/y", in preference
+to any x/y in GOROOT or GOPATH; if there are several vendor
+directories, the one nearest the importing package wins.  In the
+example above, if /home/user/gocode/src/foo/vendor/x/y existed,
+both foo/bar and foo/quux would import it as "x/y", and it would
+be installed to /home/user/gocode/pkg/linux_amd64/foo/vendor/x/y.a.
+
+A vendored package cannot be imported by the path of its directory,
+such as "foo/vendor/x/y", and the pattern ... does not match vendor
+directories: their packages are built for the packages that import
+them.  Because a program can hold only one package for each import
+path, it is an error to build a program whose packages import two
+different packages as "x/y".  'go get' does not download vendored
+packages.
+
+A project can instead be built in place, anywhere outside GOPATH.
+Its root directory holds a file named go.project declaring the
+import path prefix of its packages:
+
+    # go.project
+    example.com/proj
+
+Inside that tree, the package in the root has the import path
+"example.com/proj" and the package in the subdirectory x/y has the
+import path "example.com/proj/x/y".  When run anywhere inside the
+tree, the go command finds these import paths in the project before
+GOROOT and GOPATH, and the pattern ... matches its packages.  The
+project's root directory also holds its pkg/ and bin/ directories,
+into which 'go install' writes its package objects and commands.
+'go get' downloads the packages a project imports, but not the
+project's own packages.
+
 
 Description of import paths
 
@@ -552,10 +779,28 @@ The flags handled by 'go test' are:
 	-i
 	    Install packages that are dependencies of the test.
 
+	-cover
+	    Enable coverage analysis: rewrite the Go files of the package
+	    under test, but not its test files, with 'go tool cover' to
+	    count the statements that run, and report the percentage of
+	    statements covered after the tests pass or fail.
+
+	-covermode set,count,atomic
+	    Set the mode for coverage analysis for the package being tested.
+	    The default is "set".  Implies -cover.
+		set: bool: does this statement run?
+		count: int: how many times does this statement run?
+		atomic: int: count, but correct in multithreaded tests;
+			significantly more expensive.
+
 	-p n
 	    Compile and test up to n packages in parallel.
 	    The default value is the number of CPUs available.
 
+	-race
+	    Enable data race detection.  The package, its dependencies
+	    and the test binary are built as with 'go build -race'.
+
 	-x  Print each subcommand go test executes.
 
 The resulting test binary, called pkg.test, where pkg is the name of the
@@ -572,12 +817,29 @@ directory containing the package sources, has its own flags:
 	    Run benchmarks matching the regular expression.
 	    By default, no benchmarks run.
 
+	-test.benchmem
+	    Print memory allocation statistics for benchmarks: the bytes
+	    allocated and the number of allocations per iteration, counted
+	    while the benchmark timer runs.
+
+	-test.json
+	    Print a JSON event for each test that runs, passes or fails,
+	    each line of test output and each benchmark result, in place
+	    of the usual report.  See the testing package for the format.
+
+	-test.coverprofile cover.out
+	    Write a coverage profile to the specified file after all tests
+	    have passed or failed.  Under 'go test', it implies -cover and
+	    may be used for one package only.  See 'go tool cover' for
+	    reports on the profile.
+
 	-test.cpuprofile cpu.out
-	    Write a CPU profile to the specified file before exiting.
+	    Write a CPU profile of the tests and benchmarks that ran to the
+	    specified file before exiting, even if a test failed.
 
 	-test.memprofile mem.out
 	    Write a memory profile to the specified file when all tests
-	    are complete.
+	    and benchmarks are complete, even if a test failed.
 
 	-test.memprofilerate n
 	    Enable more precise (and expensive) memory profiles by setting
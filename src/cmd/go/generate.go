@@ -0,0 +1,337 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var cmdGenerate = &Command{
+	UsageLine: "generate [-run regexp] [-n] [-v] [-x] [importpath... | gofiles...]",
+	Short:     "generate Go files by processing source",
+	Long: `
+Generate runs commands described by directives within existing
+files.  Those commands can run any process but the intent is to
+create or update Go source files, for instance by running yacc.
+
+Go generate is never run automatically by go build, go get, go test,
+and so on.  It must be run explicitly.
+
+Go generate scans the package's Go files for directives, which
+are lines of the form
+
+	//go:generate command argument...
+
+(note: no leading spaces and no space in "//go") where command
+is the generator to be run, corresponding to an executable file
+that can be run locally.  It must either be in the shell path
+(gofmt), a fully qualified path (/usr/you/bin/mytool), or a
+command alias, described below.
+
+The arguments to the directive are space-separated tokens or
+double-quoted strings passed to the generator as individual
+arguments when it is run.  Quoted strings use Go syntax and are
+evaluated before execution; a quoted string appears as a single
+argument to the generator.
+
+Go generate sets several variables when it runs the generator:
+
+	$GOARCH
+		The execution architecture (arm, amd64, etc.)
+	$GOOS
+		The execution operating system (linux, windows, etc.)
+	$GOFILE
+		The base name of the file.
+	$GOLINE
+		The line number of the directive in the source file.
+	$GOPACKAGE
+		The name of the package of the file containing the directive.
+	$DOLLAR
+		A dollar sign.
+
+Other than variable substitution and quoted-string evaluation, no
+special processing such as "globbing" is performed on the command
+line.  As a last step before running the command, any invocations
+of any environment variables with alphanumeric names, such as
+$GOFILE or $HOME, are expanded throughout the command line.
+
+A directive of the form
+
+	//go:generate -command xxx args...
+
+specifies, for the remainder of this source file only, that the
+string xxx represents the command identified by the arguments.
+This can be used to create aliases or to handle multiword
+generators.  For example,
+
+	//go:generate -command yacc go tool yacc
+
+specifies that the command "yacc" represents the generator
+"go tool yacc".
+
+Generate processes packages in the order given on the command line,
+one at a time.  If the command line lists .go files, they are treated
+as a single package.  Within a package, generate processes the source
+files in file name order, one at a time.  Within a source file,
+generate runs generators in the order they appear in the file, one at
+a time.  The generators run in the directory of the source file.
+
+If any generator returns an error exit status, generate skips
+all further processing for that package.
+
+The -run flag specifies a regular expression to select directives
+whose full original source text (excluding any trailing spaces and
+final newline) matches the expression.
+
+The -n flag prints the commands that would be executed but does
+not run them.  The -v flag prints the names of packages and files
+as they are processed.  The -x flag prints the commands as they
+are executed.
+
+For more about import paths, see 'go help importpath'.
+	`,
+}
+
+var generateRun = cmdGenerate.Flag.String("run", "", "")
+
+func init() {
+	cmdGenerate.Run = runGenerate // break init loop
+
+	cmdGenerate.Flag.BoolVar(&buildN, "n", false, "")
+	cmdGenerate.Flag.BoolVar(&buildV, "v", false, "")
+	cmdGenerate.Flag.BoolVar(&buildX, "x", false, "")
+}
+
+const generatePrefix = "//go:generate"
+
+var generateRunRE *regexp.Regexp
+
+func runGenerate(cmd *Command, args []string) {
+	if *generateRun != "" {
+		var err error
+		generateRunRE, err = regexp.Compile(*generateRun)
+		if err != nil {
+			fatalf("go generate: -run: %v", err)
+		}
+	}
+
+	var pkgs []*Package
+	if len(args) > 0 && strings.HasSuffix(args[0], ".go") {
+		pkgs = append(pkgs, goFilesPackage(args, ""))
+	} else {
+		pkgs = packages(args)
+	}
+	for _, pkg := range pkgs {
+		if buildV {
+			fmt.Fprintf(os.Stderr, "%s\n", pkg.ImportPath)
+		}
+		for _, file := range pkg.gofiles {
+			if !generate(pkg.Name, file) {
+				break
+			}
+		}
+	}
+	exitIfErrors()
+}
+
+// generate runs the generation directives of a single file.
+// It reports whether processing of the package should continue.
+func generate(pkg, path string) bool {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		errorf("%v", err)
+		return false
+	}
+	// Most files have no directives.
+	if !bytes.Contains(src, []byte(generatePrefix)) {
+		return true
+	}
+	if buildV {
+		fmt.Fprintf(os.Stderr, "%s\n", shortPath(path))
+	}
+	g := &generator{
+		path:     path,
+		dir:      filepath.Dir(path),
+		file:     filepath.Base(path),
+		pkg:      pkg,
+		commands: make(map[string][]string),
+	}
+	return g.run(string(src))
+}
+
+// A generator holds the state of the directives of one source file.
+type generator struct {
+	path     string              // full path of the file
+	dir      string              // directory of the file
+	file     string              // base name of the file
+	pkg      string              // name of the package
+	line     int                 // line number of the current directive
+	commands map[string][]string // aliases defined by -command
+}
+
+// run runs the directives in src, the contents of the file.
+// It reports whether they all succeeded.
+func (g *generator) run(src string) bool {
+	for i, line := range strings.Split(src, "\n") {
+		g.line = i + 1
+		line = strings.TrimRight(line, " \t\r")
+		if !isGoGenerate(line) {
+			continue
+		}
+		if generateRunRE != nil && !generateRunRE.MatchString(line) {
+			continue
+		}
+
+		words, err := g.split(line)
+		if err != nil {
+			g.errorf("%v", err)
+			return false
+		}
+		if len(words) == 0 {
+			g.errorf("no arguments to directive")
+			return false
+		}
+		if words[0] == "-command" {
+			if len(words) < 3 {
+				g.errorf("-command needs a name and a command")
+				return false
+			}
+			g.commands[words[1]] = words[2:]
+			continue
+		}
+		if buildN || buildX {
+			fmt.Fprintf(os.Stderr, "%s\n", strings.Join(words, " "))
+		}
+		if buildN {
+			continue
+		}
+		if err := g.exec(words); err != nil {
+			g.errorf("running %q: %v", words[0], err)
+			return false
+		}
+	}
+	return true
+}
+
+// isGoGenerate reports whether line is a generation directive.
+func isGoGenerate(line string) bool {
+	return strings.HasPrefix(line, generatePrefix+" ") || strings.HasPrefix(line, generatePrefix+"\t")
+}
+
+// split breaks the directive line into words, evaluating quoted
+// strings, substituting command aliases and expanding variables.
+func (g *generator) split(line string) ([]string, error) {
+	var words []string
+	line = strings.TrimLeft(line[len(generatePrefix):], " \t")
+Words:
+	for line != "" {
+		if line[0] == '"' {
+			for i := 1; i < len(line); i++ {
+				switch line[i] {
+				case '\\':
+					i++
+				case '"':
+					word, err := strconv.Unquote(line[:i+1])
+					if err != nil {
+						return nil, fmt.Errorf("bad quoted string %s", line[:i+1])
+					}
+					words = append(words, word)
+					line = line[i+1:]
+					if line != "" && line[0] != ' ' && line[0] != '\t' {
+						return nil, fmt.Errorf("no space after quoted string")
+					}
+					line = strings.TrimLeft(line, " \t")
+					continue Words
+				}
+			}
+			return nil, fmt.Errorf("unterminated quoted string")
+		}
+		i := strings.IndexAny(line, " \t")
+		if i < 0 {
+			i = len(line)
+		}
+		words = append(words, line[:i])
+		line = strings.TrimLeft(line[i:], " \t")
+	}
+
+	if len(words) > 0 && g.commands[words[0]] != nil {
+		words = append(append([]string{}, g.commands[words[0]]...), words[1:]...)
+	}
+	for i, word := range words {
+		words[i] = os.Expand(word, func(s string) string { return g.expandVar(s) })
+	}
+	return words, nil
+}
+
+// env returns the variables set for generators of the current directive.
+func (g *generator) env() []string {
+	return []string{
+		"GOARCH=" + buildContext.GOARCH,
+		"GOOS=" + buildContext.GOOS,
+		"GOFILE=" + g.file,
+		"GOLINE=" + strconv.Itoa(g.line),
+		"GOPACKAGE=" + g.pkg,
+		"DOLLAR=$",
+	}
+}
+
+// expandVar expands the variable named word for os.Expand.
+func (g *generator) expandVar(word string) string {
+	prefix := word + "="
+	for _, kv := range g.env() {
+		if strings.HasPrefix(kv, prefix) {
+			return kv[len(prefix):]
+		}
+	}
+	return os.Getenv(word)
+}
+
+// exec runs the generator described by words in the file's directory.
+func (g *generator) exec(words []string) error {
+	cmd := exec.Command(words[0], words[1:]...)
+	cmd.Dir = g.dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = mergeEnv(os.Environ(), g.env())
+	return cmd.Run()
+}
+
+// errorf reports an error at the current directive.
+func (g *generator) errorf(format string, args ...interface{}) {
+	errorf("%s:%d: %s", shortPath(g.path), g.line, fmt.Sprintf(format, args...))
+}
+
+// mergeEnv returns the environment env with the variables in
+// set added, replacing any earlier settings of them.
+func mergeEnv(env, set []string) []string {
+	var out []string
+	for _, kv := range env {
+		keep := true
+		for _, s := range set {
+			if i := strings.Index(s, "="); strings.HasPrefix(kv, s[:i+1]) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			out = append(out, kv)
+		}
+	}
+	return append(out, set...)
+}
+
+// shortPath returns path relative to the current directory
+// if that is shorter.
+func shortPath(path string) string {
+	return relPaths([]string{path})[0]
+}
@@ -0,0 +1,79 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+type splitTest struct {
+	in  string
+	out []string
+}
+
+var splitTests = []splitTest{
+	{"", nil},
+	{"x", []string{"x"}},
+	{" a b\tc ", []string{"a", "b", "c"}},
+	{` " a " `, []string{" a "}},
+	{`"a\tb" "\"c\""`, []string{"a\tb", `"c"`}},
+	{"$GOARCH", []string{runtime.GOARCH}},
+	{"$GOFILE $GOLINE $GOPACKAGE", []string{"proc.go", "42", "sys"}},
+	{"$DOLLAR{x}", []string{"${x}"}},
+	{"yacc -o $GOFILE.y", []string{"go", "tool", "yacc", "-o", "proc.go.y"}},
+	{`"yacc" x`, []string{"go", "tool", "yacc", "x"}},
+}
+
+func TestGenerateSplit(t *testing.T) {
+	defer func(goarch string) { buildContext.GOARCH = goarch }(buildContext.GOARCH)
+	buildContext.GOARCH = runtime.GOARCH
+	g := &generator{
+		file:     "proc.go",
+		pkg:      "sys",
+		line:     42,
+		commands: map[string][]string{"yacc": {"go", "tool", "yacc"}},
+	}
+	for _, test := range splitTests {
+		got, err := g.split("//go:generate " + test.in)
+		if err != nil {
+			t.Errorf("split(%q): %v", test.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.out) {
+			t.Errorf("split(%q) = %q, want %q", test.in, got, test.out)
+		}
+	}
+
+	for _, bad := range []string{`"a`, `"a"b`, `"\q"`} {
+		if got, err := g.split("//go:generate " + bad); err == nil {
+			t.Errorf("split(%q) = %q, want error", bad, got)
+		}
+	}
+}
+
+func TestIsGoGenerate(t *testing.T) {
+	for line, want := range map[string]bool{
+		"//go:generate yacc":   true,
+		"//go:generate\tyacc":  true,
+		"// go:generate yacc":  false,
+		" //go:generate yacc":  false,
+		"//go:generateyacc":    false,
+		"/*go:generate yacc*/": false,
+	} {
+		if got := isGoGenerate(line); got != want {
+			t.Errorf("isGoGenerate(%q) = %v, want %v", line, got, want)
+		}
+	}
+}
+
+func TestMergeEnv(t *testing.T) {
+	got := mergeEnv([]string{"A=1", "GOFILE=old", "GOFILEX=2"}, []string{"GOFILE=x.go"})
+	want := []string{"A=1", "GOFILEX=2", "GOFILE=x.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeEnv = %q, want %q", got, want)
+	}
+}
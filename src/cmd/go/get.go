@@ -11,20 +11,19 @@ import (
 	"go/build"
 	"os"
 	"path/filepath"
-	"runtime"
 	"strconv"
 	"strings"
 )
 
 var cmdGet = &Command{
-	UsageLine: "get [-a] [-d] [-fix] [-n] [-p n] [-u] [-v] [-x] [importpath...]",
+	UsageLine: "get [-a] [-d] [-fix] [-n] [-p n] [-race] [-u] [-v] [-x] [importpath...]",
 	Short:     "download and install packages and dependencies",
 	Long: `
 Get downloads and installs the packages named by the import paths,
 along with their dependencies.
 
-The -a, -n, -v, -x, and -p flags have the same meaning as in 'go build'
-and 'go install'.  See 'go help install'.
+The -a, -n, -race, -v, -x, and -p flags have the same meaning as in
+'go build' and 'go install'.  See 'go help install'.
 
 The -d flag instructs get to stop after downloading the packages; that is,
 it instructs get not to install the packages.
@@ -36,6 +35,10 @@ The -u flag instructs get to use the network to update the named packages
 and their dependencies.  By default, get uses the network to check out 
 missing packages but does not use it to look for updates to existing packages.
 
+If a pin file is present, get checks out the pinned revision of each
+repository instead, downloading updates as needed to find it.
+See 'go help pin'.
+
 TODO: Explain versions better.
 
 For more about import paths, see 'go help importpath'.
@@ -57,6 +60,8 @@ func init() {
 }
 
 func runGet(cmd *Command, args []string) {
+	raceInit()
+
 	// Phase 1.  Download/update.
 	args = importPaths(args)
 	var stk importStack
@@ -113,8 +118,12 @@ func download(arg string, stk *importStack) {
 	}
 	downloadCache[arg] = true
 
-	// Download if the package is missing, or update if we're using -u.
-	if p.Dir == "" || *getU {
+	// Download if the package is missing, or update if we're using -u
+	// or the checkout does not match the pin file.
+	// Packages in the project tree are the project's own; only
+	// their dependencies are downloaded.
+	inProject := p.t != nil && p.t.Prefix != ""
+	if !inProject && (p.Dir == "" || *getU || checkPin(p) != nil) {
 		// The actual download.
 		stk.push(p.ImportPath)
 		defer stk.pop()
@@ -143,7 +152,11 @@ func download(arg string, stk *importStack) {
 	}
 
 	// Process dependencies, now that we know what they are.
+	// Vendored packages ship with the packages importing them.
 	for _, dep := range p.deps {
+		if dep.Vendored {
+			continue
+		}
 		download(dep.ImportPath, stk)
 	}
 }
@@ -151,11 +164,29 @@ func download(arg string, stk *importStack) {
 // downloadPackage runs the create or download command
 // to make the first copy of or update a copy of the given package.
 func downloadPackage(p *Package) error {
+	// A pin for the package's repository fixes the revision
+	// to check out, and perhaps the repository to use.
+	var pn *pin
+	if pf := loadPins(); pf != nil {
+		pn = pf.lookup(p.ImportPath)
+	}
+
 	// Analyze the import path to determine the version control system,
 	// repository, and the import path for the root of the repository.
-	vcs, repo, rootPath, err := vcsForImportPath(p.ImportPath)
-	if err != nil {
-		return err
+	var vcs *vcsCmd
+	var repo, rootPath string
+	if pn != nil && pn.repo != "" {
+		vcs, repo, rootPath = pn.vcs, pn.repo, pn.root
+	} else {
+		var err error
+		vcs, repo, rootPath, err = vcsForImportPath(p.ImportPath)
+		if err != nil {
+			return err
+		}
+		if pn != nil && (vcs != pn.vcs || rootPath != pn.root) {
+			return fmt.Errorf("%s pins %s as a %s repository, but it is a %s repository rooted at %s",
+				loadPins().file, pn.root, pn.vcs.cmd, vcs.cmd, rootPath)
+		}
 	}
 	if p.t == nil {
 		// Package not found.  Put in first directory of $GOPATH or else $GOROOT.
@@ -206,16 +237,18 @@ func downloadPackage(p *Package) error {
 		}
 	}
 
+	// Sync to the pinned revision, if any.
+	if pn != nil {
+		delete(pinnedRevs, root)
+		return vcs.revSync(root, pn.rev)
+	}
+
 	// Select and sync to appropriate version of the repository.
 	tags, err := vcs.tags(root)
 	if err != nil {
 		return err
 	}
-	vers := runtime.Version()
-	if i := strings.Index(vers, " "); i >= 0 {
-		vers = vers[:i]
-	}
-	if err := vcs.tagSync(root, selectTag(vers, tags)); err != nil {
+	if err := vcs.tagSync(root, selectTag(goVersion(), tags)); err != nil {
 		return err
 	}
 
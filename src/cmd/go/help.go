@@ -137,7 +137,7 @@ On Windows, the value is a semicolon-separated string.
 On Plan 9, the value is a list.
 
 GOPATH must be set to build and install packages outside the
-standard Go tree.
+standard Go tree, unless they are in a project tree (see below).
 
 Each directory listed in GOPATH must have a prescribed structure:
 
@@ -182,5 +182,39 @@ Here's an example directory layout:
 Go searches each directory listed in GOPATH to find source code,
 but new packages are always downloaded into the first directory 
 in the list.
+
+A package can ship its own copies of the packages it imports in a
+directory named vendor.  Code below the directory containing vendor
+imports the package with source in vendor/x/y as "x/y", in preference
+to any x/y in GOROOT or GOPATH; if there are several vendor
+directories, the one nearest the importing package wins.  In the
+example above, if /home/user/gocode/src/foo/vendor/x/y existed,
+both foo/bar and foo/quux would import it as "x/y", and it would
+be installed to /home/user/gocode/pkg/linux_amd64/foo/vendor/x/y.a.
+
+A vendored package cannot be imported by the path of its directory,
+such as "foo/vendor/x/y", and the pattern ... does not match vendor
+directories: their packages are built for the packages that import
+them.  Because a program can hold only one package for each import
+path, it is an error to build a program whose packages import two
+different packages as "x/y".  'go get' does not download vendored
+packages.
+
+A project can instead be built in place, anywhere outside GOPATH.
+Its root directory holds a file named go.project declaring the
+import path prefix of its packages:
+
+    # go.project
+    example.com/proj
+
+Inside that tree, the package in the root has the import path
+"example.com/proj" and the package in the subdirectory x/y has the
+import path "example.com/proj/x/y".  When run anywhere inside the
+tree, the go command finds these import paths in the project before
+GOROOT and GOPATH, and the pattern ... matches its packages.  The
+project's root directory also holds its pkg/ and bin/ directories,
+into which 'go install' writes its package objects and commands.
+'go get' downloads the packages a project imports, but not the
+project's own packages.
 	`,
 }
@@ -9,11 +9,13 @@ import (
 	"encoding/json"
 	"io"
 	"os"
+	"sort"
+	"strings"
 	"text/template"
 )
 
 var cmdList = &Command{
-	UsageLine: "list [-e] [-f format] [-json] [importpath...]",
+	UsageLine: "list [-e] [-f format] [-json] [-graph] [importpath...]",
 	Short:     "list packages",
 	Long: `
 List lists the packages named by the import paths, one per line.
@@ -30,12 +32,14 @@ is equivalent to -f '{{.ImportPath}}'.  The struct
 being passed to the template is:
 
     type Package struct {
-        Name       string // package name
-        Doc        string // package documentation string
-        ImportPath string // import path of package in dir
-        Dir        string // directory containing package sources
-        Version    string // version of installed package (TODO)
-        Stale      bool   // would 'go install' do anything for this package?
+        Name        string // package name
+        Doc         string // package documentation string
+        ImportPath  string // import path of package in dir
+        Dir         string // directory containing package sources
+        Version     string // version of installed package (TODO)
+        Stale       bool   // would 'go install' do anything for this package?
+        StaleReason string // why is Stale true?
+        Vendored    bool   // was the package found in a vendor directory?
 
         // Source files
         GoFiles      []string // .go source files (excluding CgoFiles, TestGoFiles, and XTestGoFiles)
@@ -45,10 +49,14 @@ being passed to the template is:
         HFiles       []string // .h source files
         SFiles       []string // .s source files
         CgoFiles     []string // .go sources files that import "C"
+        SysoFiles    []string // .syso object files to add to archive
 
         // Dependency information
-        Imports []string // import paths used by this package
-        Deps    []string // all (recursively) imported dependencies
+        Imports     []string          // import paths used by this package
+        ImportDirs  map[string]string // directory of each imported package, by import path
+        Deps        []string          // all (recursively) imported dependencies
+        TestImports []string          // import paths used by TestGoFiles and XTestGoFiles
+        TestDeps    []string          // Deps plus the dependencies of the tests
         
         // Error information
         Incomplete bool            // this package or a dependency has an error
@@ -56,9 +64,19 @@ being passed to the template is:
         DepsErrors []*PackageError // errors loading dependencies
     }
 
+StaleReason is a short explanation such as "newer source file x.go"
+or "stale dependency fmt".  ImportDirs records where each import was
+found, which for a vendored package is its vendor directory.
+
 The -json flag causes the package data to be printed in JSON format
 instead of using the template format.
 
+The -graph flag causes list to print the import graph of the named
+packages and all their dependencies instead, one edge per line:
+the import path of the importing package, a space, and the import
+path of the imported package.  The edges include the implicit
+imports, such as runtime, and are sorted.
+
 The -e flag changes the handling of erroneous packages, those that
 cannot be found or are malformed.  By default, the list command
 prints an error to standard error for each erroneous package and
@@ -80,6 +98,7 @@ func init() {
 var listE = cmdList.Flag.Bool("e", false, "")
 var listFmt = cmdList.Flag.String("f", "{{.ImportPath}}", "")
 var listJson = cmdList.Flag.Bool("json", false, "")
+var listGraph = cmdList.Flag.Bool("graph", false, "")
 var nl = []byte{'\n'}
 
 func runList(cmd *Command, args []string) {
@@ -119,11 +138,89 @@ func runList(cmd *Command, args []string) {
 		load = packagesAndErrors
 	}
 
+	if *listGraph {
+		for _, edge := range importGraph(load(args)) {
+			out.w.WriteString(edge)
+			out.w.WriteRune('\n')
+		}
+		return
+	}
+
+	// Loading the tests' imports costs time; do it only if asked.
+	needTestDeps := *listJson || strings.Contains(*listFmt, ".TestDeps")
 	for _, pkg := range load(args) {
+		if needTestDeps {
+			pkg.TestDeps = testDeps(pkg)
+		}
 		do(pkg)
 	}
 }
 
+// testDeps returns the sorted import paths of the dependencies
+// of p and of its tests, other than p itself.
+func testDeps(p *Package) []string {
+	if p.info == nil {
+		return p.Deps
+	}
+	have := map[string]bool{p.ImportPath: true}
+	deps := []string{}
+	add := func(path string) {
+		if !have[path] {
+			have[path] = true
+			deps = append(deps, path)
+		}
+	}
+	for _, path := range p.Deps {
+		add(path)
+	}
+	var stk importStack
+	stk.push(p.ImportPath + "_test")
+	for _, path := range p.info.TestImports {
+		if path == "C" {
+			continue
+		}
+		p1 := loadImport(path, p, &stk)
+		add(p1.ImportPath)
+		for _, path := range p1.Deps {
+			add(path)
+		}
+	}
+	sort.Strings(deps)
+	return deps
+}
+
+// importGraph returns the edges of the import graph of pkgs and
+// their dependencies, each an importing and an imported import
+// path separated by a space, sorted.
+func importGraph(pkgs []*Package) []string {
+	var edges []string
+	seen := map[*Package]bool{}
+	var walk func(*Package)
+	walk = func(p *Package) {
+		if seen[p] {
+			return
+		}
+		seen[p] = true
+		for _, p1 := range p.imports {
+			edges = append(edges, p.ImportPath+" "+p1.ImportPath)
+			walk(p1)
+		}
+	}
+	for _, p := range pkgs {
+		walk(p)
+	}
+	sort.Strings(edges)
+
+	// A package can import another explicitly and implicitly.
+	var out []string
+	for _, e := range edges {
+		if len(out) == 0 || e != out[len(out)-1] {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
 // CountingWriter counts its data, so we can avoid appending a newline
 // if there was no actual output.
 type CountingWriter struct {
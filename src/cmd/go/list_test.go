@@ -0,0 +1,88 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// listTree lays out a GOPATH tree in which a imports b and c,
+// b imports c, and the tests of c import d.
+var listTree = map[string]string{
+	"a/a.go":      "package a\nimport (\n_ \"b\"\n_ \"c\"\n)\n",
+	"b/b.go":      "package b\nimport _ \"c\"\n",
+	"c/c.go":      "package c\n",
+	"c/c_test.go": "package c\nimport _ \"d\"\n",
+	"d/d.go":      "package d\n",
+}
+
+func TestList(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "golist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+	for name, data := range listTree {
+		file := filepath.Join(gopath, "src", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func(path []*build.Tree) { build.Path = path }(build.Path)
+	build.Path = append(build.Path, &build.Tree{Path: gopath})
+	defer func(cache map[string]*Package) { packageCache = cache }(packageCache)
+	packageCache = map[string]*Package{}
+
+	var stk importStack
+	a := loadPackage("a", &stk)
+	c := loadPackage("c", &stk)
+
+	// Nothing is installed.
+	if !a.Stale || a.StaleReason != "not installed" {
+		t.Errorf("a: Stale=%v, StaleReason=%q, want not installed", a.Stale, a.StaleReason)
+	}
+
+	if want := filepath.Join(gopath, "src", "b"); a.ImportDirs["b"] != want {
+		t.Errorf("a: ImportDirs[b] = %q, want %q", a.ImportDirs["b"], want)
+	}
+
+	// Leave out the standard library, such as the implicit
+	// imports of runtime and what runtime imports in turn.
+	inTree := func(path string) bool {
+		_, ok := listTree[path+"/"+path+".go"]
+		return ok
+	}
+	withoutStd := func(list []string) []string {
+		var out []string
+		for _, s := range list {
+			ok := true
+			for _, path := range strings.Fields(s) {
+				ok = ok && inTree(path)
+			}
+			if ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+
+	if deps := withoutStd(testDeps(c)); !reflect.DeepEqual(deps, []string{"d"}) {
+		t.Errorf("c: TestDeps = %v, want [d]", deps)
+	}
+
+	edges := withoutStd(importGraph([]*Package{a}))
+	if want := []string{"a b", "a c", "b c"}; !reflect.DeepEqual(edges, want) {
+		t.Errorf("import graph of a = %q, want %q", edges, want)
+	}
+}
@@ -78,15 +78,18 @@ var commands = []*Command{
 	cmdDoc,
 	cmdFix,
 	cmdFmt,
+	cmdGenerate,
 	cmdGet,
 	cmdInstall,
 	cmdList,
+	cmdPin,
 	cmdRun,
 	cmdTest,
 	cmdTool,
 	cmdVersion,
 	cmdVet,
 
+	helpCache,
 	helpGopath,
 	helpImportpath,
 	helpRemote,
@@ -120,6 +123,13 @@ func main() {
 		return
 	}
 
+	// Inside a project tree, its packages are found relative to its root.
+	project, err := buildContext.FindProject(".")
+	if err != nil {
+		fatalf("go: %v", err)
+	}
+	buildContext.Project = project
+
 	for _, cmd := range commands {
 		if cmd.Name() == args[0] && cmd.Run != nil {
 			cmd.Flag.Usage = func() { cmd.Usage() }
@@ -378,23 +388,29 @@ func allPackages(pattern string) []string {
 		return nil
 	})
 
-	for _, t := range build.Path {
+	trees := build.Path
+	if buildContext.Project != nil {
+		trees = append([]*build.Tree{buildContext.Project}, trees...)
+	}
+	for _, t := range trees {
 		if pattern == "std" && !t.Goroot {
 			continue
 		}
 		src := t.SrcDir() + string(filepath.Separator)
 		filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
-			if err != nil || !fi.IsDir() || path == src {
+			// The root of a project tree is itself a package.
+			if err != nil || !fi.IsDir() || path == src && t.Prefix == "" {
 				return nil
 			}
 
-			// Avoid .foo, _foo, and testdata directory trees.
+			// Avoid .foo, _foo, testdata and vendor directory trees.
+			// Vendored packages are built for the packages importing them.
 			_, elem := filepath.Split(path)
-			if strings.HasPrefix(elem, ".") || strings.HasPrefix(elem, "_") || elem == "testdata" {
+			if strings.HasPrefix(elem, ".") || strings.HasPrefix(elem, "_") || elem == "testdata" || elem == "vendor" {
 				return filepath.SkipDir
 			}
 
-			name := filepath.ToSlash(path[len(src):])
+			name, _ := t.ImportPath(path)
 			if pattern == "std" && strings.Contains(name, ".") {
 				return filepath.SkipDir
 			}
@@ -455,9 +471,10 @@ func allPackagesInFS(pattern string) []string {
 			return nil
 		}
 
-		// Avoid .foo, _foo, and testdata directory trees.
+		// Avoid .foo, _foo, testdata and vendor directory trees.
+		// Vendored packages are built for the packages importing them.
 		_, elem := filepath.Split(path)
-		if strings.HasPrefix(elem, ".") || strings.HasPrefix(elem, "_") || elem == "testdata" {
+		if strings.HasPrefix(elem, ".") || strings.HasPrefix(elem, "_") || elem == "testdata" || elem == "vendor" {
 			return filepath.SkipDir
 		}
 
@@ -0,0 +1,394 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+var cmdPin = &Command{
+	UsageLine: "pin [-u] [-verify] [importpath...]",
+	Short:     "record the revisions of downloaded packages",
+	Long: `
+Pin records, in the pin file, the revision checked out in each
+repository holding the packages named by the import paths or their
+dependencies.  Packages in the standard library are never pinned.
+
+The pin file is the file named go.pin in the current directory or the
+nearest parent directory that has one.  If there is none, pin creates
+it in the current directory.  Each line of the file pins one repository:
+
+	code.google.com/p/go.net hg 7b1cb8fa3ed4a5b1b3b2d0d7bb3a5e1b7a5c8d6e
+	example.com/lib git 3f9c2a... file:///home/user/mirror/lib
+
+The fields are the import path of the root of the repository, the
+version control system, the revision, and, optionally, the repository
+to download from instead of the one named by the import path.  Blank
+lines and lines beginning with # are ignored.
+
+When a pin file is present, 'go get' checks out the pinned revision of
+each repository it downloads, even with -u, and 'go build', 'go install'
+and 'go test' refuse to build packages from a repository that is not
+checked out at its pinned revision.
+
+The -u flag causes pin to download updates for the repositories and
+check out the same revisions 'go get' would for unpinned repositories
+before recording them.
+
+The -verify flag causes pin to check, instead of record, the revisions:
+it reports each repository that is not checked out at its pinned
+revision.  With no import paths, it checks every repository in the file.
+
+For more about import paths, see 'go help importpath'.
+
+See also: go get.
+	`,
+}
+
+var pinU = cmdPin.Flag.Bool("u", false, "")
+var pinVerify = cmdPin.Flag.Bool("verify", false, "")
+
+func init() {
+	cmdPin.Run = runPin // break init loop
+}
+
+// pinFileName is the name of the pin file.
+const pinFileName = "go.pin"
+
+// A pin records the revision of a repository to use.
+type pin struct {
+	root string  // import path of the repository root
+	vcs  *vcsCmd // version control system
+	rev  string  // revision to check out
+	repo string  // repository to download from; "" for the default
+}
+
+// A pinFile is the parsed form of a pin file.
+type pinFile struct {
+	file string
+	pins []*pin
+}
+
+var (
+	thePins      *pinFile
+	thePinsValid bool
+)
+
+// loadPins returns the pin file that applies to the current
+// directory, or nil if there is none.
+func loadPins() *pinFile {
+	if thePinsValid {
+		return thePins
+	}
+	thePinsValid = true
+	file := findPinFile()
+	if file == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	thePins, err = parsePins(file, data)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	return thePins
+}
+
+// findPinFile returns the name of the pin file in the current
+// directory or its nearest parent, or "" if there is none.
+func findPinFile() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		file := filepath.Join(dir, pinFileName)
+		if fi, err := os.Stat(file); err == nil && !fi.IsDir() {
+			return file
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return ""
+}
+
+// parsePins parses the contents of the pin file.
+func parsePins(file string, data []byte) (*pinFile, error) {
+	pf := &pinFile{file: file}
+	seen := map[string]bool{}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Fields(line)
+		if len(f) != 3 && len(f) != 4 {
+			return nil, fmt.Errorf("%s:%d: want import path, version control system, revision and optional repository", file, i+1)
+		}
+		p := &pin{root: f[0], vcs: vcsByCmd(f[1]), rev: f[2]}
+		if p.vcs == nil {
+			return nil, fmt.Errorf("%s:%d: unknown version control system %q", file, i+1, f[1])
+		}
+		if len(f) == 4 {
+			p.repo = f[3]
+		}
+		if seen[p.root] {
+			return nil, fmt.Errorf("%s:%d: %s pinned twice", file, i+1, p.root)
+		}
+		seen[p.root] = true
+		pf.pins = append(pf.pins, p)
+	}
+	return pf, nil
+}
+
+// lookup returns the pin for the repository holding the package
+// with the given import path, or nil if there is none.
+func (pf *pinFile) lookup(importPath string) *pin {
+	var match *pin
+	for _, p := range pf.pins {
+		if importPath == p.root || strings.HasPrefix(importPath, p.root+"/") {
+			if match == nil || len(p.root) > len(match.root) {
+				match = p
+			}
+		}
+	}
+	return match
+}
+
+// set records p, replacing any earlier pin for the same repository.
+func (pf *pinFile) set(p *pin) {
+	for i, old := range pf.pins {
+		if old.root == p.root {
+			pf.pins[i] = p
+			return
+		}
+	}
+	pf.pins = append(pf.pins, p)
+}
+
+type pinsByRoot []*pin
+
+func (x pinsByRoot) Len() int           { return len(x) }
+func (x pinsByRoot) Swap(i, j int)      { x[i], x[j] = x[j], x[i] }
+func (x pinsByRoot) Less(i, j int) bool { return x[i].root < x[j].root }
+
+// format returns the contents of the pin file, sorted by import path.
+func (pf *pinFile) format() []byte {
+	sort.Sort(pinsByRoot(pf.pins))
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Revisions of the repositories used to build this project.\n")
+	fmt.Fprintf(&buf, "# Maintained by 'go pin'; see 'go help pin'.\n")
+	for _, p := range pf.pins {
+		fmt.Fprintf(&buf, "%s %s %s", p.root, p.vcs.cmd, p.rev)
+		if p.repo != "" {
+			fmt.Fprintf(&buf, " %s", p.repo)
+		}
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
+
+// pinnedRevs records the checked-out revisions found by checkPin,
+// by repository root directory.
+var pinnedRevs = map[string]string{}
+
+// checkPin returns an error if p belongs to a pinned repository
+// that is not checked out at its pinned revision.
+func checkPin(p *Package) error {
+	pf := loadPins()
+	if pf == nil || p.Standard || p.t == nil || p.Dir == "" {
+		return nil
+	}
+	pn := pf.lookup(p.ImportPath)
+	if pn == nil {
+		return nil
+	}
+	dir := filepath.Join(p.t.SrcDir(), filepath.FromSlash(pn.root))
+	rev, ok := pinnedRevs[dir]
+	if !ok {
+		var err error
+		rev, err = pn.vcs.revision(dir)
+		if err != nil {
+			return err
+		}
+		pinnedRevs[dir] = rev
+	}
+	if rev != pn.rev {
+		return fmt.Errorf("%s is at revision %s, but %s pins revision %s; run 'go get %s/...'",
+			pn.root, rev, pf.file, pn.rev, pn.root)
+	}
+	return nil
+}
+
+// checkPins reports an error for each of the packages or their
+// dependencies that do not match the pin file.
+func checkPins(pkgs []*Package) {
+	if loadPins() == nil {
+		return
+	}
+	reported := map[string]bool{}
+	for _, p := range packageList(pkgs) {
+		if err := checkPin(p); err != nil && !reported[err.Error()] {
+			reported[err.Error()] = true
+			errorf("%v", err)
+		}
+	}
+}
+
+func runPin(cmd *Command, args []string) {
+	if *pinVerify && len(args) == 0 {
+		verifyAllPins()
+		return
+	}
+	pkgs := packagesAndErrors(args)
+	if *pinVerify {
+		checkPins(pkgs)
+		exitIfErrors()
+		return
+	}
+
+	if *pinU {
+		updatePinned(pkgs)
+		exitIfErrors()
+
+		// The updates can change the imports, so load
+		// the packages again.
+		for name := range packageCache {
+			delete(packageCache, name)
+		}
+		pkgs = packagesAndErrors(args)
+	}
+
+	pf := loadPins()
+	if pf == nil {
+		pf = &pinFile{file: pinFileName}
+	}
+	done := map[string]bool{}
+	for _, p := range packageList(pkgs) {
+		if p.Error != nil {
+			errorf("%s", p.Error)
+			continue
+		}
+		if p.Standard || p.t == nil {
+			continue
+		}
+		src := p.t.SrcDir()
+		vcs, dir, err := vcsForDir(src, p.Dir)
+		if err != nil {
+			errorf("%v", err)
+			continue
+		}
+		if done[dir] {
+			continue
+		}
+		done[dir] = true
+		rev, err := vcs.revision(dir)
+		if err != nil {
+			errorf("%v", err)
+			continue
+		}
+		root := filepath.ToSlash(dir[len(src)+1:])
+		pn := &pin{root: root, vcs: vcs, rev: rev}
+		if old := pf.lookup(root); old != nil && old.root == root {
+			pn.repo = old.repo
+		}
+		pf.set(pn)
+	}
+	exitIfErrors()
+
+	if err := ioutil.WriteFile(pf.file, pf.format(), 0666); err != nil {
+		fatalf("%v", err)
+	}
+}
+
+// updatePinned downloads updates for the repositories holding pkgs
+// and their dependencies and checks out the revisions go get would.
+func updatePinned(pkgs []*Package) {
+	done := map[string]bool{}
+	for _, p := range packageList(pkgs) {
+		if p.Error != nil || p.Standard || p.t == nil {
+			continue
+		}
+		vcs, dir, err := vcsForDir(p.t.SrcDir(), p.Dir)
+		if err != nil {
+			errorf("%v", err)
+			continue
+		}
+		if done[dir] {
+			continue
+		}
+		done[dir] = true
+		if buildV {
+			fmt.Fprintf(os.Stderr, "%s (update)\n", dir)
+		}
+		if err := vcs.download(dir); err != nil {
+			errorf("%v", err)
+			continue
+		}
+		tags, err := vcs.tags(dir)
+		if err != nil {
+			errorf("%v", err)
+			continue
+		}
+		if err := vcs.tagSync(dir, selectTag(goVersion(), tags)); err != nil {
+			errorf("%v", err)
+		}
+	}
+}
+
+// verifyAllPins reports each repository in the pin file that is
+// missing or not checked out at its pinned revision.
+func verifyAllPins() {
+	pf := loadPins()
+	if pf == nil {
+		fatalf("go pin: no %s file", pinFileName)
+	}
+	for _, pn := range pf.pins {
+		var dir string
+		for _, t := range build.Path {
+			d := filepath.Join(t.SrcDir(), filepath.FromSlash(pn.root))
+			if _, err := os.Stat(d); err == nil {
+				dir = d
+				break
+			}
+		}
+		if dir == "" {
+			errorf("%s is pinned but not downloaded; run 'go get %s/...'", pn.root, pn.root)
+			continue
+		}
+		rev, err := pn.vcs.revision(dir)
+		if err != nil {
+			errorf("%v", err)
+			continue
+		}
+		if rev != pn.rev {
+			errorf("%s is at revision %s, but %s pins revision %s", pn.root, rev, pf.file, pn.rev)
+		}
+	}
+	exitIfErrors()
+}
+
+// goVersion returns the release or weekly name of the Go version,
+// without any suffix, for use with selectTag.
+func goVersion() string {
+	vers := runtime.Version()
+	if i := strings.Index(vers, " "); i >= 0 {
+		vers = vers[:i]
+	}
+	return vers
+}
@@ -0,0 +1,210 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testPins = `# comment
+
+example.com/a/b git 0123456789abcdef0123456789abcdef01234567
+code.google.com/p/x hg fedcba9876543210fedcba9876543210fedcba98 file:///tmp/x
+example.com/a svn 42
+`
+
+func TestParsePins(t *testing.T) {
+	pf, err := parsePins("go.pin", []byte(testPins))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pf.pins) != 3 {
+		t.Fatalf("got %d pins, want 3", len(pf.pins))
+	}
+	want := &pin{"code.google.com/p/x", vcsHg, "fedcba9876543210fedcba9876543210fedcba98", "file:///tmp/x"}
+	if !reflect.DeepEqual(pf.pins[1], want) {
+		t.Errorf("got %+v, want %+v", pf.pins[1], want)
+	}
+
+	for path, root := range map[string]string{
+		"example.com/a":       "example.com/a",
+		"example.com/a/c":     "example.com/a",
+		"example.com/a/b":     "example.com/a/b",
+		"example.com/a/b/c":   "example.com/a/b",
+		"example.com/ab":      "",
+		"code.google.com/p/y": "",
+	} {
+		p := pf.lookup(path)
+		if p == nil && root != "" || p != nil && p.root != root {
+			t.Errorf("lookup(%q) = %v, want root %q", path, p, root)
+		}
+	}
+
+	// Formatting sorts the pins and round-trips.
+	pf1, err := parsePins("go.pin", pf.format())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pf1.pins) != 3 || pf1.pins[0].root != "code.google.com/p/x" || !reflect.DeepEqual(pf1.pins, pf.pins) {
+		t.Errorf("format did not round-trip:\n%s", pf.format())
+	}
+
+	for _, bad := range []string{
+		"example.com/a git\n",
+		"example.com/a cvs 1\n",
+		"example.com/a git 1\nexample.com/a hg 2\n",
+	} {
+		if _, err := parsePins("go.pin", []byte(bad)); err == nil {
+			t.Errorf("parsing %q: no error", bad)
+		}
+	}
+}
+
+// A testRepo makes a local repository for testing a version control system.
+type testRepo struct {
+	vcs *vcsCmd
+
+	// create creates a repository in dir and returns its location
+	// and the directory of a working copy to commit from.
+	create func(t *testing.T, dir string) (repo, work string)
+
+	// commit commits the new file in the working copy.
+	commit func(t *testing.T, work, file string)
+}
+
+var testRepos = []testRepo{
+	{
+		vcs: vcsGit,
+		create: func(t *testing.T, dir string) (string, string) {
+			testRun(t, dir, "git", "init", "-q", "repo")
+			return filepath.Join(dir, "repo"), filepath.Join(dir, "repo")
+		},
+		commit: func(t *testing.T, work, file string) {
+			testRun(t, work, "git", "add", file)
+			testRun(t, work, "git", "-c", "user.name=gopher", "-c", "user.email=gopher@example.com", "commit", "-q", "-m", file)
+		},
+	},
+	{
+		vcs: vcsHg,
+		create: func(t *testing.T, dir string) (string, string) {
+			testRun(t, dir, "hg", "init", "repo")
+			return filepath.Join(dir, "repo"), filepath.Join(dir, "repo")
+		},
+		commit: func(t *testing.T, work, file string) {
+			testRun(t, work, "hg", "add", file)
+			testRun(t, work, "hg", "commit", "-u", "gopher", "-m", file)
+		},
+	},
+	{
+		vcs: vcsBzr,
+		create: func(t *testing.T, dir string) (string, string) {
+			testRun(t, dir, "bzr", "init", "-q", "repo")
+			return filepath.Join(dir, "repo"), filepath.Join(dir, "repo")
+		},
+		commit: func(t *testing.T, work, file string) {
+			testRun(t, work, "bzr", "add", "-q", file)
+			testRun(t, work, "bzr", "commit", "-q", "-m", file)
+		},
+	},
+	{
+		vcs: vcsSvn,
+		create: func(t *testing.T, dir string) (string, string) {
+			testRun(t, dir, "svnadmin", "create", "repo")
+			repo := "file://" + filepath.ToSlash(filepath.Join(dir, "repo"))
+			testRun(t, dir, "svn", "checkout", "-q", repo, "work")
+			return repo, filepath.Join(dir, "work")
+		},
+		commit: func(t *testing.T, work, file string) {
+			testRun(t, work, "svn", "add", "-q", file)
+			testRun(t, work, "svn", "commit", "-q", "-m", file)
+			testRun(t, work, "svn", "update", "-q")
+		},
+	},
+}
+
+func testRun(t *testing.T, dir, name string, args ...string) {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "BZR_EMAIL=gopher <gopher@example.com>")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%s %v: %v\n%s", name, args, err, out)
+	}
+}
+
+// makeRepo makes a repository with two revisions and returns
+// the repository and the revisions.
+func makeRepo(t *testing.T, r testRepo, dir string) (repo string, revs []string) {
+	repo, work := r.create(t, dir)
+	for _, file := range []string{"a.go", "b.go"} {
+		if err := ioutil.WriteFile(filepath.Join(work, file), []byte("package lib\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		r.commit(t, work, file)
+		rev, err := r.vcs.revision(work)
+		if err != nil {
+			t.Fatal(err)
+		}
+		revs = append(revs, rev)
+	}
+	if revs[0] == revs[1] {
+		t.Fatalf("both commits are revision %s", revs[0])
+	}
+	return repo, revs
+}
+
+func TestPinnedDownload(t *testing.T) {
+	defer func(pins *pinFile, valid bool) { thePins, thePinsValid = pins, valid }(thePins, thePinsValid)
+
+	for _, r := range testRepos {
+		if _, err := exec.LookPath(r.vcs.cmd); err != nil {
+			t.Logf("skipping %s: %v", r.vcs, err)
+			continue
+		}
+		dir, err := ioutil.TempDir("", "gopin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		repo, revs := makeRepo(t, r, dir)
+
+		// Download the first revision, then switch to the second.
+		gopath := filepath.Join(dir, "gopath")
+		p := &Package{ImportPath: "example.com/lib", t: &build.Tree{Path: gopath}}
+		root := filepath.Join(gopath, "src", "example.com", "lib")
+		for _, rev := range revs {
+			thePins = &pinFile{file: "go.pin", pins: []*pin{{"example.com/lib", r.vcs, rev, repo}}}
+			thePinsValid = true
+			downloadRootCache = map[string]bool{}
+			if err := downloadPackage(p); err != nil {
+				t.Fatalf("%s: %v", r.vcs, err)
+			}
+			if got, err := r.vcs.revision(root); got != rev || err != nil {
+				t.Errorf("%s: downloaded revision %s, %v, want %s", r.vcs, got, err, rev)
+			}
+			p.Dir = root
+			if err := checkPin(p); err != nil {
+				t.Errorf("%s: %v", r.vcs, err)
+			}
+
+			v, dir, err := vcsForDir(filepath.Join(gopath, "src"), root)
+			if v != r.vcs || dir != root || err != nil {
+				t.Errorf("vcsForDir = %v, %s, %v, want %v, %s", v, dir, err, r.vcs, root)
+			}
+		}
+
+		// A checkout at another revision does not match the pin.
+		thePins.pins[0].rev = revs[0]
+		delete(pinnedRevs, root)
+		if err := checkPin(p); err == nil {
+			t.Errorf("%s: checkout at %s matches pin of %s", r.vcs, revs[1], revs[0])
+		}
+	}
+}
@@ -22,16 +22,18 @@ type Package struct {
 	// Note: These fields are part of the go command's public API.
 	// See list.go.  It is okay to add fields, but not to change or
 	// remove existing ones.  Keep in sync with list.go
-	ImportPath string        // import path of package in dir
-	Name       string        `json:",omitempty"` // package name
-	Doc        string        `json:",omitempty"` // package documentation string
-	Dir        string        `json:",omitempty"` // directory containing package sources
-	Target     string        `json:",omitempty"` // install path
-	Version    string        `json:",omitempty"` // version of installed package (TODO)
-	Standard   bool          `json:",omitempty"` // is this package part of the standard Go library?
-	Stale      bool          `json:",omitempty"` // would 'go install' do anything for this package?
-	Incomplete bool          `json:",omitempty"` // was there an error loading this package or dependencies?
-	Error      *PackageError `json:",omitempty"` // error loading this package (not dependencies)
+	ImportPath  string        // import path of package in dir
+	Name        string        `json:",omitempty"` // package name
+	Doc         string        `json:",omitempty"` // package documentation string
+	Dir         string        `json:",omitempty"` // directory containing package sources
+	Target      string        `json:",omitempty"` // install path
+	Version     string        `json:",omitempty"` // version of installed package (TODO)
+	Standard    bool          `json:",omitempty"` // is this package part of the standard Go library?
+	Vendored    bool          `json:",omitempty"` // was this package found in a vendor directory?
+	Stale       bool          `json:",omitempty"` // would 'go install' do anything for this package?
+	StaleReason string        `json:",omitempty"` // why is Stale true?
+	Incomplete  bool          `json:",omitempty"` // was there an error loading this package or dependencies?
+	Error       *PackageError `json:",omitempty"` // error loading this package (not dependencies)
 
 	// Source files
 	GoFiles      []string `json:",omitempty"` // .go source files (excluding CgoFiles, TestGoFiles and XTestGoFiles)
@@ -41,13 +43,17 @@ type Package struct {
 	HFiles       []string `json:",omitempty"` // .h source files
 	SFiles       []string `json:",omitempty"` // .s source files
 	CgoFiles     []string `json:",omitempty"` // .go sources files that import "C"
+	SysoFiles    []string `json:",omitempty"` // .syso object files to add to archive
 	CgoCFLAGS    []string `json:",omitempty"` // cgo: flags for C compiler
 	CgoLDFLAGS   []string `json:",omitempty"` // cgo: flags for linker
 
 	// Dependency information
-	Imports    []string        `json:",omitempty"` // import paths used by this package
-	Deps       []string        `json:",omitempty"` // all (recursively) imported dependencies
-	DepsErrors []*PackageError `json:",omitempty"` // errors loading dependencies
+	Imports     []string          `json:",omitempty"` // import paths used by this package
+	ImportDirs  map[string]string `json:",omitempty"` // directory of each imported package, by import path
+	Deps        []string          `json:",omitempty"` // all (recursively) imported dependencies
+	DepsErrors  []*PackageError   `json:",omitempty"` // errors loading dependencies
+	TestImports []string          `json:",omitempty"` // import paths used by TestGoFiles and XTestGoFiles
+	TestDeps    []string          `json:",omitempty"` // Deps plus the dependencies of the tests (go list only)
 
 	// Unexported fields are not part of the public API.
 	t       *build.Tree
@@ -58,6 +64,9 @@ type Package struct {
 	gofiles []string // GoFiles+CgoFiles+TestGoFiles+XTestGoFiles files, absolute paths
 	target  string   // installed file for this package (may be executable)
 	fake    bool     // synthesized package
+
+	coverMode string               // preprocess Go source files with the coverage tool in this mode
+	coverVars map[string]*CoverVar // variables created by coverage analysis
 }
 
 // A PackageError describes an error loading information about a package.
@@ -138,7 +147,7 @@ func loadPackage(arg string, stk *importStack) *Package {
 
 	// Find basic information about package path.
 	isCmd := false
-	t, importPath, err := build.FindTree(arg)
+	t, importPath, err := buildContext.FindTree(arg)
 	dir := ""
 	// Maybe it is a standard command.
 	if err != nil && strings.HasPrefix(arg, "cmd/") {
@@ -179,13 +188,22 @@ func loadPackage(arg string, stk *importStack) *Package {
 	}
 
 	if dir == "" {
-		dir = filepath.Join(t.SrcDir(), filepath.FromSlash(importPath))
+		dir = t.PkgSrcDir(importPath)
+	}
+
+	// A package named by its directory in a vendor tree
+	// is the vendored package, with the import path its
+	// importers use.
+	if vendored := unvendoredPath(importPath); vendored != "" && !isCmd {
+		importPath = vendored
 	}
 
 	// Maybe we know the package by its directory.
 	p := packageCache[dir]
 	if p != nil {
-		packageCache[importPath] = p
+		if !p.Vendored {
+			packageCache[importPath] = p
+		}
 		p = reusePackage(p, stk)
 	} else {
 		p = scanPackage(&buildContext, t, arg, importPath, dir, stk, false)
@@ -202,6 +220,82 @@ func loadPackage(arg string, stk *importStack) *Package {
 	return p
 }
 
+// loadImport is like loadPackage but resolves the import path path
+// as imported by the package parent.  A package in a vendor directory
+// takes precedence over GOROOT and GOPATH: the nearest directory
+// vendor/path in the directory of parent or one of its ancestors,
+// up to but not including the source directory of its tree
+// (including it for a project tree, whose root is a package).
+func loadImport(path string, parent *Package, stk *importStack) *Package {
+	dir := vendoredDir(parent, path)
+	if dir == "" {
+		if vendored := unvendoredPath(path); vendored != "" {
+			stk.push(path)
+			defer stk.pop()
+			return &Package{
+				ImportPath: path,
+				Error: &PackageError{
+					ImportStack: stk.copy(),
+					Err:         fmt.Sprintf("vendored package must be imported as %q", vendored),
+				},
+				Incomplete: true,
+			}
+		}
+		return loadPackage(path, stk)
+	}
+
+	stk.push(path)
+	defer stk.pop()
+	if p := packageCache[dir]; p != nil {
+		return reusePackage(p, stk)
+	}
+	return scanPackage(&buildContext, parent.t, path, path, dir, stk, false)
+}
+
+// vendoredDir returns the directory of the vendored package that
+// path names when imported by parent, or "" if there is none.
+func vendoredDir(parent *Package, path string) string {
+	if parent.t == nil || parent.Standard || parent.Dir == "" || isLocalPath(path) {
+		return ""
+	}
+	src := parent.t.SrcDir()
+	if parent.t.Prefix == "" {
+		src += string(filepath.Separator)
+	}
+	for d := parent.Dir; strings.HasPrefix(d, src); d = filepath.Dir(d) {
+		if filepath.Base(d) == "vendor" {
+			continue
+		}
+		dir := filepath.Join(d, "vendor", filepath.FromSlash(path))
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			return dir
+		}
+	}
+	return ""
+}
+
+// unvendoredPath returns the import path of the vendored package
+// named by the import path of its directory, such as "x/y" for
+// "example.com/proj/vendor/x/y", or "" if path is not in a vendor tree.
+func unvendoredPath(path string) string {
+	i := strings.LastIndex("/"+path, "/vendor/")
+	if i <= 0 {
+		return ""
+	}
+	return path[i+len("vendor/"):]
+}
+
+// vendorPrefix returns the import path of the vendor directory
+// holding the package importPath found in dir, such as
+// "example.com/proj/vendor", or "" if the package is not vendored.
+func vendorPrefix(t *build.Tree, importPath, dir string) string {
+	rel, ok := t.ImportPath(dir)
+	if !ok || !strings.HasSuffix(rel, "/vendor/"+importPath) {
+		return ""
+	}
+	return rel[:len(rel)-len(importPath)-1]
+}
+
 func reusePackage(p *Package, stk *importStack) *Package {
 	// We use p.imports==nil to detect a package that
 	// is in the midst of its own loadPackage call
@@ -225,7 +319,9 @@ func reusePackage(p *Package, stk *importStack) *Package {
 // $GOROOT/bin/tool.
 var isGoTool = map[string]bool{
 	"cmd/api":      true,
+	"cmd/buildtag": true,
 	"cmd/cgo":      true,
+	"cmd/cover":    true,
 	"cmd/fix":      true,
 	"cmd/vet":      true,
 	"cmd/yacc":     true,
@@ -236,14 +332,20 @@ var isGoTool = map[string]bool{
 func scanPackage(ctxt *build.Context, t *build.Tree, arg, importPath, dir string, stk *importStack, useAllFiles bool) *Package {
 	// Read the files in the directory to learn the structure
 	// of the package.
+	vendor := vendorPrefix(t, importPath, dir)
 	p := &Package{
 		ImportPath: importPath,
 		Dir:        dir,
-		Standard:   t.Goroot && !strings.Contains(importPath, "."),
+		Standard:   t.Goroot && !strings.Contains(importPath, ".") && vendor == "",
+		Vendored:   vendor != "",
 		t:          t,
 	}
+	// A vendored package is known only by its directory:
+	// its import path names a different package elsewhere.
 	packageCache[dir] = p
-	packageCache[importPath] = p
+	if !p.Vendored {
+		packageCache[importPath] = p
+	}
 
 	ctxt.UseAllFiles = useAllFiles
 	info, err := ctxt.ScanDir(dir)
@@ -275,6 +377,7 @@ func scanPackage(ctxt *build.Context, t *build.Tree, arg, importPath, dir string
 	p.Name = info.Package
 	p.Doc = doc.Synopsis(info.PackageComment.Text())
 	p.Imports = info.Imports
+	p.TestImports = info.TestImports
 	p.GoFiles = info.GoFiles
 	p.TestGoFiles = info.TestGoFiles
 	p.XTestGoFiles = info.XTestGoFiles
@@ -282,6 +385,7 @@ func scanPackage(ctxt *build.Context, t *build.Tree, arg, importPath, dir string
 	p.HFiles = info.HFiles
 	p.SFiles = info.SFiles
 	p.CgoFiles = info.CgoFiles
+	p.SysoFiles = info.SysoFiles
 	p.CgoCFLAGS = info.CgoCFLAGS
 	p.CgoLDFLAGS = info.CgoLDFLAGS
 
@@ -301,11 +405,19 @@ func scanPackage(ctxt *build.Context, t *build.Tree, arg, importPath, dir string
 			p.target += ".exe"
 		}
 	} else {
-		dir := t.PkgDir()
+		dir := pkgDir(t)
 		// For gccgo, rewrite p.target with the expected library name.
 		if _, ok := buildToolchain.(gccgoToolchain); ok {
 			dir = filepath.Join(filepath.Dir(dir), "gccgo", filepath.Base(dir))
 		}
+		// Install a vendored package under the vendor directory's
+		// own import path, so that it cannot be confused with the
+		// package of the same import path elsewhere.  Its importers
+		// look for it there.
+		if p.Vendored {
+			dir = filepath.Join(dir, filepath.FromSlash(vendor))
+			p.pkgdir = dir
+		}
 		p.target = buildToolchain.pkgpath(dir, p)
 	}
 
@@ -337,6 +449,7 @@ func scanPackage(ctxt *build.Context, t *build.Tree, arg, importPath, dir string
 		p.HFiles,
 		p.SFiles,
 		p.CgoFiles,
+		p.SysoFiles,
 	}
 Stale:
 	for _, srcs := range srcss {
@@ -344,6 +457,14 @@ Stale:
 			if fi, err := os.Stat(filepath.Join(p.Dir, src)); err != nil || fi.ModTime().After(built) {
 				//println("STALE", p.ImportPath, "needs", src, err)
 				p.Stale = true
+				switch {
+				case built.IsZero():
+					p.StaleReason = "not installed"
+				case err != nil:
+					p.StaleReason = "missing source file " + src
+				default:
+					p.StaleReason = "newer source file " + src
+				}
 				break Stale
 			}
 		}
@@ -355,36 +476,60 @@ Stale:
 	if len(info.CgoFiles) > 0 && (!p.Standard || p.ImportPath != "runtime/cgo") {
 		importPaths = append(importPaths, "runtime/cgo")
 	}
+	// The cgo translation of a file imports syscall,
+	// except in runtime/cgo and runtime/race.
+	if len(info.CgoFiles) > 0 && (!p.Standard || p.ImportPath != "runtime/cgo" && p.ImportPath != "runtime/race") {
+		importPaths = append(importPaths, "syscall")
+	}
 	// Everything depends on runtime, except runtime and unsafe.
 	if !p.Standard || (p.ImportPath != "runtime" && p.ImportPath != "unsafe") {
 		importPaths = append(importPaths, "runtime")
+		// In race mode everything depends on runtime/race too,
+		// except runtime/race itself, runtime/cgo and cmd/cgo,
+		// which would form import cycles.
+		if buildRace && (!p.Standard || p.ImportPath != "runtime/race" && p.ImportPath != "runtime/cgo" && p.ImportPath != "cmd/cgo") {
+			importPaths = append(importPaths, "runtime/race")
+		}
 	}
 
 	// Record package under both import path and full directory name.
 	packageCache[dir] = p
-	packageCache[importPath] = p
+	if !p.Vendored {
+		packageCache[importPath] = p
+	}
 
 	// Build list of imported packages and full dependency list.
 	imports := make([]*Package, 0, len(p.Imports))
-	deps := make(map[string]bool)
-	for _, path := range importPaths {
+	deps := make(map[string]*Package)
+	for i, path := range importPaths {
 		if path == "C" {
 			continue
 		}
-		deps[path] = true
-		p1 := loadPackage(path, stk)
+		p1 := loadImport(path, p, stk)
 		if p1.Error != nil {
 			if info.ImportPos != nil && len(info.ImportPos[path]) > 0 {
 				pos := info.ImportPos[path][0]
 				p1.Error.Pos = pos.String()
 			}
 		}
+		// Record where the explicit imports were found;
+		// the implicit ones follow them in importPaths.
+		if i < len(p.Imports) && p1.Dir != "" {
+			if p.ImportDirs == nil {
+				p.ImportDirs = make(map[string]string)
+			}
+			p.ImportDirs[path] = p1.Dir
+		}
 		imports = append(imports, p1)
-		for _, dep := range p1.Deps {
-			deps[dep] = true
+		deps[p1.ImportPath] = p1
+		for _, dep := range p1.deps {
+			deps[dep.ImportPath] = dep
 		}
 		if p1.Stale {
 			p.Stale = true
+			if p.StaleReason == "" {
+				p.StaleReason = "stale dependency " + p1.ImportPath
+			}
 		}
 		if p1.Incomplete {
 			p.Incomplete = true
@@ -397,10 +542,20 @@ Stale:
 				//println("STALE", p.ImportPath, "needs", p1.target, err)
 				//println("BUILT", built.String(), "VS", fi.ModTime().String())
 				p.Stale = true
+				if p.StaleReason == "" {
+					p.StaleReason = "newer dependency " + p1.ImportPath
+				}
 			}
 		}
 	}
 	p.imports = imports
+	if err := importConflict(imports); err != nil && p.Error == nil {
+		p.Error = &PackageError{
+			ImportStack: stk.copy(),
+			Err:         err.Error(),
+		}
+		p.Incomplete = true
+	}
 
 	p.Deps = make([]string, 0, len(deps))
 	for dep := range deps {
@@ -408,10 +563,7 @@ Stale:
 	}
 	sort.Strings(p.Deps)
 	for _, dep := range p.Deps {
-		p1 := packageCache[dep]
-		if p1 == nil {
-			panic("impossible: missing entry in package cache for " + dep + " imported by " + p.ImportPath)
-		}
+		p1 := deps[dep]
 		p.deps = append(p.deps, p1)
 		if p1.Error != nil {
 			p.DepsErrors = append(p.DepsErrors, p1.Error)
@@ -421,9 +573,29 @@ Stale:
 	// unsafe is a fake package and is never out-of-date.
 	if p.Standard && p.ImportPath == "unsafe" {
 		p.Stale = false
+		p.StaleReason = ""
 		p.target = ""
 	}
 
+	// With a build cache holding an output for the package's current
+	// inputs, the package is stale unless its target is that output;
+	// the modification times above are then irrelevant.  A package
+	// installed without the cache, as make.bash installs the standard
+	// library, has no entry and keeps the verdict of the times.
+	if c := cache(); c != nil && p.target != "" {
+		if ok, cached := c.upToDate(buildID(p), p.target); cached {
+			p.Stale = !ok
+			switch {
+			case !p.Stale:
+				p.StaleReason = ""
+			case built.IsZero():
+				p.StaleReason = "not installed"
+			default:
+				p.StaleReason = "installed package not built from current inputs"
+			}
+		}
+	}
+
 	p.Target = p.target
 
 	return p
@@ -466,9 +638,43 @@ func packagesAndErrors(args []string) []*Package {
 	return pkgs
 }
 
+// packageList returns the packages in pkgs and all their
+// dependencies, each listed once.
+func packageList(pkgs []*Package) []*Package {
+	var all []*Package
+	seen := map[*Package]bool{}
+	add := func(p *Package) {
+		if !seen[p] {
+			seen[p] = true
+			all = append(all, p)
+		}
+	}
+	for _, p := range pkgs {
+		add(p)
+		for _, p1 := range p.deps {
+			add(p1)
+		}
+	}
+	return all
+}
+
+// importConflict returns an error if pkgs and their dependencies
+// include two packages with the same import path, which vendoring
+// allows but a program cannot hold.
+func importConflict(pkgs []*Package) error {
+	seen := map[string]*Package{}
+	for _, p := range packageList(pkgs) {
+		if old := seen[p.ImportPath]; old != nil {
+			return fmt.Errorf("import path %q names both %s and %s", p.ImportPath, old.Dir, p.Dir)
+		}
+		seen[p.ImportPath] = p
+	}
+	return nil
+}
+
 // packagesForBuild is like 'packages' but fails if any of
 // the packages or their dependencies have errors
-// (cannot be built).
+// (cannot be built) or do not match the pin file.
 func packagesForBuild(args []string) []*Package {
 	pkgs := packagesAndErrors(args)
 	printed := map[*PackageError]bool{}
@@ -488,5 +694,7 @@ func packagesForBuild(args []string) []*Package {
 		}
 	}
 	exitIfErrors()
+	checkPins(pkgs)
+	exitIfErrors()
 	return pkgs
 }
@@ -0,0 +1,102 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// projectTree lays out a project tree, outside any GOPATH,
+// whose root package imports a package of its own and a
+// vendored x/y.
+var projectTree = map[string]string{
+	"go.project":       "# a project\nexample.com/proj\n",
+	"main.go":          "package main\nimport _ \"example.com/proj/lib\"\n",
+	"lib/lib.go":       "package lib\nimport _ \"x/y\"\n",
+	"vendor/x/y/y.go":  "package y\n",
+	"lib/deep/deep.go": "package deep\n",
+}
+
+func TestProject(t *testing.T) {
+	root, err := ioutil.TempDir("", "goproject")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range projectTree {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The project is found from any directory inside it.
+	project, err := buildContext.FindProject(filepath.Join(root, "lib", "deep"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if project == nil || project.Path != root || project.Prefix != "example.com/proj" {
+		t.Fatalf("FindProject = %+v, want %s with prefix example.com/proj", project, root)
+	}
+	defer func(p *build.Tree) { buildContext.Project = p }(buildContext.Project)
+	buildContext.Project = project
+	defer func(cache map[string]*Package) { packageCache = cache }(packageCache)
+	packageCache = map[string]*Package{}
+
+	load := func(path string) *Package {
+		var stk importStack
+		return loadPackage(path, &stk)
+	}
+	dep := func(p *Package, path string) *Package {
+		for _, p1 := range p.deps {
+			if p1.ImportPath == path {
+				return p1
+			}
+		}
+		t.Fatalf("%s does not depend on %s", p.ImportPath, path)
+		return nil
+	}
+
+	// Import paths under the prefix resolve relative to the root.
+	p := load("example.com/proj")
+	if p.Error != nil {
+		t.Fatal(p.Error)
+	}
+	if p.Dir != root || p.target != filepath.Join(project.BinDir(), "proj") {
+		t.Errorf("example.com/proj in %s installing to %s, want %s installing to %s", p.Dir, p.target, root, project.BinDir())
+	}
+	lib := dep(p, "example.com/proj/lib")
+	if want := filepath.Join(root, "lib"); lib.Dir != want {
+		t.Errorf("example.com/proj/lib in %s, want %s", lib.Dir, want)
+	}
+	if want := filepath.Join(project.PkgDir(), "example.com", "proj", "lib.a"); lib.target != want {
+		t.Errorf("example.com/proj/lib installs to %s, want %s", lib.target, want)
+	}
+
+	// The root's vendor directory serves the whole project.
+	if y := dep(lib, "x/y"); !y.Vendored || y.Dir != filepath.Join(root, "vendor", "x", "y") {
+		t.Errorf("example.com/proj/lib: x/y in %s, vendored=%v", y.Dir, y.Vendored)
+	}
+
+	// A directory in the project names its package.
+	if p := load(filepath.Join(root, "lib", "deep")); p.ImportPath != "example.com/proj/lib/deep" {
+		t.Errorf("lib/deep has import path %q, want example.com/proj/lib/deep", p.ImportPath)
+	}
+
+	// A missing package under the prefix is not looked for elsewhere.
+	if p := load("example.com/proj/missing"); p.Error == nil {
+		t.Errorf("example.com/proj/missing loaded from %s", p.Dir)
+	}
+}
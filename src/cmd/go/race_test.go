@@ -0,0 +1,117 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"go/build"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// raceTree lays out a GOROOT with a race detector runtime.
+// runtime/race has Go files only when built with the race tag.
+var raceTree = map[string]string{
+	"src/pkg/runtime/runtime.go":                 "package runtime\n",
+	"src/pkg/runtime/race.c":                     "",
+	"src/pkg/runtime/race/race.go":               "// +build race\n\npackage race\n",
+	"src/pkg/runtime/race/race_GOOS_GOARCH.syso": "",
+	"src/pkg/errors/errors.go":                   "package errors\n",
+}
+
+func TestRaceInstallN(t *testing.T) {
+	goos, goarch := toolGOOS, toolGOARCH
+	if goarch != "amd64" || goos != "linux" && goos != "darwin" && goos != "windows" {
+		t.Skipf("-race is not supported on %s/%s", goos, goarch)
+	}
+	tree := map[string]string{}
+	for name, data := range raceTree {
+		tree[strings.Replace(name, "GOOS_GOARCH", goos+"_"+goarch, 1)] = data
+	}
+	dir := makeTree(t, tree)
+	defer os.RemoveAll(dir)
+
+	defer func(path []*build.Tree) { build.Path = path }(build.Path)
+	build.Path = []*build.Tree{{Path: dir, Goroot: true}}
+	defer func(dir string) { goroot = dir }(goroot)
+	goroot = dir
+	defer func(ctxt build.Context) { buildContext = ctxt }(buildContext)
+	buildContext.GOOS, buildContext.GOARCH = goos, goarch
+	buildContext.CgoEnabled = true
+	buildContext.BuildTags = nil
+	defer func(race, n bool) { buildRace, buildN = race, n }(buildRace, buildN)
+	buildRace, buildN = true, true
+	defer func(cache map[string]*Package) { packageCache = cache }(packageCache)
+	packageCache = map[string]*Package{}
+
+	stdout, _ := captureOutput(t, func() { runInstall(cmdInstall, []string{"errors"}) })
+
+	if tags := buildContext.BuildTags; len(tags) != 1 || tags[0] != "race" {
+		t.Errorf("go install -race set build tags %q, want [race]", tags)
+	}
+	lines := strings.Split(stdout, "\n")
+	// find returns the first line that contains all of substrs.
+	find := func(substrs ...string) string {
+	Lines:
+		for _, line := range lines {
+			for _, s := range substrs {
+				if !strings.Contains(line, s) {
+					continue Lines
+				}
+			}
+			return line
+		}
+		return ""
+	}
+	for _, pkg := range []string{"runtime", "runtime/race", "errors"} {
+		if find("g -o ", " -p "+pkg+" ", " -b ") == "" {
+			t.Errorf("go install -race does not compile %s with -b:\n%s", pkg, stdout)
+		}
+	}
+	if find("c -FVw ", " -DRACE ", "race.c") == "" {
+		t.Errorf("go install -race does not compile runtime C files with -DRACE:\n%s", stdout)
+	}
+	if find("race_"+goos+"_"+goarch+".syso") == "" {
+		t.Errorf("go install -race does not pack the race detector runtime:\n%s", stdout)
+	}
+	// go build -n writes $GOROOT for the root of the tree.
+	if find(filepath.Join("$GOROOT", "pkg", goos+"_"+goarch+"_race", "errors.a")) == "" {
+		t.Errorf("go install -race does not install errors into the race package directory:\n%s", stdout)
+	}
+	if find(filepath.Join("$GOROOT", "pkg", goos+"_"+goarch, "errors.a")) != "" {
+		t.Errorf("go install -race installs errors into the plain package directory:\n%s", stdout)
+	}
+	p := packageCache["errors"]
+	if p == nil {
+		t.Fatalf("errors was not loaded")
+	}
+	found := false
+	for _, dep := range p.imports {
+		if dep.ImportPath == "runtime/race" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("errors does not depend on runtime/race under -race")
+	}
+}
+
+func TestRaceTestFlag(t *testing.T) {
+	defer func(race bool) { buildRace = race }(buildRace)
+	buildRace = false
+	pkgs, pass := testFlags([]string{"-race", "errors", "-v"})
+	if !buildRace {
+		t.Errorf("go test -race does not set -race")
+	}
+	if len(pkgs) != 1 || pkgs[0] != "errors" {
+		t.Errorf("go test -race errors -v: packages %q, want [errors]", pkgs)
+	}
+	for _, arg := range pass {
+		if strings.Contains(arg, "race") {
+			t.Errorf("go test passes %q to the test binary", arg)
+		}
+	}
+}
@@ -12,13 +12,14 @@ import (
 )
 
 var cmdRun = &Command{
-	UsageLine: "run [-a] [-n] [-x] gofiles... [arguments...]",
+	UsageLine: "run [-a] [-n] [-race] [-x] gofiles... [arguments...]",
 	Short:     "compile and run Go program",
 	Long: `
 Run compiles and runs the main package comprising the named Go source files.
 
 The -a flag forces reinstallation of packages that are already up-to-date.
 The -n flag prints the commands but does not run them.
+The -race flag enables data race detection, as in 'go build'.
 The -x flag prints the commands.
 
 See also: go build.
@@ -30,6 +31,7 @@ func init() {
 
 	cmdRun.Flag.BoolVar(&buildA, "a", false, "")
 	cmdRun.Flag.BoolVar(&buildN, "n", false, "")
+	cmdRun.Flag.BoolVar(&buildRace, "race", false, "")
 	cmdRun.Flag.BoolVar(&buildX, "x", false, "")
 }
 
@@ -38,6 +40,7 @@ func printStderr(args ...interface{}) (int, error) {
 }
 
 func runRun(cmd *Command, args []string) {
+	raceInit()
 	var b builder
 	b.init()
 	b.print = printStderr
@@ -17,6 +17,7 @@ import (
 	"os/exec"
 	"path"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"sort"
 	"strings"
@@ -33,7 +34,7 @@ func init() {
 
 var cmdTest = &Command{
 	CustomFlags: true,
-	UsageLine:   "test [-c] [-i] [-p n] [-x] [importpath...] [flags for test binary]",
+	UsageLine:   "test [-c] [-i] [-cover] [-covermode mode] [-json] [-p n] [-race] [-x] [importpath...] [flags for test binary]",
 	Short:       "test packages",
 	Long: `
 'Go test' automates testing the packages named by the import paths.
@@ -64,10 +65,37 @@ The flags handled by 'go test' itself are:
 	    Install packages that are dependencies of the test.
 	    Do not run the test.
 
+	-cover
+	    Enable coverage analysis: rewrite the Go files of the package
+	    under test, but not its test files, with 'go tool cover' to
+	    count the statements that run, and report the percentage of
+	    statements covered after the tests pass or fail.
+
+	-covermode set,count,atomic
+	    Set the mode for coverage analysis for the package being tested.
+	    The default is "set".  Implies -cover.
+		set: bool: does this statement run?
+		count: int: how many times does this statement run?
+		atomic: int: count, but correct in multithreaded tests;
+			significantly more expensive.
+
+	-json
+	    Print the results as a stream of JSON events, one per line,
+	    in place of the summary and output: the events of each test
+	    binary, run with -test.json, with a Package field added, and
+	    an event with Action "pass", "fail" or "skip" and the elapsed
+	    time for each package.  Output of a test binary that isn't an
+	    event becomes an event with Action "output".  See the testing
+	    package for the fields of the events.
+
 	-p n
 	    Compile and test up to n packages in parallel.
 	    The default value is the number of CPUs available.
 
+	-race
+	    Enable data race detection.  The package, its dependencies
+	    and the test binary are built as with 'go build -race'.
+
 	-x  Print each subcommand go test executes.
 
 The test binary also accepts flags that control execution of the test; these
@@ -100,12 +128,29 @@ directory containing the package sources, has its own flags:
 	    Run benchmarks matching the regular expression.
 	    By default, no benchmarks run.
 
+	-test.benchmem
+	    Print memory allocation statistics for benchmarks: the bytes
+	    allocated and the number of allocations per iteration, counted
+	    while the benchmark timer runs.
+
+	-test.json
+	    Print a JSON event for each test that runs, passes or fails,
+	    each line of test output and each benchmark result, in place
+	    of the usual report.  See the testing package for the format.
+
+	-test.coverprofile cover.out
+	    Write a coverage profile to the specified file after all tests
+	    have passed or failed.  Under 'go test', it implies -cover and
+	    may be used for one package only.  See 'go tool cover' for
+	    reports on the profile.
+
 	-test.cpuprofile cpu.out
-	    Write a CPU profile to the specified file before exiting.
+	    Write a CPU profile of the tests and benchmarks that ran to the
+	    specified file before exiting, even if a test failed.
 
 	-test.memprofile mem.out
 	    Write a memory profile to the specified file when all tests
-	    are complete.
+	    and benchmarks are complete, even if a test failed.
 
 	-test.memprofilerate n
 	    Enable more precise (and expensive) memory profiles by setting
@@ -197,7 +242,11 @@ See the documentation of the testing package for more information.
 
 var (
 	testC            bool     // -c flag
+	testCover        bool     // -cover flag
+	testCoverMode    string   // -covermode flag
+	testCoverProfile bool     // -coverprofile flag
 	testI            bool     // -i flag
+	testJSON         bool     // -json flag
 	testP            int      // -p flag
 	testX            bool     // -x flag
 	testV            bool     // -v flag
@@ -215,6 +264,8 @@ func runTest(cmd *Command, args []string) {
 	var pkgArgs []string
 	pkgArgs, testArgs = testFlags(args)
 
+	raceInit()
+
 	pkgs := packagesForBuild(pkgArgs)
 	if len(pkgs) == 0 {
 		fatalf("no packages to test")
@@ -223,6 +274,12 @@ func runTest(cmd *Command, args []string) {
 	if testC && len(pkgs) != 1 {
 		fatalf("cannot use -c flag with multiple packages")
 	}
+	if testCoverProfile && len(pkgs) != 1 {
+		fatalf("cannot use -coverprofile flag with multiple packages")
+	}
+	if testCover && testCoverMode == "" {
+		testCoverMode = "set"
+	}
 
 	// If a test timeout was given and is parseable, set our kill timeout
 	// to that timeout plus one minute.  This is a backup alarm in case
@@ -235,7 +292,8 @@ func runTest(cmd *Command, args []string) {
 	// show passing test output (after buffering) with -v flag.
 	// must buffer because tests are running in parallel, and
 	// otherwise the output will get mixed.
-	testShowPass = testV
+	// The events of -json are all shown.
+	testShowPass = testV || testJSON
 
 	// stream test output (no buffering) when no package has
 	// been given on the command line (implicit current directory)
@@ -281,6 +339,10 @@ func runTest(cmd *Command, args []string) {
 				deps["cmd/cgo"] = true
 			}
 		}
+		// Dependency for the annotated package.
+		if testCoverMode == "atomic" {
+			deps["sync/atomic"] = true
+		}
 		// Ignore pseudo-packages.
 		delete(deps, "unsafe")
 
@@ -401,12 +463,15 @@ func (b *builder) test(p *Package) (buildAction, runAction, printAction *action,
 	var stk importStack
 	stk.push(p.ImportPath + "_test")
 	for _, path := range p.info.TestImports {
-		p1 := loadPackage(path, &stk)
+		p1 := loadImport(path, p, &stk)
 		if p1.Error != nil {
 			return nil, nil, nil, p1.Error
 		}
 		imports = append(imports, p1)
 	}
+	if err := importConflict(append([]*Package{p}, imports...)); err != nil {
+		return nil, nil, nil, &PackageError{ImportStack: stk.copy(), Err: err.Error()}
+	}
 	stk.pop()
 
 	// Use last element of import path, not package name.
@@ -436,12 +501,19 @@ func (b *builder) test(p *Package) (buildAction, runAction, printAction *action,
 	if err := b.mkdir(ptestDir); err != nil {
 		return nil, nil, nil, err
 	}
-	if err := writeTestmain(filepath.Join(testDir, "_testmain.go"), p); err != nil {
+	// With -cover, the package under test is compiled from annotated
+	// copies of its Go files, whose counters the test main reports.
+	var coverVars map[string]*CoverVar
+	if testCover {
+		coverVars = declareCoverVars(p.ImportPath, p.GoFiles...)
+	}
+
+	if err := writeTestmain(filepath.Join(testDir, "_testmain.go"), p, coverVars); err != nil {
 		return nil, nil, nil, err
 	}
 
 	// Test package.
-	if len(p.info.TestGoFiles) > 0 {
+	if len(p.info.TestGoFiles) > 0 || testCover {
 		ptest = new(Package)
 		*ptest = *p
 		ptest.GoFiles = nil
@@ -452,6 +524,17 @@ func (b *builder) test(p *Package) (buildAction, runAction, printAction *action,
 		ptest.imports = append(append([]*Package{}, p.imports...), imports...)
 		ptest.pkgdir = testDir
 		ptest.fake = true
+		if testCover {
+			ptest.coverMode = testCoverMode
+			ptest.coverVars = coverVars
+			if testCoverMode == "atomic" {
+				patomic := loadPackage("sync/atomic", &stk)
+				if patomic.Error != nil {
+					return nil, nil, nil, patomic.Error
+				}
+				ptest.imports = append(ptest.imports, patomic)
+			}
+		}
 		a := b.action(modeBuild, modeBuild, ptest)
 		a.objdir = testDir + string(filepath.Separator)
 		a.objpkg = ptestObj
@@ -561,7 +644,12 @@ func (b *builder) runTest(a *action) error {
 	if a.failed {
 		// We were unable to build the binary.
 		a.failed = false
-		fmt.Fprintf(a.testOutput, "FAIL\t%s [build failed]\n", a.p.ImportPath)
+		if testJSON {
+			writeTestEvent(a.testOutput, a.p.ImportPath, "output", "build failed\n", -1)
+			writeTestEvent(a.testOutput, a.p.ImportPath, "fail", "", 0)
+		} else {
+			fmt.Fprintf(a.testOutput, "FAIL\t%s [build failed]\n", a.p.ImportPath)
+		}
 		setExitStatus(1)
 		return nil
 	}
@@ -576,6 +664,12 @@ func (b *builder) runTest(a *action) error {
 		cmd.Stdout = &buf
 		cmd.Stderr = &buf
 	}
+	var jsonw *testJSONWriter
+	if testJSON {
+		jsonw = newTestJSONWriter(cmd.Stdout, a.p.ImportPath)
+		cmd.Stdout = jsonw
+		cmd.Stderr = jsonw
+	}
 
 	t0 := time.Now()
 	err := cmd.Start()
@@ -595,18 +689,33 @@ func (b *builder) runTest(a *action) error {
 		case <-tick.C:
 			cmd.Process.Kill()
 			err = <-done
-			fmt.Fprintf(&buf, "*** Test killed: ran too long.\n")
+			fmt.Fprintf(cmd.Stdout, "*** Test killed: ran too long.\n")
 		}
 		tick.Stop()
 	}
 	out := buf.Bytes()
 	t1 := time.Now()
+	if testJSON {
+		if err != nil && !testStreamOutput && len(out) == 0 {
+			fmt.Fprintf(jsonw, "%s\n", err)
+		}
+		jsonw.Close()
+		out = buf.Bytes()
+		a.testOutput.Write(out)
+		action := "pass"
+		if err != nil {
+			setExitStatus(1)
+			action = "fail"
+		}
+		writeTestEvent(a.testOutput, a.p.ImportPath, action, "", t1.Sub(t0))
+		return nil
+	}
 	t := fmt.Sprintf("%.3fs", t1.Sub(t0).Seconds())
 	if err == nil {
 		if testShowPass {
 			a.testOutput.Write(out)
 		}
-		fmt.Fprintf(a.testOutput, "ok  \t%s\t%s\n", a.p.ImportPath, t)
+		fmt.Fprintf(a.testOutput, "ok  \t%s\t%s%s\n", a.p.ImportPath, t, coveragePercentage(out))
 		return nil
 	}
 
@@ -622,6 +731,21 @@ func (b *builder) runTest(a *action) error {
 	return nil
 }
 
+var coverageRegexp = regexp.MustCompile(`(?m)^coverage: (.*)$`)
+
+// coveragePercentage returns, for the ok line of go test -cover, the
+// coverage that the test binary printed in its output, if any.
+func coveragePercentage(out []byte) string {
+	if !testCover {
+		return ""
+	}
+	m := coverageRegexp.FindSubmatch(out)
+	if m == nil {
+		return ""
+	}
+	return fmt.Sprintf("\tcoverage: %s", m[1])
+}
+
 // cleanTest is the action for cleaning up after a test.
 func (b *builder) cleanTest(a *action) error {
 	run := a.deps[0]
@@ -641,6 +765,10 @@ func (b *builder) printTest(a *action) error {
 
 // notest is the action for testing a package with no test files.
 func (b *builder) notest(a *action) error {
+	if testJSON {
+		writeTestEvent(os.Stdout, a.p.ImportPath, "skip", "no test files\n", -1)
+		return nil
+	}
 	fmt.Printf("?   \t%s\t[no test files]\n", a.p.ImportPath)
 	return nil
 }
@@ -659,12 +787,37 @@ func isTest(name, prefix string) bool {
 	return !unicode.IsLower(rune)
 }
 
+// CoverVar holds the name of the generated coverage variable of a
+// Go file of the package under test.
+type CoverVar struct {
+	File string // import path of the package joined with the file name
+	Var  string // name of the variable holding the counters
+}
+
+// declareCoverVars names the coverage variables of the named files of
+// the package with the given import path, for annotating the files.
+func declareCoverVars(importPath string, files ...string) map[string]*CoverVar {
+	coverVars := make(map[string]*CoverVar)
+	for i, file := range files {
+		coverVars[file] = &CoverVar{
+			File: path.Join(importPath, file),
+			Var:  fmt.Sprintf("GoCover_%d", i),
+		}
+	}
+	return coverVars
+}
+
 // writeTestmain writes the _testmain.go file for package p to
-// the file named out.
-func writeTestmain(out string, p *Package) error {
+// the file named out.  If coverVars is not nil, the package under
+// test is annotated for coverage and the test main reports it.
+func writeTestmain(out string, p *Package, coverVars map[string]*CoverVar) error {
 	t := &testFuncs{
-		Package: p,
-		Info:    p.info,
+		Package:   p,
+		Info:      p.info,
+		CoverVars: coverVars,
+	}
+	if coverVars != nil {
+		t.CoverMode = testCoverMode
 	}
 	for _, file := range p.info.TestGoFiles {
 		if err := t.load(filepath.Join(p.Dir, file), "_test", &t.NeedTest); err != nil {
@@ -698,6 +851,8 @@ type testFuncs struct {
 	Info       *build.DirInfo
 	NeedTest   bool
 	NeedXtest  bool
+	CoverMode  string               // coverage mode, if -cover is set
+	CoverVars  map[string]*CoverVar // coverage variables by file name
 }
 
 type testFunc struct {
@@ -755,6 +910,9 @@ import (
 {{if .NeedXtest}}
 	_xtest {{.Package.ImportPath | printf "%s_test" | printf "%q"}}
 {{end}}
+{{if .CoverVars}}
+	_cover {{.Package.ImportPath | printf "%q"}}
+{{end}}
 )
 
 var tests = []testing.InternalTest{
@@ -789,7 +947,51 @@ func matchString(pat, str string) (result bool, err error) {
 	return matchRe.MatchString(str), nil
 }
 
+{{if .CoverMode}}
+
+// Only updated by init functions, so no need for atomicity.
+var (
+	coverCounters = make(map[string][]uint32)
+	coverBlocks   = make(map[string][]testing.CoverBlock)
+)
+
+func init() {
+	{{range $file, $cover := .CoverVars}}
+	coverRegisterFile({{printf "%q" $cover.File}}, _cover.{{$cover.Var}}.Count[:], _cover.{{$cover.Var}}.Pos[:], _cover.{{$cover.Var}}.NumStmt[:])
+	{{end}}
+}
+
+func coverRegisterFile(fileName string, counter []uint32, pos []uint32, numStmts []uint16) {
+	if 3*len(counter) != len(pos) || len(counter) != len(numStmts) {
+		panic("coverage: mismatched sizes")
+	}
+	if coverCounters[fileName] != nil {
+		// Already registered.
+		return
+	}
+	coverCounters[fileName] = counter
+	block := make([]testing.CoverBlock, len(counter))
+	for i := range counter {
+		block[i] = testing.CoverBlock{
+			Line0: pos[3*i+0],
+			Col0:  uint16(pos[3*i+2]),
+			Line1: pos[3*i+1],
+			Col1:  uint16(pos[3*i+2] >> 16),
+			Stmts: numStmts[i],
+		}
+	}
+	coverBlocks[fileName] = block
+}
+{{end}}
+
 func main() {
+{{if .CoverMode}}
+	testing.RegisterCover(testing.Cover{
+		Mode:     {{printf "%q" .CoverMode}},
+		Counters: coverCounters,
+		Blocks:   coverBlocks,
+	})
+{{end}}
 	testing.Main(matchString, tests, benchmarks, examples)
 }
 
@@ -7,6 +7,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 )
@@ -18,15 +19,20 @@ import (
 
 var usageMessage = `Usage of go test:
   -c=false: compile but do not run the test binary
+  -cover=false: enable coverage analysis
+  -covermode="set": set the mode for coverage analysis: set, count, atomic; implies -cover
   -file=file_test.go: specify file to use for tests;
       use multiple times for multiple files
+  -json=false: print the results as JSON events; passes -test.json to test
   -p=n: build and test up to n packages in parallel
   -x=false: print command lines as they are executed
 
   // These flags can be passed with or without a "test." prefix: -v or -test.v.
   -bench="": passes -test.bench to test
+  -benchmem=false: passes -test.benchmem to test
   -benchtime=1: passes -test.benchtime to test
   -cpu="": passes -test.cpu to test
+  -coverprofile="": passes -test.coverprofile to test; implies -cover
   -cpuprofile="": passes -test.cpuprofile to test
   -memprofile="": passes -test.memprofile to test
   -memprofilerate=0: passes -test.memprofilerate to test
@@ -57,14 +63,20 @@ type testFlagSpec struct {
 var testFlagDefn = []*testFlagSpec{
 	// local.
 	{name: "c", isBool: true},
+	{name: "cover", isBool: true},
+	{name: "covermode"},
 	{name: "file", multiOK: true},
 	{name: "i", isBool: true},
+	{name: "json", isBool: true, passToTest: true},
 	{name: "p"},
+	{name: "race", isBool: true},
 	{name: "x", isBool: true},
 
 	// passed to 6.out, adding a "test." prefix to the name if necessary: -v becomes -test.v.
 	{name: "bench", passToTest: true},
+	{name: "benchmem", isBool: true, passToTest: true},
 	{name: "benchtime", passToTest: true},
+	{name: "coverprofile", passToTest: true},
 	{name: "cpu", passToTest: true},
 	{name: "cpuprofile", passToTest: true},
 	{name: "memprofile", passToTest: true},
@@ -120,10 +132,24 @@ func testFlags(args []string) (packageNames, passToTest []string) {
 		switch f.name {
 		case "c":
 			setBoolFlag(&testC, value)
+		case "cover":
+			setBoolFlag(&testCover, value)
+		case "covermode":
+			switch value {
+			case "set", "count", "atomic":
+				testCoverMode = value
+			default:
+				fatalf("invalid flag argument for -covermode: %q", value)
+			}
+			testCover = true
 		case "i":
 			setBoolFlag(&testI, value)
+		case "json":
+			setBoolFlag(&testJSON, value)
 		case "p":
 			setIntFlag(&testP, value)
+		case "race":
+			setBoolFlag(&buildRace, value)
 		case "x":
 			setBoolFlag(&testX, value)
 		case "v":
@@ -135,6 +161,15 @@ func testFlags(args []string) (packageNames, passToTest []string) {
 			testBench = true
 		case "timeout":
 			testTimeout = value
+		case "coverprofile":
+			// The test binary runs in the package directory,
+			// so make the file name relative to ours.
+			if !filepath.IsAbs(value) {
+				pwd, _ := os.Getwd()
+				value = filepath.Join(pwd, value)
+			}
+			testCover = true
+			testCoverProfile = true
 		}
 		if extraWord {
 			i++
@@ -0,0 +1,109 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// A testEvent is an event of go test -json: an event printed by a
+// test binary run with -test.json, with the package added, or one that
+// go test reports about the package itself.  See the testing package
+// for the meaning of the fields.
+type testEvent struct {
+	Time              string `json:",omitempty"`
+	Action            string
+	Package           string   `json:",omitempty"`
+	Test              string   `json:",omitempty"`
+	Elapsed           *float64 `json:",omitempty"`
+	Output            string   `json:",omitempty"`
+	N                 *int64   `json:",omitempty"`
+	NsPerOp           *int64   `json:",omitempty"`
+	MBPerSec          *float64 `json:",omitempty"`
+	AllocsPerOp       *int64   `json:",omitempty"`
+	AllocedBytesPerOp *int64   `json:",omitempty"`
+}
+
+// writeTestEvent writes a line of JSON for an event of package pkg
+// that go test reports itself.  If d is non-negative, it is the
+// elapsed time of the event.
+func writeTestEvent(w io.Writer, pkg, action, output string, d time.Duration) {
+	e := &testEvent{
+		Time:    time.Now().Format(time.RFC3339Nano),
+		Action:  action,
+		Package: pkg,
+		Output:  output,
+	}
+	if d >= 0 {
+		secs := float64(int64(d.Seconds()*1000)) / 1000
+		e.Elapsed = &secs
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		fatalf("go test: %v", err)
+	}
+	w.Write(append(b, '\n'))
+}
+
+// A testJSONWriter converts the output of a test binary run with
+// -test.json into the events of go test -json.  It adds the package to
+// the binary's events, drops the binary's final event, which go test
+// reports itself, and turns the lines that aren't events, such as
+// those the tests print themselves, into output events.
+type testJSONWriter struct {
+	w    io.Writer
+	pkg  string
+	line []byte // incomplete last line
+}
+
+func newTestJSONWriter(w io.Writer, pkg string) *testJSONWriter {
+	return &testJSONWriter{w: w, pkg: pkg}
+}
+
+func (t *testJSONWriter) Write(b []byte) (int, error) {
+	n := len(b)
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			t.line = append(t.line, b...)
+			break
+		}
+		t.line = append(t.line, b[:i+1]...)
+		t.convert(t.line)
+		t.line = t.line[:0]
+		b = b[i+1:]
+	}
+	return n, nil
+}
+
+// Close converts the incomplete last line, if any.
+func (t *testJSONWriter) Close() error {
+	if len(t.line) > 0 {
+		t.convert(append(t.line, '\n'))
+		t.line = t.line[:0]
+	}
+	return nil
+}
+
+// convert converts a line of output, ending in a newline.
+func (t *testJSONWriter) convert(line []byte) {
+	var e testEvent
+	if line[0] == '{' && json.Unmarshal(line, &e) == nil && e.Action != "" {
+		if e.Test == "" && (e.Action == "pass" || e.Action == "fail") {
+			return
+		}
+		e.Package = t.pkg
+		b, err := json.Marshal(&e)
+		if err != nil {
+			fatalf("go test: %v", err)
+		}
+		t.w.Write(append(b, '\n'))
+		return
+	}
+	writeTestEvent(t.w, t.pkg, "output", string(line), -1)
+}
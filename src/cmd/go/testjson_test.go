@@ -0,0 +1,60 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestTestJSONWriter(t *testing.T) {
+	out := `{"Time":"2012-01-01T00:00:00Z","Action":"run","Test":"TestA"}
+hello from TestA
+{"Time":"2012-01-01T00:00:00Z","Action":"pass","Test":"TestA","Elapsed":0.5}
+{not an event
+{"Time":"2012-01-01T00:00:00Z","Action":"pass","Elapsed":0.5}
+panic: oops`
+	var buf bytes.Buffer
+	w := newTestJSONWriter(&buf, "p")
+	// Write the output in pieces that split its lines.
+	for len(out) > 0 {
+		n := 7
+		if n > len(out) {
+			n = len(out)
+		}
+		if k, err := w.Write([]byte(out[:n])); k != n || err != nil {
+			t.Fatalf("Write = %d, %v, want %d, nil", k, err, n)
+		}
+		out = out[n:]
+	}
+	w.Close()
+
+	var got []string
+	for _, line := range strings.SplitAfter(buf.String(), "\n") {
+		if line == "" {
+			continue
+		}
+		var e testEvent
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("invalid event %q: %v", line, err)
+		}
+		if e.Package != "p" {
+			t.Errorf("event %q is not for package p", line)
+		}
+		got = append(got, e.Action+" "+e.Test+" "+e.Output)
+	}
+	want := []string{
+		"run TestA ",
+		"output  hello from TestA\n",
+		"pass TestA ",
+		"output  {not an event\n",
+		"output  panic: oops\n",
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("events:\n\t%q\nwant:\n\t%q", got, want)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strings"
 )
@@ -28,6 +29,9 @@ type vcsCmd struct {
 	tagSyncCmd     string   // command to sync to specific tag
 	tagSyncDefault string   // command to sync to default tag
 
+	revCmd     tagCmd // command to print the current revision
+	revSyncCmd string // command to sync to a specific revision
+
 	scheme  []string
 	pingCmd string
 }
@@ -78,6 +82,9 @@ var vcsHg = &vcsCmd{
 	tagSyncCmd:     "update -r {tag}",
 	tagSyncDefault: "update default",
 
+	revCmd:     tagCmd{"log -r . --template {node}", `^([0-9a-f]{40})$`},
+	revSyncCmd: "update -r {rev}",
+
 	scheme:  []string{"https", "http"},
 	pingCmd: "identify {scheme}://{repo}",
 }
@@ -101,6 +108,9 @@ var vcsGit = &vcsCmd{
 	tagSyncCmd:     "checkout {tag}",
 	tagSyncDefault: "checkout origin/master",
 
+	revCmd:     tagCmd{"rev-parse HEAD", `^([0-9a-f]{40})$`},
+	revSyncCmd: "checkout {rev}",
+
 	scheme:  []string{"git", "https", "http"},
 	pingCmd: "ls-remote {scheme}://{repo}",
 }
@@ -120,6 +130,11 @@ var vcsBzr = &vcsCmd{
 	tagSyncCmd:     "update -r {tag}",
 	tagSyncDefault: "update -r revno:-1",
 
+	// Revision numbers differ between branches;
+	// revision ids identify a revision everywhere.
+	revCmd:     tagCmd{"version-info --custom --template={revision_id}", `^(\S+)$`},
+	revSyncCmd: "update -r revid:{rev}",
+
 	scheme:  []string{"https", "http", "bzr"},
 	pingCmd: "info {scheme}://{repo}",
 }
@@ -135,6 +150,9 @@ var vcsSvn = &vcsCmd{
 	// There is no tag command in subversion.
 	// The branch information is all in the path names.
 
+	revCmd:     tagCmd{"info", `^Revision: ([0-9]+)$`},
+	revSyncCmd: "update -r {rev}",
+
 	scheme:  []string{"https", "http", "svn"},
 	pingCmd: "info {scheme}://{repo}",
 }
@@ -256,6 +274,57 @@ func (v *vcsCmd) tagSync(dir, tag string) error {
 	return v.run(dir, v.tagSyncCmd, "tag", tag)
 }
 
+// revision returns the revision that the repo in dir has checked out.
+func (v *vcsCmd) revision(dir string) (string, error) {
+	out, err := v.runOutput(dir, v.revCmd.cmd)
+	if err != nil {
+		return "", err
+	}
+	re := regexp.MustCompile(`(?m-s)` + v.revCmd.pattern)
+	m := re.FindStringSubmatch(strings.TrimSpace(string(out)))
+	if m == nil {
+		return "", fmt.Errorf("cannot find %s revision of %s", v.name, dir)
+	}
+	return m[1], nil
+}
+
+// revSync syncs the repo in dir to the given revision,
+// which must already have been downloaded.
+func (v *vcsCmd) revSync(dir, rev string) error {
+	return v.run(dir, v.revSyncCmd, "rev", rev)
+}
+
+// vcsForDir returns the version control system and the root directory
+// of the repository holding dir, which must be inside the source
+// directory src of a tree.
+func vcsForDir(src, dir string) (vcs *vcsCmd, root string, err error) {
+	for d := dir; strings.HasPrefix(d, src+string(filepath.Separator)); d = filepath.Dir(d) {
+		var found *vcsCmd
+		for _, v := range vcsList {
+			if fi, err := os.Stat(filepath.Join(d, "."+v.cmd)); err == nil && fi.IsDir() {
+				found = v
+				break
+			}
+		}
+		if found == nil {
+			if vcs != nil {
+				break
+			}
+			continue
+		}
+		vcs, root = found, d
+		// Subversion keeps metadata in every directory of a
+		// checkout, so keep looking for the top one.
+		if vcs != vcsSvn {
+			break
+		}
+	}
+	if vcs == nil {
+		return nil, "", fmt.Errorf("directory %s is not under version control", dir)
+	}
+	return vcs, root, nil
+}
+
 // A vcsPath describes how to convert an import path into a
 // version control system and repository name.
 type vcsPath struct {
@@ -0,0 +1,102 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// vendorTree lays out a GOPATH tree in which the project proj
+// vendors its own copy of x/y.
+var vendorTree = map[string]string{
+	"proj/main.go":          "package main\nimport _ \"x/y\"\n",
+	"proj/sub/sub.go":       "package sub\nimport _ \"x/y\"\n",
+	"proj/vendor/x/y/y.go":  "package y\nimport _ \"x/z\"\n",
+	"proj/vendor/x/z/z.go":  "package z\n",
+	"proj/mixed/mixed.go":   "package mixed\nimport (\n_ \"x/y\"\n_ \"other\"\n)\n",
+	"proj/direct/direct.go": "package direct\nimport _ \"proj/vendor/x/z\"\n",
+	"other/other.go":        "package other\nimport _ \"x/y\"\n",
+	"x/y/y.go":              "package y\n",
+}
+
+func TestVendor(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "govendor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+	for name, data := range vendorTree {
+		file := filepath.Join(gopath, "src", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func(path []*build.Tree) { build.Path = path }(build.Path)
+	build.Path = append(build.Path, &build.Tree{Path: gopath})
+	defer func(cache map[string]*Package) { packageCache = cache }(packageCache)
+	packageCache = map[string]*Package{}
+
+	src := filepath.Join(gopath, "src")
+	vendored := filepath.Join(src, "proj", "vendor", "x", "y")
+	load := func(path string) *Package {
+		var stk importStack
+		return loadPackage(path, &stk)
+	}
+	dep := func(p *Package, path string) *Package {
+		for _, p1 := range p.deps {
+			if p1.ImportPath == path {
+				return p1
+			}
+		}
+		t.Fatalf("%s does not depend on %s", p.ImportPath, path)
+		return nil
+	}
+
+	// Packages in the project and below use the vendored copy,
+	// which finds its own imports in the same vendor directory.
+	for _, path := range []string{"proj", "proj/sub"} {
+		p := load(path)
+		y := dep(p, "x/y")
+		if y.Dir != vendored || !y.Vendored {
+			t.Errorf("%s: x/y in %s, vendored=%v; want vendored in %s", path, y.Dir, y.Vendored, vendored)
+		}
+		if z := dep(p, "x/z"); !z.Vendored {
+			t.Errorf("%s: x/z in %s is not vendored", path, z.Dir)
+		}
+	}
+	y := dep(load("proj"), "x/y")
+	pkgdir := build.Path[len(build.Path)-1].PkgDir()
+	if want := filepath.Join(pkgdir, "proj", "vendor", "x", "y.a"); y.target != want {
+		t.Errorf("vendored x/y installs to %s, want %s", y.target, want)
+	}
+
+	// Other packages use the GOPATH copy.
+	if y := dep(load("other"), "x/y"); y.Dir != filepath.Join(src, "x", "y") || y.Vendored {
+		t.Errorf("other: x/y in %s, vendored=%v", y.Dir, y.Vendored)
+	}
+
+	// The directory of a vendored package names the vendored package.
+	if p := load("proj/vendor/x/y"); p != y {
+		t.Errorf("proj/vendor/x/y loaded %s from %s, want the vendored x/y", p.ImportPath, p.Dir)
+	}
+
+	// A program cannot hold both copies.
+	if p := load("proj/mixed"); p.Error == nil || !strings.Contains(p.Error.Err, `import path "x/y" names both`) {
+		t.Errorf("proj/mixed: error %v, want conflict for x/y", p.Error)
+	}
+
+	// Vendored packages cannot be imported by their directory's path.
+	if p := dep(load("proj/direct"), "proj/vendor/x/z"); p.Error == nil || !strings.Contains(p.Error.Err, `imported as "x/z"`) {
+		t.Errorf("proj/direct: importing vendor path: error %v", p.Error)
+	}
+}
@@ -389,9 +389,13 @@ func main() {
 	}
 	relpath := path
 	abspath := path
-	if t, pkg, err := build.FindTree(path); err == nil {
+	// Inside a project tree, its packages are found relative to its root,
+	// as the go command finds them.
+	ctxt := build.DefaultContext
+	ctxt.Project, _ = ctxt.FindProject(".") // ignore errors
+	if t, pkg, err := ctxt.FindTree(path); err == nil {
 		relpath = pkg
-		abspath = filepath.Join(t.SrcDir(), pkg)
+		abspath = t.PkgSrcDir(pkg)
 	} else if !filepath.IsAbs(path) {
 		abspath = absolutePath(path, pkgHandler.fsRoot)
 	} else {
@@ -23,6 +23,9 @@ Options new in this version:
 	Elide the dynamic linking header.  With this option, the binary
 	is statically linked and does not refer to dynld.  Without this option
 	(the default), the binary's contents are identical but it is loaded with dynld.
+-b
+	Link with the race detector runtime, using the packages
+	in $GOROOT/pkg/$GOOS_$GOARCH_race in place of $GOROOT/pkg/$GOOS_$GOARCH.
 -Hdarwin
 	Write Apple Mach-O binaries (default when $GOOS is darwin)
 -Hlinux
@@ -61,6 +61,8 @@ Lflag(char *arg)
 void
 libinit(void)
 {
+	char *suffix;
+
 	fmtinstall('i', iconv);
 	fmtinstall('Y', Yconv);
 	fmtinstall('Z', Zconv);
@@ -69,7 +71,11 @@ libinit(void)
 		print("goarch is not known: %s\n", goarch);
 
 	// add goroot to the end of the libdir list.
-	libdir[nlibdir++] = smprint("%s/pkg/%s_%s", goroot, goos, goarch);
+	// -b links against the packages built for race detection.
+	suffix = "";
+	if(debug['b'])
+		suffix = "_race";
+	libdir[nlibdir++] = smprint("%s/pkg/%s_%s%s", goroot, goos, goarch, suffix);
 
 	// Unix doesn't like it when we write to a running (or, sometimes,
 	// recently run) binary, so remove the output file before writing it.
@@ -270,6 +276,8 @@ loadlib(void)
 	loadinternal("runtime");
 	if(thechar == '5')
 		loadinternal("math");
+	if(debug['b'])
+		loadinternal("runtime/race");
 
 	for(i=0; i<libraryp; i++) {
 		if(debug['v'])
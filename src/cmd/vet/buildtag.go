@@ -0,0 +1,128 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains the check for build constraint lines.
+
+package main
+
+import (
+	"fmt"
+	"go/build"
+	"os"
+	"strings"
+)
+
+// maxTags limits the number of tags for which checkBuildTag
+// compares the //go:build and +build lines of a file.
+const maxTags = 12
+
+// checkBuildTag checks that the build constraint lines in the file
+// are well formed and that go/build honors them.  A file with both
+// forms must have equivalent lines.
+func (f *File) checkBuildTag(name string, data []byte) {
+	lines := strings.Split(string(data), "\n")
+
+	// Find the lines go/build reads, as its shouldBuild does.  It
+	// reads none unless the leading run of // comments and blank
+	// lines has a blank line in it, and then it reads them all.
+	body := 0 // first line that is not a // comment or blank
+	blank := false
+	for ; body < len(lines); body++ {
+		line := strings.TrimSpace(lines[body])
+		if line == "" {
+			blank = true
+		} else if !strings.HasPrefix(line, "//") {
+			break
+		}
+	}
+
+	if !blank {
+		for i, line := range lines[:body] {
+			if isConstraint(line) {
+				badLine(name, i, "build constraint must be followed by a blank line")
+			}
+		}
+		// Below the leading run, only line comments can be constraints.
+		for _, group := range f.file.Comments {
+			for _, c := range group.List {
+				if f.fset.Position(c.Pos()).Line > body && isConstraint(c.Text) {
+					f.Badf(c.Pos(), "misplaced build constraint: must appear before package clause")
+				}
+			}
+		}
+		return
+	}
+
+	var goBuild, plusBuild []string
+	for i, line := range lines {
+		if !isConstraint(line) {
+			continue
+		}
+		isGo := build.IsGoBuild(line)
+		if _, err := build.ParseConstraint(line); err != nil {
+			badLine(name, i, "malformed build constraint: %v", err)
+			continue
+		}
+		if isGo {
+			if len(goBuild) > 0 {
+				badLine(name, i, "more than one //go:build line")
+				continue
+			}
+			goBuild = append(goBuild, line)
+		} else {
+			plusBuild = append(plusBuild, line)
+		}
+	}
+
+	if len(goBuild) == 0 || len(plusBuild) == 0 {
+		return
+	}
+	x, err1 := build.ParseConstraint(goBuild...)
+	y, err2 := build.ParseConstraint(plusBuild...)
+	if err1 != nil || err2 != nil {
+		return
+	}
+	if !equivalent(x, y) {
+		fmt.Fprintf(os.Stderr, "%s: +build lines do not match //go:build line %s\n", name, x)
+		setExit(1)
+	}
+}
+
+func isConstraint(line string) bool {
+	return build.IsGoBuild(line) || build.IsPlusBuild(line)
+}
+
+// badLine reports an error on the line with the given index.
+func badLine(name string, i int, format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "%s:%d: %s\n", name, i+1, fmt.Sprintf(format, args...))
+	setExit(1)
+}
+
+// equivalent reports whether x and y agree for every assignment of
+// truth values to the tags they use.  It gives them the benefit of
+// the doubt if there are too many tags to try.
+func equivalent(x, y build.Constraint) bool {
+	tags := build.Tags(x)
+	for _, tag := range build.Tags(y) {
+		tags = append(tags, tag)
+	}
+	if len(tags) > maxTags {
+		return true
+	}
+	for bits := 0; bits < 1<<uint(len(tags)); bits++ {
+		ok := func(tag string) bool {
+			for i, t := range tags {
+				if t == tag {
+					return bits&(1<<uint(i)) != 0
+				}
+			}
+			return false
+		}
+		if x.Eval(ok) != y.Eval(ok) {
+			return false
+		}
+	}
+	return true
+}
+
@@ -16,6 +16,12 @@ If the function name ends with an 'f', the function is assumed to take
 a format descriptor string in the manner of fmt.Printf. If not, vet
 complains about arguments that look like format descriptor strings.
 
+It also checks the build constraint lines described in the documentation
+of package go/build.  It reports // +build and //go:build lines that are
+malformed, that go/build would ignore because they come after the package
+clause or are not followed by a blank line, and +build lines that do not
+match the file's //go:build line.
+
 Usage:
 
 	go tool vet [flag] [file.go ...]
@@ -14,6 +14,7 @@ import (
 	"go/parser"
 	"go/token"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -91,13 +92,25 @@ func main() {
 // doFile analyzes one file.  If the reader is nil, the source code is read from the
 // named file.
 func doFile(name string, reader io.Reader) {
+	var data []byte
+	var err error
+	if reader == nil {
+		data, err = ioutil.ReadFile(name)
+	} else {
+		data, err = ioutil.ReadAll(reader)
+	}
+	if err != nil {
+		errorf("%s: %s", name, err)
+		return
+	}
 	fs := token.NewFileSet()
-	parsedFile, err := parser.ParseFile(fs, name, reader, 0)
+	parsedFile, err := parser.ParseFile(fs, name, data, parser.ParseComments)
 	if err != nil {
 		errorf("%s: %s", name, err)
 		return
 	}
 	file := &File{fset: fs, file: parsedFile}
+	file.checkBuildTag(name, data)
 	file.walkFile(name, parsedFile)
 }
 
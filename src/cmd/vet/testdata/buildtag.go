@@ -0,0 +1,14 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+// +build vet_test // ERROR "must be followed by a blank line"
+// This file contains tests for the buildtag checker.  The leading
+// comments have no blank line after them, so go/build ignores every
+// build constraint in the file.
+package testdata
+
+// +build ignore // ERROR "misplaced build constraint"
+
+/*
+// +build inside a block comment is not a constraint
+*/
@@ -12,16 +12,26 @@ import (
 	"fmt"
 	"reflect"
 	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
 )
 
 // subsetTypeArgs takes a slice of arguments from callers of the sql
 // package and converts them into a slice of the driver package's
-// "subset types".
-func subsetTypeArgs(args []interface{}) ([]driver.Value, error) {
-	out := make([]driver.Value, len(args))
+// "subset types", keeping the names of NamedArg arguments.
+func subsetTypeArgs(args []interface{}) ([]driver.NamedValue, error) {
+	out := make([]driver.NamedValue, len(args))
 	for n, arg := range args {
+		nv := &out[n]
+		nv.Ordinal = n + 1
 		var err error
-		out[n], err = driver.DefaultParameterConverter.ConvertValue(arg)
+		nv.Name, arg, err = namedArg(arg)
+		if err != nil {
+			return nil, err
+		}
+		nv.Value, err = driver.DefaultParameterConverter.ConvertValue(arg)
 		if err != nil {
 			return nil, fmt.Errorf("sql: converting argument #%d's type: %v", n+1, err)
 		}
@@ -29,6 +39,35 @@ func subsetTypeArgs(args []interface{}) ([]driver.Value, error) {
 	return out, nil
 }
 
+// namedArg returns the name and value of arg if it's a NamedArg, and
+// arg itself otherwise.
+func namedArg(arg interface{}) (name string, value interface{}, err error) {
+	na, ok := arg.(NamedArg)
+	if !ok {
+		return "", arg, nil
+	}
+	r, _ := utf8.DecodeRuneInString(na.Name)
+	if !unicode.IsLetter(r) {
+		return "", nil, fmt.Errorf("sql: name %q does not begin with a letter", na.Name)
+	}
+	return na.Name, na.Value, nil
+}
+
+var errNamedUnsupported = errors.New("sql: driver does not support named parameters")
+
+// positionalArgs returns the values of args for a driver that doesn't
+// support named parameters, failing if any of them has a name.
+func positionalArgs(args []driver.NamedValue) ([]driver.Value, error) {
+	out := make([]driver.Value, len(args))
+	for n, nv := range args {
+		if nv.Name != "" {
+			return nil, errNamedUnsupported
+		}
+		out[n] = nv.Value
+	}
+	return out, nil
+}
+
 // convertAssign copies to dest the value in src, converting it if possible.
 // An error is returned if the copy would result in loss of information.
 // dest should be a pointer type.
@@ -156,3 +195,151 @@ func asString(src interface{}) string {
 	}
 	return fmt.Sprintf("%v", src)
 }
+
+// A structField is a field of a struct that a column can be scanned
+// into.
+type structField struct {
+	index []int // for fieldByIndex, through embedded structs
+}
+
+var (
+	structFieldsLock  sync.RWMutex
+	structFieldsCache = make(map[reflect.Type]map[string]*structField)
+)
+
+// structFields returns the fields of struct type t by lower-cased
+// column name.  A nil field means the name is ambiguous.
+func structFields(t reflect.Type) map[string]*structField {
+	structFieldsLock.RLock()
+	fields, ok := structFieldsCache[t]
+	structFieldsLock.RUnlock()
+	if ok {
+		return fields
+	}
+
+	fields = newStructFields(t)
+	structFieldsLock.Lock()
+	structFieldsCache[t] = fields
+	structFieldsLock.Unlock()
+	return fields
+}
+
+var scannerType = reflect.TypeOf((*Scanner)(nil)).Elem()
+
+func newStructFields(t reflect.Type) map[string]*structField {
+	type candidate struct {
+		f      *structField
+		depth  int
+		tagged bool
+	}
+	byName := make(map[string][]candidate)
+	onPath := make(map[reflect.Type]bool) // guards against recursive embedding
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		onPath[t] = true
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if sf.PkgPath != "" && (!sf.Anonymous || sf.Type.Kind() != reflect.Struct) {
+				// Only the fields of an unexported embedded
+				// struct are settable.
+				continue
+			}
+			tag := sf.Tag.Get("db")
+			if tag == "-" {
+				continue
+			}
+			fi := make([]int, len(index)+1)
+			copy(fi, index)
+			fi[len(index)] = i
+
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			// Embedded structs contribute their fields, unless
+			// they scan a column themselves.
+			if sf.Anonymous && tag == "" && ft.Kind() == reflect.Struct && !reflect.PtrTo(ft).Implements(scannerType) {
+				if !onPath[ft] {
+					walk(ft, fi)
+				}
+				continue
+			}
+			if sf.PkgPath != "" {
+				continue
+			}
+			name := tag
+			if name == "" {
+				name = sf.Name
+			}
+			key := strings.ToLower(name)
+			byName[key] = append(byName[key], candidate{&structField{fi}, len(index), tag != ""})
+		}
+		delete(onPath, t)
+	}
+	walk(t, nil)
+
+	// As with Go's embedded fields, the shallowest field of a name
+	// wins; at equal depth, a tagged field wins over untagged ones.
+	fields := make(map[string]*structField)
+	for key, cands := range byName {
+		var best []candidate
+		for _, c := range cands {
+			switch {
+			case len(best) == 0 || c.depth < best[0].depth:
+				best = []candidate{c}
+			case c.depth == best[0].depth:
+				best = append(best, c)
+			}
+		}
+		var dominant *structField
+		for _, c := range best {
+			if len(best) == 1 || c.tagged {
+				if dominant != nil {
+					dominant = nil
+					break
+				}
+				dominant = c.f
+			}
+		}
+		fields[key] = dominant
+	}
+	return fields
+}
+
+// fieldByIndex returns the field of struct v at index, allocating the
+// nil pointers to embedded structs on the way.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// structDest returns pointers to the fields of the struct that dest
+// points to, in the order of cols.
+func structDest(dest interface{}, cols []string) ([]interface{}, error) {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("sql: ScanStruct destination %T is not a non-nil pointer to a struct", dest)
+	}
+	v = v.Elem()
+	fields := structFields(v.Type())
+	ptrs := make([]interface{}, len(cols))
+	for i, col := range cols {
+		f, ok := fields[strings.ToLower(col)]
+		if !ok {
+			return nil, fmt.Errorf("sql: column %q has no matching field in %v", col, v.Type())
+		}
+		if f == nil {
+			return nil, fmt.Errorf("sql: column %q matches several fields in %v", col, v.Type())
+		}
+		ptrs[i] = fieldByIndex(v, f.index).Addr().Interface()
+	}
+	return ptrs, nil
+}
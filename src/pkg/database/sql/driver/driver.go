@@ -8,7 +8,10 @@
 // Most code should use package sql.
 package driver
 
-import "errors"
+import (
+	"errors"
+	"reflect"
+)
 
 // A driver Value is a value that drivers must be able to handle.
 // A Value is either nil or an instance of one of these types:
@@ -21,6 +24,20 @@ import "errors"
 //   time.Time
 type Value interface{}
 
+// NamedValue holds an argument along with its name, if it was passed
+// as a named parameter, and its position.
+type NamedValue struct {
+	// Name is the name of the parameter, or empty if the argument
+	// is positional.
+	Name string
+
+	// Ordinal is the position of the argument, starting from one.
+	Ordinal int
+
+	// Value is the argument value.
+	Value Value
+}
+
 // Driver is the interface that must be implemented by a database
 // driver.
 type Driver interface {
@@ -43,6 +60,28 @@ type Driver interface {
 // documented.
 var ErrSkip = errors.New("driver: skip fast-path; continue as if unimplemented")
 
+// ErrBadConn should be returned by a driver to signal to the sql
+// package that a driver.Conn is in a bad state (such as the server
+// having earlier closed the connection) and the sql package should
+// retry on a new connection.
+//
+// To prevent duplicate operations, ErrBadConn should NOT be returned
+// if there's a possibility that the database server might have
+// performed the operation. Even if the server sends back an error,
+// you shouldn't return ErrBadConn.
+var ErrBadConn = errors.New("driver: bad connection")
+
+// Pinger is an optional interface that may be implemented by a Conn.
+//
+// If a Conn does not implement Pinger, the sql package's DB.Ping
+// only checks that a connection can be obtained.
+//
+// If Ping returns ErrBadConn, DB.Ping removes the Conn from the pool
+// and retries on another one.
+type Pinger interface {
+	Ping() error
+}
+
 // Execer is an optional interface that may be implemented by a Conn.
 //
 // If a Conn does not implement Execer, the db package's DB.Exec will
@@ -54,8 +93,65 @@ type Execer interface {
 	Exec(query string, args []Value) (Result, error)
 }
 
+// ExecerCancel is an optional interface that may be implemented by a
+// Conn.  It is like Execer, but ExecCancel should abandon the query and
+// return promptly once done is closed.
+//
+// ExecCancel may return ErrSkip.
+type ExecerCancel interface {
+	ExecCancel(done <-chan struct{}, query string, args []Value) (Result, error)
+}
+
+// ExecerNamed is an optional interface that may be implemented by a
+// Conn.  It is like ExecerCancel, but receives the arguments with
+// their names, which drivers that support named parameters bind to
+// the parameters of the query.  Done may be nil.
+//
+// If a Conn doesn't implement ExecerNamed and its statements don't
+// implement StmtNamed, the sql package rejects named arguments.
+//
+// ExecNamed may return ErrSkip.
+type ExecerNamed interface {
+	ExecNamed(done <-chan struct{}, query string, args []NamedValue) (Result, error)
+}
+
+// IsolationLevel is the transaction isolation level stored in
+// TxOptions.  Its values are those of the sql package's
+// IsolationLevel.
+type IsolationLevel int
+
+// TxOptions holds the options of a transaction.
+type TxOptions struct {
+	Isolation IsolationLevel
+	ReadOnly  bool
+}
+
+// ConnBeginTx is an optional interface that may be implemented by a
+// Conn.  It is like ConnBeginCanceler, but also receives the options
+// of the transaction; done may be nil.  If the driver doesn't support
+// the isolation level or read-only mode asked for, BeginTx must
+// return an error rather than start a transaction with other
+// properties.  An isolation level of zero means the driver's default.
+//
+// If a Conn doesn't implement ConnBeginTx, the sql package fails to
+// begin transactions with non-default options.
+type ConnBeginTx interface {
+	BeginTx(done <-chan struct{}, opts TxOptions) (Tx, error)
+}
+
+// ConnBeginCanceler is an optional interface that may be implemented by
+// a Conn.  It is like Begin, but once done is closed the driver should
+// abandon any operation in progress in the transaction, after which the
+// sql package rolls the transaction back.
+type ConnBeginCanceler interface {
+	BeginCancel(done <-chan struct{}) (Tx, error)
+}
+
 // Conn is a connection to a database. It is not used concurrently
-// by multiple goroutines.
+// by multiple goroutines, with one exception: to abandon an operation
+// on a Conn that doesn't implement the cancellation interfaces
+// (ExecerCancel, ConnBeginCanceler and StmtCanceler), the sql package
+// calls Close from another goroutine while the operation is running.
 //
 // Conn is assumed to be stateful.
 type Conn interface {
@@ -70,6 +166,9 @@ type Conn interface {
 	// connections and only calls Close when there's a surplus of
 	// idle connections, it shouldn't be necessary for drivers to
 	// do their own connection caching.
+	//
+	// Close may interrupt an operation in progress, which should
+	// then return an error promptly.
 	Close() error
 
 	// Begin starts and returns a new transaction.
@@ -132,6 +231,24 @@ type Stmt interface {
 	Query(args []Value) (Rows, error)
 }
 
+// StmtCanceler is an optional interface that may be implemented by a
+// Stmt.  Its methods are like Exec and Query, but should abandon the
+// query and return promptly once done is closed.  Closing done also
+// abandons the Rows returned by QueryCancel: a Next in progress or
+// called later should return an error.
+type StmtCanceler interface {
+	ExecCancel(done <-chan struct{}, args []Value) (Result, error)
+	QueryCancel(done <-chan struct{}, args []Value) (Rows, error)
+}
+
+// StmtNamed is an optional interface that may be implemented by a
+// Stmt.  Its methods are like those of StmtCanceler, but receive the
+// arguments with their names; done may be nil.
+type StmtNamed interface {
+	ExecNamed(done <-chan struct{}, args []NamedValue) (Result, error)
+	QueryNamed(done <-chan struct{}, args []NamedValue) (Rows, error)
+}
+
 // ColumnConverter may be optionally implemented by Stmt if the
 // the statement is aware of its own columns' types and can
 // convert from any type to a driver Value.
@@ -166,6 +283,65 @@ type Rows interface {
 	Next(dest []Value) error
 }
 
+// RowsNextResultSet is an optional interface that may be implemented by
+// Rows that hold several result sets, such as those of a batch of
+// queries or of a stored procedure.
+type RowsNextResultSet interface {
+	Rows
+
+	// HasNextResultSet is called at the end of the current result
+	// set and reports whether there is another one after it.
+	HasNextResultSet() bool
+
+	// NextResultSet advances to the next result set, after which
+	// Columns and Next describe and return its rows.  It should
+	// return io.EOF when there are no more result sets.
+	NextResultSet() error
+}
+
+// RowsColumnTypeScanType may be implemented by Rows.  It returns the
+// Go type that can hold the values of the column at index, such as
+// reflect.TypeOf(int64(0)).
+type RowsColumnTypeScanType interface {
+	Rows
+	ColumnTypeScanType(index int) reflect.Type
+}
+
+// RowsColumnTypeDatabaseTypeName may be implemented by Rows.  It
+// returns the database system's name for the type of the column at
+// index, in upper case, without its length: "VARCHAR", "INT",
+// "DECIMAL".
+type RowsColumnTypeDatabaseTypeName interface {
+	Rows
+	ColumnTypeDatabaseTypeName(index int) string
+}
+
+// RowsColumnTypeLength may be implemented by Rows.  It returns the
+// length of the column at index if its type has one: the maximum
+// length of a variable length text or binary type, which is
+// math.MaxInt64 if the type is unbounded.  Ok is false for types
+// without a length, such as numbers.
+type RowsColumnTypeLength interface {
+	Rows
+	ColumnTypeLength(index int) (length int64, ok bool)
+}
+
+// RowsColumnTypeNullable may be implemented by Rows.  Nullable reports
+// whether the column at index may hold NULL; ok is false if that isn't
+// known.
+type RowsColumnTypeNullable interface {
+	Rows
+	ColumnTypeNullable(index int) (nullable, ok bool)
+}
+
+// RowsColumnTypePrecisionScale may be implemented by Rows.  It returns
+// the precision and scale of the decimal type of the column at index;
+// ok is false for other types.
+type RowsColumnTypePrecisionScale interface {
+	Rows
+	ColumnTypePrecisionScale(index int) (precision, scale int64, ok bool)
+}
+
 // Tx is a transaction.
 type Tx interface {
 	Commit() error
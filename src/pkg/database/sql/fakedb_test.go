@@ -10,6 +10,8 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
@@ -30,6 +32,13 @@ var _ = log.Printf
 //     where types are: "string", [u]int{8,16,32,64}, "bool"
 //   INSERT|<tablename>|col=val,col2=val2,col3=?
 //   SELECT|<tablename>|projectcol1,projectcol2|filtercol=?,filtercol2=?
+//     where a placeholder ?name binds the argument named name, if
+//     the connection supports named parameters
+//   WAIT|<duration>
+//     sleeps for the duration, or until the connection is closed
+//
+// Several SELECTs separated by semicolons make one statement whose
+// rows have a result set for each.
 //
 // When opening a a fakeDriver's database, it starts empty with no
 // tables.  All tables and data are stored in memory only.
@@ -77,13 +86,29 @@ type fakeConn struct {
 	db *fakeDB // where to return ourselves to
 
 	currTx *fakeTx
+	txDone <-chan struct{} // from BeginCancel; abandons WAITs in the transaction
+
+	closedc chan struct{} // closed by Close
 
 	// Stats for tests:
 	mu          sync.Mutex
+	closed      bool
 	stmtsMade   int
 	stmtsClosed int
 }
 
+// fakeOptConn is a connection opened with the "opt" option.  It
+// implements the driver's optional interfaces for cancellation,
+// transaction options and named parameters, so that the sql package
+// doesn't have to close it to abandon a WAIT.
+type fakeOptConn struct {
+	*fakeConn
+}
+
+type fakeOptStmt struct {
+	*fakeStmt
+}
+
 func (c *fakeConn) incrStat(v *int) {
 	c.mu.Lock()
 	*v++
@@ -91,7 +116,8 @@ func (c *fakeConn) incrStat(v *int) {
 }
 
 type fakeTx struct {
-	c *fakeConn
+	c        *fakeConn
+	readOnly bool
 }
 
 type fakeStmt struct {
@@ -108,20 +134,37 @@ type fakeStmt struct {
 	colValue     []interface{} // used by INSERT (mix of strings and "?" for bound params)
 	placeholders int           // used by INSERT/SELECT: number of ? params
 
+	placeholderNames []string // used by INSERT/SELECT: names of ? params, or empty
+
 	whereCol []string // used by SELECT (all placeholders)
 
 	placeholderConverter []driver.ValueConverter // used by INSERT
+
+	waitFor time.Duration // used by WAIT
+
+	next *fakeStmt // next SELECT of a statement with several result sets
 }
 
 var fdriver driver.Driver = &fakeDriver{}
 
+// Hooks for tests to make a connection report driver.ErrBadConn.
+// They are called with no locks held.
+var (
+	hookPrepareBadConn func() bool
+	hookPingBadConn    func() bool
+)
+
+// hookCommit, if set, is called by a transaction's Commit before it
+// commits.
+var hookCommit func()
+
 func init() {
 	Register("test", fdriver)
 }
 
 // Supports dsn forms:
 //    <dbname>
-//    <dbname>;<opts>  (no currently supported options)
+//    <dbname>;<opts>  (opts: "opt", for a fakeOptConn)
 func (d *fakeDriver) Open(dsn string) (driver.Conn, error) {
 	parts := strings.Split(dsn, ";")
 	if len(parts) < 1 {
@@ -134,7 +177,16 @@ func (d *fakeDriver) Open(dsn string) (driver.Conn, error) {
 	d.mu.Lock()
 	d.openCount++
 	d.mu.Unlock()
-	return &fakeConn{db: db}, nil
+	c := &fakeConn{db: db, closedc: make(chan struct{})}
+	for _, opt := range parts[1:] {
+		switch opt {
+		case "opt":
+			return fakeOptConn{c}, nil
+		default:
+			return nil, fmt.Errorf("fakedb: unknown option %q", opt)
+		}
+	}
+	return c, nil
 }
 
 func (d *fakeDriver) getDB(name string) *fakeDB {
@@ -198,6 +250,19 @@ func (db *fakeDB) columnType(table, column string) (typ string, ok bool) {
 	return "", false
 }
 
+func (d *fakeDriver) opened() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.openCount
+}
+
+func (c *fakeConn) Ping() error {
+	if hookPingBadConn != nil && hookPingBadConn() {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
 func (c *fakeConn) Begin() (driver.Tx, error) {
 	if c.currTx != nil {
 		return nil, errors.New("already in a transaction")
@@ -207,16 +272,22 @@ func (c *fakeConn) Begin() (driver.Tx, error) {
 }
 
 func (c *fakeConn) Close() error {
-	if c.currTx != nil {
-		return errors.New("can't close; in a Transaction")
-	}
-	if c.db == nil {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
 		return errors.New("can't close; already closed")
 	}
-	c.db = nil
+	c.closed = true
+	close(c.closedc)
 	return nil
 }
 
+func (c *fakeConn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
 func checkSubsetTypes(args []driver.Value) error {
 	for n, arg := range args {
 		switch arg.(type) {
@@ -266,12 +337,13 @@ func (c *fakeConn) prepareSelect(stmt *fakeStmt, parts []string) (driver.Stmt, e
 		if !ok {
 			return nil, errf("SELECT on table %q references non-existent column %q", stmt.table, column)
 		}
-		if value != "?" {
+		if !strings.HasPrefix(value, "?") {
 			return nil, errf("SELECT on table %q has pre-bound value for where column %q; need a question mark",
 				stmt.table, column)
 		}
 		stmt.whereCol = append(stmt.whereCol, column)
 		stmt.placeholders++
+		stmt.placeholderNames = append(stmt.placeholderNames, value[1:])
 	}
 	return stmt, nil
 }
@@ -311,7 +383,7 @@ func (c *fakeConn) prepareInsert(stmt *fakeStmt, parts []string) (driver.Stmt, e
 		}
 		stmt.colName = append(stmt.colName, column)
 
-		if value != "?" {
+		if !strings.HasPrefix(value, "?") {
 			var subsetVal interface{}
 			// Convert to driver subset type
 			switch ctype {
@@ -331,6 +403,7 @@ func (c *fakeConn) prepareInsert(stmt *fakeStmt, parts []string) (driver.Stmt, e
 			stmt.colValue = append(stmt.colValue, subsetVal)
 		} else {
 			stmt.placeholders++
+			stmt.placeholderNames = append(stmt.placeholderNames, value[1:])
 			stmt.placeholderConverter = append(stmt.placeholderConverter, converterForType(ctype))
 			stmt.colValue = append(stmt.colValue, "?")
 		}
@@ -338,9 +411,34 @@ func (c *fakeConn) prepareInsert(stmt *fakeStmt, parts []string) (driver.Stmt, e
 	return stmt, nil
 }
 
+// prepareSets prepares a statement with a result set for the SELECT
+// first and one for each of the SELECTs in rest.
+func (c *fakeConn) prepareSets(first, rest string) (driver.Stmt, error) {
+	si, err := c.Prepare(first)
+	if err != nil {
+		return nil, err
+	}
+	stmt := si.(*fakeStmt)
+	if stmt.cmd != "SELECT" {
+		return nil, errf("%s in a statement with several result sets", stmt.cmd)
+	}
+	next, err := c.Prepare(rest)
+	if err != nil {
+		return nil, err
+	}
+	stmt.next = next.(*fakeStmt)
+	return stmt, nil
+}
+
 func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
-	if c.db == nil {
-		panic("nil c.db; conn = " + fmt.Sprintf("%#v", c))
+	if c.isClosed() {
+		panic("closed conn; conn = " + fmt.Sprintf("%#v", c))
+	}
+	if hookPrepareBadConn != nil && hookPrepareBadConn() {
+		return nil, driver.ErrBadConn
+	}
+	if i := strings.Index(query, ";"); i >= 0 {
+		return c.prepareSets(query[:i], query[i+1:])
 	}
 	parts := strings.Split(query, "|")
 	if len(parts) < 1 {
@@ -359,6 +457,15 @@ func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
 		return c.prepareCreate(stmt, parts)
 	case "INSERT":
 		return c.prepareInsert(stmt, parts)
+	case "WAIT":
+		if len(parts) != 1 {
+			return nil, errf("invalid WAIT syntax with %d parts; want 1", len(parts))
+		}
+		d, err := time.ParseDuration(parts[0])
+		if err != nil {
+			return nil, errf("invalid WAIT duration %q", parts[0])
+		}
+		stmt.waitFor = d
 	default:
 		return nil, errf("unsupported command type %q", cmd)
 	}
@@ -370,6 +477,9 @@ func (s *fakeStmt) ColumnConverter(idx int) driver.ValueConverter {
 }
 
 func (s *fakeStmt) Close() error {
+	if s.next != nil {
+		s.next.Close()
+	}
 	if !s.closed {
 		s.c.incrStat(&s.c.stmtsClosed)
 		s.closed = true
@@ -388,6 +498,10 @@ func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
 		return nil, err
 	}
 
+	if tx := s.c.currTx; tx != nil && tx.readOnly && s.cmd != "WAIT" {
+		return nil, errf("%s in a read-only transaction", s.cmd)
+	}
+
 	db := s.c.db
 	switch s.cmd {
 	case "WIPE":
@@ -400,6 +514,11 @@ func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
 		return driver.ResultNoRows, nil
 	case "INSERT":
 		return s.execInsert(args)
+	case "WAIT":
+		if err := s.wait(nil); err != nil {
+			return nil, err
+		}
+		return driver.ResultNoRows, nil
 	}
 	fmt.Printf("EXEC statement, cmd=%q: %#v\n", s.cmd, s)
 	return nil, fmt.Errorf("unimplemented statement Exec command type of %q", s.cmd)
@@ -450,11 +569,27 @@ func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
 		return nil, err
 	}
 
+	if s.cmd == "WAIT" {
+		if err := s.wait(nil); err != nil {
+			return nil, err
+		}
+		return &rowsCursor{pos: -1}, nil
+	}
+
 	db := s.c.db
-	if len(args) != s.placeholders {
+	if len(args) != s.NumInput() {
 		panic("error in pkg db; should only get here if size is correct")
 	}
 
+	var next *rowsCursor
+	if s.next != nil {
+		nrows, err := s.next.Query(args[s.placeholders:])
+		if err != nil {
+			return nil, err
+		}
+		next = nrows.(*rowsCursor)
+	}
+
 	db.mu.Lock()
 	t, ok := db.table(s.table)
 	db.mu.Unlock()
@@ -465,12 +600,14 @@ func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
 	defer t.mu.Unlock()
 
 	colIdx := make(map[string]int) // select column name -> column index in table
+	var colType []string
 	for _, name := range s.colName {
 		idx := t.columnIndex(name)
 		if idx == -1 {
 			return nil, fmt.Errorf("fakedb: unknown column name %q", name)
 		}
 		colIdx[name] = idx
+		colType = append(colType, t.coltype[idx])
 	}
 
 	mrows := []*row{}
@@ -501,32 +638,156 @@ rows:
 	}
 
 	cursor := &rowsCursor{
-		pos:  -1,
-		rows: mrows,
-		cols: s.colName,
+		pos:     -1,
+		rows:    mrows,
+		cols:    s.colName,
+		colType: colType,
+		next:    next,
 	}
 	return cursor, nil
 }
 
+// wait runs a WAIT statement, which ends early with an error if the
+// connection is closed or if done or the transaction's done channel is
+// closed.
+func (s *fakeStmt) wait(done <-chan struct{}) error {
+	select {
+	case <-time.After(s.waitFor):
+		return nil
+	case <-s.c.closedc:
+		return errors.New("fakedb: connection closed")
+	case <-done:
+	case <-s.c.txDone:
+	}
+	return errors.New("fakedb: canceled")
+}
+
 func (s *fakeStmt) NumInput() int {
+	if s.next != nil {
+		return s.placeholders + s.next.NumInput()
+	}
 	return s.placeholders
 }
 
+func (c fakeOptConn) Prepare(query string) (driver.Stmt, error) {
+	si, err := c.fakeConn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return fakeOptStmt{si.(*fakeStmt)}, nil
+}
+
+func (c fakeOptConn) BeginTx(done <-chan struct{}, opts driver.TxOptions) (driver.Tx, error) {
+	switch IsolationLevel(opts.Isolation) {
+	case LevelDefault, LevelReadCommitted, LevelSerializable:
+	default:
+		return nil, errf("isolation level %v not supported", IsolationLevel(opts.Isolation))
+	}
+	tx, err := c.Begin()
+	if err == nil {
+		c.txDone = done
+		c.currTx.readOnly = opts.ReadOnly
+	}
+	return tx, err
+}
+
+func (c fakeOptConn) ExecNamed(done <-chan struct{}, query string, args []driver.NamedValue) (driver.Result, error) {
+	// As with Exec, prepare the query instead.
+	return nil, driver.ErrSkip
+}
+
+// bind returns the arguments in the order of the statement's
+// placeholders, matching named placeholders by name.
+func (s *fakeStmt) bind(nargs []driver.NamedValue) ([]driver.Value, error) {
+	var names []string
+	for t := s; t != nil; t = t.next {
+		names = append(names, t.placeholderNames...)
+	}
+	if len(nargs) != len(names) {
+		return nil, errf("got %d arguments for %d placeholders", len(nargs), len(names))
+	}
+	args := make([]driver.Value, len(names))
+	for i, name := range names {
+		if name == "" {
+			if nargs[i].Name != "" {
+				return nil, errf("named argument %q for positional placeholder %d", nargs[i].Name, i+1)
+			}
+			args[i] = nargs[i].Value
+			continue
+		}
+		found := false
+		for _, nv := range nargs {
+			if nv.Name == name {
+				args[i], found = nv.Value, true
+				break
+			}
+		}
+		if !found {
+			return nil, errf("no argument for parameter %q", name)
+		}
+	}
+	return args, nil
+}
+
+func (s fakeOptStmt) ExecNamed(done <-chan struct{}, nargs []driver.NamedValue) (driver.Result, error) {
+	args, err := s.bind(nargs)
+	if err != nil {
+		return nil, err
+	}
+	return s.ExecCancel(done, args)
+}
+
+func (s fakeOptStmt) QueryNamed(done <-chan struct{}, nargs []driver.NamedValue) (driver.Rows, error) {
+	args, err := s.bind(nargs)
+	if err != nil {
+		return nil, err
+	}
+	return s.QueryCancel(done, args)
+}
+
+func (s fakeOptStmt) ExecCancel(done <-chan struct{}, args []driver.Value) (driver.Result, error) {
+	if s.cmd != "WAIT" {
+		return s.Exec(args)
+	}
+	if err := s.wait(done); err != nil {
+		return nil, err
+	}
+	return driver.ResultNoRows, nil
+}
+
+func (s fakeOptStmt) QueryCancel(done <-chan struct{}, args []driver.Value) (driver.Rows, error) {
+	if s.cmd != "WAIT" {
+		return s.Query(args)
+	}
+	if err := s.wait(done); err != nil {
+		return nil, err
+	}
+	return &rowsCursor{pos: -1}, nil
+}
+
 func (tx *fakeTx) Commit() error {
+	if hookCommit != nil {
+		hookCommit()
+	}
 	tx.c.currTx = nil
+	tx.c.txDone = nil
 	return nil
 }
 
 func (tx *fakeTx) Rollback() error {
 	tx.c.currTx = nil
+	tx.c.txDone = nil
 	return nil
 }
 
 type rowsCursor struct {
-	cols   []string
-	pos    int
-	rows   []*row
-	closed bool
+	cols    []string
+	colType []string
+	pos     int
+	rows    []*row
+	closed  bool
+
+	next *rowsCursor // the following result set, if any
 
 	// a clone of slices to give out to clients, indexed by the
 	// the original slice's first byte address.  we clone them
@@ -548,6 +809,41 @@ func (rc *rowsCursor) Columns() []string {
 	return rc.cols
 }
 
+func (rc *rowsCursor) HasNextResultSet() bool {
+	return rc.next != nil
+}
+
+func (rc *rowsCursor) NextResultSet() error {
+	if rc.next == nil {
+		return io.EOF
+	}
+	next := rc.next
+	rc.cols, rc.colType, rc.rows, rc.next = next.cols, next.colType, next.rows, next.next
+	rc.pos = -1
+	return nil
+}
+
+func (rc *rowsCursor) ColumnTypeScanType(index int) reflect.Type {
+	return scanTypeForType(rc.colType[index])
+}
+
+func (rc *rowsCursor) ColumnTypeDatabaseTypeName(index int) string {
+	return strings.ToUpper(rc.colType[index])
+}
+
+func (rc *rowsCursor) ColumnTypeLength(index int) (length int64, ok bool) {
+	switch rc.colType[index] {
+	case "string", "nullstring", "blob":
+		return math.MaxInt64, true
+	}
+	return 0, false
+}
+
+func (rc *rowsCursor) ColumnTypeNullable(index int) (nullable, ok bool) {
+	typ := rc.colType[index]
+	return typ == "blob" || typ == "datetime" || strings.HasPrefix(typ, "null"), true
+}
+
 func (rc *rowsCursor) Next(dest []driver.Value) error {
 	if rc.closed {
 		return errors.New("fakedb: cursor is closed")
@@ -581,6 +877,34 @@ func (rc *rowsCursor) Next(dest []driver.Value) error {
 	return nil
 }
 
+func scanTypeForType(typ string) reflect.Type {
+	switch typ {
+	case "bool":
+		return reflect.TypeOf(false)
+	case "nullbool":
+		return reflect.TypeOf(NullBool{})
+	case "int32":
+		return reflect.TypeOf(int32(0))
+	case "string":
+		return reflect.TypeOf("")
+	case "nullstring":
+		return reflect.TypeOf(NullString{})
+	case "int64":
+		return reflect.TypeOf(int64(0))
+	case "nullint64":
+		return reflect.TypeOf(NullInt64{})
+	case "float64":
+		return reflect.TypeOf(float64(0))
+	case "nullfloat64":
+		return reflect.TypeOf(NullFloat64{})
+	case "datetime":
+		return reflect.TypeOf(time.Time{})
+	case "blob":
+		return reflect.TypeOf([]byte(nil))
+	}
+	panic("invalid fakedb column type of " + typ)
+}
+
 func converterForType(typ string) driver.ValueConverter {
 	switch typ {
 	case "bool":
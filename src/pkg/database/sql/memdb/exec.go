@@ -0,0 +1,1001 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memdb
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// Column types.
+const (
+	typeInteger = iota
+	typeReal
+	typeText
+	typeBlob
+	typeBoolean
+	typeTimestamp
+)
+
+// typeNames maps the type names accepted by CREATE TABLE to column types.
+var typeNames = map[string]int{
+	"INTEGER":   typeInteger,
+	"INT":       typeInteger,
+	"BIGINT":    typeInteger,
+	"SMALLINT":  typeInteger,
+	"REAL":      typeReal,
+	"FLOAT":     typeReal,
+	"DOUBLE":    typeReal,
+	"TEXT":      typeText,
+	"VARCHAR":   typeText,
+	"CHAR":      typeText,
+	"BLOB":      typeBlob,
+	"BOOLEAN":   typeBoolean,
+	"BOOL":      typeBoolean,
+	"TIMESTAMP": typeTimestamp,
+	"DATETIME":  typeTimestamp,
+}
+
+// scanTypes are the Go types of the values of each column type.
+var scanTypes = []reflect.Type{
+	typeInteger:   reflect.TypeOf(int64(0)),
+	typeReal:      reflect.TypeOf(float64(0)),
+	typeText:      reflect.TypeOf(""),
+	typeBlob:      reflect.TypeOf([]byte(nil)),
+	typeBoolean:   reflect.TypeOf(false),
+	typeTimestamp: reflect.TypeOf(time.Time{}),
+}
+
+type column struct {
+	name       string
+	typ        int
+	typeName   string // as written in CREATE TABLE, upper-cased
+	notNull    bool
+	primaryKey bool
+}
+
+// A row is shared by a table and the undo log of the transaction that
+// last changed it, so its values are replaced rather than modified.
+type row struct {
+	vals []driver.Value
+}
+
+type table struct {
+	name string
+	cols []column
+	rows []*row
+}
+
+func (t *table) colIndex(name string) int {
+	for i, c := range t.cols {
+		if c.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t *table) removeRow(r *row) {
+	for i, r1 := range t.rows {
+		if r1 == r {
+			t.rows = append(t.rows[:i], t.rows[i+1:]...)
+			return
+		}
+	}
+}
+
+// A result is the outcome of a statement that returns no rows.
+type result struct {
+	lastInsertId int64
+	rowsAffected int64
+}
+
+func (r result) LastInsertId() (int64, error) { return r.lastInsertId, nil }
+func (r result) RowsAffected() (int64, error) { return r.rowsAffected, nil }
+
+// A resultSet is the outcome of a SELECT, computed in full.
+type resultSet struct {
+	cols  []string
+	types []*column // the column a result column comes from, or nil
+	rows  [][]driver.Value
+}
+
+// An undo reverts a change to db; the caller holds db.mu.
+type undo func(db *database)
+
+// execCtx is the state of the execution of one statement.
+type execCtx struct {
+	db   *database
+	args []driver.Value
+	log  *[]undo // the transaction's undo log, or nil
+}
+
+func (x *execCtx) logUndo(u undo) {
+	if x.log != nil {
+		*x.log = append(*x.log, u)
+	}
+}
+
+func (x *execCtx) table(name string) (*table, error) {
+	t := x.db.tables[name]
+	if t == nil {
+		return nil, fmt.Errorf("memdb: no such table %s", name)
+	}
+	return t, nil
+}
+
+// exec runs a statement that doesn't return rows.  The caller holds
+// x.db.mu for writing.
+func (x *execCtx) exec(stmt interface{}) (driver.Result, error) {
+	switch s := stmt.(type) {
+	case *createTable:
+		return x.createTable(s)
+	case *dropTable:
+		t := x.db.tables[s.table]
+		if t == nil {
+			if s.ifExists {
+				return result{}, nil
+			}
+			return nil, fmt.Errorf("memdb: no such table %s", s.table)
+		}
+		delete(x.db.tables, s.table)
+		x.logUndo(func(db *database) { db.tables[t.name] = t })
+		return result{}, nil
+	case *insert:
+		return x.insert(s)
+	case *update:
+		return x.update(s)
+	case *deleteStmt:
+		return x.delete(s)
+	case *selectStmt:
+		if _, err := x.query(s); err != nil {
+			return nil, err
+		}
+		return result{}, nil
+	}
+	panic(fmt.Sprintf("memdb: unknown statement %T", stmt))
+}
+
+func (x *execCtx) createTable(s *createTable) (driver.Result, error) {
+	if x.db.tables[s.table] != nil {
+		if s.ifNotExists {
+			return result{}, nil
+		}
+		return nil, fmt.Errorf("memdb: table %s already exists", s.table)
+	}
+	t := &table{name: s.table, cols: s.cols}
+	pk := false
+	for i, c := range t.cols {
+		if t.colIndex(c.name) != i {
+			return nil, fmt.Errorf("memdb: duplicate column %s in table %s", c.name, t.name)
+		}
+		if c.primaryKey {
+			if pk {
+				return nil, fmt.Errorf("memdb: table %s has more than one primary key", t.name)
+			}
+			pk = true
+		}
+	}
+	x.db.tables[t.name] = t
+	x.logUndo(func(db *database) {
+		if db.tables[t.name] == t {
+			delete(db.tables, t.name)
+		}
+	})
+	return result{}, nil
+}
+
+func (x *execCtx) insert(s *insert) (driver.Result, error) {
+	t, err := x.table(s.table)
+	if err != nil {
+		return nil, err
+	}
+	idx := make([]int, len(t.cols))
+	if s.cols == nil {
+		for i := range idx {
+			idx[i] = i
+		}
+	} else {
+		idx = idx[:0]
+		for _, name := range s.cols {
+			i := t.colIndex(name)
+			if i < 0 {
+				return nil, fmt.Errorf("memdb: table %s has no column %s", t.name, name)
+			}
+			idx = append(idx, i)
+		}
+	}
+	var res result
+	added := make([]*row, 0, len(s.rows))
+	fail := func(err error) (driver.Result, error) {
+		// Statements are atomic.
+		for _, r := range added {
+			t.removeRow(r)
+		}
+		return nil, err
+	}
+	for _, exprs := range s.rows {
+		if len(exprs) != len(idx) {
+			return fail(fmt.Errorf("memdb: %d values for %d columns", len(exprs), len(idx)))
+		}
+		r := &row{make([]driver.Value, len(t.cols))}
+		for i, e := range exprs {
+			v, err := x.eval(e, nil)
+			if err != nil {
+				return fail(err)
+			}
+			r.vals[idx[i]] = v
+		}
+		id, err := x.check(t, r.vals, nil)
+		if err != nil {
+			return fail(err)
+		}
+		if id != 0 {
+			res.lastInsertId = id
+		}
+		t.rows = append(t.rows, r)
+		added = append(added, r)
+		res.rowsAffected++
+	}
+	x.logUndo(func(db *database) {
+		for _, r := range added {
+			t.removeRow(r)
+		}
+	})
+	return res, nil
+}
+
+// check converts the values of a new or changed row to the types of the
+// columns of t and enforces the constraints, assigning the next value
+// of an INTEGER PRIMARY KEY if vals has none.  It returns the assigned
+// key, if any.  self is the row being changed, which is not a duplicate
+// of itself.
+func (x *execCtx) check(t *table, vals []driver.Value, self *row) (id int64, err error) {
+	for i, c := range t.cols {
+		if vals[i] == nil {
+			if c.primaryKey && c.typ == typeInteger {
+				var max int64
+				for _, r := range t.rows {
+					if n := r.vals[i].(int64); n > max {
+						max = n
+					}
+				}
+				vals[i] = max + 1
+				id = max + 1
+				continue
+			}
+			if c.notNull {
+				return 0, fmt.Errorf("memdb: NULL in NOT NULL column %s.%s", t.name, c.name)
+			}
+			continue
+		}
+		v, err := convert(vals[i], c.typ)
+		if err != nil {
+			return 0, fmt.Errorf("memdb: column %s.%s: %v", t.name, c.name, err)
+		}
+		vals[i] = v
+		if c.primaryKey {
+			for _, r := range t.rows {
+				if r != self && r.vals[i] != nil {
+					if n, err := compare(r.vals[i], v); err == nil && n == 0 {
+						return 0, fmt.Errorf("memdb: duplicate primary key %v in table %s", v, t.name)
+					}
+				}
+			}
+			if c.typ == typeInteger {
+				id = v.(int64)
+			}
+		}
+	}
+	return id, nil
+}
+
+// convert converts non-nil v to a value of column type typ.
+func convert(v driver.Value, typ int) (driver.Value, error) {
+	if b, ok := v.([]byte); ok && typ != typeBlob {
+		v = string(b)
+	}
+	switch typ {
+	case typeInteger:
+		switch v := v.(type) {
+		case int64:
+			return v, nil
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) < 1<<63 {
+				return int64(v), nil
+			}
+		case string:
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return n, nil
+			}
+		}
+	case typeReal:
+		switch v := v.(type) {
+		case int64:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		case string:
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return f, nil
+			}
+		}
+	case typeText:
+		if v, ok := v.(string); ok {
+			return v, nil
+		}
+	case typeBlob:
+		switch v := v.(type) {
+		case []byte:
+			return append([]byte(nil), v...), nil
+		case string:
+			return []byte(v), nil
+		}
+	case typeBoolean:
+		switch v := v.(type) {
+		case bool:
+			return v, nil
+		case int64:
+			if v == 0 || v == 1 {
+				return v == 1, nil
+			}
+		}
+	case typeTimestamp:
+		switch v := v.(type) {
+		case time.Time:
+			return v, nil
+		case string:
+			// The fractional second is optional.
+			if t, err := time.Parse(time.RFC3339, v); err == nil {
+				return t, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("cannot store %T value %v as %s", v, v, canonicalTypeNames[typ])
+}
+
+// canonicalTypeNames are the names of the column types in messages.
+var canonicalTypeNames = []string{
+	typeInteger:   "INTEGER",
+	typeReal:      "REAL",
+	typeText:      "TEXT",
+	typeBlob:      "BLOB",
+	typeBoolean:   "BOOLEAN",
+	typeTimestamp: "TIMESTAMP",
+}
+
+func (x *execCtx) update(s *update) (driver.Result, error) {
+	t, err := x.table(s.table)
+	if err != nil {
+		return nil, err
+	}
+	idx := make([]int, len(s.set))
+	for i, a := range s.set {
+		idx[i] = t.colIndex(a.col)
+		if idx[i] < 0 {
+			return nil, fmt.Errorf("memdb: table %s has no column %s", t.name, a.col)
+		}
+	}
+	// Compute all the new rows before changing any, so that a failed
+	// statement changes nothing.
+	var changed []*row
+	var newVals [][]driver.Value
+	for _, r := range t.rows {
+		ok, err := x.match(s.where, t, r.vals)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		vals := append([]driver.Value(nil), r.vals...)
+		for i, a := range s.set {
+			v, err := x.eval(a.x, &env{t: t, vals: r.vals})
+			if err != nil {
+				return nil, err
+			}
+			vals[idx[i]] = v
+		}
+		changed = append(changed, r)
+		newVals = append(newVals, vals)
+	}
+	old := make([][]driver.Value, len(changed))
+	for i, r := range changed {
+		old[i] = r.vals
+		if _, err := x.check(t, newVals[i], r); err != nil {
+			for j := 0; j < i; j++ {
+				changed[j].vals = old[j]
+			}
+			return nil, err
+		}
+		r.vals = newVals[i]
+	}
+	x.logUndo(func(db *database) {
+		for i, r := range changed {
+			r.vals = old[i]
+		}
+	})
+	return result{rowsAffected: int64(len(changed))}, nil
+}
+
+func (x *execCtx) delete(s *deleteStmt) (driver.Result, error) {
+	t, err := x.table(s.table)
+	if err != nil {
+		return nil, err
+	}
+	var kept, deleted []*row
+	for _, r := range t.rows {
+		ok, err := x.match(s.where, t, r.vals)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			deleted = append(deleted, r)
+		} else {
+			kept = append(kept, r)
+		}
+	}
+	t.rows = kept
+	x.logUndo(func(db *database) {
+		t.rows = append(t.rows, deleted...)
+	})
+	return result{rowsAffected: int64(len(deleted))}, nil
+}
+
+// match reports whether the row vals of t satisfies where, which may be
+// nil.
+func (x *execCtx) match(where expr, t *table, vals []driver.Value) (bool, error) {
+	if where == nil {
+		return true, nil
+	}
+	v, err := x.eval(where, &env{t: t, vals: vals})
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if v != nil && !ok {
+		return false, fmt.Errorf("memdb: WHERE condition is %T, not a boolean", v)
+	}
+	return b, nil
+}
+
+// query runs a SELECT.  The caller holds x.db.mu for reading.
+func (x *execCtx) query(s *selectStmt) (*resultSet, error) {
+	var t *table
+	if s.table != "" {
+		var err error
+		if t, err = x.table(s.table); err != nil {
+			return nil, err
+		}
+	}
+
+	rs := new(resultSet)
+	items := s.items
+	if items == nil {
+		for i := range t.cols {
+			items = append(items, selectItem{&columnRef{name: t.cols[i].name}, t.cols[i].name})
+		}
+	}
+	aliases := make(map[string]expr)
+	count := false
+	for _, item := range items {
+		rs.cols = append(rs.cols, item.name)
+		var col *column
+		if c, ok := item.x.(*columnRef); ok && t != nil {
+			if i := t.colIndex(c.name); i >= 0 {
+				col = &t.cols[i]
+			}
+		}
+		rs.types = append(rs.types, col)
+		aliases[item.name] = item.x
+		if _, ok := item.x.(countStar); ok {
+			count = true
+		}
+	}
+
+	// Collect the matching rows of the table; a SELECT without FROM
+	// has a single row with no columns.
+	var rows [][]driver.Value
+	if t == nil {
+		rows = [][]driver.Value{nil}
+	} else {
+		for _, r := range t.rows {
+			ok, err := x.match(s.where, t, r.vals)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				rows = append(rows, r.vals)
+			}
+		}
+	}
+	if t == nil && s.where != nil {
+		ok, err := x.match(s.where, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			rows = nil
+		}
+	}
+
+	if count {
+		// An aggregate query: one row, whose other items are constants.
+		out := make([]driver.Value, len(items))
+		for i, item := range items {
+			if _, ok := item.x.(countStar); ok {
+				out[i] = int64(len(rows))
+				continue
+			}
+			v, err := x.eval(item.x, &env{})
+			if err != nil {
+				return nil, fmt.Errorf("memdb: %s in a query with COUNT(*): %v", item.name, err)
+			}
+			out[i] = v
+		}
+		rs.rows = [][]driver.Value{out}
+		return rs, x.limit(s, rs)
+	}
+
+	if len(s.orderBy) > 0 {
+		keys := make([][]driver.Value, len(rows))
+		for i, vals := range rows {
+			e := &env{t: t, vals: vals, aliases: aliases}
+			for _, o := range s.orderBy {
+				v, err := x.eval(o.x, e)
+				if err != nil {
+					return nil, err
+				}
+				keys[i] = append(keys[i], v)
+			}
+		}
+		index := make([]int, len(rows))
+		for i := range index {
+			index[i] = i
+		}
+		sorter := &rowSorter{rows: rows, keys: keys, index: index, order: s.orderBy}
+		sort.Sort(sorter)
+		if sorter.err != nil {
+			return nil, sorter.err
+		}
+	}
+
+	for _, vals := range rows {
+		out := make([]driver.Value, len(items))
+		e := &env{t: t, vals: vals}
+		for i, item := range items {
+			v, err := x.eval(item.x, e)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = v
+		}
+		rs.rows = append(rs.rows, out)
+	}
+	return rs, x.limit(s, rs)
+}
+
+// limit applies the LIMIT and OFFSET clauses of s to rs.
+func (x *execCtx) limit(s *selectStmt, rs *resultSet) error {
+	count := func(e expr, clause string) (int, error) {
+		v, err := x.eval(e, &env{})
+		if err != nil {
+			return 0, err
+		}
+		n, ok := v.(int64)
+		if !ok || n < 0 {
+			return 0, fmt.Errorf("memdb: %s is %v, not a non-negative integer", clause, v)
+		}
+		if n > int64(len(rs.rows)) {
+			n = int64(len(rs.rows))
+		}
+		return int(n), nil
+	}
+	if s.offset != nil {
+		n, err := count(s.offset, "OFFSET")
+		if err != nil {
+			return err
+		}
+		rs.rows = rs.rows[n:]
+	}
+	if s.limit != nil {
+		n, err := count(s.limit, "LIMIT")
+		if err != nil {
+			return err
+		}
+		rs.rows = rs.rows[:n]
+	}
+	return nil
+}
+
+type rowSorter struct {
+	rows  [][]driver.Value
+	keys  [][]driver.Value
+	index []int // the position of each row before sorting
+	order []orderItem
+	err   error // the first comparison that failed
+}
+
+func (s *rowSorter) Len() int { return len(s.rows) }
+
+func (s *rowSorter) Swap(i, j int) {
+	s.rows[i], s.rows[j] = s.rows[j], s.rows[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+	s.index[i], s.index[j] = s.index[j], s.index[i]
+}
+
+// Less orders NULL before any other value, and rows with equal keys
+// in their original order.
+func (s *rowSorter) Less(i, j int) bool {
+	for k, o := range s.order {
+		a, b := s.keys[i][k], s.keys[j][k]
+		var n int
+		switch {
+		case a == nil && b == nil:
+			continue
+		case a == nil:
+			n = -1
+		case b == nil:
+			n = 1
+		default:
+			var err error
+			if n, err = compare(a, b); err != nil {
+				if s.err == nil {
+					s.err = err
+				}
+				return false
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		if o.desc {
+			n = -n
+		}
+		return n < 0
+	}
+	return s.index[i] < s.index[j]
+}
+
+// An env is the row an expression is evaluated against.
+type env struct {
+	t       *table
+	vals    []driver.Value
+	aliases map[string]expr // the select items, for ORDER BY
+}
+
+var errDivideByZero = errors.New("memdb: division by zero")
+
+// eval evaluates e, in which NULL is nil.  A nil env has no row, as in
+// the VALUES of an INSERT.
+func (x *execCtx) eval(e expr, en *env) (driver.Value, error) {
+	switch e := e.(type) {
+	case *literal:
+		return e.val, nil
+	case param:
+		if int(e) >= len(x.args) {
+			return nil, fmt.Errorf("memdb: missing argument %d", int(e)+1)
+		}
+		return x.args[e], nil
+	case *columnRef:
+		if en != nil && en.t != nil && (e.table == "" || e.table == en.t.name) {
+			if i := en.t.colIndex(e.name); i >= 0 {
+				return en.vals[i], nil
+			}
+		}
+		if en != nil && e.table == "" && en.aliases[e.name] != nil {
+			return x.eval(en.aliases[e.name], &env{t: en.t, vals: en.vals})
+		}
+		if e.table != "" {
+			return nil, fmt.Errorf("memdb: no such column %s.%s", e.table, e.name)
+		}
+		return nil, fmt.Errorf("memdb: no such column %s", e.name)
+	case countStar:
+		return nil, errors.New("memdb: COUNT(*) is only allowed in the items of a SELECT")
+	case *unaryExpr:
+		v, err := x.eval(e.x, en)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		switch e.op {
+		case "NOT":
+			b, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("memdb: NOT of %T", v)
+			}
+			return !b, nil
+		case "-":
+			switch v := v.(type) {
+			case int64:
+				return -v, nil
+			case float64:
+				return -v, nil
+			}
+			return nil, fmt.Errorf("memdb: negation of %T", v)
+		}
+	case *isNullExpr:
+		v, err := x.eval(e.x, en)
+		if err != nil {
+			return nil, err
+		}
+		return (v == nil) != e.not, nil
+	case *inExpr:
+		v, err := x.eval(e.x, en)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		// As with a chain of ORs, an unmatched NULL in the list
+		// makes the result NULL.
+		var res driver.Value = false
+		for _, le := range e.list {
+			lv, err := x.eval(le, en)
+			if err != nil {
+				return nil, err
+			}
+			if lv == nil {
+				res = nil
+				continue
+			}
+			n, err := compare(v, lv)
+			if err != nil {
+				return nil, err
+			}
+			if n == 0 {
+				res = true
+				break
+			}
+		}
+		if b, ok := res.(bool); ok && e.not {
+			return !b, nil
+		}
+		return res, nil
+	case *binaryExpr:
+		if e.op == "AND" || e.op == "OR" {
+			return x.logical(e, en)
+		}
+		l, err := x.eval(e.l, en)
+		if err != nil {
+			return nil, err
+		}
+		r, err := x.eval(e.r, en)
+		if err != nil || l == nil || r == nil {
+			return nil, err
+		}
+		return binary(e.op, l, r)
+	}
+	panic(fmt.Sprintf("memdb: unknown expression %T", e))
+}
+
+// logical evaluates AND and OR with SQL's three-valued logic.
+func (x *execCtx) logical(e *binaryExpr, en *env) (driver.Value, error) {
+	operand := func(o expr) (driver.Value, error) {
+		v, err := x.eval(o, en)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := v.(bool); v != nil && !ok {
+			return nil, fmt.Errorf("memdb: %s of %T", e.op, v)
+		}
+		return v, nil
+	}
+	// The result when either operand has this value.
+	decisive := e.op == "OR"
+	l, err := operand(e.l)
+	if err != nil {
+		return nil, err
+	}
+	if l == decisive {
+		return decisive, nil
+	}
+	r, err := operand(e.r)
+	if err != nil {
+		return nil, err
+	}
+	if r == decisive {
+		return decisive, nil
+	}
+	if l == nil || r == nil {
+		return nil, nil
+	}
+	return !decisive, nil
+}
+
+// binary applies the operator op to non-NULL operands.
+func binary(op string, l, r driver.Value) (driver.Value, error) {
+	switch op {
+	case "=", "!=", "<", "<=", ">", ">=":
+		n, err := compare(l, r)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "=":
+			return n == 0, nil
+		case "!=":
+			return n != 0, nil
+		case "<":
+			return n < 0, nil
+		case "<=":
+			return n <= 0, nil
+		case ">":
+			return n > 0, nil
+		}
+		return n >= 0, nil
+	case "||":
+		return text(l) + text(r), nil
+	case "LIKE":
+		ls, lok := l.(string)
+		rs, rok := r.(string)
+		if !lok || !rok {
+			return nil, fmt.Errorf("memdb: %T LIKE %T", l, r)
+		}
+		return like(ls, rs), nil
+	}
+
+	// Arithmetic.
+	if li, ok := l.(int64); ok {
+		if ri, ok := r.(int64); ok {
+			switch op {
+			case "+":
+				return li + ri, nil
+			case "-":
+				return li - ri, nil
+			case "*":
+				return li * ri, nil
+			}
+			if ri == 0 {
+				return nil, errDivideByZero
+			}
+			if op == "/" {
+				return li / ri, nil
+			}
+			return li % ri, nil
+		}
+	}
+	lf, lok := float(l)
+	rf, rok := float(r)
+	if !lok || !rok {
+		return nil, fmt.Errorf("memdb: %T %s %T", l, op, r)
+	}
+	switch op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	}
+	if rf == 0 {
+		return nil, errDivideByZero
+	}
+	if op == "/" {
+		return lf / rf, nil
+	}
+	return math.Mod(lf, rf), nil
+}
+
+func float(v driver.Value) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// text returns v as concatenated by ||.
+func text(v driver.Value) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
+
+// compare returns the order of non-NULL values a and b: negative if a
+// is less, zero if they're equal and positive if a is greater.
+func compare(a, b driver.Value) (int, error) {
+	if ai, ok := a.(int64); ok {
+		if bi, ok := b.(int64); ok {
+			switch {
+			case ai < bi:
+				return -1, nil
+			case ai > bi:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	if af, ok := float(a); ok {
+		if bf, ok := float(b); ok {
+			switch {
+			case af < bf:
+				return -1, nil
+			case af > bf:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	if ab, ok := a.([]byte); ok {
+		a = string(ab)
+	}
+	if bb, ok := b.([]byte); ok {
+		b = string(bb)
+	}
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			switch {
+			case a < b:
+				return -1, nil
+			case a > b:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			switch {
+			case a == b:
+				return 0, nil
+			case b:
+				return -1, nil
+			}
+			return 1, nil
+		}
+	case time.Time:
+		if b, ok := b.(time.Time); ok {
+			switch {
+			case a.Before(b):
+				return -1, nil
+			case a.After(b):
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	return 0, fmt.Errorf("memdb: cannot compare %T with %T", a, b)
+}
+
+// like reports whether s matches pattern, in which % matches any
+// sequence of characters and _ matches any single character.
+func like(s, pattern string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '%':
+			for i := len(s); i >= 0; i-- {
+				if like(s[i:], pattern[1:]) {
+					return true
+				}
+			}
+			return false
+		case '_':
+			if len(s) == 0 {
+				return false
+			}
+			_, n := utf8.DecodeRuneInString(s)
+			s, pattern = s[n:], pattern[1:]
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+			s, pattern = s[1:], pattern[1:]
+		}
+	}
+	return len(s) == 0
+}
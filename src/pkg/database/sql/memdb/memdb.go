@@ -0,0 +1,302 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package memdb implements an in-memory SQL database driver for package
+// database/sql, meant for tests that need a database without an
+// external server.
+//
+// Importing the package registers the driver under the name "memdb":
+//
+//	import (
+//		"database/sql"
+//		_ "database/sql/memdb"
+//	)
+//
+//	db, err := sql.Open("memdb", "test")
+//
+// The data source name names a database that is shared by all the
+// connections that open it, in any sql.DB of the process, and that
+// lasts until the process exits.  Tests that want a database of their
+// own should use a name no other test uses.
+//
+// The driver speaks a small subset of SQL:
+//
+//	CREATE TABLE [IF NOT EXISTS] t (col type [NOT NULL] [PRIMARY KEY], ...)
+//	DROP TABLE [IF EXISTS] t
+//	INSERT INTO t [(col, ...)] VALUES (expr, ...), ...
+//	SELECT * | expr [AS name], ... [FROM t] [WHERE expr]
+//		[ORDER BY expr [ASC | DESC], ...] [LIMIT expr [OFFSET expr]]
+//	UPDATE t SET col = expr, ... [WHERE expr]
+//	DELETE FROM t [WHERE expr]
+//
+// The column types are INTEGER (or INT, BIGINT, SMALLINT), REAL (FLOAT,
+// DOUBLE), TEXT (VARCHAR, CHAR), BLOB, BOOLEAN (BOOL) and TIMESTAMP
+// (DATETIME); their values scan as int64, float64, string, []byte, bool
+// and time.Time.  A length after a type, as in VARCHAR(20), is ignored.
+// A table may have one PRIMARY KEY column, whose values must be unique
+// and not NULL.  An INTEGER PRIMARY KEY left NULL by an INSERT gets the
+// next integer after the largest in the table, which is the result's
+// LastInsertId.
+//
+// Expressions are made of column names, literals (numbers, 'strings',
+// TRUE, FALSE and NULL), ? placeholders, parentheses and the operators
+//
+//	OR  AND  NOT
+//	=  !=  <>  <  <=  >  >=  IS [NOT] NULL  [NOT] IN (...)  [NOT] LIKE
+//	+  -  ||
+//	*  /  %
+//
+// from the lowest precedence to the highest, with NULL treated as in
+// SQL.  The items of a SELECT may also include COUNT(*), which makes
+// the query return a single row.  Names are case-insensitive unless
+// written in double quotes.
+//
+// Each statement is atomic.  Statements in a transaction take effect
+// immediately, and are visible to other connections before the
+// transaction commits; Rollback undoes them.  Transactions are thus
+// isolated at the level of read uncommitted.  A transaction has the
+// database to itself for writing, though: until it ends, Begin and
+// statements that write on other connections wait for it.
+package memdb
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+)
+
+func init() {
+	sql.Register("memdb", drv)
+}
+
+var drv = &memDriver{dbs: make(map[string]*database)}
+
+type memDriver struct {
+	mu  sync.Mutex
+	dbs map[string]*database
+}
+
+// A database holds the tables of a data source name.
+type database struct {
+	mu     sync.RWMutex
+	tables map[string]*table
+
+	// wmu is held by the transaction in progress, if any, and by a
+	// statement writing outside a transaction, so that Rollback
+	// undoes only the transaction's own writes.
+	wmu sync.Mutex
+}
+
+func (d *memDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	db := d.dbs[name]
+	if db == nil {
+		db = &database{tables: make(map[string]*table)}
+		d.dbs[name] = db
+	}
+	return &conn{db: db}, nil
+}
+
+var (
+	errClosed    = errors.New("memdb: connection is closed")
+	errInTx      = errors.New("memdb: a transaction is already in progress")
+	errTxDone    = errors.New("memdb: transaction has already been committed or rolled back")
+	errQueryRows = errors.New("memdb: statement does not return rows")
+)
+
+type conn struct {
+	db     *database
+	tx     *tx // the transaction in progress, or nil
+	closed bool
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	if c.closed {
+		return nil, errClosed
+	}
+	s, n, err := parse(query)
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{c: c, stmt: s, nparams: n}, nil
+}
+
+// Close rolls back the transaction in progress, if any.
+func (c *conn) Close() error {
+	if c.closed {
+		return errClosed
+	}
+	if c.tx != nil {
+		c.tx.Rollback()
+	}
+	c.closed = true
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	if c.closed {
+		return nil, errClosed
+	}
+	if c.tx != nil {
+		return nil, errInTx
+	}
+	c.db.wmu.Lock()
+	c.tx = &tx{c: c}
+	return c.tx, nil
+}
+
+type tx struct {
+	c   *conn
+	log []undo
+}
+
+func (t *tx) Commit() error {
+	if t.c.tx != t {
+		return errTxDone
+	}
+	t.c.tx = nil
+	t.c.db.wmu.Unlock()
+	return nil
+}
+
+func (t *tx) Rollback() error {
+	if t.c.tx != t {
+		return errTxDone
+	}
+	t.c.tx = nil
+	db := t.c.db
+	defer db.wmu.Unlock()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for i := len(t.log) - 1; i >= 0; i-- {
+		t.log[i](db)
+	}
+	return nil
+}
+
+type stmt struct {
+	c       *conn
+	stmt    interface{} // from parse
+	nparams int
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return s.nparams
+}
+
+func (s *stmt) ctx(args []driver.Value) *execCtx {
+	x := &execCtx{db: s.c.db, args: args}
+	if s.c.tx != nil {
+		x.log = &s.c.tx.log
+	}
+	return x
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	if s.c.closed {
+		return nil, errClosed
+	}
+	db := s.c.db
+	if sel, ok := s.stmt.(*selectStmt); ok {
+		db.mu.RLock()
+		defer db.mu.RUnlock()
+		if _, err := s.ctx(args).query(sel); err != nil {
+			return nil, err
+		}
+		return driver.RowsAffected(0), nil
+	}
+	if s.c.tx == nil {
+		db.wmu.Lock()
+		defer db.wmu.Unlock()
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return s.ctx(args).exec(s.stmt)
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	if s.c.closed {
+		return nil, errClosed
+	}
+	sel, ok := s.stmt.(*selectStmt)
+	if !ok {
+		return nil, errQueryRows
+	}
+	db := s.c.db
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	rs, err := s.ctx(args).query(sel)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{rs: rs}, nil
+}
+
+type rows struct {
+	rs  *resultSet
+	pos int
+}
+
+func (r *rows) Columns() []string {
+	return r.rs.cols
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rs.rows) {
+		return io.EOF
+	}
+	for i, v := range r.rs.rows[r.pos] {
+		switch v := v.(type) {
+		case string:
+			dest[i] = []byte(v)
+		case []byte:
+			// The table keeps its own copy.
+			dest[i] = append([]byte(nil), v...)
+		default:
+			dest[i] = v
+		}
+	}
+	r.pos++
+	return nil
+}
+
+var interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// ColumnTypeScanType returns the Go type of the values of a table
+// column, and interface{} for other expressions.
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	if c := r.rs.types[index]; c != nil {
+		return scanTypes[c.typ]
+	}
+	return interfaceType
+}
+
+// ColumnTypeDatabaseTypeName returns the type of a table column as
+// written in CREATE TABLE, without any length, and "" for other
+// expressions.
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	if c := r.rs.types[index]; c != nil {
+		return c.typeName
+	}
+	return ""
+}
+
+func (r *rows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	if c := r.rs.types[index]; c != nil {
+		return !c.notNull, true
+	}
+	return false, false
+}
@@ -0,0 +1,450 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memdb
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestDB(t *testing.T, name string) *sql.DB {
+	db, err := sql.Open("memdb", "test:"+name)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	// Databases outlive the test, which may run more than once.
+	exec(t, db, "DROP TABLE IF EXISTS people")
+	exec(t, db, "CREATE TABLE people (id INTEGER PRIMARY KEY, name VARCHAR(20) NOT NULL, age INT, photo BLOB)")
+	exec(t, db, "INSERT INTO people (name, age) VALUES ('Alice', 1), ('Bob', 2), ('Chris', 3)")
+	return db
+}
+
+func exec(t *testing.T, db *sql.DB, query string, args ...interface{}) sql.Result {
+	res, err := db.Exec(query, args...)
+	if err != nil {
+		t.Fatalf("Exec of %q: %v", query, err)
+	}
+	return res
+}
+
+// names returns the first column of the rows of query.
+func names(t *testing.T, db *sql.DB, query string, args ...interface{}) []string {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		t.Fatalf("Query of %q: %v", query, err)
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+		out = append(out, s)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	return out
+}
+
+func TestQuery(t *testing.T) {
+	db := newTestDB(t, "query")
+	defer db.Close()
+
+	tests := []struct {
+		query string
+		args  []interface{}
+		want  string
+	}{
+		{"SELECT name FROM people", nil, "Alice,Bob,Chris"},
+		{"select NAME from PEOPLE where age >= ?", []interface{}{2}, "Bob,Chris"},
+		{"SELECT name FROM people WHERE age = 1 OR name = 'Chris'", nil, "Alice,Chris"},
+		{"SELECT name FROM people WHERE NOT (age < 2 OR age > 2)", nil, "Bob"},
+		{"SELECT name FROM people WHERE name LIKE '%r%'", nil, "Chris"},
+		{"SELECT name FROM people WHERE name NOT LIKE '_ob'", nil, "Alice,Chris"},
+		{"SELECT name FROM people WHERE age IN (1, 3)", nil, "Alice,Chris"},
+		{"SELECT name FROM people WHERE age NOT IN (1, ?)", []interface{}{3}, "Bob"},
+		{"SELECT name FROM people WHERE photo IS NULL AND age * 2 > 3", nil, "Bob,Chris"},
+		{"SELECT name FROM people ORDER BY age DESC", nil, "Chris,Bob,Alice"},
+		{"SELECT name FROM people ORDER BY age / 3 DESC", nil, "Chris,Alice,Bob"},
+		{"SELECT name || '!' AS shout FROM people ORDER BY shout DESC LIMIT 2", nil, "Chris!,Bob!"},
+		{"SELECT name FROM people ORDER BY id LIMIT 5 OFFSET 1", nil, "Bob,Chris"},
+		{"SELECT name FROM people LIMIT 0", nil, ""},
+		{"SELECT COUNT(*) FROM people WHERE age > 1", nil, "2"},
+		{"SELECT 7 / 2 + 0.5 * 3 - 1", nil, "3.5"},
+		{"SELECT 'it''s'", nil, "it's"},
+	}
+	for _, tt := range tests {
+		got := strings.Join(names(t, db, tt.query, tt.args...), ",")
+		if got != tt.want {
+			t.Errorf("%s: got %q; want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestOrderByStable(t *testing.T) {
+	db := newTestDB(t, "orderby")
+	defer db.Close()
+
+	// Enough rows for sort.Sort not to sort by insertion.
+	var want0, want1 []string
+	for i := 4; i < 100; i++ {
+		exec(t, db, "INSERT INTO people (id, name, age) VALUES (?, ?, ?)", i, fmt.Sprint(i), i%2)
+		if i%2 == 0 {
+			want0 = append(want0, fmt.Sprint(i))
+		} else {
+			want1 = append(want1, fmt.Sprint(i))
+		}
+	}
+	got := strings.Join(names(t, db, "SELECT name FROM people WHERE id > 3 ORDER BY age DESC"), ",")
+	if want := strings.Join(append(want1, want0...), ","); got != want {
+		t.Errorf("ORDER BY age DESC got %q; want %q", got, want)
+	}
+}
+
+func TestNullLogic(t *testing.T) {
+	db := newTestDB(t, "null")
+	defer db.Close()
+	exec(t, db, "INSERT INTO people (name) VALUES ('Dana')")
+
+	tests := []struct {
+		where string
+		want  string
+	}{
+		{"age = NULL", ""},
+		{"age IS NULL", "Dana"},
+		{"age IS NOT NULL AND age < 2", "Alice"},
+		{"NOT (age > 1)", "Alice"},
+		{"age > 2 OR age IS NULL", "Chris,Dana"},
+		{"age IN (1, NULL)", "Alice"},
+		{"NOT (age IN (1, NULL))", ""},
+		{"age + 1 IS NULL", "Dana"},
+	}
+	for _, tt := range tests {
+		got := strings.Join(names(t, db, "SELECT name FROM people WHERE "+tt.where), ",")
+		if got != tt.want {
+			t.Errorf("WHERE %s: got %q; want %q", tt.where, got, tt.want)
+		}
+	}
+	if got := strings.Join(names(t, db, "SELECT name FROM people ORDER BY age"), ","); got != "Dana,Alice,Bob,Chris" {
+		t.Errorf("ORDER BY age: got %q; NULL should sort first", got)
+	}
+}
+
+func TestInsertResult(t *testing.T) {
+	db := newTestDB(t, "insert")
+	defer db.Close()
+
+	res := exec(t, db, "INSERT INTO people (name, age) VALUES (?, ?)", "Dana", 4)
+	if id, err := res.LastInsertId(); err != nil || id != 4 {
+		t.Errorf("LastInsertId = %d, %v; want 4", id, err)
+	}
+	res = exec(t, db, "INSERT INTO people VALUES (10, 'Eve', NULL, ?)", []byte("jpeg"))
+	if id, _ := res.LastInsertId(); id != 10 {
+		t.Errorf("LastInsertId = %d; want 10", id)
+	}
+	res = exec(t, db, "INSERT INTO people (name) VALUES ('Fred')")
+	if id, _ := res.LastInsertId(); id != 11 {
+		t.Errorf("LastInsertId after explicit key = %d; want 11", id)
+	}
+
+	var (
+		name  string
+		age   sql.NullInt64
+		photo []byte
+	)
+	err := db.QueryRow("SELECT name, age, photo FROM people WHERE id = ?", 10).Scan(&name, &age, &photo)
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	if name != "Eve" || age.Valid || string(photo) != "jpeg" {
+		t.Errorf("got %q, %v, %q; want Eve, NULL, jpeg", name, age, photo)
+	}
+
+	errs := []struct {
+		query string
+		args  []interface{}
+		want  string
+	}{
+		{"INSERT INTO people (id, name) VALUES (1, 'Dup')", nil, "duplicate primary key"},
+		{"INSERT INTO people (age) VALUES (5)", nil, "NULL in NOT NULL column people.name"},
+		{"INSERT INTO people (name, age) VALUES ('Gina', 'old')", nil, "cannot store"},
+		{"INSERT INTO people (name, height) VALUES ('Gina', 5)", nil, "no column height"},
+		{"INSERT INTO nobody VALUES (1)", nil, "no such table"},
+		{"INSERT INTO people (name) VALUES ('Gina'), (NULL)", nil, "NULL in NOT NULL"},
+	}
+	for _, tt := range errs {
+		_, err := db.Exec(tt.query, tt.args...)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v; want %q", tt.query, err, tt.want)
+		}
+	}
+	// The failed multi-row INSERT added nothing.
+	if got := names(t, db, "SELECT name FROM people WHERE name = 'Gina'"); len(got) != 0 {
+		t.Errorf("failed INSERT left rows %q", got)
+	}
+}
+
+func TestUpdateDelete(t *testing.T) {
+	db := newTestDB(t, "update")
+	defer db.Close()
+
+	res := exec(t, db, "UPDATE people SET age = age + 10, name = name || '2' WHERE age >= ?", 2)
+	if n, _ := res.RowsAffected(); n != 2 {
+		t.Errorf("UPDATE RowsAffected = %d; want 2", n)
+	}
+	if got := strings.Join(names(t, db, "SELECT name || ':' || age FROM people"), ","); got != "Alice:1,Bob2:12,Chris2:13" {
+		t.Errorf("after UPDATE got %q", got)
+	}
+	if _, err := db.Exec("UPDATE people SET name = NULL WHERE age > 10"); err == nil {
+		t.Errorf("UPDATE to NULL in NOT NULL column succeeded")
+	}
+
+	res = exec(t, db, "DELETE FROM people WHERE name LIKE '%2'")
+	if n, _ := res.RowsAffected(); n != 2 {
+		t.Errorf("DELETE RowsAffected = %d; want 2", n)
+	}
+	if got := strings.Join(names(t, db, "SELECT name FROM people"), ","); got != "Alice" {
+		t.Errorf("after DELETE got %q", got)
+	}
+	exec(t, db, "DELETE FROM people")
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM people").Scan(&n); err != nil || n != 0 {
+		t.Errorf("COUNT(*) = %d, %v; want 0", n, err)
+	}
+}
+
+func TestTxRollback(t *testing.T) {
+	db := newTestDB(t, "tx")
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	for _, q := range []string{
+		"INSERT INTO people (name, age) VALUES ('Dana', 4)",
+		"UPDATE people SET age = 0 WHERE name = 'Alice'",
+		"DELETE FROM people WHERE name = 'Bob'",
+		"CREATE TABLE pets (name TEXT)",
+		"DROP TABLE people",
+	} {
+		if _, err := tx.Exec(q); err != nil {
+			t.Fatalf("Exec of %q in tx: %v", q, err)
+		}
+	}
+	if _, err := db.Exec("SELECT * FROM people"); err == nil {
+		t.Errorf("dropped table is visible outside tx")
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if got := strings.Join(names(t, db, "SELECT name || age FROM people ORDER BY id"), ","); got != "Alice1,Bob2,Chris3" {
+		t.Errorf("after Rollback got %q", got)
+	}
+	if _, err := db.Exec("SELECT * FROM pets"); err == nil {
+		t.Errorf("table created in rolled back tx exists")
+	}
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if _, err := tx.Exec("DELETE FROM people WHERE age < 3"); err != nil {
+		t.Fatalf("Exec in tx: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if got := strings.Join(names(t, db, "SELECT name FROM people"), ","); got != "Chris" {
+		t.Errorf("after Commit got %q", got)
+	}
+}
+
+func TestTxWritesWait(t *testing.T) {
+	db := newTestDB(t, "txwait")
+	defer db.Close()
+
+	// wait runs query on another connection and checks that it
+	// waits for the transaction in progress.
+	wait := func(query string) <-chan error {
+		errc := make(chan error, 1)
+		go func() {
+			_, err := db.Exec(query)
+			errc <- err
+		}()
+		select {
+		case err := <-errc:
+			t.Fatalf("Exec of %q during tx did not wait: %v", query, err)
+		case <-time.After(20 * time.Millisecond):
+		}
+		return errc
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if _, err := tx.Exec("DELETE FROM people WHERE id = 1"); err != nil {
+		t.Fatalf("Exec in tx: %v", err)
+	}
+	errc := wait("INSERT INTO people (id, name) VALUES (1, 'Dana')")
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if err := <-errc; err == nil {
+		t.Errorf("INSERT of a key restored by Rollback succeeded")
+	}
+	if got := strings.Join(names(t, db, "SELECT name FROM people WHERE id = 1"), ","); got != "Alice" {
+		t.Errorf("after Rollback of DELETE got %q; want Alice", got)
+	}
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if _, err := tx.Exec("UPDATE people SET age = 10 WHERE id = 2"); err != nil {
+		t.Fatalf("Exec in tx: %v", err)
+	}
+	errc = wait("UPDATE people SET age = 20 WHERE id = 2")
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("UPDATE after Rollback: %v", err)
+	}
+	if got := strings.Join(names(t, db, "SELECT name || age FROM people WHERE id = 2"), ","); got != "Bob20" {
+		t.Errorf("after Rollback of UPDATE got %q; want Bob20", got)
+	}
+}
+
+func TestSharedByName(t *testing.T) {
+	db := newTestDB(t, "shared")
+	defer db.Close()
+	db2, err := sql.Open("memdb", "test:shared")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db2.Close()
+	if got := strings.Join(names(t, db2, "SELECT name FROM people WHERE id = 2"), ","); got != "Bob" {
+		t.Errorf("second DB got %q; want Bob", got)
+	}
+
+	db3, err := sql.Open("memdb", "test:other")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db3.Close()
+	if _, err := db3.Exec("SELECT * FROM people"); err == nil {
+		t.Errorf("table visible in a database of another name")
+	}
+}
+
+func TestTypes(t *testing.T) {
+	db, err := sql.Open("memdb", "test:types")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+	exec(t, db, `DROP TABLE IF EXISTS "Mixed"`)
+	exec(t, db, `CREATE TABLE "Mixed" (i BIGINT, f DOUBLE, s TEXT, b BOOLEAN, ts TIMESTAMP NOT NULL)`)
+	when := time.Date(2012, 3, 4, 5, 6, 7, 0, time.UTC)
+	exec(t, db, `INSERT INTO "Mixed" VALUES (?, ?, ?, ?, ?)`, int64(1)<<40, 2.5, "str", true, when)
+	exec(t, db, `INSERT INTO "Mixed" VALUES (3.0, 4, 'x', FALSE, '2012-01-01T00:00:00Z')`)
+
+	rows, err := db.Query(`SELECT i, f, s, b, ts, i + 1 FROM "Mixed" WHERE b ORDER BY ts`)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	defer rows.Close()
+	cts, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatalf("ColumnTypes: %v", err)
+	}
+	wantTypes := []struct {
+		scan     interface{}
+		name     string
+		nullable bool
+	}{
+		{int64(0), "BIGINT", true},
+		{float64(0), "DOUBLE", true},
+		{"", "TEXT", true},
+		{false, "BOOLEAN", true},
+		{time.Time{}, "TIMESTAMP", false},
+	}
+	for i, w := range wantTypes {
+		ct := cts[i]
+		nullable, ok := ct.Nullable()
+		if ct.ScanType() != reflect.TypeOf(w.scan) || ct.DatabaseTypeName() != w.name || !ok || nullable != w.nullable {
+			t.Errorf("column %s: %v, %q, %v; want %T, %q, %v", ct.Name(), ct.ScanType(), ct.DatabaseTypeName(), nullable, w.scan, w.name, w.nullable)
+		}
+	}
+	if _, ok := cts[5].Nullable(); ok || cts[5].DatabaseTypeName() != "" {
+		t.Errorf("expression column has a table column's type")
+	}
+
+	if !rows.Next() {
+		t.Fatalf("no rows: %v", rows.Err())
+	}
+	var (
+		i, i1 int64
+		f     float64
+		s     string
+		b     bool
+		ts    time.Time
+	)
+	if err := rows.Scan(&i, &f, &s, &b, &ts, &i1); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if i != 1<<40 || f != 2.5 || s != "str" || !b || !ts.Equal(when) || i1 != 1<<40+1 {
+		t.Errorf("got %v, %v, %q, %v, %v, %v", i, f, s, b, ts, i1)
+	}
+	if rows.Next() {
+		t.Errorf("WHERE b matched a false row")
+	}
+
+	var i2 int64
+	if err := db.QueryRow(`SELECT i FROM "Mixed" WHERE ts < ?`, when).Scan(&i2); err != nil || i2 != 3 {
+		t.Errorf("REAL 3.0 stored in BIGINT column = %d, %v; want 3", i2, err)
+	}
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	db := newTestDB(t, "syntax")
+	defer db.Close()
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT FROM people", "found \"FROM\""},
+		{"SELECT name FROM people WHERE", "end of statement"},
+		{"SELECT name FROM people extra", "unexpected \"extra\""},
+		{"CREATE TABLE t (x WIDGET)", "unknown type"},
+		{"SELECT 'open", "unterminated"},
+		{"SELECT name FROM people WHERE age # 1", "unexpected character"},
+		{"SELECT height FROM people", "no such column height"},
+		{"SELECT name FROM people WHERE name", "not a boolean"},
+		{"SELECT 1 / 0", "division by zero"},
+		{"SELECT name FROM people WHERE name > 1", "cannot compare"},
+		{"CREATE TABLE people (x INT)", "already exists"},
+	}
+	for _, tt := range tests {
+		_, err := db.Exec(tt.query)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v; want %q", tt.query, err, tt.want)
+		}
+	}
+	if _, err := db.Query("DELETE FROM people"); err != errQueryRows {
+		t.Errorf("Query of DELETE: error %v; want %v", err, errQueryRows)
+	}
+	exec(t, db, "CREATE TABLE IF NOT EXISTS people (x INT)")
+	exec(t, db, "DROP TABLE IF EXISTS nobody")
+}
@@ -0,0 +1,673 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memdb
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Token kinds.
+const (
+	tokEOF = iota
+	tokIdent
+	tokQuotedIdent
+	tokNumber
+	tokString
+	tokParam
+	tokOp
+)
+
+type token struct {
+	kind int
+	text string // identifiers as written; strings unquoted
+	pos  int    // byte offset in the query
+}
+
+// lex splits query into tokens.
+func lex(query string) ([]token, error) {
+	var toks []token
+	i := 0
+	for {
+		for i < len(query) && isSpace(query[i]) {
+			i++
+		}
+		if strings.HasPrefix(query[i:], "--") {
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+			continue
+		}
+		if i == len(query) {
+			return append(toks, token{tokEOF, "", i}), nil
+		}
+		start := i
+		c := query[i]
+		switch {
+		case isLetter(c):
+			for i < len(query) && (isLetter(query[i]) || isDigit(query[i])) {
+				i++
+			}
+			toks = append(toks, token{tokIdent, query[start:i], start})
+		case isDigit(c) || c == '.' && i+1 < len(query) && isDigit(query[i+1]):
+			for i < len(query) && (isDigit(query[i]) || query[i] == '.') {
+				i++
+			}
+			if i < len(query) && (query[i] == 'e' || query[i] == 'E') {
+				i++
+				if i < len(query) && (query[i] == '+' || query[i] == '-') {
+					i++
+				}
+				for i < len(query) && isDigit(query[i]) {
+					i++
+				}
+			}
+			toks = append(toks, token{tokNumber, query[start:i], start})
+		case c == '\'' || c == '"':
+			// Quotes are escaped by doubling them.
+			var buf []byte
+			i++
+			for {
+				if i == len(query) {
+					return nil, fmt.Errorf("memdb: unterminated quoted string at offset %d", start)
+				}
+				if query[i] == c {
+					if i+1 < len(query) && query[i+1] == c {
+						buf = append(buf, c)
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				buf = append(buf, query[i])
+				i++
+			}
+			kind := tokString
+			if c == '"' {
+				kind = tokQuotedIdent
+			}
+			toks = append(toks, token{kind, string(buf), start})
+		case c == '?':
+			i++
+			toks = append(toks, token{tokParam, "?", start})
+		default:
+			op := ""
+			for _, o := range []string{"<=", ">=", "<>", "!=", "||"} {
+				if strings.HasPrefix(query[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				if !strings.ContainsRune("(),*=<>+-/%.;", rune(c)) {
+					return nil, fmt.Errorf("memdb: unexpected character %q at offset %d", c, i)
+				}
+				op = query[i : i+1]
+			}
+			i += len(op)
+			toks = append(toks, token{tokOp, op, start})
+		}
+	}
+	panic("unreachable")
+}
+
+func isSpace(c byte) bool  { return c == ' ' || c == '\t' || c == '\n' || c == '\r' }
+func isLetter(c byte) bool { return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_' }
+func isDigit(c byte) bool  { return '0' <= c && c <= '9' }
+
+// Expressions.
+type (
+	expr interface{}
+
+	literal struct {
+		val driver.Value
+	}
+
+	// param is the index of a ? placeholder.
+	param int
+
+	columnRef struct {
+		table string // qualifier, if any
+		name  string
+	}
+
+	unaryExpr struct {
+		op string // "-" or "NOT"
+		x  expr
+	}
+
+	binaryExpr struct {
+		op   string // arithmetic and comparison operators, "||", "AND", "OR", "LIKE"
+		l, r expr
+	}
+
+	isNullExpr struct {
+		x   expr
+		not bool
+	}
+
+	inExpr struct {
+		x    expr
+		list []expr
+		not  bool
+	}
+
+	// countStar is COUNT(*).
+	countStar struct{}
+)
+
+// Statements.
+type (
+	createTable struct {
+		table       string
+		ifNotExists bool
+		cols        []column
+	}
+
+	dropTable struct {
+		table    string
+		ifExists bool
+	}
+
+	insert struct {
+		table string
+		cols  []string // nil for all columns in order
+		rows  [][]expr
+	}
+
+	selectStmt struct {
+		items   []selectItem // nil for *
+		table   string       // empty if there is no FROM clause
+		where   expr
+		orderBy []orderItem
+		limit   expr
+		offset  expr
+	}
+
+	selectItem struct {
+		x    expr
+		name string // alias, or the text of the expression
+	}
+
+	orderItem struct {
+		x    expr
+		desc bool
+	}
+
+	update struct {
+		table string
+		set   []assignment
+		where expr
+	}
+
+	assignment struct {
+		col string
+		x   expr
+	}
+
+	deleteStmt struct {
+		table string
+		where expr
+	}
+)
+
+// parser holds the state of parsing one statement.
+type parser struct {
+	query   string
+	toks    []token
+	pos     int
+	nparams int
+}
+
+// parse parses query, a single statement optionally ending with a
+// semicolon, and returns it with its number of placeholders.
+func parse(query string) (stmt interface{}, nparams int, err error) {
+	toks, err := lex(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	p := &parser{query: query, toks: toks}
+	defer func() {
+		if e := recover(); e != nil {
+			se, ok := e.(syntaxError)
+			if !ok {
+				panic(e)
+			}
+			stmt, nparams, err = nil, 0, se
+		}
+	}()
+	stmt = p.statement()
+	if p.peek().kind == tokOp && p.peek().text == ";" {
+		p.next()
+	}
+	if p.peek().kind != tokEOF {
+		p.errorf("unexpected %s after statement", p.describe(p.peek()))
+	}
+	return stmt, p.nparams, nil
+}
+
+type syntaxError string
+
+func (e syntaxError) Error() string { return "memdb: syntax error: " + string(e) }
+
+func (p *parser) errorf(format string, args ...interface{}) {
+	panic(syntaxError(fmt.Sprintf(format, args...)))
+}
+
+func (p *parser) describe(t token) string {
+	switch t.kind {
+	case tokEOF:
+		return "end of statement"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// isKeyword reports whether t is the keyword kw, which is upper case.
+func isKeyword(t token, kw string) bool {
+	return t.kind == tokIdent && strings.ToUpper(t.text) == kw
+}
+
+// accept consumes the next token if it's the keyword or operator s.
+func (p *parser) accept(s string) bool {
+	t := p.peek()
+	if isKeyword(t, s) || t.kind == tokOp && t.text == s {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(s string) {
+	if !p.accept(s) {
+		p.errorf("expected %s, found %s", s, p.describe(p.peek()))
+	}
+}
+
+// reserved are the keywords that can't be used as unquoted names.
+var reserved = map[string]bool{
+	"AND": true, "AS": true, "ASC": true, "BY": true, "CREATE": true,
+	"DELETE": true, "DESC": true, "DROP": true, "FROM": true, "IN": true,
+	"INSERT": true, "INTO": true, "IS": true, "LIKE": true, "LIMIT": true,
+	"NOT": true, "NULL": true, "OFFSET": true, "OR": true, "ORDER": true,
+	"SELECT": true, "SET": true, "TABLE": true, "UPDATE": true,
+	"VALUES": true, "WHERE": true, "TRUE": true, "FALSE": true,
+}
+
+func (p *parser) name() string {
+	t := p.next()
+	switch {
+	case t.kind == tokQuotedIdent:
+		return t.text
+	case t.kind == tokIdent && !reserved[strings.ToUpper(t.text)]:
+		return strings.ToLower(t.text)
+	}
+	p.errorf("expected name, found %s", p.describe(t))
+	panic("unreachable")
+}
+
+func (p *parser) statement() interface{} {
+	t := p.next()
+	switch {
+	case isKeyword(t, "CREATE"):
+		return p.createTable()
+	case isKeyword(t, "DROP"):
+		p.expect("TABLE")
+		s := &dropTable{}
+		if p.accept("IF") {
+			p.expect("EXISTS")
+			s.ifExists = true
+		}
+		s.table = p.name()
+		return s
+	case isKeyword(t, "INSERT"):
+		return p.insert()
+	case isKeyword(t, "SELECT"):
+		return p.selectStmt()
+	case isKeyword(t, "UPDATE"):
+		return p.update()
+	case isKeyword(t, "DELETE"):
+		p.expect("FROM")
+		s := &deleteStmt{table: p.name()}
+		if p.accept("WHERE") {
+			s.where = p.expr()
+		}
+		return s
+	}
+	p.errorf("unknown statement %s", p.describe(t))
+	panic("unreachable")
+}
+
+func (p *parser) createTable() *createTable {
+	p.expect("TABLE")
+	s := &createTable{}
+	if p.accept("IF") {
+		p.expect("NOT")
+		p.expect("EXISTS")
+		s.ifNotExists = true
+	}
+	s.table = p.name()
+	p.expect("(")
+	for {
+		c := column{name: p.name()}
+		t := p.next()
+		typ, ok := typeNames[strings.ToUpper(t.text)]
+		if t.kind != tokIdent || !ok {
+			p.errorf("unknown type %s of column %s", p.describe(t), c.name)
+		}
+		c.typ, c.typeName = typ, strings.ToUpper(t.text)
+		if p.accept("(") {
+			// A length or precision, which is ignored.
+			for !p.accept(")") {
+				if p.next().kind == tokEOF {
+					p.errorf("unterminated type of column %s", c.name)
+				}
+			}
+		}
+		for {
+			if p.accept("NOT") {
+				p.expect("NULL")
+				c.notNull = true
+			} else if p.accept("PRIMARY") {
+				p.expect("KEY")
+				c.primaryKey, c.notNull = true, true
+			} else {
+				break
+			}
+		}
+		s.cols = append(s.cols, c)
+		if !p.accept(",") {
+			break
+		}
+	}
+	p.expect(")")
+	return s
+}
+
+func (p *parser) insert() *insert {
+	p.expect("INTO")
+	s := &insert{table: p.name()}
+	if p.accept("(") {
+		for {
+			s.cols = append(s.cols, p.name())
+			if !p.accept(",") {
+				break
+			}
+		}
+		p.expect(")")
+	}
+	p.expect("VALUES")
+	for {
+		p.expect("(")
+		var row []expr
+		for {
+			row = append(row, p.expr())
+			if !p.accept(",") {
+				break
+			}
+		}
+		p.expect(")")
+		s.rows = append(s.rows, row)
+		if !p.accept(",") {
+			break
+		}
+	}
+	return s
+}
+
+func (p *parser) selectStmt() *selectStmt {
+	s := &selectStmt{}
+	if !p.accept("*") {
+		for {
+			start := p.peek().pos
+			item := selectItem{x: p.expr()}
+			if p.accept("AS") {
+				item.name = p.name()
+			} else if c, ok := item.x.(*columnRef); ok {
+				item.name = c.name
+			} else {
+				item.name = strings.TrimSpace(p.query[start:p.peek().pos])
+			}
+			s.items = append(s.items, item)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.accept("FROM") {
+		s.table = p.name()
+	} else if s.items == nil {
+		p.errorf("SELECT * without FROM")
+	}
+	if p.accept("WHERE") {
+		s.where = p.expr()
+	}
+	if p.accept("ORDER") {
+		p.expect("BY")
+		for {
+			item := orderItem{x: p.expr()}
+			if p.accept("DESC") {
+				item.desc = true
+			} else {
+				p.accept("ASC")
+			}
+			s.orderBy = append(s.orderBy, item)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.accept("LIMIT") {
+		s.limit = p.expr()
+		if p.accept("OFFSET") {
+			s.offset = p.expr()
+		}
+	}
+	return s
+}
+
+func (p *parser) update() *update {
+	s := &update{table: p.name()}
+	p.expect("SET")
+	for {
+		a := assignment{col: p.name()}
+		p.expect("=")
+		a.x = p.expr()
+		s.set = append(s.set, a)
+		if !p.accept(",") {
+			break
+		}
+	}
+	if p.accept("WHERE") {
+		s.where = p.expr()
+	}
+	return s
+}
+
+// Expressions, from the lowest precedence up.
+
+func (p *parser) expr() expr {
+	x := p.andExpr()
+	for p.accept("OR") {
+		x = &binaryExpr{"OR", x, p.andExpr()}
+	}
+	return x
+}
+
+func (p *parser) andExpr() expr {
+	x := p.notExpr()
+	for p.accept("AND") {
+		x = &binaryExpr{"AND", x, p.notExpr()}
+	}
+	return x
+}
+
+func (p *parser) notExpr() expr {
+	if p.accept("NOT") {
+		return &unaryExpr{"NOT", p.notExpr()}
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() expr {
+	x := p.additive()
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == tokOp && (t.text == "=" || t.text == "!=" || t.text == "<>" ||
+			t.text == "<" || t.text == "<=" || t.text == ">" || t.text == ">="):
+			p.next()
+			op := t.text
+			if op == "<>" {
+				op = "!="
+			}
+			x = &binaryExpr{op, x, p.additive()}
+		case isKeyword(t, "IS"):
+			p.next()
+			not := p.accept("NOT")
+			p.expect("NULL")
+			x = &isNullExpr{x, not}
+		case isKeyword(t, "LIKE"):
+			p.next()
+			x = &binaryExpr{"LIKE", x, p.additive()}
+		case isKeyword(t, "IN"):
+			p.next()
+			x = p.inList(x, false)
+		case isKeyword(t, "NOT"):
+			// NOT LIKE or NOT IN
+			p.next()
+			switch {
+			case p.accept("LIKE"):
+				x = &unaryExpr{"NOT", &binaryExpr{"LIKE", x, p.additive()}}
+			case p.accept("IN"):
+				x = p.inList(x, true)
+			default:
+				p.errorf("expected LIKE or IN after NOT, found %s", p.describe(p.peek()))
+			}
+		default:
+			return x
+		}
+	}
+	panic("unreachable")
+}
+
+func (p *parser) inList(x expr, not bool) expr {
+	in := &inExpr{x: x, not: not}
+	p.expect("(")
+	for {
+		in.list = append(in.list, p.expr())
+		if !p.accept(",") {
+			break
+		}
+	}
+	p.expect(")")
+	return in
+}
+
+func (p *parser) additive() expr {
+	x := p.multiplicative()
+	for {
+		t := p.peek()
+		if t.kind != tokOp || t.text != "+" && t.text != "-" && t.text != "||" {
+			return x
+		}
+		p.next()
+		x = &binaryExpr{t.text, x, p.multiplicative()}
+	}
+	panic("unreachable")
+}
+
+func (p *parser) multiplicative() expr {
+	x := p.unary()
+	for {
+		t := p.peek()
+		if t.kind != tokOp || t.text != "*" && t.text != "/" && t.text != "%" {
+			return x
+		}
+		p.next()
+		x = &binaryExpr{t.text, x, p.unary()}
+	}
+	panic("unreachable")
+}
+
+func (p *parser) unary() expr {
+	if p.accept("-") {
+		return &unaryExpr{"-", p.unary()}
+	}
+	p.accept("+")
+	return p.primary()
+}
+
+func (p *parser) primary() expr {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		if i, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return &literal{i}
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			p.errorf("invalid number %s", t.text)
+		}
+		return &literal{f}
+	case tokString:
+		return &literal{t.text}
+	case tokParam:
+		p.nparams++
+		return param(p.nparams - 1)
+	case tokQuotedIdent:
+		p.pos--
+		return p.columnRef()
+	case tokOp:
+		if t.text == "(" {
+			x := p.expr()
+			p.expect(")")
+			return x
+		}
+	case tokIdent:
+		switch strings.ToUpper(t.text) {
+		case "NULL":
+			return &literal{nil}
+		case "TRUE":
+			return &literal{true}
+		case "FALSE":
+			return &literal{false}
+		case "COUNT":
+			if p.accept("(") {
+				p.expect("*")
+				p.expect(")")
+				return countStar{}
+			}
+		}
+		p.pos--
+		return p.columnRef()
+	}
+	p.errorf("unexpected %s in expression", p.describe(t))
+	panic("unreachable")
+}
+
+func (p *parser) columnRef() expr {
+	c := &columnRef{name: p.name()}
+	if p.accept(".") {
+		c.table, c.name = c.name, p.name()
+	}
+	return c
+}
@@ -11,7 +11,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"reflect"
+	"strconv"
 	"sync"
+	"time"
 )
 
 var drivers = make(map[string]driver.Driver)
@@ -168,6 +171,32 @@ type Scanner interface {
 	Scan(src interface{}) error
 }
 
+// A NamedArg is a named argument.  NamedArg values may be used as
+// arguments to the Query and Exec methods, binding to the parameter
+// of that name in the query, if the driver supports named parameters.
+//
+// Create NamedArg values with the Named function.
+type NamedArg struct {
+	// Name is the name of the parameter.  It must begin with a
+	// letter, and must not carry the driver's placeholder prefix
+	// such as ":" or "@".
+	Name string
+
+	// Value is the value of the parameter.  It may be of any type
+	// that an unnamed argument could be.
+	Value interface{}
+}
+
+// Named returns a NamedArg binding value to the parameter name.
+//
+// Example usage:
+//
+//  db.Exec(`DELETE FROM orders WHERE created < @end`,
+//      sql.Named("end", endTime))
+func Named(name string, value interface{}) NamedArg {
+	return NamedArg{Name: name, Value: value}
+}
+
 // ErrNoRows is returned by Scan when QueryRow doesn't return a
 // row. In such a case, QueryRow returns a placeholder *Row value that
 // defers this error until a Scan.
@@ -175,15 +204,56 @@ var ErrNoRows = errors.New("sql: no rows in result set")
 
 // DB is a database handle. It's safe for concurrent use by multiple
 // goroutines.
+//
+// DB maintains a pool of connections to the database.  Connections
+// are opened as needed, up to the limit set with SetMaxOpenConns,
+// and returned to a pool of idle connections once they are no longer
+// in use.  A connection that the driver reports as bad with
+// driver.ErrBadConn is closed instead, and the operation is retried
+// on another connection.
 type DB struct {
 	driver driver.Driver
 	dsn    string
 
-	mu       sync.Mutex // protects freeConn and closed
-	freeConn []driver.Conn
+	mu       sync.Mutex // protects following fields
+	cond     *sync.Cond // signaled when a connection is released or closed
+	freeConn []*driverConn
+	numOpen  int // number of open and opening connections
 	closed   bool
+
+	maxIdle     int           // zero means defaultMaxIdleConns; negative means 0
+	maxOpen     int           // <= 0 means unlimited
+	maxLifetime time.Duration // maximum amount of time a connection may be reused
+
+	waitCount         int64 // total number of connections waited for
+	waitDuration      time.Duration
+	maxIdleClosed     int64 // total number of connections closed due to SetMaxIdleConns
+	maxLifetimeClosed int64 // total number of connections closed due to SetConnMaxLifetime
+	badConnClosed     int64 // total number of connections closed due to driver.ErrBadConn
+}
+
+// driverConn wraps a driver.Conn with the state the pool keeps for it.
+type driverConn struct {
+	db        *DB
+	ci        driver.Conn
+	createdAt time.Time
+	closed    bool // set by closeConn, guarded by db.mu
+}
+
+// expired reports whether the connection is older than timeout,
+// if timeout is positive.
+func (dc *driverConn) expired(timeout time.Duration) bool {
+	if timeout <= 0 {
+		return false
+	}
+	return dc.createdAt.Add(timeout).Before(nowFunc())
 }
 
+// nowFunc returns the current time; it's overridden in tests.
+var nowFunc = time.Now
+
+var errDBClosed = errors.New("sql: database is closed")
+
 // Open opens a database specified by its database driver name and a
 // driver-specific data source name, usually consisting of at least a
 // database name and connection information.
@@ -195,54 +265,276 @@ func Open(driverName, dataSourceName string) (*DB, error) {
 	if !ok {
 		return nil, fmt.Errorf("sql: unknown driver %q (forgotten import?)", driverName)
 	}
-	return &DB{driver: driver, dsn: dataSourceName}, nil
+	db := &DB{driver: driver, dsn: dataSourceName}
+	db.cond = sync.NewCond(&db.mu)
+	return db, nil
 }
 
 // Close closes the database, releasing any open resources.
+// Connections in use are closed when they are released.
 func (db *DB) Close() error {
 	db.mu.Lock()
-	defer db.mu.Unlock()
+	free := db.freeConn
+	db.freeConn = nil
+	db.numOpen -= len(free)
+	db.closed = true
+	db.cond.Broadcast()
+	db.mu.Unlock()
+
 	var err error
-	for _, c := range db.freeConn {
-		err1 := c.Close()
+	for _, dc := range free {
+		err1 := db.closeConn(dc)
 		if err1 != nil {
 			err = err1
 		}
 	}
-	db.freeConn = nil
-	db.closed = true
 	return err
 }
 
-func (db *DB) maxIdleConns() int {
-	const defaultMaxIdleConns = 2
-	// TODO(bradfitz): ask driver, if supported, for its default preference
-	// TODO(bradfitz): let users override?
-	return defaultMaxIdleConns
+const defaultMaxIdleConns = 2
+
+func (db *DB) maxIdleConnsLocked() int {
+	n := db.maxIdle
+	switch {
+	case n == 0:
+		// TODO(bradfitz): ask driver, if supported, for its default preference
+		return defaultMaxIdleConns
+	case n < 0:
+		return 0
+	}
+	return n
 }
 
-// conn returns a newly-opened or cached driver.Conn
-func (db *DB) conn() (driver.Conn, error) {
+// SetMaxIdleConns sets the maximum number of connections in the idle
+// connection pool.  If n <= 0, no idle connections are retained.
+//
+// If MaxOpenConns is greater than 0 but less than n, n is reduced to
+// match the MaxOpenConns limit.
+func (db *DB) SetMaxIdleConns(n int) {
 	db.mu.Lock()
-	if db.closed {
-		db.mu.Unlock()
-		return nil, errors.New("sql: database is closed")
+	if n > 0 {
+		db.maxIdle = n
+	} else {
+		db.maxIdle = -1
 	}
-	if n := len(db.freeConn); n > 0 {
-		conn := db.freeConn[n-1]
-		db.freeConn = db.freeConn[:n-1]
-		db.mu.Unlock()
-		return conn, nil
+	if db.maxOpen > 0 && db.maxIdleConnsLocked() > db.maxOpen {
+		db.maxIdle = db.maxOpen
 	}
+	closing := db.shrinkIdleLocked()
 	db.mu.Unlock()
-	return db.driver.Open(db.dsn)
+	for _, dc := range closing {
+		db.closeConn(dc)
+	}
+}
+
+// SetMaxOpenConns sets the maximum number of open connections to the
+// database.  When the limit is reached, operations that need a new
+// connection block until another one is released.  If n <= 0, there
+// is no limit on the number of open connections; that is the default.
+//
+// If MaxIdleConns is greater than n, it is reduced to match.
+func (db *DB) SetMaxOpenConns(n int) {
+	db.mu.Lock()
+	db.maxOpen = n
+	if n < 0 {
+		db.maxOpen = 0
+	}
+	if db.maxOpen > 0 && db.maxIdleConnsLocked() > db.maxOpen {
+		db.maxIdle = db.maxOpen
+	}
+	closing := db.shrinkIdleLocked()
+	db.cond.Broadcast()
+	db.mu.Unlock()
+	for _, dc := range closing {
+		db.closeConn(dc)
+	}
+}
+
+// SetConnMaxLifetime sets the maximum amount of time a connection may
+// be reused.  Expired connections are closed when they would next be
+// used or returned to the idle pool.  If d <= 0, connections are
+// reused forever; that is the default.
+func (db *DB) SetConnMaxLifetime(d time.Duration) {
+	db.mu.Lock()
+	if d < 0 {
+		d = 0
+	}
+	db.maxLifetime = d
+	db.mu.Unlock()
+}
+
+// shrinkIdleLocked removes the idle connections beyond the limit from
+// the pool and returns them for the caller to close once db.mu is
+// released.
+func (db *DB) shrinkIdleLocked() []*driverConn {
+	max := db.maxIdleConnsLocked()
+	if len(db.freeConn) <= max {
+		return nil
+	}
+	closing := make([]*driverConn, len(db.freeConn)-max)
+	copy(closing, db.freeConn[max:])
+	db.freeConn = db.freeConn[:max]
+	db.numOpen -= len(closing)
+	db.maxIdleClosed += int64(len(closing))
+	db.cond.Broadcast()
+	return closing
 }
 
-func (db *DB) connIfFree(wanted driver.Conn) (conn driver.Conn, ok bool) {
+// DBStats contains statistics about the database's connection pool.
+type DBStats struct {
+	MaxOpenConnections int // Maximum number of open connections; 0 means unlimited.
+
+	// Pool status
+	OpenConnections int // The number of connections, both in use and idle.
+	InUse           int // The number of connections currently in use.
+	Idle            int // The number of idle connections.
+
+	// Counters
+	WaitCount         int64         // The total number of connections waited for.
+	WaitDuration      time.Duration // The total time blocked waiting for a new connection.
+	MaxIdleClosed     int64         // The total number of connections closed due to SetMaxIdleConns.
+	MaxLifetimeClosed int64         // The total number of connections closed due to SetConnMaxLifetime.
+	BadConnClosed     int64         // The total number of connections closed due to driver.ErrBadConn.
+}
+
+// Stats returns a snapshot of the database's connection pool statistics.
+func (db *DB) Stats() DBStats {
 	db.mu.Lock()
 	defer db.mu.Unlock()
-	for n, conn := range db.freeConn {
-		if conn == wanted {
+	return DBStats{
+		MaxOpenConnections: db.maxOpen,
+		OpenConnections:    db.numOpen,
+		InUse:              db.numOpen - len(db.freeConn),
+		Idle:               len(db.freeConn),
+		WaitCount:          db.waitCount,
+		WaitDuration:       db.waitDuration,
+		MaxIdleClosed:      db.maxIdleClosed,
+		MaxLifetimeClosed:  db.maxLifetimeClosed,
+		BadConnClosed:      db.badConnClosed,
+	}
+}
+
+// connReuseStrategy determines how conn returns connections.
+type connReuseStrategy bool
+
+const (
+	// cachedOrNewConn returns an idle connection if one is available,
+	// and opens a new one otherwise.
+	cachedOrNewConn connReuseStrategy = false
+	// alwaysNewConn opens a new connection.
+	alwaysNewConn connReuseStrategy = true
+)
+
+// maxBadConnRetries is the number of times an operation is retried on
+// a cached connection after driver.ErrBadConn, before trying a final
+// time on a new connection.
+const maxBadConnRetries = 2
+
+// conn returns a newly-opened or cached connection, blocking while the
+// maximum number of connections are open, unless done is closed.
+func (db *DB) conn(strategy connReuseStrategy, done <-chan struct{}) (*driverConn, error) {
+	var expired []*driverConn // connections to close once db.mu is released
+	var waitStart time.Time
+	db.mu.Lock()
+	for {
+		if db.closed {
+			db.mu.Unlock()
+			db.closeConns(expired)
+			return nil, errDBClosed
+		}
+		if canceled(done) {
+			if !waitStart.IsZero() {
+				// Pass on a wakeup this goroutine may have taken.
+				db.cond.Signal()
+			}
+			db.mu.Unlock()
+			db.closeConns(expired)
+			return nil, ErrCanceled
+		}
+		if n := len(db.freeConn); strategy == cachedOrNewConn && n > 0 {
+			dc := db.freeConn[n-1]
+			db.freeConn = db.freeConn[:n-1]
+			if dc.expired(db.maxLifetime) {
+				db.numOpen--
+				db.maxLifetimeClosed++
+				expired = append(expired, dc)
+				continue
+			}
+			db.recordWaitLocked(waitStart)
+			db.mu.Unlock()
+			db.closeConns(expired)
+			return dc, nil
+		}
+		if strategy == alwaysNewConn && db.maxOpen > 0 && db.numOpen >= db.maxOpen && len(db.freeConn) > 0 {
+			// Make room for the new connection by closing the
+			// least recently used idle one.
+			expired = append(expired, db.freeConn[0])
+			copy(db.freeConn, db.freeConn[1:])
+			db.freeConn = db.freeConn[:len(db.freeConn)-1]
+			db.numOpen--
+			continue
+		}
+		if db.maxOpen <= 0 || db.numOpen < db.maxOpen {
+			db.numOpen++ // reserve a slot while the connection is opened
+			db.recordWaitLocked(waitStart)
+			db.mu.Unlock()
+			db.closeConns(expired)
+			ci, err := db.driver.Open(db.dsn)
+			if err != nil {
+				db.mu.Lock()
+				db.numOpen--
+				db.cond.Signal()
+				db.mu.Unlock()
+				return nil, err
+			}
+			return &driverConn{db: db, ci: ci, createdAt: nowFunc()}, nil
+		}
+		if len(expired) > 0 {
+			db.mu.Unlock()
+			db.closeConns(expired)
+			expired = nil
+			db.mu.Lock()
+			continue
+		}
+		if waitStart.IsZero() {
+			waitStart = time.Now()
+			db.waitCount++
+			if done != nil {
+				stop := make(chan struct{})
+				defer close(stop)
+				go db.wakeOnDone(done, stop)
+			}
+		}
+		db.cond.Wait()
+	}
+	panic("unreachable")
+}
+
+// wakeOnDone wakes the goroutines waiting for a connection once done is
+// closed, so that the one waiting on done can give up.
+func (db *DB) wakeOnDone(done <-chan struct{}, stop chan struct{}) {
+	select {
+	case <-done:
+		db.mu.Lock()
+		db.cond.Broadcast()
+		db.mu.Unlock()
+	case <-stop:
+	}
+}
+
+func (db *DB) recordWaitLocked(waitStart time.Time) {
+	if !waitStart.IsZero() {
+		db.waitDuration += time.Since(waitStart)
+	}
+}
+
+// connIfFree returns (wanted, true) if wanted is still a valid conn and
+// isn't in use.
+func (db *DB) connIfFree(wanted *driverConn) (dc *driverConn, ok bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for n, dc := range db.freeConn {
+		if dc == wanted {
 			db.freeConn[n] = db.freeConn[len(db.freeConn)-1]
 			db.freeConn = db.freeConn[:len(db.freeConn)-1]
 			return wanted, true
@@ -251,77 +543,309 @@ func (db *DB) connIfFree(wanted driver.Conn) (conn driver.Conn, ok bool) {
 	return nil, false
 }
 
-func (db *DB) putConn(c driver.Conn) {
+// putConn returns dc to the pool of idle connections.  If err, the
+// error from the last operation on dc, is driver.ErrBadConn or
+// ErrCanceled, dc is closed instead.
+func (db *DB) putConn(dc *driverConn, err error) {
 	db.mu.Lock()
-	defer db.mu.Unlock()
-	if n := len(db.freeConn); !db.closed && n < db.maxIdleConns() {
-		db.freeConn = append(db.freeConn, c)
+	switch {
+	case err == driver.ErrBadConn:
+		// Don't reuse bad connections.
+		db.badConnClosed++
+	case err == ErrCanceled, dc.closed:
+		// The state of a connection whose operation was
+		// abandoned is unknown.
+	case db.closed:
+	case dc.expired(db.maxLifetime):
+		db.maxLifetimeClosed++
+	case len(db.freeConn) >= db.maxIdleConnsLocked():
+		db.maxIdleClosed++
+	default:
+		db.freeConn = append(db.freeConn, dc)
+		db.cond.Signal()
+		db.mu.Unlock()
 		return
 	}
-	db.closeConn(c) // TODO(bradfitz): release lock before calling this?
+	db.numOpen--
+	db.cond.Signal()
+	db.mu.Unlock()
+	db.closeConn(dc)
 }
 
-func (db *DB) closeConn(c driver.Conn) {
+func (db *DB) closeConn(dc *driverConn) error {
 	// TODO: check to see if we need this Conn for any prepared statements
 	// that are active.
-	c.Close()
+	db.mu.Lock()
+	if dc.closed {
+		db.mu.Unlock()
+		return nil
+	}
+	dc.closed = true
+	db.mu.Unlock()
+	return dc.ci.Close()
+}
+
+func (db *DB) closeConns(dcs []*driverConn) {
+	for _, dc := range dcs {
+		db.closeConn(dc)
+	}
+}
+
+// ErrCanceled is returned by an operation whose done channel was
+// closed before it completed.
+//
+// The methods whose names end in Cancel take a done channel; closing
+// it abandons the operation, including any wait for a free connection.
+// If the driver implements the cancellation interfaces of package
+// driver, it is handed the channel; otherwise the operation is
+// interrupted by closing its connection.  Either way, a connection
+// used by an abandoned operation is never returned to the pool.  A
+// nil done channel is never closed.
+var ErrCanceled = errors.New("sql: operation canceled")
+
+// Deadline returns a channel, for use as the done argument of the
+// Cancel methods, that is closed at time t.
+func Deadline(t time.Time) <-chan struct{} {
+	done := make(chan struct{})
+	time.AfterFunc(t.Sub(time.Now()), func() { close(done) })
+	return done
+}
+
+// canceled reports whether done has been closed.
+func canceled(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+	}
+	return false
+}
+
+// cancelResult returns the error to report for an operation that
+// returned err, and the error with which to release its connection.
+// If done has been closed, the connection is discarded.
+func cancelResult(done <-chan struct{}, err error) (opErr, releaseErr error) {
+	if !canceled(done) {
+		return err, err
+	}
+	if err != nil {
+		err = ErrCanceled
+	}
+	return err, ErrCanceled
+}
+
+// interrupt arranges for dc to be closed if done is closed before the
+// returned stop function is called, which abandons the operation in
+// progress on drivers that don't implement the cancellation
+// interfaces.  Stop must be called once; it reports whether dc was
+// closed.
+func (db *DB) interrupt(dc *driverConn, done <-chan struct{}) (stop func() bool) {
+	if done == nil {
+		return func() bool { return false }
+	}
+	finished := make(chan struct{})
+	closed := make(chan bool, 1)
+	go func() {
+		select {
+		case <-done:
+			db.closeConn(dc)
+			closed <- true
+		case <-finished:
+			closed <- false
+		}
+	}()
+	return func() bool {
+		close(finished)
+		return <-closed
+	}
+}
+
+// execConn executes query on dc, abandoning it if done is closed.
+func (db *DB) execConn(dc *driverConn, done <-chan struct{}, query string, nargs []driver.NamedValue) (driver.Result, error) {
+	if execer, ok := dc.ci.(driver.ExecerNamed); ok {
+		resi, err := execer.ExecNamed(done, query, nargs)
+		if err != driver.ErrSkip {
+			return resi, err
+		}
+	} else if args, err := positionalArgs(nargs); err != nil {
+		// The statement may still support names.
+	} else if execer, ok := dc.ci.(driver.ExecerCancel); ok && done != nil {
+		resi, err := execer.ExecCancel(done, query, args)
+		if err != driver.ErrSkip {
+			return resi, err
+		}
+	} else if execer, ok := dc.ci.(driver.Execer); ok {
+		stop := db.interrupt(dc, done)
+		resi, err := execer.Exec(query, args)
+		if stop() {
+			return nil, ErrCanceled
+		}
+		if err != driver.ErrSkip {
+			return resi, err
+		}
+	}
+
+	si, err := dc.ci.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer si.Close()
+	return db.execStmt(dc, si, done, nargs)
+}
+
+// execStmt executes si, a statement on dc, abandoning it if done is
+// closed.
+func (db *DB) execStmt(dc *driverConn, si driver.Stmt, done <-chan struct{}, nargs []driver.NamedValue) (driver.Result, error) {
+	if sn, ok := si.(driver.StmtNamed); ok {
+		return sn.ExecNamed(done, nargs)
+	}
+	args, err := positionalArgs(nargs)
+	if err != nil {
+		return nil, err
+	}
+	if sc, ok := si.(driver.StmtCanceler); ok && done != nil {
+		return sc.ExecCancel(done, args)
+	}
+	stop := db.interrupt(dc, done)
+	defer stop()
+	return si.Exec(args)
+}
+
+// queryStmt runs si, a statement on dc, abandoning it if done is
+// closed.  Unless the driver handles done, the returned stop function
+// must be called once the rows are closed.
+func (db *DB) queryStmt(dc *driverConn, si driver.Stmt, done <-chan struct{}, nargs []driver.NamedValue) (rowsi driver.Rows, stop func() bool, err error) {
+	if sn, ok := si.(driver.StmtNamed); ok {
+		rowsi, err = sn.QueryNamed(done, nargs)
+		return rowsi, nil, err
+	}
+	args, err := positionalArgs(nargs)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sc, ok := si.(driver.StmtCanceler); ok && done != nil {
+		rowsi, err = sc.QueryCancel(done, args)
+		return rowsi, nil, err
+	}
+	stop = db.interrupt(dc, done)
+	rowsi, err = si.Query(args)
+	return rowsi, stop, err
+}
+
+// Ping verifies that a connection to the database is still alive,
+// establishing a connection if necessary.  If the driver's connection
+// implements driver.Pinger, Ping uses it to check the connection.
+func (db *DB) Ping() error {
+	var err error
+	for i := 0; i <= maxBadConnRetries; i++ {
+		strategy := cachedOrNewConn
+		if i == maxBadConnRetries {
+			strategy = alwaysNewConn
+		}
+		err = db.ping(strategy)
+		if err != driver.ErrBadConn {
+			break
+		}
+	}
+	return err
+}
+
+func (db *DB) ping(strategy connReuseStrategy) (err error) {
+	dc, err := db.conn(strategy, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		db.putConn(dc, err)
+	}()
+	if pinger, ok := dc.ci.(driver.Pinger); ok {
+		err = pinger.Ping()
+	}
+	return err
 }
 
 // Prepare creates a prepared statement for later execution.
 func (db *DB) Prepare(query string) (*Stmt, error) {
+	return db.prepareCancel(nil, query)
+}
+
+func (db *DB) prepareCancel(done <-chan struct{}, query string) (*Stmt, error) {
+	var stmt *Stmt
+	var err error
+	for i := 0; i <= maxBadConnRetries; i++ {
+		strategy := cachedOrNewConn
+		if i == maxBadConnRetries {
+			strategy = alwaysNewConn
+		}
+		stmt, err = db.prepare(done, query, strategy)
+		if err != driver.ErrBadConn {
+			break
+		}
+	}
+	return stmt, err
+}
+
+func (db *DB) prepare(done <-chan struct{}, query string, strategy connReuseStrategy) (stmt *Stmt, err error) {
 	// TODO: check if db.driver supports an optional
 	// driver.Preparer interface and call that instead, if so,
 	// otherwise we make a prepared statement that's bound
 	// to a connection, and to execute this prepared statement
 	// we either need to use this connection (if it's free), else
 	// get a new connection + re-prepare + execute on that one.
-	ci, err := db.conn()
+	dc, err := db.conn(strategy, done)
 	if err != nil {
 		return nil, err
 	}
-	defer db.putConn(ci)
-	si, err := ci.Prepare(query)
+	defer func() {
+		db.putConn(dc, err)
+	}()
+	si, err := dc.ci.Prepare(query)
 	if err != nil {
 		return nil, err
 	}
-	stmt := &Stmt{
+	stmt = &Stmt{
 		db:    db,
 		query: query,
-		css:   []connStmt{{ci, si}},
+		css:   []connStmt{{dc, si}},
 	}
 	return stmt, nil
 }
 
 // Exec executes a query without returning any rows.
 func (db *DB) Exec(query string, args ...interface{}) (Result, error) {
-	sargs, err := subsetTypeArgs(args)
-	if err != nil {
-		return nil, err
-	}
+	return db.ExecCancel(nil, query, args...)
+}
 
-	ci, err := db.conn()
+// ExecCancel is like Exec, but abandons the query and returns
+// ErrCanceled once done is closed.
+func (db *DB) ExecCancel(done <-chan struct{}, query string, args ...interface{}) (Result, error) {
+	sargs, err := subsetTypeArgs(args)
 	if err != nil {
 		return nil, err
 	}
-	defer db.putConn(ci)
 
-	if execer, ok := ci.(driver.Execer); ok {
-		resi, err := execer.Exec(query, sargs)
-		if err != driver.ErrSkip {
-			if err != nil {
-				return nil, err
-			}
-			return result{resi}, nil
+	var res Result
+	for i := 0; i <= maxBadConnRetries; i++ {
+		strategy := cachedOrNewConn
+		if i == maxBadConnRetries {
+			strategy = alwaysNewConn
+		}
+		res, err = db.exec(done, query, sargs, strategy)
+		if err != driver.ErrBadConn {
+			break
 		}
 	}
+	return res, err
+}
 
-	sti, err := ci.Prepare(query)
+func (db *DB) exec(done <-chan struct{}, query string, sargs []driver.NamedValue, strategy connReuseStrategy) (Result, error) {
+	dc, err := db.conn(strategy, done)
 	if err != nil {
 		return nil, err
 	}
-	defer sti.Close()
-
-	resi, err := sti.Exec(sargs)
+	resi, err := db.execConn(dc, done, query, sargs)
+	err, releaseErr := cancelResult(done, err)
+	db.putConn(dc, releaseErr)
 	if err != nil {
 		return nil, err
 	}
@@ -330,11 +854,18 @@ func (db *DB) Exec(query string, args ...interface{}) (Result, error) {
 
 // Query executes a query that returns rows, typically a SELECT.
 func (db *DB) Query(query string, args ...interface{}) (*Rows, error) {
-	stmt, err := db.Prepare(query)
+	return db.QueryCancel(nil, query, args...)
+}
+
+// QueryCancel is like Query, but abandons the query once done is
+// closed: it returns ErrCanceled, or if the rows have already been
+// returned, their Next returns false and Err returns ErrCanceled.
+func (db *DB) QueryCancel(done <-chan struct{}, query string, args ...interface{}) (*Rows, error) {
+	stmt, err := db.prepareCancel(done, query)
 	if err != nil {
 		return nil, err
 	}
-	rows, err := stmt.Query(args...)
+	rows, err := stmt.QueryCancel(done, args...)
 	if err != nil {
 		stmt.Close()
 		return nil, err
@@ -347,27 +878,138 @@ func (db *DB) Query(query string, args ...interface{}) (*Rows, error) {
 // QueryRow always return a non-nil value. Errors are deferred until
 // Row's Scan method is called.
 func (db *DB) QueryRow(query string, args ...interface{}) *Row {
-	rows, err := db.Query(query, args...)
+	return db.QueryRowCancel(nil, query, args...)
+}
+
+// QueryRowCancel is like QueryRow, but abandons the query once done is
+// closed.
+func (db *DB) QueryRowCancel(done <-chan struct{}, query string, args ...interface{}) *Row {
+	rows, err := db.QueryCancel(done, query, args...)
 	return &Row{rows: rows, err: err}
 }
 
 // Begin starts a transaction. The isolation level is dependent on
 // the driver.
 func (db *DB) Begin() (*Tx, error) {
-	ci, err := db.conn()
+	return db.BeginTx(nil, nil)
+}
+
+// BeginCancel is like Begin, but if done is closed before the
+// transaction is committed or rolled back, the operation in progress
+// in it is abandoned and the transaction is rolled back, after which
+// its operations fail with ErrTxDone.
+func (db *DB) BeginCancel(done <-chan struct{}) (*Tx, error) {
+	return db.BeginTx(done, nil)
+}
+
+// IsolationLevel is the transaction isolation level used in TxOptions.
+type IsolationLevel int
+
+// Isolation levels that drivers may support in BeginTx.  A driver
+// that doesn't support a level returns an error rather than use
+// another one.  See https://en.wikipedia.org/wiki/Isolation_(database_systems)#Isolation_levels.
+const (
+	LevelDefault IsolationLevel = iota
+	LevelReadUncommitted
+	LevelReadCommitted
+	LevelWriteCommitted
+	LevelRepeatableRead
+	LevelSnapshot
+	LevelSerializable
+	LevelLinearizable
+)
+
+var isolationLevelNames = []string{
+	LevelDefault:         "Default",
+	LevelReadUncommitted: "Read Uncommitted",
+	LevelReadCommitted:   "Read Committed",
+	LevelWriteCommitted:  "Write Committed",
+	LevelRepeatableRead:  "Repeatable Read",
+	LevelSnapshot:        "Snapshot",
+	LevelSerializable:    "Serializable",
+	LevelLinearizable:    "Linearizable",
+}
+
+func (i IsolationLevel) String() string {
+	if i < 0 || int(i) >= len(isolationLevelNames) {
+		return "IsolationLevel(" + strconv.Itoa(int(i)) + ")"
+	}
+	return isolationLevelNames[i]
+}
+
+// TxOptions holds the options of a transaction begun with BeginTx.
+type TxOptions struct {
+	// Isolation is the isolation level of the transaction.  If
+	// it's zero, the driver's default level is used.
+	Isolation IsolationLevel
+	ReadOnly  bool
+}
+
+// BeginTx is like BeginCancel, but starts the transaction with the
+// given options, which may be nil for the defaults.  If the driver
+// doesn't support the options, BeginTx returns an error.
+func (db *DB) BeginTx(done <-chan struct{}, opts *TxOptions) (*Tx, error) {
+	var tx *Tx
+	var err error
+	for i := 0; i <= maxBadConnRetries; i++ {
+		strategy := cachedOrNewConn
+		if i == maxBadConnRetries {
+			strategy = alwaysNewConn
+		}
+		tx, err = db.begin(done, opts, strategy)
+		if err != driver.ErrBadConn {
+			break
+		}
+	}
+	return tx, err
+}
+
+func (db *DB) begin(done <-chan struct{}, opts *TxOptions, strategy connReuseStrategy) (*Tx, error) {
+	dc, err := db.conn(strategy, done)
 	if err != nil {
 		return nil, err
 	}
-	txi, err := ci.Begin()
+	var txi driver.Tx
+	handlesDone := false // whether the driver abandons the transaction itself
+	if bt, ok := dc.ci.(driver.ConnBeginTx); ok {
+		var dopts driver.TxOptions
+		if opts != nil {
+			dopts = driver.TxOptions{
+				Isolation: driver.IsolationLevel(opts.Isolation),
+				ReadOnly:  opts.ReadOnly,
+			}
+		}
+		txi, err = bt.BeginTx(done, dopts)
+		handlesDone = true
+	} else if opts != nil && opts.Isolation != LevelDefault {
+		db.putConn(dc, nil)
+		return nil, fmt.Errorf("sql: driver does not support isolation level %v", opts.Isolation)
+	} else if opts != nil && opts.ReadOnly {
+		db.putConn(dc, nil)
+		return nil, errors.New("sql: driver does not support read-only transactions")
+	} else if bc, ok := dc.ci.(driver.ConnBeginCanceler); ok && done != nil {
+		txi, err = bc.BeginCancel(done)
+		handlesDone = true
+	} else {
+		txi, err = dc.ci.Begin()
+	}
 	if err != nil {
-		db.putConn(ci)
+		db.putConn(dc, err)
+		if err == driver.ErrBadConn {
+			return nil, err
+		}
 		return nil, fmt.Errorf("sql: failed to Begin transaction: %v", err)
 	}
-	return &Tx{
+	tx := &Tx{
 		db:  db,
-		ci:  ci,
+		dc:  dc,
 		txi: txi,
-	}, nil
+	}
+	if done != nil {
+		tx.stop = make(chan struct{})
+		go tx.awaitDone(dc, done, !handlesDone)
+	}
+	return tx, nil
 }
 
 // Driver returns the database's underlying driver.
@@ -384,61 +1026,131 @@ func (db *DB) Driver() driver.Driver {
 type Tx struct {
 	db *DB
 
-	// ci is owned exclusively until Commit or Rollback, at which point
+	// dc is owned exclusively until Commit or Rollback, at which point
 	// it's returned with putConn.
-	ci  driver.Conn
+	dc  *driverConn
 	txi driver.Tx
 
-	// cimu is held while somebody is using ci (between grabConn
+	// cimu is held while somebody is using dc (between grabConn
 	// and releaseConn)
 	cimu sync.Mutex
 
 	// done transitions from false to true exactly once, on Commit
-	// or Rollback. once done, all operations fail with
-	// ErrTxDone.
+	// or Rollback, or when the transaction is canceled. once done,
+	// all operations fail with ErrTxDone.
+	mu   sync.Mutex // guards done
 	done bool
+
+	// stop is closed when the transaction ends, if it was begun
+	// with a done channel, to stop awaitDone.
+	stop chan struct{}
 }
 
 var ErrTxDone = errors.New("sql: Transaction has already been committed or rolled back")
 
-func (tx *Tx) close() {
+// markDone marks the transaction done, reporting false if it already
+// was.  The caller that marks it done must then call close.
+func (tx *Tx) markDone() bool {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
 	if tx.done {
-		panic("double close") // internal error
+		return false
 	}
 	tx.done = true
-	tx.db.putConn(tx.ci)
-	tx.ci = nil
+	return true
+}
+
+func (tx *Tx) isDone() bool {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	return tx.done
+}
+
+// close returns the transaction's connection to the pool.  Err is
+// the result of the Commit or Rollback.
+func (tx *Tx) close(err error) {
+	if tx.stop != nil {
+		close(tx.stop)
+	}
+	tx.db.putConn(tx.dc, err)
+	tx.dc = nil
 	tx.txi = nil
 }
 
-func (tx *Tx) grabConn() (driver.Conn, error) {
-	if tx.done {
+func (tx *Tx) grabConn() (*driverConn, error) {
+	if tx.isDone() {
 		return nil, ErrTxDone
 	}
 	tx.cimu.Lock()
-	return tx.ci, nil
+	if tx.isDone() {
+		// Canceled while waiting for the connection.
+		tx.cimu.Unlock()
+		return nil, ErrTxDone
+	}
+	return tx.dc, nil
 }
 
-func (tx *Tx) releaseConn() {
+// releaseConn releases the connection taken by grabConn.  Err is the
+// error with which the operation on it should release it; ErrCanceled
+// rolls the transaction back.
+func (tx *Tx) releaseConn(err error) {
+	if err == ErrCanceled {
+		tx.cancelLocked()
+	}
+	tx.cimu.Unlock()
+}
+
+// cancelLocked rolls back and closes the transaction after an
+// operation in it was abandoned.  It must be called with tx.cimu held.
+func (tx *Tx) cancelLocked() {
+	if !tx.markDone() {
+		return
+	}
+	tx.txi.Rollback()
+	tx.close(ErrCanceled)
+}
+
+// awaitDone cancels the transaction if done is closed before it ends.
+// If interrupt is set, the driver doesn't handle done, so the
+// operation in progress on dc is first interrupted by closing dc.
+func (tx *Tx) awaitDone(dc *driverConn, done <-chan struct{}, interrupt bool) {
+	select {
+	case <-done:
+	case <-tx.stop:
+		return
+	}
+	// Once Commit or Rollback has marked the transaction done, dc
+	// may already be back in the pool and in use by somebody else.
+	if !tx.markDone() {
+		return
+	}
+	if interrupt {
+		tx.db.closeConn(dc)
+	}
+	tx.cimu.Lock()
+	tx.txi.Rollback()
+	tx.close(ErrCanceled)
 	tx.cimu.Unlock()
 }
 
 // Commit commits the transaction.
 func (tx *Tx) Commit() error {
-	if tx.done {
+	if !tx.markDone() {
 		return ErrTxDone
 	}
-	defer tx.close()
-	return tx.txi.Commit()
+	err := tx.txi.Commit()
+	tx.close(err)
+	return err
 }
 
 // Rollback aborts the transaction.
 func (tx *Tx) Rollback() error {
-	if tx.done {
+	if !tx.markDone() {
 		return ErrTxDone
 	}
-	defer tx.close()
-	return tx.txi.Rollback()
+	err := tx.txi.Rollback()
+	tx.close(err)
+	return err
 }
 
 // Prepare creates a prepared statement for use within a transaction.
@@ -461,13 +1173,13 @@ func (tx *Tx) Prepare(query string) (*Stmt, error) {
 	// Perhaps just looking at the reference count (by noting
 	// Stmt.Close) would be enough. We might also want a finalizer
 	// on Stmt to drop the reference count.
-	ci, err := tx.grabConn()
+	dc, err := tx.grabConn()
 	if err != nil {
 		return nil, err
 	}
-	defer tx.releaseConn()
+	defer tx.releaseConn(nil)
 
-	si, err := ci.Prepare(query)
+	si, err := dc.ci.Prepare(query)
 	if err != nil {
 		return nil, err
 	}
@@ -499,12 +1211,12 @@ func (tx *Tx) Stmt(stmt *Stmt) *Stmt {
 	if tx.db != stmt.db {
 		return &Stmt{stickyErr: errors.New("sql: Tx.Stmt: statement from different database used")}
 	}
-	ci, err := tx.grabConn()
+	dc, err := tx.grabConn()
 	if err != nil {
 		return &Stmt{stickyErr: err}
 	}
-	defer tx.releaseConn()
-	si, err := ci.Prepare(stmt.query)
+	defer tx.releaseConn(nil)
+	si, err := dc.ci.Prepare(stmt.query)
 	return &Stmt{
 		db:        tx.db,
 		tx:        tx,
@@ -517,34 +1229,24 @@ func (tx *Tx) Stmt(stmt *Stmt) *Stmt {
 // Exec executes a query that doesn't return rows.
 // For example: an INSERT and UPDATE.
 func (tx *Tx) Exec(query string, args ...interface{}) (Result, error) {
-	ci, err := tx.grabConn()
-	if err != nil {
-		return nil, err
-	}
-	defer tx.releaseConn()
+	return tx.ExecCancel(nil, query, args...)
+}
 
+// ExecCancel is like Exec, but abandons the query and returns
+// ErrCanceled once done is closed, which also rolls back the
+// transaction.
+func (tx *Tx) ExecCancel(done <-chan struct{}, query string, args ...interface{}) (Result, error) {
 	sargs, err := subsetTypeArgs(args)
 	if err != nil {
 		return nil, err
 	}
-
-	if execer, ok := ci.(driver.Execer); ok {
-		resi, err := execer.Exec(query, sargs)
-		if err == nil {
-			return result{resi}, nil
-		}
-		if err != driver.ErrSkip {
-			return nil, err
-		}
-	}
-
-	sti, err := ci.Prepare(query)
+	dc, err := tx.grabConn()
 	if err != nil {
 		return nil, err
 	}
-	defer sti.Close()
-
-	resi, err := sti.Exec(sargs)
+	resi, err := tx.db.execConn(dc, done, query, sargs)
+	err, releaseErr := cancelResult(done, err)
+	tx.releaseConn(releaseErr)
 	if err != nil {
 		return nil, err
 	}
@@ -553,14 +1255,21 @@ func (tx *Tx) Exec(query string, args ...interface{}) (Result, error) {
 
 // Query executes a query that returns rows, typically a SELECT.
 func (tx *Tx) Query(query string, args ...interface{}) (*Rows, error) {
-	if tx.done {
+	return tx.QueryCancel(nil, query, args...)
+}
+
+// QueryCancel is like Query, but abandons the query once done is
+// closed, as DB.QueryCancel does, which also rolls back the
+// transaction.
+func (tx *Tx) QueryCancel(done <-chan struct{}, query string, args ...interface{}) (*Rows, error) {
+	if tx.isDone() {
 		return nil, ErrTxDone
 	}
 	stmt, err := tx.Prepare(query)
 	if err != nil {
 		return nil, err
 	}
-	rows, err := stmt.Query(args...)
+	rows, err := stmt.QueryCancel(done, args...)
 	if err == nil {
 		rows.closeStmt = stmt
 	}
@@ -571,13 +1280,19 @@ func (tx *Tx) Query(query string, args ...interface{}) (*Rows, error) {
 // QueryRow always return a non-nil value. Errors are deferred until
 // Row's Scan method is called.
 func (tx *Tx) QueryRow(query string, args ...interface{}) *Row {
-	rows, err := tx.Query(query, args...)
+	return tx.QueryRowCancel(nil, query, args...)
+}
+
+// QueryRowCancel is like QueryRow, but abandons the query once done is
+// closed, which also rolls back the transaction.
+func (tx *Tx) QueryRowCancel(done <-chan struct{}, query string, args ...interface{}) *Row {
+	rows, err := tx.QueryCancel(done, query, args...)
 	return &Row{rows: rows, err: err}
 }
 
 // connStmt is a prepared statement on a particular connection.
 type connStmt struct {
-	ci driver.Conn
+	dc *driverConn
 	si driver.Stmt
 }
 
@@ -605,11 +1320,36 @@ type Stmt struct {
 // Exec executes a prepared statement with the given arguments and
 // returns a Result summarizing the effect of the statement.
 func (s *Stmt) Exec(args ...interface{}) (Result, error) {
-	_, releaseConn, si, err := s.connStmt()
+	return s.ExecCancel(nil, args...)
+}
+
+// ExecCancel is like Exec, but abandons the statement and returns
+// ErrCanceled once done is closed.
+func (s *Stmt) ExecCancel(done <-chan struct{}, args ...interface{}) (Result, error) {
+	var res Result
+	var err error
+	for i := 0; i <= maxBadConnRetries; i++ {
+		strategy := cachedOrNewConn
+		if i == maxBadConnRetries {
+			strategy = alwaysNewConn
+		}
+		res, err = s.execOnce(done, args, strategy)
+		if err != driver.ErrBadConn || s.tx != nil {
+			break
+		}
+	}
+	return res, err
+}
+
+func (s *Stmt) execOnce(done <-chan struct{}, args []interface{}, strategy connReuseStrategy) (res Result, err error) {
+	dc, releaseConn, si, err := s.connStmt(done, strategy)
 	if err != nil {
 		return nil, err
 	}
-	defer releaseConn()
+	releaseErr := error(nil)
+	defer func() {
+		releaseConn(releaseErr)
+	}()
 
 	// -1 means the driver doesn't know how to count the number of
 	// placeholders, so we won't sanity check input here and instead let the
@@ -618,11 +1358,17 @@ func (s *Stmt) Exec(args ...interface{}) (Result, error) {
 		return nil, fmt.Errorf("sql: expected %d arguments, got %d", want, len(args))
 	}
 
-	sargs := make([]driver.Value, len(args))
+	sargs := make([]driver.NamedValue, len(args))
 
 	// Convert args to subset types.
 	if cc, ok := si.(driver.ColumnConverter); ok {
 		for n, arg := range args {
+			sargs[n].Ordinal = n + 1
+			sargs[n].Name, arg, err = namedArg(arg)
+			if err != nil {
+				return nil, err
+			}
+
 			// First, see if the value itself knows how to convert
 			// itself to a driver type.  For example, a NullString
 			// struct changing into a string or nil.
@@ -644,25 +1390,31 @@ func (s *Stmt) Exec(args ...interface{}) (Result, error) {
 			// truncated), or that a nil can't go into a NOT NULL
 			// column before going across the network to get the
 			// same error.
-			sargs[n], err = cc.ColumnConverter(n).ConvertValue(arg)
+			sargs[n].Value, err = cc.ColumnConverter(n).ConvertValue(arg)
 			if err != nil {
 				return nil, fmt.Errorf("sql: converting Exec argument #%d's type: %v", n, err)
 			}
-			if !driver.IsValue(sargs[n]) {
+			if !driver.IsValue(sargs[n].Value) {
 				return nil, fmt.Errorf("sql: driver ColumnConverter error converted %T to unsupported type %T",
-					arg, sargs[n])
+					arg, sargs[n].Value)
 			}
 		}
 	} else {
 		for n, arg := range args {
-			sargs[n], err = driver.DefaultParameterConverter.ConvertValue(arg)
+			sargs[n].Ordinal = n + 1
+			sargs[n].Name, arg, err = namedArg(arg)
+			if err != nil {
+				return nil, err
+			}
+			sargs[n].Value, err = driver.DefaultParameterConverter.ConvertValue(arg)
 			if err != nil {
 				return nil, fmt.Errorf("sql: converting Exec argument #%d's type: %v", n, err)
 			}
 		}
 	}
 
-	resi, err := si.Exec(sargs)
+	resi, err := s.db.execStmt(dc, si, done, sargs)
+	err, releaseErr = cancelResult(done, err)
 	if err != nil {
 		return nil, err
 	}
@@ -670,9 +1422,9 @@ func (s *Stmt) Exec(args ...interface{}) (Result, error) {
 }
 
 // connStmt returns a free driver connection on which to execute the
-// statement, a function to call to release the connection, and a
-// statement bound to that connection.
-func (s *Stmt) connStmt() (ci driver.Conn, releaseConn func(), si driver.Stmt, err error) {
+// statement, a function to call to release the connection with the
+// error of the operation, and a statement bound to that connection.
+func (s *Stmt) connStmt(done <-chan struct{}, strategy connReuseStrategy) (dc *driverConn, releaseConn func(error), si driver.Stmt, err error) {
 	if err = s.stickyErr; err != nil {
 		return
 	}
@@ -687,52 +1439,90 @@ func (s *Stmt) connStmt() (ci driver.Conn, releaseConn func(), si driver.Stmt, e
 	// transaction was created on.
 	if s.tx != nil {
 		s.mu.Unlock()
-		ci, err = s.tx.grabConn() // blocks, waiting for the connection.
+		dc, err = s.tx.grabConn() // blocks, waiting for the connection.
 		if err != nil {
 			return
 		}
-		releaseConn = func() { s.tx.releaseConn() }
-		return ci, releaseConn, s.txsi, nil
+		releaseConn = func(err error) { s.tx.releaseConn(err) }
+		return dc, releaseConn, s.txsi, nil
 	}
 
+	s.removeClosedStmtLocked()
 	var cs connStmt
 	match := false
-	for _, v := range s.css {
-		// TODO(bradfitz): lazily clean up entries in this
-		// list with dead conns while enumerating
-		if _, match = s.db.connIfFree(cs.ci); match {
-			cs = v
-			break
+	if strategy == cachedOrNewConn {
+		for _, v := range s.css {
+			if _, match = s.db.connIfFree(v.dc); match {
+				cs = v
+				break
+			}
 		}
 	}
 	s.mu.Unlock()
 
 	// Make a new conn if all are busy.
-	// TODO(bradfitz): or wait for one? make configurable later?
 	if !match {
-		ci, err := s.db.conn()
+		dc, err := s.db.conn(strategy, done)
 		if err != nil {
 			return nil, nil, nil, err
 		}
-		si, err := ci.Prepare(s.query)
+		si, err := dc.ci.Prepare(s.query)
 		if err != nil {
+			s.db.putConn(dc, err)
 			return nil, nil, nil, err
 		}
 		s.mu.Lock()
-		cs = connStmt{ci, si}
+		cs = connStmt{dc, si}
 		s.css = append(s.css, cs)
 		s.mu.Unlock()
 	}
 
-	conn := cs.ci
-	releaseConn = func() { s.db.putConn(conn) }
+	conn := cs.dc
+	releaseConn = func(err error) { s.db.putConn(conn, err) }
 	return conn, releaseConn, cs.si, nil
 }
 
+// removeClosedStmtLocked forgets the statements whose connections
+// have been closed.  It must be called with s.mu held.
+func (s *Stmt) removeClosedStmtLocked() {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	css := s.css[:0]
+	for _, v := range s.css {
+		if !v.dc.closed {
+			css = append(css, v)
+		}
+	}
+	s.css = css
+}
+
 // Query executes a prepared query statement with the given arguments
 // and returns the query results as a *Rows.
 func (s *Stmt) Query(args ...interface{}) (*Rows, error) {
-	ci, releaseConn, si, err := s.connStmt()
+	return s.QueryCancel(nil, args...)
+}
+
+// QueryCancel is like Query, but abandons the query once done is
+// closed: it returns ErrCanceled, or if the rows have already been
+// returned, their Next returns false and Err returns ErrCanceled.
+func (s *Stmt) QueryCancel(done <-chan struct{}, args ...interface{}) (*Rows, error) {
+	var rows *Rows
+	var err error
+	for i := 0; i <= maxBadConnRetries; i++ {
+		strategy := cachedOrNewConn
+		if i == maxBadConnRetries {
+			strategy = alwaysNewConn
+		}
+		rows, err = s.queryOnce(done, args, strategy)
+		if err != driver.ErrBadConn || s.tx != nil {
+			break
+		}
+	}
+	return rows, err
+}
+
+func (s *Stmt) queryOnce(done <-chan struct{}, args []interface{}, strategy connReuseStrategy) (*Rows, error) {
+	dc, releaseConn, si, err := s.connStmt(done, strategy)
 	if err != nil {
 		return nil, err
 	}
@@ -741,24 +1531,32 @@ func (s *Stmt) Query(args ...interface{}) (*Rows, error) {
 	// placeholders, so we won't sanity check input here and instead let the
 	// driver deal with errors.
 	if want := si.NumInput(); want != -1 && len(args) != want {
+		releaseConn(nil)
 		return nil, fmt.Errorf("sql: statement expects %d inputs; got %d", si.NumInput(), len(args))
 	}
 	sargs, err := subsetTypeArgs(args)
 	if err != nil {
+		releaseConn(nil)
 		return nil, err
 	}
-	rowsi, err := si.Query(sargs)
+	rowsi, stop, err := s.db.queryStmt(dc, si, done, sargs)
 	if err != nil {
-		s.db.putConn(ci)
+		if stop != nil {
+			stop()
+		}
+		err, releaseErr := cancelResult(done, err)
+		releaseConn(releaseErr)
 		return nil, err
 	}
-	// Note: ownership of ci passes to the *Rows, to be freed
+	// Note: ownership of dc passes to the *Rows, to be freed
 	// with releaseConn.
 	rows := &Rows{
 		db:          s.db,
-		ci:          ci,
+		dc:          dc,
 		releaseConn: releaseConn,
 		rowsi:       rowsi,
+		done:        done,
+		stop:        stop,
 	}
 	return rows, nil
 }
@@ -775,7 +1573,13 @@ func (s *Stmt) Query(args ...interface{}) (*Rows, error) {
 //  var name string
 //  err := nameByUseridStmt.QueryRow(id).Scan(&name)
 func (s *Stmt) QueryRow(args ...interface{}) *Row {
-	rows, err := s.Query(args...)
+	return s.QueryRowCancel(nil, args...)
+}
+
+// QueryRowCancel is like QueryRow, but abandons the query once done is
+// closed.
+func (s *Stmt) QueryRowCancel(done <-chan struct{}, args ...interface{}) *Row {
+	rows, err := s.QueryCancel(done, args...)
 	if err != nil {
 		return &Row{err: err}
 	}
@@ -798,9 +1602,9 @@ func (s *Stmt) Close() error {
 		s.txsi.Close()
 	} else {
 		for _, v := range s.css {
-			if ci, match := s.db.connIfFree(v.ci); match {
+			if dc, match := s.db.connIfFree(v.dc); match {
 				v.si.Close()
-				s.db.putConn(ci)
+				s.db.putConn(dc, nil)
 			} else {
 				// TODO(bradfitz): care that we can't close
 				// this statement because the statement's
@@ -826,9 +1630,11 @@ func (s *Stmt) Close() error {
 //     ...
 type Rows struct {
 	db          *DB
-	ci          driver.Conn // owned; must call putconn when closed to release
-	releaseConn func()
+	dc          *driverConn // owned; must call releaseConn when closed to release
+	releaseConn func(error)
 	rowsi       driver.Rows
+	done        <-chan struct{} // closed to abandon the query
+	stop        func() bool     // if non-nil, stops interrupting dc on close
 
 	closed    bool
 	lastcols  []driver.Value
@@ -847,16 +1653,72 @@ func (rs *Rows) Next() bool {
 	if rs.lasterr != nil {
 		return false
 	}
+	if canceled(rs.done) {
+		rs.lasterr = ErrCanceled
+		rs.Close()
+		return false
+	}
 	if rs.lastcols == nil {
 		rs.lastcols = make([]driver.Value, len(rs.rowsi.Columns()))
 	}
 	rs.lasterr = rs.rowsi.Next(rs.lastcols)
-	if rs.lasterr == io.EOF {
+	if rs.lasterr != nil && canceled(rs.done) {
+		rs.lasterr = ErrCanceled
+	}
+	switch rs.lasterr {
+	case io.EOF:
+		// Stay open for NextResultSet if another set follows.
+		if nr, ok := rs.rowsi.(driver.RowsNextResultSet); !ok || !nr.HasNextResultSet() {
+			rs.Close()
+		}
+	case ErrCanceled:
 		rs.Close()
 	}
 	return rs.lasterr == nil
 }
 
+// NextResultSet prepares the next result set for reading, for queries
+// that return several.  It reports whether there is one; it returns
+// false if there are no more result sets or if advancing failed, in
+// which case Err returns the error.  Next must be called before
+// Scan, even for the first row of the new result set.
+//
+//     for {
+//         for rows.Next() {
+//             ...
+//         }
+//         if !rows.NextResultSet() {
+//             break
+//         }
+//     }
+//     err = rows.Err()
+func (rs *Rows) NextResultSet() bool {
+	if rs.closed {
+		return false
+	}
+	if rs.lasterr != nil && rs.lasterr != io.EOF {
+		return false
+	}
+	if canceled(rs.done) {
+		rs.lasterr = ErrCanceled
+		rs.Close()
+		return false
+	}
+	rs.lastcols = nil
+	nr, ok := rs.rowsi.(driver.RowsNextResultSet)
+	if !ok {
+		rs.lasterr = io.EOF
+		rs.Close()
+		return false
+	}
+	rs.lasterr = nr.NextResultSet()
+	if rs.lasterr != nil {
+		rs.Close()
+		return false
+	}
+	return true
+}
+
 // Err returns the error, if any, that was encountered during iteration.
 func (rs *Rows) Err() error {
 	if rs.lasterr == io.EOF {
@@ -878,6 +1740,104 @@ func (rs *Rows) Columns() ([]string, error) {
 	return rs.rowsi.Columns(), nil
 }
 
+// ColumnTypes returns the names and types of the columns of the
+// current result set.  It returns an error under the same conditions
+// as Columns.
+func (rs *Rows) ColumnTypes() ([]*ColumnType, error) {
+	if rs.closed {
+		return nil, errors.New("sql: Rows are closed")
+	}
+	if rs.rowsi == nil {
+		return nil, errors.New("sql: no Rows available")
+	}
+	return columnTypes(rs.rowsi), nil
+}
+
+// ColumnType describes the type of a column.  The driver may not
+// know all of it, in which case the methods report so or return
+// defaults.
+type ColumnType struct {
+	name string
+
+	hasNullable       bool
+	hasLength         bool
+	hasPrecisionScale bool
+
+	nullable     bool
+	length       int64
+	databaseType string
+	precision    int64
+	scale        int64
+	scanType     reflect.Type
+}
+
+// Name returns the name of the column.
+func (ci *ColumnType) Name() string {
+	return ci.name
+}
+
+// Length returns the length of variable length column types such as
+// text and binary types, which is math.MaxInt64 if the type is
+// unbounded.  Ok is false if the column type has no length or the
+// driver doesn't report it.
+func (ci *ColumnType) Length() (length int64, ok bool) {
+	return ci.length, ci.hasLength
+}
+
+// DecimalSize returns the precision and scale of a decimal column.
+// Ok is false if the column isn't a decimal or the driver doesn't
+// report it.
+func (ci *ColumnType) DecimalSize() (precision, scale int64, ok bool) {
+	return ci.precision, ci.scale, ci.hasPrecisionScale
+}
+
+// ScanType returns a Go type suitable for scanning the column into.
+// If the driver doesn't report one, ScanType returns the type of
+// interface{}.
+func (ci *ColumnType) ScanType() reflect.Type {
+	return ci.scanType
+}
+
+// Nullable reports whether the column may be NULL.  Ok is false if
+// the driver doesn't report it.
+func (ci *ColumnType) Nullable() (nullable, ok bool) {
+	return ci.nullable, ci.hasNullable
+}
+
+// DatabaseTypeName returns the database system's name for the column
+// type, such as "VARCHAR" or "INT", or the empty string if the driver
+// doesn't report it.
+func (ci *ColumnType) DatabaseTypeName() string {
+	return ci.databaseType
+}
+
+var interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+func columnTypes(rowsi driver.Rows) []*ColumnType {
+	names := rowsi.Columns()
+	list := make([]*ColumnType, len(names))
+	for i := range list {
+		ci := &ColumnType{name: names[i], scanType: interfaceType}
+		if prop, ok := rowsi.(driver.RowsColumnTypeScanType); ok {
+			ci.scanType = prop.ColumnTypeScanType(i)
+		}
+		if prop, ok := rowsi.(driver.RowsColumnTypeDatabaseTypeName); ok {
+			ci.databaseType = prop.ColumnTypeDatabaseTypeName(i)
+		}
+		if prop, ok := rowsi.(driver.RowsColumnTypeLength); ok {
+			ci.length, ci.hasLength = prop.ColumnTypeLength(i)
+		}
+		if prop, ok := rowsi.(driver.RowsColumnTypeNullable); ok {
+			ci.nullable, ci.hasNullable = prop.ColumnTypeNullable(i)
+		}
+		if prop, ok := rowsi.(driver.RowsColumnTypePrecisionScale); ok {
+			ci.precision, ci.scale, ci.hasPrecisionScale = prop.ColumnTypePrecisionScale(i)
+		}
+		list[i] = ci
+	}
+	return list
+}
+
 // Scan copies the columns in the current row into the values pointed
 // at by dest.
 //
@@ -930,6 +1890,38 @@ func (rs *Rows) Scan(dest ...interface{}) error {
 	return nil
 }
 
+// ScanStruct copies the columns in the current row into the fields of
+// the struct pointed at by dest, as Scan would.  A column is copied
+// into the field whose "db" tag names it, or, failing that, into the
+// untagged field of the same name; names match without regard to
+// case.  Fields tagged `db:"-"` are ignored, as are unexported ones.
+// The fields of embedded structs are matched as if they were fields of
+// dest, unless the embedded struct implements Scanner; as with Go's
+// own field selectors, a shallower field hides deeper ones of the same
+// name.  It is an error if a column matches no field.
+//
+// Example usage:
+//
+//  type Person struct {
+//      ID   int64  `db:"id"`
+//      Name string `db:"name"`
+//      Age  NullInt64
+//  }
+//  ...
+//  var p Person
+//  err = rows.ScanStruct(&p)
+func (rs *Rows) ScanStruct(dest interface{}) error {
+	cols, err := rs.Columns()
+	if err != nil {
+		return err
+	}
+	ptrs, err := structDest(dest, cols)
+	if err != nil {
+		return err
+	}
+	return rs.Scan(ptrs...)
+}
+
 // Close closes the Rows, preventing further enumeration. If the
 // end is encountered, the Rows are closed automatically. Close
 // is idempotent.
@@ -938,8 +1930,12 @@ func (rs *Rows) Close() error {
 		return nil
 	}
 	rs.closed = true
+	if rs.stop != nil {
+		rs.stop()
+	}
 	err := rs.rowsi.Close()
-	rs.releaseConn()
+	_, releaseErr := cancelResult(rs.done, err)
+	rs.releaseConn(releaseErr)
 	if rs.closeStmt != nil {
 		rs.closeStmt.Close()
 	}
@@ -993,6 +1989,26 @@ func (r *Row) Scan(dest ...interface{}) error {
 	return nil
 }
 
+// ScanStruct copies the columns from the matched row into the fields
+// of the struct pointed at by dest, as Rows.ScanStruct does.  If no
+// row matches the query, ScanStruct returns ErrNoRows.
+func (r *Row) ScanStruct(dest interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	cols, err := r.rows.Columns()
+	if err != nil {
+		r.rows.Close()
+		return err
+	}
+	ptrs, err := structDest(dest, cols)
+	if err != nil {
+		r.rows.Close()
+		return err
+	}
+	return r.Scan(ptrs...)
+}
+
 // A Result summarizes an executed SQL command.
 type Result interface {
 	LastInsertId() (int64, error)
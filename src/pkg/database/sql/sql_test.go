@@ -5,7 +5,10 @@
 package sql
 
 import (
+	"database/sql/driver"
 	"fmt"
+	"io"
+	"math"
 	"reflect"
 	"strings"
 	"testing"
@@ -430,7 +433,7 @@ func TestQueryRowClosingStmt(t *testing.T) {
 	if len(db.freeConn) != 1 {
 		t.Fatalf("expected 1 free conn")
 	}
-	fakeConn := db.freeConn[0].(*fakeConn)
+	fakeConn := db.freeConn[0].ci.(*fakeConn)
 	if made, closed := fakeConn.stmtsMade, fakeConn.stmtsClosed; made != closed {
 		t.Errorf("statement close mismatch: made %d, closed %d", made, closed)
 	}
@@ -549,3 +552,733 @@ func nullTestRun(t *testing.T, spec nullTestSpec) {
 		}
 	}
 }
+
+func TestMaxIdleConns(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer closeDB(t, db)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Commit()
+	if got := len(db.freeConn); got != 1 {
+		t.Errorf("freeConns = %d; want 1", got)
+	}
+
+	db.SetMaxIdleConns(0)
+	if got := len(db.freeConn); got != 0 {
+		t.Errorf("freeConns after set to zero = %d; want 0", got)
+	}
+	if got := db.Stats().MaxIdleClosed; got != 1 {
+		t.Errorf("MaxIdleClosed = %d; want 1", got)
+	}
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Commit()
+	if got := len(db.freeConn); got != 0 {
+		t.Errorf("freeConns = %d; want 0", got)
+	}
+	if got := db.Stats().MaxIdleClosed; got != 2 {
+		t.Errorf("MaxIdleClosed = %d; want 2", got)
+	}
+}
+
+func TestMaxOpenConns(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer closeDB(t, db)
+	db.SetMaxOpenConns(1)
+
+	rows, err := db.Query("SELECT|people|name|")
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if s := db.Stats(); s.OpenConnections != 1 || s.InUse != 1 || s.Idle != 0 {
+		t.Errorf("stats with rows open = %+v; want 1 open, 1 in use", s)
+	}
+
+	done := make(chan error)
+	go func() {
+		var name string
+		done <- db.QueryRow("SELECT|people|name|age=?", 1).Scan(&name)
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("QueryRow finished while the only connection was in use: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	rows.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("QueryRow: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("QueryRow still blocked after the connection was released")
+	}
+
+	s := db.Stats()
+	if s.MaxOpenConnections != 1 || s.OpenConnections != 1 || s.InUse != 0 || s.Idle != 1 {
+		t.Errorf("stats after release = %+v; want 1 open and idle", s)
+	}
+	if s.WaitCount != 1 || s.WaitDuration <= 0 {
+		t.Errorf("WaitCount = %d, WaitDuration = %v; want 1 and positive", s.WaitCount, s.WaitDuration)
+	}
+}
+
+func TestMaxOpenConnsClose(t *testing.T) {
+	db := newTestDB(t, "people")
+	db.SetMaxOpenConns(1)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := db.Begin()
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	closeDB(t, db)
+	select {
+	case err := <-done:
+		if err != errDBClosed {
+			t.Errorf("Begin on closed database = %v; want %v", err, errDBClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Begin still blocked after the database was closed")
+	}
+	tx.Rollback()
+	if n := db.Stats().OpenConnections; n != 0 {
+		t.Errorf("OpenConnections after close = %d; want 0", n)
+	}
+}
+
+func TestConnMaxLifetime(t *testing.T) {
+	t0 := time.Unix(1000000, 0)
+	offset := time.Duration(0)
+	nowFunc = func() time.Time { return t0.Add(offset) }
+	defer func() { nowFunc = time.Now }()
+
+	db := newTestDB(t, "people")
+	defer closeDB(t, db)
+	db.SetConnMaxLifetime(10 * time.Second)
+
+	opened := fdriver.(*fakeDriver).opened()
+	exec(t, db, "INSERT|people|name=Dave,age=?", 4)
+	if n := fdriver.(*fakeDriver).opened(); n != opened {
+		t.Errorf("opened %d connections within lifetime; want 0", n-opened)
+	}
+
+	offset = 11 * time.Second
+	exec(t, db, "INSERT|people|name=Eve,age=?", 5)
+	if n := fdriver.(*fakeDriver).opened(); n != opened+1 {
+		t.Errorf("opened %d connections after lifetime; want 1", n-opened)
+	}
+	if got := db.Stats().MaxLifetimeClosed; got != 1 {
+		t.Errorf("MaxLifetimeClosed = %d; want 1", got)
+	}
+}
+
+func TestBadConnRetry(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer closeDB(t, db)
+
+	bad := 2
+	hookPrepareBadConn = func() bool {
+		bad--
+		return bad >= 0
+	}
+	defer func() { hookPrepareBadConn = nil }()
+
+	var name string
+	if err := db.QueryRow("SELECT|people|name|age=?", 2).Scan(&name); err != nil || name != "Bob" {
+		t.Errorf("QueryRow = %q, %v; want Bob", name, err)
+	}
+	if got := db.Stats().BadConnClosed; got != 2 {
+		t.Errorf("BadConnClosed = %d; want 2", got)
+	}
+
+	bad = maxBadConnRetries + 1
+	if _, err := db.Prepare("SELECT|people|name|"); err != driver.ErrBadConn {
+		t.Errorf("Prepare on always bad connections = %v; want driver.ErrBadConn", err)
+	}
+	if n := db.Stats().OpenConnections; n != 0 {
+		t.Errorf("OpenConnections after bad connections = %d; want 0", n)
+	}
+}
+
+func TestPing(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer closeDB(t, db)
+
+	if err := db.Ping(); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	bad := 1
+	hookPingBadConn = func() bool {
+		bad--
+		return bad >= 0
+	}
+	defer func() { hookPingBadConn = nil }()
+	if err := db.Ping(); err != nil {
+		t.Fatalf("Ping after bad connection: %v", err)
+	}
+	if got := db.Stats().BadConnClosed; got != 1 {
+		t.Errorf("BadConnClosed = %d; want 1", got)
+	}
+}
+
+// cancelDSNs are the data source names of connections that are
+// interrupted by closing them and of connections that handle done
+// channels themselves.
+var cancelDSNs = []string{fakeDBName, fakeDBName + ";opt"}
+
+func TestExecCancel(t *testing.T) {
+	for _, dsn := range cancelDSNs {
+		db, err := Open("test", dsn)
+		if err != nil {
+			t.Fatalf("Open(%q): %v", dsn, err)
+		}
+		exec(t, db, "WAIT|0s")
+		fc := db.freeConn[0].ci
+
+		done := make(chan struct{})
+		time.AfterFunc(20*time.Millisecond, func() { close(done) })
+		t0 := time.Now()
+		if _, err := db.ExecCancel(done, "WAIT|10s"); err != ErrCanceled {
+			t.Errorf("%s: ExecCancel = %v; want ErrCanceled", dsn, err)
+		}
+		if d := time.Since(t0); d > 5*time.Second {
+			t.Errorf("%s: ExecCancel took %v", dsn, d)
+		}
+		if s := db.Stats(); s.OpenConnections != 0 || s.Idle != 0 {
+			t.Errorf("%s: stats after cancel = %+v; want no connections", dsn, s)
+		}
+		var closed bool
+		switch c := fc.(type) {
+		case *fakeConn:
+			closed = c.isClosed()
+		case fakeOptConn:
+			closed = c.isClosed()
+		}
+		if !closed {
+			t.Errorf("%s: canceled connection not closed", dsn)
+		}
+
+		opened := fdriver.(*fakeDriver).opened()
+		if _, err := db.ExecCancel(done, "WAIT|0s"); err != ErrCanceled {
+			t.Errorf("%s: ExecCancel after done = %v; want ErrCanceled", dsn, err)
+		}
+		if n := fdriver.(*fakeDriver).opened(); n != opened {
+			t.Errorf("%s: opened %d connections for a canceled Exec; want 0", dsn, n-opened)
+		}
+		closeDB(t, db)
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	db := newTestDB(t, "")
+	defer closeDB(t, db)
+
+	if _, err := db.ExecCancel(Deadline(time.Now().Add(10*time.Second)), "WAIT|1ms"); err != nil {
+		t.Fatalf("ExecCancel before deadline: %v", err)
+	}
+	if s := db.Stats(); s.Idle != 1 {
+		t.Errorf("idle connections after ExecCancel = %d; want 1", s.Idle)
+	}
+	if _, err := db.ExecCancel(Deadline(time.Now().Add(20*time.Millisecond)), "WAIT|10s"); err != ErrCanceled {
+		t.Errorf("ExecCancel past deadline = %v; want ErrCanceled", err)
+	}
+	if s := db.Stats(); s.Idle != 0 {
+		t.Errorf("idle connections after canceled ExecCancel = %d; want 0", s.Idle)
+	}
+}
+
+func TestCancelWaitForConn(t *testing.T) {
+	db := newTestDB(t, "")
+	defer closeDB(t, db)
+	db.SetMaxOpenConns(1)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := db.ExecCancel(Deadline(time.Now().Add(20*time.Millisecond)), "WIPE"); err != ErrCanceled {
+		t.Errorf("ExecCancel waiting for a connection = %v; want ErrCanceled", err)
+	}
+}
+
+func TestQueryCancel(t *testing.T) {
+	for _, dsn := range cancelDSNs {
+		db, err := Open("test", dsn)
+		if err != nil {
+			t.Fatalf("Open(%q): %v", dsn, err)
+		}
+		exec(t, db, "WIPE")
+		exec(t, db, "CREATE|people|name=string,age=int32")
+		exec(t, db, "INSERT|people|name=Alice,age=?", 1)
+		exec(t, db, "INSERT|people|name=Bob,age=?", 2)
+
+		done := make(chan struct{})
+		rows, err := db.QueryCancel(done, "SELECT|people|name|")
+		if err != nil {
+			t.Fatalf("%s: QueryCancel: %v", dsn, err)
+		}
+		if !rows.Next() {
+			t.Fatalf("%s: Next = false before cancel: %v", dsn, rows.Err())
+		}
+		close(done)
+		if rows.Next() {
+			t.Errorf("%s: Next = true after cancel", dsn)
+		}
+		if err := rows.Err(); err != ErrCanceled {
+			t.Errorf("%s: Err after cancel = %v; want ErrCanceled", dsn, err)
+		}
+		if s := db.Stats(); s.OpenConnections != 0 || s.Idle != 0 {
+			t.Errorf("%s: stats after cancel = %+v; want no connections", dsn, s)
+		}
+
+		done = make(chan struct{})
+		time.AfterFunc(20*time.Millisecond, func() { close(done) })
+		if _, err := db.QueryCancel(done, "WAIT|10s"); err != ErrCanceled {
+			t.Errorf("%s: QueryCancel = %v; want ErrCanceled", dsn, err)
+		}
+		closeDB(t, db)
+	}
+}
+
+func TestTxCancel(t *testing.T) {
+	for _, dsn := range cancelDSNs {
+		db, err := Open("test", dsn)
+		if err != nil {
+			t.Fatalf("Open(%q): %v", dsn, err)
+		}
+
+		done := make(chan struct{})
+		tx, err := db.BeginCancel(done)
+		if err != nil {
+			t.Fatalf("%s: BeginCancel: %v", dsn, err)
+		}
+		if _, err := tx.Exec("WAIT|0s"); err != nil {
+			t.Fatalf("%s: Exec in transaction: %v", dsn, err)
+		}
+		time.AfterFunc(20*time.Millisecond, func() { close(done) })
+		if _, err := tx.Exec("WAIT|10s"); err == nil {
+			t.Errorf("%s: Exec in canceled transaction succeeded", dsn)
+		}
+		// The cancellation closes the connection in the background.
+		deadline := time.Now().Add(5 * time.Second)
+		for db.Stats().OpenConnections != 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if err := tx.Commit(); err != ErrTxDone {
+			t.Errorf("%s: Commit after cancel = %v; want ErrTxDone", dsn, err)
+		}
+		if s := db.Stats(); s.OpenConnections != 0 {
+			t.Errorf("%s: stats after cancel = %+v; want no connections", dsn, s)
+		}
+
+		tx, err = db.Begin()
+		if err != nil {
+			t.Fatalf("%s: Begin: %v", dsn, err)
+		}
+		done = make(chan struct{})
+		time.AfterFunc(20*time.Millisecond, func() { close(done) })
+		if _, err := tx.ExecCancel(done, "WAIT|10s"); err != ErrCanceled {
+			t.Errorf("%s: Tx.ExecCancel = %v; want ErrCanceled", dsn, err)
+		}
+		if err := tx.Rollback(); err != ErrTxDone {
+			t.Errorf("%s: Rollback after canceled Exec = %v; want ErrTxDone", dsn, err)
+		}
+		if s := db.Stats(); s.OpenConnections != 0 {
+			t.Errorf("%s: stats after canceled Exec = %+v; want no connections", dsn, s)
+		}
+		closeDB(t, db)
+	}
+}
+
+func TestTxCancelAfterCommit(t *testing.T) {
+	for _, dsn := range cancelDSNs {
+		db, err := Open("test", dsn)
+		if err != nil {
+			t.Fatalf("Open(%q): %v", dsn, err)
+		}
+
+		done := make(chan struct{})
+		tx, err := db.BeginCancel(done)
+		if err != nil {
+			t.Fatalf("%s: BeginCancel: %v", dsn, err)
+		}
+		// Cancel while Commit is running, and give the
+		// cancellation time to act on the connection.
+		hookCommit = func() {
+			close(done)
+			time.Sleep(20 * time.Millisecond)
+		}
+		err = tx.Commit()
+		hookCommit = nil
+		if err != nil {
+			t.Fatalf("%s: Commit: %v", dsn, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+		if s := db.Stats(); s.OpenConnections != 1 || s.Idle != 1 {
+			t.Fatalf("%s: stats after Commit = %+v; want one idle connection", dsn, s)
+		}
+		var closed bool
+		switch c := db.freeConn[0].ci.(type) {
+		case *fakeConn:
+			closed = c.isClosed()
+		case fakeOptConn:
+			closed = c.isClosed()
+		}
+		if closed {
+			t.Errorf("%s: connection of committed transaction closed by its cancellation", dsn)
+		}
+
+		opened := fdriver.(*fakeDriver).opened()
+		exec(t, db, "WAIT|0s")
+		if n := fdriver.(*fakeDriver).opened(); n != opened {
+			t.Errorf("%s: opened %d connections after Commit; want to reuse the committed one", dsn, n-opened)
+		}
+		closeDB(t, db)
+	}
+}
+
+func TestRowsColumnTypes(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer closeDB(t, db)
+
+	rows, err := db.Query("SELECT|people|name,age,photo,bdate|")
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	defer rows.Close()
+	cts, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatalf("ColumnTypes: %v", err)
+	}
+	want := []struct {
+		name     string
+		dbType   string
+		scanType reflect.Type
+		nullable bool
+		length   int64
+		hasLen   bool
+	}{
+		{"name", "STRING", reflect.TypeOf(""), false, math.MaxInt64, true},
+		{"age", "INT32", reflect.TypeOf(int32(0)), false, 0, false},
+		{"photo", "BLOB", reflect.TypeOf([]byte(nil)), true, math.MaxInt64, true},
+		{"bdate", "DATETIME", reflect.TypeOf(time.Time{}), true, 0, false},
+	}
+	if len(cts) != len(want) {
+		t.Fatalf("got %d column types; want %d", len(cts), len(want))
+	}
+	for i, ct := range cts {
+		w := want[i]
+		if ct.Name() != w.name || ct.DatabaseTypeName() != w.dbType || ct.ScanType() != w.scanType {
+			t.Errorf("column %d = %q, %q, %v; want %q, %q, %v", i,
+				ct.Name(), ct.DatabaseTypeName(), ct.ScanType(), w.name, w.dbType, w.scanType)
+		}
+		if nullable, ok := ct.Nullable(); !ok || nullable != w.nullable {
+			t.Errorf("column %d Nullable = %v, %v; want %v, true", i, nullable, ok, w.nullable)
+		}
+		if length, ok := ct.Length(); ok != w.hasLen || length != w.length {
+			t.Errorf("column %d Length = %d, %v; want %d, %v", i, length, ok, w.length, w.hasLen)
+		}
+		if _, _, ok := ct.DecimalSize(); ok {
+			t.Errorf("column %d has a DecimalSize from a driver without support", i)
+		}
+	}
+
+	rows.Close()
+	if _, err := rows.ColumnTypes(); err == nil {
+		t.Error("ColumnTypes on closed Rows succeeded")
+	}
+}
+
+func TestColumnTypeDefaults(t *testing.T) {
+	ct := columnTypes(bareRows{})[0]
+	if ct.Name() != "x" || ct.ScanType() != reflect.TypeOf((*interface{})(nil)).Elem() || ct.DatabaseTypeName() != "" {
+		t.Errorf("column type = %q, %v, %q; want x, interface{}, empty", ct.Name(), ct.ScanType(), ct.DatabaseTypeName())
+	}
+	if _, ok := ct.Nullable(); ok {
+		t.Error("Nullable known without driver support")
+	}
+	if _, ok := ct.Length(); ok {
+		t.Error("Length known without driver support")
+	}
+}
+
+// bareRows implements only driver.Rows.
+type bareRows struct{}
+
+func (bareRows) Columns() []string              { return []string{"x"} }
+func (bareRows) Close() error                   { return nil }
+func (bareRows) Next(dest []driver.Value) error { return io.EOF }
+
+func TestNextResultSet(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer closeDB(t, db)
+
+	rows, err := db.Query("SELECT|people|name|age=?;SELECT|people|age,name|;SELECT|people|name|age=?", 1, 3)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	var got [][]string
+	for {
+		cols, err := rows.Columns()
+		if err != nil {
+			t.Fatalf("Columns: %v", err)
+		}
+		var set []string
+		for rows.Next() {
+			vals := make([]string, len(cols))
+			dest := make([]interface{}, len(cols))
+			for i := range vals {
+				dest[i] = &vals[i]
+			}
+			if err := rows.Scan(dest...); err != nil {
+				t.Fatalf("Scan: %v", err)
+			}
+			set = append(set, strings.Join(vals, "="))
+		}
+		got = append(got, set)
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	want := [][]string{{"Alice"}, {"1=Alice", "2=Bob", "3=Chris"}, {"Chris"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("result sets = %q; want %q", got, want)
+	}
+	if !rows.closed {
+		t.Error("Rows not closed after the last result set")
+	}
+	if n := db.Stats().InUse; n != 0 {
+		t.Errorf("connections in use after the last result set = %d; want 0", n)
+	}
+
+	// A single result set ends at its last row.
+	rows, err = db.Query("SELECT|people|name|")
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	for rows.Next() {
+	}
+	if rows.NextResultSet() {
+		t.Error("NextResultSet = true for a single result set")
+	}
+}
+
+func TestNamedArgs(t *testing.T) {
+	db, err := Open("test", fakeDBName+";opt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeDB(t, db)
+	exec(t, db, "WIPE")
+	exec(t, db, "CREATE|people|name=string,age=int32")
+	exec(t, db, "INSERT|people|name=?name,age=?age", Named("name", "Alice"), Named("age", 1))
+	exec(t, db, "INSERT|people|name=?,age=?", "Bob", 2)
+
+	var name string
+	err = db.QueryRow("SELECT|people|name|name=?name,age=?age", Named("age", 2), Named("name", "Bob")).Scan(&name)
+	if err != nil || name != "Bob" {
+		t.Errorf("QueryRow with named arguments = %q, %v; want Bob", name, err)
+	}
+	stmt, err := db.Prepare("SELECT|people|name|age=?age")
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	defer stmt.Close()
+	if err := stmt.QueryRow(Named("age", 1)).Scan(&name); err != nil || name != "Alice" {
+		t.Errorf("Stmt.QueryRow with named argument = %q, %v; want Alice", name, err)
+	}
+	if _, err := db.Exec("INSERT|people|name=?name,age=?", Named("1st", "Chris"), 3); err == nil || !strings.Contains(err.Error(), "does not begin with a letter") {
+		t.Errorf("Exec with invalid name = %v; want an error about the name", err)
+	}
+}
+
+func TestNamedArgsUnsupported(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer closeDB(t, db)
+
+	if _, err := db.Exec("INSERT|people|name=?name,age=?age", Named("name", "Dave"), Named("age", 4)); err != errNamedUnsupported {
+		t.Errorf("Exec with named arguments = %v; want %v", err, errNamedUnsupported)
+	}
+	var name string
+	if err := db.QueryRow("SELECT|people|name|age=?age", Named("age", 1)).Scan(&name); err != errNamedUnsupported {
+		t.Errorf("QueryRow with named argument = %v; want %v", err, errNamedUnsupported)
+	}
+	if n := db.Stats().InUse; n != 0 {
+		t.Errorf("connections in use = %d; want 0", n)
+	}
+}
+
+func TestBeginTxOptions(t *testing.T) {
+	db, err := Open("test", fakeDBName+";opt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeDB(t, db)
+	exec(t, db, "WIPE")
+	exec(t, db, "CREATE|people|name=string,age=int32")
+
+	tx, err := db.BeginTx(nil, &TxOptions{Isolation: LevelSerializable, ReadOnly: true})
+	if err != nil {
+		t.Fatalf("BeginTx: %v", err)
+	}
+	if _, err := tx.Exec("INSERT|people|name=Alice,age=?", 1); err == nil {
+		t.Error("INSERT in a read-only transaction succeeded")
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Errorf("Rollback: %v", err)
+	}
+
+	if _, err := db.BeginTx(nil, &TxOptions{Isolation: LevelSnapshot}); err == nil || !strings.Contains(err.Error(), "Snapshot") {
+		t.Errorf("BeginTx at an unsupported level = %v; want an error naming the level", err)
+	}
+	if n := db.Stats().InUse; n != 0 {
+		t.Errorf("connections in use after failed BeginTx = %d; want 0", n)
+	}
+}
+
+func TestBeginTxOptionsUnsupported(t *testing.T) {
+	db := newTestDB(t, "")
+	defer closeDB(t, db)
+
+	for _, opts := range []*TxOptions{{Isolation: LevelReadCommitted}, {ReadOnly: true}} {
+		if _, err := db.BeginTx(nil, opts); err == nil {
+			t.Errorf("BeginTx(%+v) succeeded on a driver without transaction options", *opts)
+		}
+	}
+	if n := db.Stats().InUse; n != 0 {
+		t.Errorf("connections in use after failed BeginTx = %d; want 0", n)
+	}
+	tx, err := db.BeginTx(nil, &TxOptions{})
+	if err != nil {
+		t.Fatalf("BeginTx with default options: %v", err)
+	}
+	tx.Rollback()
+}
+
+func TestIsolationLevelString(t *testing.T) {
+	for level, want := range map[IsolationLevel]string{
+		LevelDefault:       "Default",
+		LevelReadCommitted: "Read Committed",
+		LevelLinearizable:  "Linearizable",
+		42:                 "IsolationLevel(42)",
+	} {
+		if got := level.String(); got != want {
+			t.Errorf("IsolationLevel(%d).String() = %q; want %q", int(level), got, want)
+		}
+	}
+}
+
+type scanBase struct {
+	Name string `db:"name"`
+	Age  int    // untagged; hidden by person.Years
+}
+
+type ScanExtra struct {
+	Photo []byte `db:"photo"`
+}
+
+type scanPerson struct {
+	scanBase
+	*ScanExtra
+	Years   int64      `db:"age"`
+	Dead    NullBool   `db:"dead"`
+	Born    *time.Time `db:"bdate"`
+	Ignored string     `db:"-"`
+	secret  string
+}
+
+func TestRowsScanStruct(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer closeDB(t, db)
+
+	rows, err := db.Query("SELECT|people|name,age,photo,dead,bdate|")
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	defer rows.Close()
+	var got []scanPerson
+	for rows.Next() {
+		var p scanPerson
+		if err := rows.ScanStruct(&p); err != nil {
+			t.Fatalf("ScanStruct: %v", err)
+		}
+		got = append(got, p)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %d rows; want 3", len(got))
+	}
+	p := got[2]
+	if p.Name != "Chris" || p.Years != 3 || p.Age != 0 || p.ScanExtra == nil || string(p.Photo) != "CPHOTO" {
+		t.Errorf("row 2 = %+v, extra %+v; want Chris, 3, CPHOTO", p, p.ScanExtra)
+	}
+	if p.Dead.Valid {
+		t.Errorf("Dead = %+v; want NULL", p.Dead)
+	}
+	if p.Born == nil || !p.Born.Equal(chrisBirthday) {
+		t.Errorf("Born = %v; want %v", p.Born, chrisBirthday)
+	}
+	if got[0].Born != nil {
+		t.Errorf("row 0 Born = %v; want nil", got[0].Born)
+	}
+}
+
+func TestRowScanStruct(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer closeDB(t, db)
+
+	var p scanPerson
+	if err := db.QueryRow("SELECT|people|name,age|age=?", 2).ScanStruct(&p); err != nil || p.Name != "Bob" || p.Years != 2 {
+		t.Errorf("ScanStruct = %+v, %v; want Bob, 2", p, err)
+	}
+	if err := db.QueryRow("SELECT|people|name|age=?", 42).ScanStruct(&p); err != ErrNoRows {
+		t.Errorf("ScanStruct with no rows = %v; want ErrNoRows", err)
+	}
+
+	var untagged struct{ NAME string }
+	if err := db.QueryRow("SELECT|people|name|age=?", 1).ScanStruct(&untagged); err != nil || untagged.NAME != "Alice" {
+		t.Errorf("ScanStruct into untagged field = %q, %v; want Alice", untagged.NAME, err)
+	}
+
+	tests := []struct {
+		dest interface{}
+		err  string
+	}{
+		{&struct{ Name string }{}, `sql: column "age" has no matching field in struct { Name string }`},
+		{&struct {
+			A   string `db:"name"`
+			B   string `db:"name"`
+			Age int
+		}{}, `sql: column "name" matches several fields`},
+		{p, "not a non-nil pointer to a struct"},
+		{new(int), "not a non-nil pointer to a struct"},
+	}
+	for i, tt := range tests {
+		err := db.QueryRow("SELECT|people|name,age|age=?", 1).ScanStruct(tt.dest)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%d. ScanStruct = %v; want error containing %q", i, err, tt.err)
+		}
+	}
+	if n := db.Stats().InUse; n != 0 {
+		t.Errorf("connections in use after ScanStruct errors = %d; want 0", n)
+	}
+}
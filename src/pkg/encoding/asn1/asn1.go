@@ -21,9 +21,14 @@ package asn1
 
 import (
 	"fmt"
+	"math"
 	"math/big"
 	"reflect"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf16"
 )
 
 // A StructuralError suggests that the ASN.1 data is valid, but the Go type
@@ -258,9 +263,119 @@ func parseUTCTime(bytes []byte) (ret time.Time, err error) {
 }
 
 // parseGeneralizedTime parses the GeneralizedTime from the given byte slice
-// and returns the resulting time.
+// and returns the resulting time. The seconds may be followed by a decimal
+// fraction, introduced by a period or a comma.
 func parseGeneralizedTime(bytes []byte) (ret time.Time, err error) {
-	return time.Parse("20060102150405Z0700", string(bytes))
+	s := string(bytes)
+	nsec := 0
+	if len(s) > 14 && (s[14] == '.' || s[14] == ',') {
+		i := 15
+		for scale := int(time.Second / 10); i < len(s) && '0' <= s[i] && s[i] <= '9'; i++ {
+			nsec += int(s[i]-'0') * scale
+			scale /= 10
+		}
+		if i == 15 {
+			err = SyntaxError{"missing digits in GeneralizedTime fraction"}
+			return
+		}
+		s = s[:14] + s[i:]
+	}
+	ret, err = time.Parse("20060102150405Z0700", s)
+	if err == nil {
+		ret = ret.Add(time.Duration(nsec))
+	}
+	return
+}
+
+// REAL
+
+// parseReal parses an ASN.1 REAL from the given byte slice and returns it.
+// All three encodings described in X.690, section 8.5 are accepted: binary,
+// decimal and the special values.
+func parseReal(bytes []byte) (ret float64, err error) {
+	if len(bytes) == 0 {
+		return 0, nil
+	}
+	b := bytes[0]
+	switch {
+	case b&0x80 != 0:
+		return parseBinaryReal(bytes)
+	case b&0x40 != 0:
+		if len(bytes) != 1 {
+			err = SyntaxError{"invalid special REAL value"}
+			return
+		}
+		switch b {
+		case 0x40:
+			return math.Inf(1), nil
+		case 0x41:
+			return math.Inf(-1), nil
+		case 0x42:
+			return math.NaN(), nil
+		case 0x43:
+			return math.Copysign(0, -1), nil
+		}
+		err = SyntaxError{"invalid special REAL value"}
+		return
+	}
+	if form := b & 0x3f; form < 1 || form > 3 {
+		err = SyntaxError{"invalid decimal REAL form"}
+		return
+	}
+	s := strings.TrimLeft(string(bytes[1:]), " ")
+	s = strings.Replace(s, ",", ".", 1)
+	ret, err = strconv.ParseFloat(s, 64)
+	if err != nil {
+		err = SyntaxError{"invalid decimal REAL"}
+	}
+	return
+}
+
+// parseBinaryReal parses the binary encoding of a REAL: a sign, a base, a
+// scale factor, an exponent and an unsigned mantissa.
+func parseBinaryReal(bytes []byte) (ret float64, err error) {
+	b := bytes[0]
+	var bitsPerDigit int
+	switch (b >> 4) & 3 {
+	case 0:
+		bitsPerDigit = 1
+	case 1:
+		bitsPerDigit = 3
+	case 2:
+		bitsPerDigit = 4
+	default:
+		err = SyntaxError{"invalid REAL base"}
+		return
+	}
+	expStart, expLen := 1, int(b&3)+1
+	if expLen == 4 {
+		if len(bytes) < 2 {
+			err = SyntaxError{"truncated REAL"}
+			return
+		}
+		expStart, expLen = 2, int(bytes[1])
+	}
+	if expLen == 0 || len(bytes) <= expStart+expLen {
+		err = SyntaxError{"truncated REAL"}
+		return
+	}
+	exp, err := parseInt64(bytes[expStart : expStart+expLen])
+	if err != nil {
+		return
+	}
+	if exp < -1<<20 || exp > 1<<20 {
+		// Far beyond the range of a float64.
+		err = StructuralError{"REAL exponent too large"}
+		return
+	}
+	for _, d := range bytes[expStart+expLen:] {
+		ret = ret*256 + float64(d)
+	}
+	ret = math.Ldexp(ret, int(exp)*bitsPerDigit+int(b>>2&3))
+	if b&0x40 != 0 {
+		ret = -ret
+	}
+	return
 }
 
 // PrintableString
@@ -326,6 +441,57 @@ func parseUTF8String(bytes []byte) (ret string, err error) {
 	return string(bytes), nil
 }
 
+// BMPString
+
+// parseBMPString parses a ASN.1 BMPString (big-endian UCS-2) from the given
+// byte slice and returns it. Surrogate pairs are decoded as in UTF-16.
+func parseBMPString(bytes []byte) (ret string, err error) {
+	if len(bytes)%2 != 0 {
+		err = SyntaxError{"BMPString has odd length"}
+		return
+	}
+	s := make([]uint16, len(bytes)/2)
+	for i := range s {
+		s[i] = uint16(bytes[2*i])<<8 | uint16(bytes[2*i+1])
+	}
+	ret = string(utf16.Decode(s))
+	return
+}
+
+// UniversalString
+
+// parseUniversalString parses a ASN.1 UniversalString (big-endian UCS-4)
+// from the given byte slice and returns it.
+func parseUniversalString(bytes []byte) (ret string, err error) {
+	if len(bytes)%4 != 0 {
+		err = SyntaxError{"UniversalString length not a multiple of four"}
+		return
+	}
+	s := make([]rune, len(bytes)/4)
+	for i := range s {
+		b := bytes[4*i : 4*i+4]
+		r := rune(b[0])<<24 | rune(b[1])<<16 | rune(b[2])<<8 | rune(b[3])
+		if r < 0 || r > unicode.MaxRune || 0xd800 <= r && r < 0xe000 {
+			err = SyntaxError{"UniversalString contains invalid character"}
+			return
+		}
+		s[i] = r
+	}
+	ret = string(s)
+	return
+}
+
+// isStringTag returns true iff tag is one of the string types that can be
+// written to a Go string.
+func isStringTag(tag int) bool {
+	switch tag {
+	case tagPrintableString, tagIA5String, tagGeneralString, tagT61String,
+		tagUTF8String, tagBMPString, tagUniversalString:
+		return true
+	}
+	return false
+}
+
 // A RawValue represents an undecoded ASN.1 object.
 type RawValue struct {
 	Class, Tag int
@@ -400,8 +566,9 @@ func parseTagAndLength(bytes []byte, initOffset int) (ret tagAndLength, offset i
 
 // parseSequenceOf is used for SEQUENCE OF and SET OF values. It tries to parse
 // a number of ASN.1 values from the given byte slice and returns them as a
-// slice of Go values of the given type.
-func parseSequenceOf(bytes []byte, sliceType reflect.Type, elemType reflect.Type) (ret reflect.Value, err error) {
+// slice of Go values of the given type. If der is true, the elements must be
+// DER encoded.
+func parseSequenceOf(bytes []byte, sliceType reflect.Type, elemType reflect.Type, der bool) (ret reflect.Value, err error) {
 	expectedTag, compoundType, ok := getUniversalType(elemType)
 	if !ok {
 		err = StructuralError{"unknown Go type for slice"}
@@ -434,7 +601,7 @@ func parseSequenceOf(bytes []byte, sliceType reflect.Type, elemType reflect.Type
 		numElements++
 	}
 	ret = reflect.MakeSlice(sliceType, numElements, numElements)
-	params := fieldParameters{}
+	params := fieldParameters{der: der}
 	offset := 0
 	for i := 0; i < numElements; i++ {
 		offset, err = parseField(ret.Index(i), bytes, offset, params)
@@ -477,6 +644,17 @@ func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParam
 		return
 	}
 
+	if params.der {
+		if err = checkTagAndLengthDER(bytes, offset); err != nil {
+			return
+		}
+	}
+
+	// Deal with CHOICE types.
+	if params.choice {
+		return parseChoice(v, bytes, offset, params)
+	}
+
 	// Deal with raw values.
 	if fieldType == rawValueType {
 		var t tagAndLength
@@ -525,11 +703,22 @@ func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParam
 				result, err = parseObjectIdentifier(innerBytes)
 			case tagUTCTime:
 				result, err = parseUTCTime(innerBytes)
+			case tagGeneralizedTime:
+				result, err = parseGeneralizedTime(innerBytes)
+			case tagBMPString:
+				result, err = parseBMPString(innerBytes)
+			case tagUniversalString:
+				result, err = parseUniversalString(innerBytes)
+			case tagReal:
+				result, err = parseReal(innerBytes)
 			case tagOctetString:
 				result = innerBytes
 			default:
 				// If we don't know how to handle the type, we just leave Value as nil.
 			}
+			if err == nil && params.der {
+				err = checkContentsDER(t.tag, innerBytes)
+			}
 		}
 		offset += t.length
 		if err != nil {
@@ -557,6 +746,11 @@ func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParam
 		}
 		if t.class == expectedClass && t.tag == *params.tag && (t.length == 0 || t.isCompound) {
 			if t.length > 0 {
+				if params.der {
+					if err = checkTagAndLengthDER(bytes, offset); err != nil {
+						return
+					}
+				}
 				t, offset, err = parseTagAndLength(bytes, offset)
 				if err != nil {
 					return
@@ -585,11 +779,8 @@ func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParam
 	// type string. getUniversalType returns the tag for PrintableString
 	// when it sees a string, so if we see a different string type on the
 	// wire, we change the universal type to match.
-	if universalTag == tagPrintableString {
-		switch t.tag {
-		case tagIA5String, tagGeneralString, tagT61String, tagUTF8String:
-			universalTag = t.tag
-		}
+	if universalTag == tagPrintableString && isStringTag(t.tag) {
+		universalTag = t.tag
 	}
 
 	// Special case for time: UTCTime and GeneralizedTime both map to the
@@ -598,6 +789,10 @@ func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParam
 		universalTag = tagGeneralizedTime
 	}
 
+	if params.set && universalTag == tagSequence {
+		universalTag = tagSet
+	}
+
 	expectedClass := classUniversal
 	expectedTag := universalTag
 
@@ -629,6 +824,12 @@ func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParam
 	innerBytes := bytes[offset : offset+t.length]
 	offset += t.length
 
+	if params.der {
+		if err = checkContentsDER(universalTag, innerBytes); err != nil {
+			return
+		}
+	}
+
 	// We deal with the structures defined in this package first.
 	switch fieldType {
 	case objectIdentifierType:
@@ -661,6 +862,9 @@ func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParam
 		return
 	case enumeratedType:
 		parsedInt, err1 := parseInt(innerBytes)
+		if err1 == nil {
+			err1 = checkDefaultDER(int64(parsedInt), params)
+		}
 		if err1 == nil {
 			v.SetInt(int64(parsedInt))
 		}
@@ -684,6 +888,9 @@ func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParam
 		return
 	case reflect.Int, reflect.Int32:
 		parsedInt, err1 := parseInt(innerBytes)
+		if err1 == nil {
+			err1 = checkDefaultDER(int64(parsedInt), params)
+		}
 		if err1 == nil {
 			val.SetInt(int64(parsedInt))
 		}
@@ -691,11 +898,24 @@ func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParam
 		return
 	case reflect.Int64:
 		parsedInt, err1 := parseInt64(innerBytes)
+		if err1 == nil {
+			err1 = checkDefaultDER(parsedInt, params)
+		}
 		if err1 == nil {
 			val.SetInt(parsedInt)
 		}
 		err = err1
 		return
+	case reflect.Float32, reflect.Float64:
+		parsedReal, err1 := parseReal(innerBytes)
+		if err1 == nil && val.OverflowFloat(parsedReal) {
+			err1 = StructuralError{"REAL too large"}
+		}
+		if err1 == nil {
+			val.SetFloat(parsedReal)
+		}
+		err = err1
+		return
 	// TODO(dfc) Add support for the remaining integer types
 	case reflect.Struct:
 		structType := fieldType
@@ -712,7 +932,9 @@ func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParam
 			if i == 0 && field.Type == rawContentsType {
 				continue
 			}
-			innerOffset, err = parseField(val.Field(i), innerBytes, innerOffset, parseFieldParameters(field.Tag.Get("asn1")))
+			fieldParams := parseFieldParameters(field.Tag.Get("asn1"))
+			fieldParams.der = fieldParams.der || params.der
+			innerOffset, err = parseField(val.Field(i), innerBytes, innerOffset, fieldParams)
 			if err != nil {
 				return
 			}
@@ -728,7 +950,12 @@ func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParam
 			reflect.Copy(val, reflect.ValueOf(innerBytes))
 			return
 		}
-		newSlice, err1 := parseSequenceOf(innerBytes, sliceType, sliceType.Elem())
+		if params.der && universalTag == tagSet {
+			if err = checkSetOfDER(innerBytes); err != nil {
+				return
+			}
+		}
+		newSlice, err1 := parseSequenceOf(innerBytes, sliceType, sliceType.Elem(), params.der)
 		if err1 == nil {
 			val.Set(newSlice)
 		}
@@ -745,6 +972,10 @@ func parseField(v reflect.Value, bytes []byte, initOffset int, params fieldParam
 			v, err = parseT61String(innerBytes)
 		case tagUTF8String:
 			v, err = parseUTF8String(innerBytes)
+		case tagBMPString:
+			v, err = parseBMPString(innerBytes)
+		case tagUniversalString:
+			v, err = parseUniversalString(innerBytes)
 		case tagGeneralString:
 			// GeneralString is specified in ISO-2022/ECMA-35,
 			// A brief review suggests that it includes structures
@@ -781,6 +1012,129 @@ func setDefaultValue(v reflect.Value, params fieldParameters) (ok bool) {
 	return
 }
 
+// parseChoice parses a CHOICE into v, a struct with one field for each
+// alternative. The first field whose type and tag match the next element
+// is set; the other fields are left unchanged. A pointer field is set to
+// a newly allocated value.
+func parseChoice(v reflect.Value, bytes []byte, initOffset int, params fieldParameters) (offset int, err error) {
+	offset = initOffset
+	if v.Kind() != reflect.Struct {
+		err = StructuralError{"CHOICE must be a struct"}
+		return
+	}
+	if offset >= len(bytes) {
+		err = SyntaxError{"sequence truncated"}
+		return
+	}
+	t, innerOffset, err := parseTagAndLength(bytes, offset)
+	if err != nil {
+		return
+	}
+	if params.explicit {
+		expectedClass := classContextSpecific
+		if params.application {
+			expectedClass = classApplication
+		}
+		if t.class != expectedClass || t.tag != *params.tag || !t.isCompound {
+			if !setDefaultValue(v, params) {
+				err = StructuralError{"explicitly tagged CHOICE didn't match"}
+			}
+			return
+		}
+		if invalidLength(innerOffset, t.length, len(bytes)) {
+			err = SyntaxError{"data truncated"}
+			return
+		}
+		end := innerOffset + t.length
+		innerParams := fieldParameters{choice: true, der: params.der}
+		if params.der && innerOffset < end {
+			if err = checkTagAndLengthDER(bytes[:end], innerOffset); err != nil {
+				return
+			}
+		}
+		if innerOffset, err = parseChoice(v, bytes[:end], innerOffset, innerParams); err != nil {
+			return
+		}
+		if innerOffset != end {
+			err = SyntaxError{"trailing data in explicitly tagged CHOICE"}
+			return
+		}
+		return end, nil
+	}
+
+	structType := v.Type()
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		fieldParams := parseFieldParameters(field.Tag.Get("asn1"))
+		if !choiceMatches(field.Type, fieldParams, t) {
+			continue
+		}
+		fieldParams.optional = false
+		fieldParams.der = fieldParams.der || params.der
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Ptr && fv.Type() != bigIntType {
+			fv.Set(reflect.New(fv.Type().Elem()))
+			fv = fv.Elem()
+		}
+		return parseField(fv, bytes, offset, fieldParams)
+	}
+	if !setDefaultValue(v, params) {
+		err = StructuralError{fmt.Sprintf("no alternative of CHOICE %s matched tag %d", structType, t.tag)}
+	}
+	return
+}
+
+// choiceMatches returns true iff an element with the given tag could be
+// parsed into a CHOICE alternative of the given type and parameters.
+func choiceMatches(fieldType reflect.Type, params fieldParameters, t tagAndLength) bool {
+	if fieldType.Kind() == reflect.Ptr && fieldType != bigIntType {
+		fieldType = fieldType.Elem()
+	}
+	expectedClass := classContextSpecific
+	if params.application {
+		expectedClass = classApplication
+	}
+	if params.explicit {
+		return t.class == expectedClass && t.tag == *params.tag && t.isCompound
+	}
+	if params.choice {
+		if fieldType.Kind() != reflect.Struct {
+			return false
+		}
+		for i := 0; i < fieldType.NumField(); i++ {
+			field := fieldType.Field(i)
+			if choiceMatches(field.Type, parseFieldParameters(field.Tag.Get("asn1")), t) {
+				return true
+			}
+		}
+		return false
+	}
+	if fieldType == rawValueType || fieldType.Kind() == reflect.Interface && fieldType.NumMethod() == 0 {
+		return true
+	}
+	universalTag, compoundType, ok := getUniversalType(fieldType)
+	if !ok || t.isCompound != compoundType {
+		return false
+	}
+	if params.tag != nil {
+		return t.class == expectedClass && t.tag == *params.tag
+	}
+	if t.class != classUniversal {
+		return false
+	}
+	switch universalTag {
+	case tagPrintableString:
+		return isStringTag(t.tag)
+	case tagUTCTime:
+		return t.tag == tagUTCTime || t.tag == tagGeneralizedTime
+	case tagSequence:
+		if params.set {
+			return t.tag == tagSet
+		}
+	}
+	return t.tag == universalTag
+}
+
 // Unmarshal parses the DER-encoded ASN.1 data structure b
 // and uses the reflect package to fill in an arbitrary value pointed at by val.
 // Because Unmarshal uses the reflect package, the structs
@@ -801,8 +1155,12 @@ func setDefaultValue(v reflect.Value, params fieldParameters) (ok bool) {
 // An ASN.1 ENUMERATED can be written to an Enumerated.
 //
 // An ASN.1 UTCTIME or GENERALIZEDTIME can be written to a time.Time.
+// A GENERALIZEDTIME may have fractional seconds.
 //
-// An ASN.1 PrintableString or IA5String can be written to a string.
+// An ASN.1 REAL can be written to a float32 or float64.
+//
+// An ASN.1 PrintableString, IA5String, T61String, UTF8String, BMPString
+// or UniversalString can be written to a string.
 //
 // Any of the above ASN.1 values can be written to an interface{}.
 // The value stored in the interface has the corresponding Go type.
@@ -815,11 +1173,18 @@ func setDefaultValue(v reflect.Value, params fieldParameters) (ok bool) {
 // if each of the elements in the sequence can be
 // written to the corresponding element in the struct.
 //
+// An ASN.1 CHOICE can be written to a struct with the choice tag. Each
+// field of the struct is an alternative, usually a pointer, and the first
+// one that matches the tag of the element is set.
+//
 // The following tags on struct fields have special meaning to Unmarshal:
 //
 //	optional		marks the field as ASN.1 OPTIONAL
 //	[explicit] tag:x	specifies the ASN.1 tag number; implies ASN.1 CONTEXT SPECIFIC
 //	default:x		sets the default value for optional integer fields
+//	set			expects a SET rather than a SEQUENCE
+//	choice			marks the field, which must be a struct, as an ASN.1 CHOICE
+//	der			rejects encodings of the field that DER forbids, as UnmarshalDER does
 //
 // If the type of the first field of a structure is RawContent then the raw
 // ASN1 contents of the struct will be stored in it.
@@ -830,6 +1195,16 @@ func Unmarshal(b []byte, val interface{}) (rest []byte, err error) {
 	return UnmarshalWithParams(b, val, "")
 }
 
+// UnmarshalDER is like Unmarshal but accepts only the Distinguished
+// Encoding Rules. Unmarshal tolerates some encodings that are valid BER
+// but not DER, such as non-minimal lengths and integers, booleans other
+// than 0x00 and 0xff, unsorted SET OF elements, encoded DEFAULT values,
+// and times with time zones or trailing zeros in fractional seconds.
+// UnmarshalDER rejects them with a SyntaxError.
+func UnmarshalDER(b []byte, val interface{}) (rest []byte, err error) {
+	return UnmarshalWithParams(b, val, "der")
+}
+
 // UnmarshalWithParams allows field parameters to be specified for the
 // top-level element. The form of the params is the same as the field tags.
 func UnmarshalWithParams(b []byte, val interface{}, params string) (rest []byte, err error) {
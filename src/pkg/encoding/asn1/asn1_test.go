@@ -248,6 +248,10 @@ var generalizedTimeTestData = []timeTest{
 	{"20100102030405", false, time.Time{}},
 	{"20100102030405+0607", true, time.Date(2010, 01, 02, 03, 04, 05, 0, time.FixedZone("", 6*60*60+7*60))},
 	{"20100102030405-0607", true, time.Date(2010, 01, 02, 03, 04, 05, 0, time.FixedZone("", -6*60*60-7*60))},
+	{"20100102030405.5Z", true, time.Date(2010, 01, 02, 03, 04, 05, 5e8, time.UTC)},
+	{"20100102030405,25Z", true, time.Date(2010, 01, 02, 03, 04, 05, 25e7, time.UTC)},
+	{"20100102030405.123456789Z", true, time.Date(2010, 01, 02, 03, 04, 05, 123456789, time.UTC)},
+	{"20100102030405.Z", false, time.Time{}},
 }
 
 func TestGeneralizedTime(t *testing.T) {
@@ -321,8 +325,14 @@ var parseFieldParametersTestData []parseFieldParametersTest = []parseFieldParame
 	{"default:42", fieldParameters{defaultValue: newInt64(42)}},
 	{"tag:17", fieldParameters{tag: newInt(17)}},
 	{"optional,explicit,default:42,tag:17", fieldParameters{optional: true, explicit: true, defaultValue: newInt64(42), tag: newInt(17)}},
-	{"optional,explicit,default:42,tag:17,rubbish1", fieldParameters{true, true, false, newInt64(42), newInt(17), 0, false}},
+	{"optional,explicit,default:42,tag:17,rubbish1", fieldParameters{optional: true, explicit: true, defaultValue: newInt64(42), tag: newInt(17)}},
 	{"set", fieldParameters{set: true}},
+	{"bmp", fieldParameters{stringType: tagBMPString}},
+	{"universal", fieldParameters{stringType: tagUniversalString}},
+	{"utc", fieldParameters{timeType: tagUTCTime}},
+	{"generalized", fieldParameters{timeType: tagGeneralizedTime}},
+	{"choice", fieldParameters{choice: true}},
+	{"der", fieldParameters{der: true}},
 }
 
 func TestParseFieldParameters(t *testing.T) {
@@ -375,6 +385,34 @@ var unmarshalTestData = []struct {
 	{[]byte{0x01, 0x01, 0x01}, newBool(true)},
 	{[]byte{0x30, 0x0b, 0x13, 0x03, 0x66, 0x6f, 0x6f, 0x02, 0x01, 0x22, 0x02, 0x01, 0x33}, &TestElementsAfterString{"foo", 0x22, 0x33}},
 	{[]byte{0x30, 0x05, 0x02, 0x03, 0x12, 0x34, 0x56}, &TestBigInt{big.NewInt(0x123456)}},
+	{[]byte{0x09, 0x03, 0x80, 0x00, 0x01}, newFloat64(1)},
+	{[]byte{0x09, 0x03, 0x80, 0xff, 0x01}, newFloat64(0.5)},
+	{[]byte{0x09, 0x03, 0xc0, 0x00, 0x03}, newFloat64(-3)},
+	{[]byte{0x09, 0x00}, newFloat64(0)},
+	{[]byte{0x09, 0x08, 0x03, '1', '2', '5', '.', 'E', '-', '2'}, newFloat64(1.25)},
+	{[]byte{0x1e, 0x04, 0x00, 'h', 0x20, 0xac}, newString("h\u20ac")},
+	{[]byte{0x1c, 0x08, 0x00, 0x00, 0x00, 'h', 0x00, 0x01, 0xf6, 0x00}, newString("h\U0001f600")},
+	{[]byte{0x30, 0x03, 0x02, 0x01, 0x07}, &TestChoiceStruct{TestChoice{Int: newInt(7)}}},
+	{[]byte{0x30, 0x04, 0x13, 0x02, 'h', 'i'}, &TestChoiceStruct{TestChoice{String: newString("hi")}}},
+	{[]byte{0x30, 0x03, 0x80, 0x01, 0xff}, &TestChoiceStruct{TestChoice{Bool: newBool(true)}}},
+	{[]byte{0x30, 0x08, 0xa2, 0x03, 0x02, 0x01, 0x07, 0x02, 0x01, 0x05}, &TestExplicitChoiceStruct{TestChoice{Int: newInt(7)}, 5}},
+}
+
+func newFloat64(f float64) *float64 { return &f }
+
+type TestChoice struct {
+	Int    *int
+	String *string
+	Bool   *bool `asn1:"tag:0"`
+}
+
+type TestChoiceStruct struct {
+	C TestChoice `asn1:"choice"`
+}
+
+type TestExplicitChoiceStruct struct {
+	C TestChoice `asn1:"choice,explicit,tag:2"`
+	A int
 }
 
 func TestUnmarshal(t *testing.T) {
@@ -391,6 +429,105 @@ func TestUnmarshal(t *testing.T) {
 	}
 }
 
+type TestDefaultStruct struct {
+	A int `asn1:"optional,default:1"`
+}
+
+type TestSetOf struct {
+	A []int `asn1:"set"`
+}
+
+var unmarshalDERTestData = []struct {
+	in  []byte
+	out interface{}
+	ok  bool
+}{
+	{[]byte{0x02, 0x01, 0x42}, newInt(0x42), true},
+	{[]byte{0x02, 0x81, 0x01, 0x42}, newInt(0x42), false},
+	{[]byte{0x02, 0x02, 0x00, 0x42}, newInt(0x42), false},
+	{[]byte{0x02, 0x02, 0xff, 0xc2}, newInt(-0x3e), false},
+	{[]byte{0x01, 0x01, 0xff}, newBool(true), true},
+	{[]byte{0x01, 0x01, 0x01}, newBool(true), false},
+	{[]byte{0x09, 0x03, 0x80, 0x00, 0x01}, newFloat64(1), true},
+	{[]byte{0x09, 0x03, 0x80, 0xff, 0x02}, newFloat64(1), false},
+	{[]byte{0x09, 0x08, 0x03, '1', '2', '5', '.', 'E', '-', '2'}, newFloat64(1.25), true},
+	{[]byte{0x09, 0x05, 0x03, '1', '.', '2', '5'}, newFloat64(1.25), false},
+	{[]byte{0x30, 0x08, 0x31, 0x06, 0x02, 0x01, 0x01, 0x02, 0x01, 0x02}, &TestSetOf{[]int{1, 2}}, true},
+	{[]byte{0x30, 0x08, 0x31, 0x06, 0x02, 0x01, 0x02, 0x02, 0x01, 0x01}, &TestSetOf{[]int{2, 1}}, false},
+	{[]byte{0x30, 0x03, 0x02, 0x01, 0x02}, &TestDefaultStruct{2}, true},
+	{[]byte{0x30, 0x03, 0x02, 0x01, 0x01}, &TestDefaultStruct{1}, false},
+	{[]byte("\x18\x0f20100102030405Z"), &time.Time{}, true},
+	{[]byte("\x18\x1320100102030405+0607"), &time.Time{}, false},
+	{[]byte("\x18\x1120100102030405.5Z"), &time.Time{}, true},
+	{[]byte("\x18\x1220100102030405.50Z"), &time.Time{}, false},
+	{[]byte("\x17\x0d910506234540Z"), &time.Time{}, true},
+	{[]byte("\x17\x0b9105062345Z"), &time.Time{}, false},
+}
+
+func TestUnmarshalDER(t *testing.T) {
+	for i, test := range unmarshalDERTestData {
+		pv := reflect.New(reflect.TypeOf(test.out).Elem())
+		val := pv.Interface()
+		_, err := UnmarshalDER(test.in, val)
+		if (err == nil) != test.ok {
+			t.Errorf("#%d: Incorrect error result (did fail? %v, expected: %v): %v", i, err != nil, !test.ok, err)
+			continue
+		}
+		if _, isTime := test.out.(*time.Time); err == nil && !isTime && !reflect.DeepEqual(val, test.out) {
+			t.Errorf("#%d:\nhave %#v\nwant %#v", i, val, test.out)
+		}
+		if test.ok {
+			continue
+		}
+		// The same input must be accepted as BER.
+		if _, err := Unmarshal(test.in, val); err != nil {
+			t.Errorf("#%d: Unmarshal failed: %v", i, err)
+		}
+	}
+}
+
+type TestDERField struct {
+	A int `asn1:"der"`
+	B int
+}
+
+type TestDERChoice struct {
+	Int    *int `asn1:"der"`
+	String *string
+}
+
+type TestDERChoiceStruct struct {
+	C TestDERChoice `asn1:"choice"`
+}
+
+// A field tagged der is decoded as DER even within BER.
+var unmarshalDERFieldTestData = []struct {
+	in  []byte
+	out interface{}
+	ok  bool
+}{
+	{[]byte{0x30, 0x06, 0x02, 0x01, 0x01, 0x02, 0x01, 0x02}, &TestDERField{1, 2}, true},
+	{[]byte{0x30, 0x07, 0x02, 0x02, 0x00, 0x01, 0x02, 0x01, 0x02}, &TestDERField{}, false},
+	{[]byte{0x30, 0x07, 0x02, 0x01, 0x01, 0x02, 0x02, 0x00, 0x02}, &TestDERField{1, 2}, true},
+	{[]byte{0x30, 0x03, 0x02, 0x01, 0x07}, &TestDERChoiceStruct{TestDERChoice{Int: newInt(7)}}, true},
+	{[]byte{0x30, 0x04, 0x02, 0x02, 0x00, 0x07}, &TestDERChoiceStruct{}, false},
+}
+
+func TestUnmarshalDERField(t *testing.T) {
+	for i, test := range unmarshalDERFieldTestData {
+		pv := reflect.New(reflect.TypeOf(test.out).Elem())
+		val := pv.Interface()
+		_, err := Unmarshal(test.in, val)
+		if (err == nil) != test.ok {
+			t.Errorf("#%d: Incorrect error result (did fail? %v, expected: %v): %v", i, err != nil, !test.ok, err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(val, test.out) {
+			t.Errorf("#%d:\nhave %#v\nwant %#v", i, val, test.out)
+		}
+	}
+}
+
 type Certificate struct {
 	TBSCertificate     TBSCertificate
 	SignatureAlgorithm AlgorithmIdentifier
@@ -24,6 +24,7 @@ const (
 	tagBitString       = 3
 	tagOctetString     = 4
 	tagOID             = 6
+	tagReal            = 9
 	tagEnum            = 10
 	tagUTF8String      = 12
 	tagSequence        = 16
@@ -34,6 +35,8 @@ const (
 	tagUTCTime         = 23
 	tagGeneralizedTime = 24
 	tagGeneralString   = 27
+	tagUniversalString = 28
+	tagBMPString       = 30
 )
 
 const (
@@ -74,7 +77,10 @@ type fieldParameters struct {
 	defaultValue *int64 // a default value for INTEGER typed fields (maybe nil).
 	tag          *int   // the EXPLICIT or IMPLICIT tag (maybe nil).
 	stringType   int    // the string tag to use when marshaling.
+	timeType     int    // the time tag to use when marshaling.
 	set          bool   // true iff this should be encoded as a SET
+	choice       bool   // true iff this is a CHOICE between the fields of a struct
+	der          bool   // true iff encodings that DER forbids should be rejected
 
 	// Invariants:
 	//   if explicit is set, tag is non-nil.
@@ -97,6 +103,14 @@ func parseFieldParameters(str string) (ret fieldParameters) {
 			ret.stringType = tagIA5String
 		case part == "printable":
 			ret.stringType = tagPrintableString
+		case part == "bmp":
+			ret.stringType = tagBMPString
+		case part == "universal":
+			ret.stringType = tagUniversalString
+		case part == "utc":
+			ret.timeType = tagUTCTime
+		case part == "generalized":
+			ret.timeType = tagGeneralizedTime
 		case strings.HasPrefix(part, "default:"):
 			i, err := strconv.ParseInt(part[8:], 10, 64)
 			if err == nil {
@@ -116,6 +130,10 @@ func parseFieldParameters(str string) (ret fieldParameters) {
 			if ret.tag == nil {
 				ret.tag = new(int)
 			}
+		case part == "choice":
+			ret.choice = true
+		case part == "der":
+			ret.der = true
 		}
 	}
 	return
@@ -141,6 +159,8 @@ func getUniversalType(t reflect.Type) (tagNumber int, isCompound, ok bool) {
 		return tagBoolean, false, true
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		return tagInteger, false, true
+	case reflect.Float32, reflect.Float64:
+		return tagReal, false, true
 	case reflect.Struct:
 		return tagSequence, true, true
 	case reflect.Slice:
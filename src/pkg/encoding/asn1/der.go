@@ -0,0 +1,248 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asn1
+
+import "strings"
+
+// BER allows several encodings of most values; DER, defined in X.690
+// section 10 and 11, picks exactly one. Unmarshal accepts some of the
+// alternatives and the functions in this file reject them when parsing
+// in strict DER mode.
+
+// checkTagAndLengthDER returns an error if the identifier and length
+// octets at the given offset are not in the minimal form that DER
+// requires. Other errors are left to parseTagAndLength.
+func checkTagAndLengthDER(bytes []byte, offset int) error {
+	b := bytes[offset]
+	offset++
+	if b&0x1f == 0x1f {
+		if offset < len(bytes) && bytes[offset] == 0x80 {
+			return SyntaxError{"non-minimal tag"}
+		}
+		tag, next, err := parseBase128Int(bytes, offset)
+		if err != nil {
+			return nil
+		}
+		if tag < 0x1f {
+			return SyntaxError{"non-minimal tag"}
+		}
+		offset = next
+	}
+	if offset >= len(bytes) {
+		return nil
+	}
+	b = bytes[offset]
+	offset++
+	if b&0x80 != 0 && b != 0x80 && offset < len(bytes) {
+		if bytes[offset] == 0 || b == 0x81 && bytes[offset] < 0x80 {
+			return SyntaxError{"non-minimal length"}
+		}
+	}
+	return nil
+}
+
+// checkContentsDER returns an error if bytes are not the DER contents
+// octets of a value of the given universal type.
+func checkContentsDER(tag int, bytes []byte) error {
+	switch tag {
+	case tagBoolean:
+		if len(bytes) == 1 && bytes[0] != 0 && bytes[0] != 0xff {
+			return SyntaxError{"invalid DER boolean"}
+		}
+	case tagInteger, tagEnum:
+		return checkIntegerDER(bytes)
+	case tagOID:
+		// No subidentifier may start with a padding octet.
+		for i := 1; i < len(bytes); i++ {
+			if bytes[i] == 0x80 && bytes[i-1]&0x80 == 0 {
+				return SyntaxError{"non-minimal OBJECT IDENTIFIER"}
+			}
+		}
+		if len(bytes) > 0 && bytes[0] == 0x80 {
+			return SyntaxError{"non-minimal OBJECT IDENTIFIER"}
+		}
+	case tagReal:
+		return checkRealDER(bytes)
+	case tagUTCTime:
+		if !isDigits(bytes, 12) || len(bytes) != 13 || bytes[12] != 'Z' {
+			return SyntaxError{"UTCTime is not of the form YYMMDDHHMMSSZ"}
+		}
+	case tagGeneralizedTime:
+		return checkGeneralizedTimeDER(bytes)
+	case tagBMPString:
+		for i := 0; i+1 < len(bytes); i += 2 {
+			if 0xd8 <= bytes[i] && bytes[i] < 0xe0 {
+				return SyntaxError{"BMPString contains surrogate"}
+			}
+		}
+	}
+	return nil
+}
+
+// checkIntegerDER returns an error if bytes are not the minimal two's
+// complement encoding of an integer.
+func checkIntegerDER(bytes []byte) error {
+	if len(bytes) == 0 {
+		return SyntaxError{"empty integer"}
+	}
+	if len(bytes) > 1 && (bytes[0] == 0 && bytes[1]&0x80 == 0 || bytes[0] == 0xff && bytes[1]&0x80 != 0) {
+		return SyntaxError{"integer not minimally encoded"}
+	}
+	return nil
+}
+
+// checkRealDER returns an error if bytes are not the DER encoding of a
+// REAL: binary with base 2, no scale factor, an odd mantissa and minimal
+// exponent and mantissa, or decimal in NR3 form. Malformed encodings are
+// left to parseReal.
+func checkRealDER(bytes []byte) error {
+	if len(bytes) == 0 {
+		return nil
+	}
+	b := bytes[0]
+	switch {
+	case b&0x80 != 0:
+		if b&0x3c != 0 {
+			return SyntaxError{"REAL must use base 2 and no scale factor"}
+		}
+		expStart, expLen := 1, int(b&3)+1
+		if expLen == 4 {
+			if len(bytes) < 2 {
+				return nil
+			}
+			expStart, expLen = 2, int(bytes[1])
+			if expLen <= 3 {
+				return SyntaxError{"non-minimal REAL exponent length"}
+			}
+		}
+		if len(bytes) <= expStart+expLen {
+			return nil
+		}
+		if checkIntegerDER(bytes[expStart:expStart+expLen]) != nil {
+			return SyntaxError{"non-minimal REAL exponent"}
+		}
+		mantissa := bytes[expStart+expLen:]
+		if mantissa[0] == 0 || mantissa[len(mantissa)-1]&1 == 0 {
+			return SyntaxError{"REAL mantissa must be odd and minimal"}
+		}
+	case b&0x40 != 0:
+		// Each special value has a single encoding.
+	default:
+		if b != 3 || !isNR3(bytes[1:]) {
+			return SyntaxError{"decimal REAL must be in restricted NR3 form"}
+		}
+	}
+	return nil
+}
+
+// isNR3 returns true iff s is in the restricted NR3 form of X.690
+// section 11.3.2: an optional minus sign, an integer mantissa with no
+// leading or trailing zeros, a period, an E and an exponent that is
+// either +0 or has no plus sign and no leading zeros.
+func isNR3(s []byte) bool {
+	i := 0
+	if i < len(s) && s[i] == '-' {
+		i++
+	}
+	start := i
+	for i < len(s) && '0' <= s[i] && s[i] <= '9' {
+		i++
+	}
+	if i == start || s[start] == '0' || s[i-1] == '0' {
+		return false
+	}
+	if i+2 > len(s) || s[i] != '.' || s[i+1] != 'E' {
+		return false
+	}
+	exp := string(s[i+2:])
+	if exp == "+0" {
+		return true
+	}
+	if strings.HasPrefix(exp, "-") {
+		exp = exp[1:]
+	}
+	return exp != "" && exp[0] != '0' && isDigits([]byte(exp), len(exp))
+}
+
+// checkGeneralizedTimeDER returns an error unless bytes are of the form
+// YYYYMMDDHHMMSS[.f]Z, where the fraction f, if present, does not end
+// with a zero.
+func checkGeneralizedTimeDER(bytes []byte) error {
+	const msg = "GeneralizedTime is not of the form YYYYMMDDHHMMSS[.f]Z"
+	if !isDigits(bytes, 14) || bytes[len(bytes)-1] != 'Z' {
+		return SyntaxError{msg}
+	}
+	frac := bytes[14 : len(bytes)-1]
+	if len(frac) == 0 {
+		return nil
+	}
+	if len(frac) < 2 || frac[0] != '.' || !isDigits(frac[1:], len(frac)-1) || frac[len(frac)-1] == '0' {
+		return SyntaxError{msg}
+	}
+	return nil
+}
+
+// isDigits returns true iff the first n bytes of b are decimal digits.
+func isDigits(b []byte, n int) bool {
+	if len(b) < n {
+		return false
+	}
+	for _, c := range b[:n] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// checkDefaultDER returns an error if params require DER and the parsed
+// value of an integer field equals its DEFAULT, which DER omits.
+func checkDefaultDER(v int64, params fieldParameters) error {
+	if params.der && params.defaultValue != nil && *params.defaultValue == v {
+		return SyntaxError{"DEFAULT value present in DER"}
+	}
+	return nil
+}
+
+// checkSetOfDER returns an error if the elements encoded in bytes are not
+// in the ascending order that DER requires for a SET OF.
+func checkSetOfDER(bytes []byte) error {
+	var prev []byte
+	for offset := 0; offset < len(bytes); {
+		t, next, err := parseTagAndLength(bytes, offset)
+		if err != nil || invalidLength(next, t.length, len(bytes)) {
+			return nil // reported when the element is parsed
+		}
+		end := next + t.length
+		if prev != nil && compareDER(prev, bytes[offset:end]) > 0 {
+			return SyntaxError{"SET OF elements not in ascending order"}
+		}
+		prev = bytes[offset:end]
+		offset = end
+	}
+	return nil
+}
+
+// compareDER compares two encodings in the way DER orders the elements of
+// a SET OF: as octet strings, with the shorter padded at its end with zero
+// octets.
+func compareDER(a, b []byte) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y byte
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
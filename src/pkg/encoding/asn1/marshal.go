@@ -8,9 +8,14 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"math"
 	"math/big"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf16"
 )
 
 // A forkableWriter is an in-memory buffer that can be
@@ -280,6 +285,81 @@ func marshalIA5String(out *forkableWriter, s string) (err error) {
 	return
 }
 
+func marshalBMPString(out *forkableWriter, s string) (err error) {
+	for _, r := range s {
+		if r >= 0x10000 || utf16.IsSurrogate(r) {
+			return StructuralError{"BMPString contains invalid character"}
+		}
+		_, err = out.Write([]byte{byte(r >> 8), byte(r)})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func marshalUniversalString(out *forkableWriter, s string) (err error) {
+	for _, r := range s {
+		_, err = out.Write([]byte{byte(r >> 24), byte(r >> 16), byte(r >> 8), byte(r)})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// marshalReal marshals f using the binary encoding with base 2 and an odd
+// mantissa, as DER requires.
+func marshalReal(out *forkableWriter, f float64) (err error) {
+	switch {
+	case f == 0 && !math.Signbit(f):
+		return
+	case f == 0:
+		return out.WriteByte(0x43)
+	case math.IsInf(f, 1):
+		return out.WriteByte(0x40)
+	case math.IsInf(f, -1):
+		return out.WriteByte(0x41)
+	case math.IsNaN(f):
+		return out.WriteByte(0x42)
+	}
+
+	frac, exp := math.Frexp(math.Abs(f))
+	mantissa := uint64(math.Ldexp(frac, 53))
+	exp -= 53
+	for mantissa&1 == 0 {
+		mantissa >>= 1
+		exp++
+	}
+
+	first := byte(0x80)
+	if f < 0 {
+		first |= 0x40
+	}
+	// Exponents of a float64 need at most two octets.
+	first |= byte(int64Length(int64(exp)) - 1)
+	err = out.WriteByte(first)
+	if err != nil {
+		return
+	}
+	err = marshalInt64(out, int64(exp))
+	if err != nil {
+		return
+	}
+
+	n := 0
+	for m := mantissa; m > 0; m >>= 8 {
+		n++
+	}
+	for ; n > 0; n-- {
+		err = out.WriteByte(byte(mantissa >> uint((n-1)*8)))
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
 func marshalTwoDigits(out *forkableWriter, v int) (err error) {
 	err = out.WriteByte(byte('0' + (v/10)%10))
 	if err != nil {
@@ -361,6 +441,70 @@ func marshalUTCTime(out *forkableWriter, t time.Time) (err error) {
 	return
 }
 
+// outsideUTCTimeRange returns true iff t cannot be represented as a
+// UTCTime, whose two-digit years cover 1950 to 2049.
+func outsideUTCTimeRange(t time.Time) bool {
+	year := t.UTC().Year()
+	return year < 1950 || year >= 2050
+}
+
+// marshalGeneralizedTime marshals t in UTC as YYYYMMDDHHMMSS[.f]Z with
+// any trailing zeros removed from the fraction, as DER requires.
+func marshalGeneralizedTime(out *forkableWriter, t time.Time) (err error) {
+	utc := t.UTC()
+	year, month, day := utc.Date()
+	if year < 0 || year > 9999 {
+		return StructuralError{"Cannot represent time as GeneralizedTime"}
+	}
+
+	err = marshalTwoDigits(out, year/100)
+	if err != nil {
+		return
+	}
+
+	err = marshalTwoDigits(out, year%100)
+	if err != nil {
+		return
+	}
+
+	err = marshalTwoDigits(out, int(month))
+	if err != nil {
+		return
+	}
+
+	err = marshalTwoDigits(out, day)
+	if err != nil {
+		return
+	}
+
+	hour, min, sec := utc.Clock()
+
+	err = marshalTwoDigits(out, hour)
+	if err != nil {
+		return
+	}
+
+	err = marshalTwoDigits(out, min)
+	if err != nil {
+		return
+	}
+
+	err = marshalTwoDigits(out, sec)
+	if err != nil {
+		return
+	}
+
+	if nsec := utc.Nanosecond(); nsec != 0 {
+		frac := strconv.Itoa(nsec + int(time.Second))[1:]
+		_, err = out.WriteString("." + strings.TrimRight(frac, "0"))
+		if err != nil {
+			return
+		}
+	}
+
+	return out.WriteByte('Z')
+}
+
 func stripTagAndLength(in []byte) []byte {
 	_, offset, err := parseTagAndLength(in, 0)
 	if err != nil {
@@ -372,7 +516,11 @@ func stripTagAndLength(in []byte) []byte {
 func marshalBody(out *forkableWriter, value reflect.Value, params fieldParameters) (err error) {
 	switch value.Type() {
 	case timeType:
-		return marshalUTCTime(out, value.Interface().(time.Time))
+		t := value.Interface().(time.Time)
+		if params.timeType == tagGeneralizedTime || params.timeType == 0 && outsideUTCTimeRange(t) {
+			return marshalGeneralizedTime(out, t)
+		}
+		return marshalUTCTime(out, t)
 	case bitStringType:
 		return marshalBitString(out, value.Interface().(BitString))
 	case objectIdentifierType:
@@ -390,6 +538,8 @@ func marshalBody(out *forkableWriter, value reflect.Value, params fieldParameter
 		}
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		return marshalInt64(out, int64(v.Int()))
+	case reflect.Float32, reflect.Float64:
+		return marshalReal(out, v.Float())
 	case reflect.Struct:
 		t := v.Type()
 
@@ -435,6 +585,10 @@ func marshalBody(out *forkableWriter, value reflect.Value, params fieldParameter
 			return
 		}
 
+		if params.set || strings.HasSuffix(sliceType.Name(), "SET") {
+			return marshalSetOf(out, v)
+		}
+
 		var params fieldParameters
 		for i := 0; i < v.Len(); i++ {
 			var pre *forkableWriter
@@ -446,17 +600,97 @@ func marshalBody(out *forkableWriter, value reflect.Value, params fieldParameter
 		}
 		return
 	case reflect.String:
-		if params.stringType == tagIA5String {
+		switch params.stringType {
+		case tagIA5String:
 			return marshalIA5String(out, v.String())
-		} else {
-			return marshalPrintableString(out, v.String())
+		case tagBMPString:
+			return marshalBMPString(out, v.String())
+		case tagUniversalString:
+			return marshalUniversalString(out, v.String())
 		}
-		return
+		return marshalPrintableString(out, v.String())
 	}
 
 	return StructuralError{"unknown Go type"}
 }
 
+// marshalSetOf marshals the elements of the slice v in the ascending order
+// of their encodings that DER requires for a SET OF.
+func marshalSetOf(out *forkableWriter, v reflect.Value) (err error) {
+	encodings := make([][]byte, v.Len())
+	for i := range encodings {
+		f := newForkableWriter()
+		err = marshalField(f, v.Index(i), fieldParameters{})
+		if err != nil {
+			return
+		}
+		var b bytes.Buffer
+		_, err = f.writeTo(&b)
+		if err != nil {
+			return
+		}
+		encodings[i] = b.Bytes()
+	}
+	sort.Sort(setOfEncodings(encodings))
+	for _, e := range encodings {
+		_, err = out.Write(e)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// setOfEncodings sorts encodings into DER SET OF order.
+type setOfEncodings [][]byte
+
+func (s setOfEncodings) Len() int           { return len(s) }
+func (s setOfEncodings) Less(i, j int) bool { return compareDER(s[i], s[j]) < 0 }
+func (s setOfEncodings) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// marshalChoice marshals the alternative of the CHOICE v that is set: the
+// only field of the struct that is not zero, such as a non-nil pointer.
+func marshalChoice(out *forkableWriter, v reflect.Value, params fieldParameters) (err error) {
+	if v.Kind() != reflect.Struct {
+		return StructuralError{"CHOICE must be a struct"}
+	}
+	chosen := -1
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if reflect.DeepEqual(f.Interface(), reflect.Zero(f.Type()).Interface()) {
+			continue
+		}
+		if chosen >= 0 {
+			return StructuralError{"more than one CHOICE alternative set"}
+		}
+		chosen = i
+	}
+	if chosen < 0 {
+		return StructuralError{"no CHOICE alternative set"}
+	}
+
+	alt := v.Field(chosen)
+	if alt.Kind() == reflect.Ptr && alt.Type() != bigIntType {
+		alt = alt.Elem()
+	}
+	altParams := parseFieldParameters(v.Type().Field(chosen).Tag.Get("asn1"))
+	altParams.optional = false
+	if !params.explicit {
+		return marshalField(out, alt, altParams)
+	}
+
+	tags, body := out.fork()
+	err = marshalField(body, alt, altParams)
+	if err != nil {
+		return
+	}
+	class := classContextSpecific
+	if params.application {
+		class = classApplication
+	}
+	return marshalTagAndLength(tags, tagAndLength{class, *params.tag, body.Len(), true})
+}
+
 func marshalField(out *forkableWriter, v reflect.Value, params fieldParameters) (err error) {
 	// If the field is an interface{} then recurse into it.
 	if v.Kind() == reflect.Interface && v.Type().NumMethod() == 0 {
@@ -467,6 +701,10 @@ func marshalField(out *forkableWriter, v reflect.Value, params fieldParameters)
 		return
 	}
 
+	if params.choice {
+		return marshalChoice(out, v, params)
+	}
+
 	if v.Type() == rawValueType {
 		rv := v.Interface().(RawValue)
 		if len(rv.FullBytes) != 0 {
@@ -495,6 +733,14 @@ func marshalField(out *forkableWriter, v reflect.Value, params fieldParameters)
 		tag = params.stringType
 	}
 
+	if params.timeType != 0 && tag != tagUTCTime {
+		return StructuralError{"Explicit time type given to non-time member"}
+	}
+
+	if tag == tagUTCTime && (params.timeType == tagGeneralizedTime || params.timeType == 0 && outsideUTCTimeRange(v.Interface().(time.Time))) {
+		tag = tagGeneralizedTime
+	}
+
 	if params.set {
 		if tag != tagSequence {
 			return StructuralError{"Non sequence tagged as set"}
@@ -540,11 +786,35 @@ func marshalField(out *forkableWriter, v reflect.Value, params fieldParameters)
 }
 
 // Marshal returns the ASN.1 encoding of val.
+//
+// The elements of a SET OF are sorted into the order that DER requires.
+// A time.Time is marshaled as a UTCTime unless it is outside the range
+// of years 1950 to 2049 or has the generalized tag, in which case it is
+// marshaled as a GeneralizedTime; with the utc tag, a time outside that
+// range is an error. A float32 or float64 is marshaled as
+// a REAL. A struct with the choice tag is marshaled as its only field
+// that is not zero.
+//
+// In addition to the struct field tags recognized by Unmarshal, Marshal
+// recognizes these:
+//
+//	ia5		causes strings to be marshaled as ASN.1, IA5String values
+//	printable	causes strings to be marshaled as ASN.1, PrintableString values
+//	bmp		causes strings to be marshaled as ASN.1, BMPString values
+//	universal	causes strings to be marshaled as ASN.1, UniversalString values
+//	utc		causes time.Time to be marshaled as ASN.1, UTCTime values
+//	generalized	causes time.Time to be marshaled as ASN.1, GeneralizedTime values
 func Marshal(val interface{}) ([]byte, error) {
+	return MarshalWithParams(val, "")
+}
+
+// MarshalWithParams allows field parameters to be specified for the
+// top-level element. The form of the params is the same as the field tags.
+func MarshalWithParams(val interface{}, params string) ([]byte, error) {
 	var out bytes.Buffer
 	v := reflect.ValueOf(val)
 	f := newForkableWriter()
-	err := marshalField(f, v, fieldParameters{})
+	err := marshalField(f, v, parseFieldParameters(params))
 	if err != nil {
 		return nil, err
 	}
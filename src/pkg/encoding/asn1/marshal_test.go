@@ -7,6 +7,7 @@ package asn1
 import (
 	"bytes"
 	"encoding/hex"
+	"math"
 	"math/big"
 	"testing"
 	"time"
@@ -56,6 +57,40 @@ type optionalRawValueTest struct {
 
 type testSET []int
 
+type setOfTest struct {
+	A []int `asn1:"set"`
+}
+
+type bmpStringTest struct {
+	A string `asn1:"bmp"`
+}
+
+type universalStringTest struct {
+	A string `asn1:"universal"`
+}
+
+type generalizedTimeTest struct {
+	A time.Time `asn1:"generalized"`
+}
+
+type utcTimeTest struct {
+	A time.Time `asn1:"utc"`
+}
+
+type choiceTest struct {
+	A choiceAlternatives `asn1:"choice"`
+}
+
+type explicitChoiceTest struct {
+	A choiceAlternatives `asn1:"choice,explicit,tag:2"`
+}
+
+type choiceAlternatives struct {
+	Int    *int
+	String *string
+	Bool   *bool `asn1:"tag:0"`
+}
+
 var PST = time.FixedZone("PST", -8*60*60)
 
 type marshalTest struct {
@@ -116,6 +151,76 @@ var marshalTests = []marshalTest{
 	{rawContentsStruct{[]byte{0x30, 3, 1, 2, 3}, 64}, "3003010203"},
 	{RawValue{Tag: 1, Class: 2, IsCompound: false, Bytes: []byte{1, 2, 3}}, "8103010203"},
 	{testSET([]int{10}), "310302010a"},
+	{testSET([]int{300, 10, -1}), "310a02010a0201ff0202012c"},
+	{setOfTest{[]int{2, 1}}, "30083106020101020102"},
+	{1.0, "0903800001"},
+	{0.5, "090380ff01"},
+	{-3.0, "0903c00003"},
+	{float32(1.5), "090380ff03"},
+	{0.0, "0900"},
+	{math.Copysign(0, -1), "090143"},
+	{math.Inf(1), "090140"},
+	{math.Inf(-1), "090141"},
+	{math.NaN(), "090142"},
+	{bmpStringTest{"h\u20ac"}, "30061e040068" + "20ac"},
+	{universalStringTest{"h\U0001f600"}, "300a1c0800000068" + "0001f600"},
+	{time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC), "170d3130303130323033303430355a"},
+	{time.Date(2050, 1, 2, 3, 4, 5, 0, time.UTC), "180f32303530303130323033303430355a"},
+	{generalizedTimeTest{time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)}, "3011180f32303130303130323033303430355a"},
+	{generalizedTimeTest{time.Date(2010, 1, 2, 3, 4, 5, 5e8, PST)}, "3013181132303130303130323131303430352e355a"},
+	{utcTimeTest{time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)}, "300f170d3130303130323033303430355a"},
+	{choiceTest{choiceAlternatives{Int: newInt(7)}}, "3003020107"},
+	{choiceTest{choiceAlternatives{String: newString("hi")}}, "300413026869"},
+	{choiceTest{choiceAlternatives{Bool: newBool(true)}}, "30038001ff"},
+	{explicitChoiceTest{choiceAlternatives{Int: newInt(7)}}, "3005a203020107"},
+}
+
+func TestMarshalChoiceErrors(t *testing.T) {
+	if _, err := Marshal(choiceTest{}); err == nil {
+		t.Errorf("no error marshaling CHOICE with no alternative set")
+	}
+	if _, err := Marshal(choiceTest{choiceAlternatives{Int: newInt(1), Bool: newBool(true)}}); err == nil {
+		t.Errorf("no error marshaling CHOICE with two alternatives set")
+	}
+}
+
+func TestMarshalUTCOutOfRange(t *testing.T) {
+	_, err := Marshal(utcTimeTest{time.Date(2060, 1, 2, 3, 4, 5, 0, time.UTC)})
+	if _, ok := err.(StructuralError); !ok {
+		t.Errorf("marshaling a year-2060 time with the utc tag: got error %v, want StructuralError", err)
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	floats := []float64{1, -1, 0.1, 1e300, -1e-300, math.MaxFloat64, math.SmallestNonzeroFloat64, 3.14159}
+	for _, f := range floats {
+		data, err := Marshal(f)
+		if err != nil {
+			t.Errorf("Marshal(%v) failed: %s", f, err)
+			continue
+		}
+		var out float64
+		if _, err := UnmarshalDER(data, &out); err != nil {
+			t.Errorf("UnmarshalDER(%x) failed: %s", data, err)
+			continue
+		}
+		if out != f {
+			t.Errorf("REAL round trip of %v gave %v", f, out)
+		}
+	}
+
+	in := setOfTest{[]int{300, -1, 10, 0}}
+	data, err := Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+	var out setOfTest
+	if _, err := UnmarshalDER(data, &out); err != nil {
+		t.Fatalf("UnmarshalDER(%x) failed: %s", data, err)
+	}
+	if len(out.A) != len(in.A) {
+		t.Errorf("SET OF round trip gave %v", out.A)
+	}
 }
 
 func TestMarshal(t *testing.T) {
@@ -120,179 +120,225 @@ func (bigEndian) GoString() string { return "binary.BigEndian" }
 // of fixed-size values.
 // Bytes read from r are decoded using the specified byte order
 // and written to successive fields of the data.
+// A struct field whose tag has the key "binary" with value "big"
+// or "little" is decoded, along with any fields nested in it, using
+// BigEndian or LittleEndian instead.
 func Read(r io.Reader, order ByteOrder, data interface{}) error {
-	// Fast path for basic types.
-	if n := intDestSize(data); n != 0 {
+	// Fast path for basic types and slices of them.
+	if n := decodeDataSize(data); n != 0 {
 		var b [8]byte
-		bs := b[:n]
+		var bs []byte
+		if n > len(b) {
+			bs = make([]byte, n)
+		} else {
+			bs = b[:n]
+		}
 		if _, err := io.ReadFull(r, bs); err != nil {
 			return err
 		}
-		switch v := data.(type) {
-		case *int8:
-			*v = int8(b[0])
-		case *uint8:
-			*v = b[0]
-		case *int16:
-			*v = int16(order.Uint16(bs))
-		case *uint16:
-			*v = order.Uint16(bs)
-		case *int32:
-			*v = int32(order.Uint32(bs))
-		case *uint32:
-			*v = order.Uint32(bs)
-		case *int64:
-			*v = int64(order.Uint64(bs))
-		case *uint64:
-			*v = order.Uint64(bs)
-		}
+		decodeFast(bs, order, data)
 		return nil
 	}
 
 	// Fallback to reflect-based.
-	var v reflect.Value
-	switch d := reflect.ValueOf(data); d.Kind() {
-	case reflect.Ptr:
-		v = d.Elem()
-	case reflect.Slice:
-		v = d
-	default:
-		return errors.New("binary.Read: invalid type " + d.Type().String())
-	}
-	size := dataSize(v)
-	if size < 0 {
-		return errors.New("binary.Read: invalid type " + v.Type().String())
+	v, c, size, err := decodeValue("binary.Read", data)
+	if err != nil {
+		return err
 	}
 	d := &decoder{order: order, buf: make([]byte, size)}
 	if _, err := io.ReadFull(r, d.buf); err != nil {
 		return err
 	}
-	d.value(v)
+	d.data(v, c)
 	return nil
 }
 
+// Decode decodes structured binary data from buf into data, as Read
+// does, and returns the number of bytes of buf that were used.
+// It returns an error if buf is too short to hold the data.
+func Decode(buf []byte, order ByteOrder, data interface{}) (int, error) {
+	if n := decodeDataSize(data); n != 0 {
+		if len(buf) < n {
+			return 0, errBufferTooSmall
+		}
+		decodeFast(buf[:n], order, data)
+		return n, nil
+	}
+
+	v, c, size, err := decodeValue("binary.Decode", data)
+	if err != nil {
+		return 0, err
+	}
+	if len(buf) < size {
+		return 0, errBufferTooSmall
+	}
+	d := &decoder{order: order, buf: buf[:size]}
+	d.data(v, c)
+	return size, nil
+}
+
 // Write writes the binary representation of data into w.
 // Data must be a fixed-size value or a slice of fixed-size
 // values, or a pointer to such data.
 // Bytes written to w are encoded using the specified byte order
 // and read from successive fields of the data.
+// Struct field tags select the byte order of a field as for Read.
 func Write(w io.Writer, order ByteOrder, data interface{}) error {
-	// Fast path for basic types.
-	var b [8]byte
-	var bs []byte
-	switch v := data.(type) {
-	case *int8:
-		bs = b[:1]
-		b[0] = byte(*v)
-	case int8:
-		bs = b[:1]
-		b[0] = byte(v)
-	case *uint8:
-		bs = b[:1]
-		b[0] = *v
-	case uint8:
-		bs = b[:1]
-		b[0] = byte(v)
-	case *int16:
-		bs = b[:2]
-		order.PutUint16(bs, uint16(*v))
-	case int16:
-		bs = b[:2]
-		order.PutUint16(bs, uint16(v))
-	case *uint16:
-		bs = b[:2]
-		order.PutUint16(bs, *v)
-	case uint16:
-		bs = b[:2]
-		order.PutUint16(bs, v)
-	case *int32:
-		bs = b[:4]
-		order.PutUint32(bs, uint32(*v))
-	case int32:
-		bs = b[:4]
-		order.PutUint32(bs, uint32(v))
-	case *uint32:
-		bs = b[:4]
-		order.PutUint32(bs, *v)
-	case uint32:
-		bs = b[:4]
-		order.PutUint32(bs, v)
-	case *int64:
-		bs = b[:8]
-		order.PutUint64(bs, uint64(*v))
-	case int64:
-		bs = b[:8]
-		order.PutUint64(bs, uint64(v))
-	case *uint64:
-		bs = b[:8]
-		order.PutUint64(bs, *v)
-	case uint64:
-		bs = b[:8]
-		order.PutUint64(bs, v)
-	}
-	if bs != nil {
+	// Fast path for basic types and slices of them.
+	if n := intDataSize(data); n != 0 {
+		var b [8]byte
+		var bs []byte
+		if n > len(b) {
+			bs = make([]byte, n)
+		} else {
+			bs = b[:n]
+		}
+		encodeFast(bs, order, data)
 		_, err := w.Write(bs)
 		return err
 	}
-	v := reflect.Indirect(reflect.ValueOf(data))
-	size := dataSize(v)
-	if size < 0 {
-		return errors.New("binary.Write: invalid type " + v.Type().String())
+
+	// Fallback to reflect-based.
+	v, c, size, err := encodeValue("binary.Write", data)
+	if err != nil {
+		return err
 	}
 	buf := make([]byte, size)
 	e := &encoder{order: order, buf: buf}
-	e.value(v)
-	_, err := w.Write(buf)
+	e.data(v, c)
+	_, err = w.Write(buf)
 	return err
 }
 
+// Encode encodes the binary representation of data into buf, as Write
+// does, and returns the number of bytes written.
+// It returns an error if buf is too short to hold the data.
+func Encode(buf []byte, order ByteOrder, data interface{}) (int, error) {
+	if n := intDataSize(data); n != 0 {
+		if len(buf) < n {
+			return 0, errBufferTooSmall
+		}
+		encodeFast(buf[:n], order, data)
+		return n, nil
+	}
+
+	v, c, size, err := encodeValue("binary.Encode", data)
+	if err != nil {
+		return 0, err
+	}
+	if len(buf) < size {
+		return 0, errBufferTooSmall
+	}
+	e := &encoder{order: order, buf: buf[:size]}
+	e.data(v, c)
+	return size, nil
+}
+
+// Append appends the binary representation of data to buf, as Write
+// does, and returns the extended buffer.
+func Append(buf []byte, order ByteOrder, data interface{}) ([]byte, error) {
+	if n := intDataSize(data); n != 0 {
+		buf, bs := grow(buf, n)
+		encodeFast(bs, order, data)
+		return buf, nil
+	}
+
+	v, c, size, err := encodeValue("binary.Append", data)
+	if err != nil {
+		return nil, err
+	}
+	buf, bs := grow(buf, size)
+	e := &encoder{order: order, buf: bs}
+	e.data(v, c)
+	return buf, nil
+}
+
 // Size returns how many bytes Write would generate to encode the value v, which
 // must be a fixed-size value or a slice of fixed-size values, or a pointer to such data.
 func Size(v interface{}) int {
+	if n := intDataSize(v); n != 0 {
+		return n
+	}
 	return dataSize(reflect.Indirect(reflect.ValueOf(v)))
 }
 
-// dataSize returns the number of bytes the actual data represented by v occupies in memory.
-// For compound structures, it sums the sizes of the elements. Thus, for instance, for a slice
-// it returns the length of the slice times the element size and does not count the memory
-// occupied by the header.
-func dataSize(v reflect.Value) int {
-	if v.Kind() == reflect.Slice {
-		elem := sizeof(v.Type().Elem())
-		if elem < 0 {
-			return -1
-		}
-		return v.Len() * elem
+var errBufferTooSmall = errors.New("binary: buffer too small")
+
+// grow extends buf by n bytes, reallocating if necessary, and returns
+// the extended buffer and the n bytes added to it.
+func grow(buf []byte, n int) ([]byte, []byte) {
+	l := len(buf)
+	if l+n > cap(buf) {
+		nbuf := make([]byte, l, 2*cap(buf)+n)
+		copy(nbuf, buf)
+		buf = nbuf
 	}
-	return sizeof(v.Type())
+	buf = buf[:l+n]
+	return buf, buf[l:]
 }
 
-func sizeof(t reflect.Type) int {
-	switch t.Kind() {
-	case reflect.Array:
-		n := sizeof(t.Elem())
-		if n < 0 {
-			return -1
-		}
-		return t.Len() * n
+// decodeValue returns the value that data points to, or the slice data,
+// its codec and its size, for the function fn.
+func decodeValue(fn string, data interface{}) (v reflect.Value, c *typeCodec, size int, err error) {
+	switch d := reflect.ValueOf(data); d.Kind() {
+	case reflect.Ptr:
+		v = d.Elem()
+	case reflect.Slice:
+		v = d
+	case reflect.Invalid:
+		return v, nil, 0, errors.New(fn + ": invalid type <nil>")
+	default:
+		return v, nil, 0, errors.New(fn + ": invalid type " + d.Type().String())
+	}
+	if !v.IsValid() {
+		return v, nil, 0, errors.New(fn + ": nil pointer")
+	}
+	c, size = dataCodec(v)
+	if c == nil {
+		return v, nil, 0, errors.New(fn + ": invalid type " + v.Type().String())
+	}
+	return v, c, size, nil
+}
 
-	case reflect.Struct:
-		sum := 0
-		for i, n := 0, t.NumField(); i < n; i++ {
-			s := sizeof(t.Field(i).Type)
-			if s < 0 {
-				return -1
-			}
-			sum += s
-		}
-		return sum
+// encodeValue returns data, or the value it points to, its codec and
+// its size, for the function fn.
+func encodeValue(fn string, data interface{}) (v reflect.Value, c *typeCodec, size int, err error) {
+	v = reflect.Indirect(reflect.ValueOf(data))
+	if !v.IsValid() {
+		return v, nil, 0, errors.New(fn + ": invalid type <nil>")
+	}
+	c, size = dataCodec(v)
+	if c == nil {
+		return v, nil, 0, errors.New(fn + ": invalid type " + v.Type().String())
+	}
+	return v, c, size, nil
+}
 
-	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
-		reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
-		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
-		return int(t.Size())
+// dataCodec returns the codec for v, or for the elements of v if it is a
+// slice, and the number of bytes the data in v occupies, or nil and -1 if
+// v does not hold fixed-size data.
+func dataCodec(v reflect.Value) (*typeCodec, int) {
+	if v.Kind() == reflect.Slice {
+		c := codecFor(v.Type().Elem())
+		if c == nil {
+			return nil, -1
+		}
+		return c, v.Len() * c.size
+	}
+	c := codecFor(v.Type())
+	if c == nil {
+		return nil, -1
 	}
-	return -1
+	return c, c.size
+}
+
+// dataSize returns the number of bytes the actual data represented by v occupies in memory.
+// For compound structures, it sums the sizes of the elements. Thus, for instance, for a slice
+// it returns the length of the slice times the element size and does not count the memory
+// occupied by the header.
+func dataSize(v reflect.Value) int {
+	_, size := dataCodec(v)
+	return size
 }
 
 type decoder struct {
@@ -365,24 +411,41 @@ func (d *decoder) int64() int64 { return int64(d.uint64()) }
 
 func (e *encoder) int64(x int64) { e.uint64(uint64(x)) }
 
-func (d *decoder) value(v reflect.Value) {
-	switch v.Kind() {
+// data decodes v, or each element of v if it is a slice, using c.
+func (d *decoder) data(v reflect.Value, c *typeCodec) {
+	if v.Kind() != reflect.Slice {
+		d.value(v, c)
+		return
+	}
+	l := v.Len()
+	for i := 0; i < l; i++ {
+		d.value(v.Index(i), c)
+	}
+}
+
+func (d *decoder) value(v reflect.Value, c *typeCodec) {
+	switch c.kind {
 	case reflect.Array:
+		if c.bytes {
+			reflect.Copy(v, reflect.ValueOf(d.buf[:c.size]))
+			d.buf = d.buf[c.size:]
+			return
+		}
 		l := v.Len()
 		for i := 0; i < l; i++ {
-			d.value(v.Index(i))
+			d.value(v.Index(i), c.elem)
 		}
 
 	case reflect.Struct:
-		l := v.NumField()
-		for i := 0; i < l; i++ {
-			d.value(v.Field(i))
-		}
-
-	case reflect.Slice:
-		l := v.Len()
-		for i := 0; i < l; i++ {
-			d.value(v.Index(i))
+		for i, f := range c.fields {
+			if f.order == nil {
+				d.value(v.Field(i), f.codec)
+				continue
+			}
+			order := d.order
+			d.order = f.order
+			d.value(v.Field(i), f.codec)
+			d.order = order
 		}
 
 	case reflect.Int8:
@@ -421,84 +484,272 @@ func (d *decoder) value(v reflect.Value) {
 	}
 }
 
-func (e *encoder) value(v reflect.Value) {
-	switch v.Kind() {
+// data encodes v, or each element of v if it is a slice, using c.
+func (e *encoder) data(v reflect.Value, c *typeCodec) {
+	if v.Kind() != reflect.Slice {
+		e.value(v, c)
+		return
+	}
+	l := v.Len()
+	for i := 0; i < l; i++ {
+		e.value(v.Index(i), c)
+	}
+}
+
+func (e *encoder) value(v reflect.Value, c *typeCodec) {
+	switch c.kind {
 	case reflect.Array:
+		if c.bytes {
+			reflect.Copy(reflect.ValueOf(e.buf[:c.size]), v)
+			e.buf = e.buf[c.size:]
+			return
+		}
 		l := v.Len()
 		for i := 0; i < l; i++ {
-			e.value(v.Index(i))
+			e.value(v.Index(i), c.elem)
 		}
 
 	case reflect.Struct:
-		l := v.NumField()
-		for i := 0; i < l; i++ {
-			e.value(v.Field(i))
-		}
-
-	case reflect.Slice:
-		l := v.Len()
-		for i := 0; i < l; i++ {
-			e.value(v.Index(i))
+		for i, f := range c.fields {
+			if f.order == nil {
+				e.value(v.Field(i), f.codec)
+				continue
+			}
+			order := e.order
+			e.order = f.order
+			e.value(v.Field(i), f.codec)
+			e.order = order
 		}
 
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		switch v.Type().Kind() {
-		case reflect.Int8:
-			e.int8(int8(v.Int()))
-		case reflect.Int16:
-			e.int16(int16(v.Int()))
-		case reflect.Int32:
-			e.int32(int32(v.Int()))
-		case reflect.Int64:
-			e.int64(v.Int())
-		}
+	case reflect.Int8:
+		e.int8(int8(v.Int()))
+	case reflect.Int16:
+		e.int16(int16(v.Int()))
+	case reflect.Int32:
+		e.int32(int32(v.Int()))
+	case reflect.Int64:
+		e.int64(v.Int())
 
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-		switch v.Type().Kind() {
-		case reflect.Uint8:
-			e.uint8(uint8(v.Uint()))
-		case reflect.Uint16:
-			e.uint16(uint16(v.Uint()))
-		case reflect.Uint32:
-			e.uint32(uint32(v.Uint()))
-		case reflect.Uint64:
-			e.uint64(v.Uint())
-		}
+	case reflect.Uint8:
+		e.uint8(uint8(v.Uint()))
+	case reflect.Uint16:
+		e.uint16(uint16(v.Uint()))
+	case reflect.Uint32:
+		e.uint32(uint32(v.Uint()))
+	case reflect.Uint64:
+		e.uint64(v.Uint())
 
-	case reflect.Float32, reflect.Float64:
-		switch v.Type().Kind() {
-		case reflect.Float32:
-			e.uint32(math.Float32bits(float32(v.Float())))
-		case reflect.Float64:
-			e.uint64(math.Float64bits(v.Float()))
-		}
+	case reflect.Float32:
+		e.uint32(math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		e.uint64(math.Float64bits(v.Float()))
 
-	case reflect.Complex64, reflect.Complex128:
-		switch v.Type().Kind() {
-		case reflect.Complex64:
-			x := v.Complex()
-			e.uint32(math.Float32bits(float32(real(x))))
-			e.uint32(math.Float32bits(float32(imag(x))))
-		case reflect.Complex128:
-			x := v.Complex()
-			e.uint64(math.Float64bits(real(x)))
-			e.uint64(math.Float64bits(imag(x)))
-		}
+	case reflect.Complex64:
+		x := v.Complex()
+		e.uint32(math.Float32bits(float32(real(x))))
+		e.uint32(math.Float32bits(float32(imag(x))))
+	case reflect.Complex128:
+		x := v.Complex()
+		e.uint64(math.Float64bits(real(x)))
+		e.uint64(math.Float64bits(imag(x)))
 	}
 }
 
-// intDestSize returns the size of the integer that ptrType points to,
-// or 0 if the type is not supported.
-func intDestSize(ptrType interface{}) int {
-	switch ptrType.(type) {
-	case *int8, *uint8:
+// intDataSize returns the size of the data required to represent data when
+// encoded, if data is a basic fixed-size number, a pointer to one or a
+// slice of them, or 0 if the data is of any other type or the slice is empty.
+func intDataSize(data interface{}) int {
+	switch data := data.(type) {
+	case int8, *int8, uint8, *uint8:
 		return 1
-	case *int16, *uint16:
+	case int16, *int16, uint16, *uint16:
 		return 2
-	case *int32, *uint32:
+	case int32, *int32, uint32, *uint32, float32, *float32:
 		return 4
-	case *int64, *uint64:
+	case int64, *int64, uint64, *uint64, float64, *float64:
 		return 8
+	case []int8:
+		return len(data)
+	case []uint8:
+		return len(data)
+	case []int16:
+		return 2 * len(data)
+	case []uint16:
+		return 2 * len(data)
+	case []int32:
+		return 4 * len(data)
+	case []uint32:
+		return 4 * len(data)
+	case []float32:
+		return 4 * len(data)
+	case []int64:
+		return 8 * len(data)
+	case []uint64:
+		return 8 * len(data)
+	case []float64:
+		return 8 * len(data)
 	}
 	return 0
 }
+
+// decodeDataSize is intDataSize for the fast paths of Read and Decode,
+// which must store into data: it returns 0 for the basic types that
+// are not pointers, which the reflect-based path rejects.
+func decodeDataSize(data interface{}) int {
+	switch data.(type) {
+	case int8, uint8, int16, uint16, int32, uint32, float32, int64, uint64, float64:
+		return 0
+	}
+	return intDataSize(data)
+}
+
+// decodeFast decodes bs into data, which must be one of the pointer
+// or slice types accepted by intDataSize.  Len(bs) must equal
+// intDataSize(data).
+func decodeFast(bs []byte, order ByteOrder, data interface{}) {
+	switch data := data.(type) {
+	case *int8:
+		*data = int8(bs[0])
+	case *uint8:
+		*data = bs[0]
+	case *int16:
+		*data = int16(order.Uint16(bs))
+	case *uint16:
+		*data = order.Uint16(bs)
+	case *int32:
+		*data = int32(order.Uint32(bs))
+	case *uint32:
+		*data = order.Uint32(bs)
+	case *float32:
+		*data = math.Float32frombits(order.Uint32(bs))
+	case *int64:
+		*data = int64(order.Uint64(bs))
+	case *uint64:
+		*data = order.Uint64(bs)
+	case *float64:
+		*data = math.Float64frombits(order.Uint64(bs))
+	case []int8:
+		for i, x := range bs {
+			data[i] = int8(x)
+		}
+	case []uint8:
+		copy(data, bs)
+	case []int16:
+		for i := range data {
+			data[i] = int16(order.Uint16(bs[2*i:]))
+		}
+	case []uint16:
+		for i := range data {
+			data[i] = order.Uint16(bs[2*i:])
+		}
+	case []int32:
+		for i := range data {
+			data[i] = int32(order.Uint32(bs[4*i:]))
+		}
+	case []uint32:
+		for i := range data {
+			data[i] = order.Uint32(bs[4*i:])
+		}
+	case []float32:
+		for i := range data {
+			data[i] = math.Float32frombits(order.Uint32(bs[4*i:]))
+		}
+	case []int64:
+		for i := range data {
+			data[i] = int64(order.Uint64(bs[8*i:]))
+		}
+	case []uint64:
+		for i := range data {
+			data[i] = order.Uint64(bs[8*i:])
+		}
+	case []float64:
+		for i := range data {
+			data[i] = math.Float64frombits(order.Uint64(bs[8*i:]))
+		}
+	}
+}
+
+// encodeFast encodes data, which must be one of the types accepted by
+// intDataSize, into bs.  Len(bs) must equal intDataSize(data).
+func encodeFast(bs []byte, order ByteOrder, data interface{}) {
+	switch v := data.(type) {
+	case *int8:
+		bs[0] = byte(*v)
+	case int8:
+		bs[0] = byte(v)
+	case *uint8:
+		bs[0] = *v
+	case uint8:
+		bs[0] = v
+	case *int16:
+		order.PutUint16(bs, uint16(*v))
+	case int16:
+		order.PutUint16(bs, uint16(v))
+	case *uint16:
+		order.PutUint16(bs, *v)
+	case uint16:
+		order.PutUint16(bs, v)
+	case *int32:
+		order.PutUint32(bs, uint32(*v))
+	case int32:
+		order.PutUint32(bs, uint32(v))
+	case *uint32:
+		order.PutUint32(bs, *v)
+	case uint32:
+		order.PutUint32(bs, v)
+	case *float32:
+		order.PutUint32(bs, math.Float32bits(*v))
+	case float32:
+		order.PutUint32(bs, math.Float32bits(v))
+	case *int64:
+		order.PutUint64(bs, uint64(*v))
+	case int64:
+		order.PutUint64(bs, uint64(v))
+	case *uint64:
+		order.PutUint64(bs, *v)
+	case uint64:
+		order.PutUint64(bs, v)
+	case *float64:
+		order.PutUint64(bs, math.Float64bits(*v))
+	case float64:
+		order.PutUint64(bs, math.Float64bits(v))
+	case []int8:
+		for i, x := range v {
+			bs[i] = byte(x)
+		}
+	case []uint8:
+		copy(bs, v)
+	case []int16:
+		for i, x := range v {
+			order.PutUint16(bs[2*i:], uint16(x))
+		}
+	case []uint16:
+		for i, x := range v {
+			order.PutUint16(bs[2*i:], x)
+		}
+	case []int32:
+		for i, x := range v {
+			order.PutUint32(bs[4*i:], uint32(x))
+		}
+	case []uint32:
+		for i, x := range v {
+			order.PutUint32(bs[4*i:], x)
+		}
+	case []float32:
+		for i, x := range v {
+			order.PutUint32(bs[4*i:], math.Float32bits(x))
+		}
+	case []int64:
+		for i, x := range v {
+			order.PutUint64(bs[8*i:], uint64(x))
+		}
+	case []uint64:
+		for i, x := range v {
+			order.PutUint64(bs[8*i:], x)
+		}
+	case []float64:
+		for i, x := range v {
+			order.PutUint64(bs[8*i:], math.Float64bits(x))
+		}
+	}
+}
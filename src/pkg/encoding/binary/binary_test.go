@@ -161,6 +161,149 @@ func TestWriteT(t *testing.T) {
 	}
 }
 
+func TestDecodeNonPointer(t *testing.T) {
+	buf := bytes.NewBuffer([]byte{1, 2, 3, 4})
+	err := Read(buf, BigEndian, int32(0))
+	if err == nil || err.Error() != "binary.Read: invalid type int32" {
+		t.Errorf("Read into int32: got error %v, want invalid type", err)
+	}
+	if buf.Len() != 4 {
+		t.Errorf("Read into int32 consumed %d bytes", 4-buf.Len())
+	}
+	n, err := Decode([]byte{1, 2, 3, 4}, BigEndian, uint32(0))
+	if n != 0 || err == nil || err.Error() != "binary.Decode: invalid type uint32" {
+		t.Errorf("Decode into uint32 = %d, %v, want 0 and invalid type", n, err)
+	}
+}
+
+func TestSliceFastPaths(t *testing.T) {
+	slices := []interface{}{
+		[]int8{-1, 2},
+		[]uint8{1, 2},
+		[]int16{-1, 0x0102},
+		[]uint16{1, 0x0102},
+		[]int32{-1, 0x01020304},
+		[]uint32{1, 0x01020304},
+		[]float32{1.5, -2},
+		[]int64{-1, 0x0102030405060708},
+		[]uint64{1, 0x0102030405060708},
+		[]float64{1.5, -2},
+	}
+	for _, order := range []ByteOrder{BigEndian, LittleEndian} {
+		for _, in := range slices {
+			buf := new(bytes.Buffer)
+			if err := Write(buf, order, in); err != nil {
+				t.Errorf("Write %T: %v", in, err)
+				continue
+			}
+			// The slow path must produce the same encoding.
+			want := make([]byte, Size(in))
+			e := &encoder{order: order, buf: want}
+			e.data(reflect.ValueOf(in), codecFor(reflect.TypeOf(in).Elem()))
+			checkResult(t, "WriteSlice", order, nil, buf.Bytes(), want)
+
+			out := reflect.MakeSlice(reflect.TypeOf(in), 2, 2).Interface()
+			err := Read(buf, order, out)
+			checkResult(t, "ReadSlice", order, err, out, in)
+		}
+	}
+}
+
+type Header struct {
+	Magic   [4]byte
+	Length  uint16 `binary:"big"`
+	Flags   uint16 `binary:"little"`
+	Default uint16
+	Inner   struct {
+		A uint16
+		B uint16 `binary:"little"`
+	} `binary:"big"`
+}
+
+func TestFieldByteOrder(t *testing.T) {
+	var h Header
+	copy(h.Magic[:], "HDR1")
+	h.Length = 0x0102
+	h.Flags = 0x0304
+	h.Default = 0x0506
+	h.Inner.A = 0x0708
+	h.Inner.B = 0x090a
+
+	want := []byte{'H', 'D', 'R', '1', 1, 2, 4, 3, 6, 5, 7, 8, 10, 9}
+	buf := new(bytes.Buffer)
+	err := Write(buf, LittleEndian, &h)
+	checkResult(t, "Write", LittleEndian, err, buf.Bytes(), want)
+
+	var h2 Header
+	err = Read(bytes.NewBuffer(want), LittleEndian, &h2)
+	checkResult(t, "Read", LittleEndian, err, h2, h)
+
+	want[8], want[9] = 5, 6
+	buf.Reset()
+	err = Write(buf, BigEndian, &h)
+	checkResult(t, "Write", BigEndian, err, buf.Bytes(), want)
+}
+
+func TestEncodeDecode(t *testing.T) {
+	buf := make([]byte, len(big)+1)
+	n, err := Encode(buf, BigEndian, &s)
+	if n != len(big) {
+		t.Errorf("Encode: have %d bytes, want %d", n, len(big))
+	}
+	checkResult(t, "Encode", BigEndian, err, buf[:len(big)], big)
+
+	var s2 Struct
+	n, err = Decode(buf, BigEndian, &s2)
+	if n != len(big) {
+		t.Errorf("Decode: have %d bytes, want %d", n, len(big))
+	}
+	checkResult(t, "Decode", BigEndian, err, s2, s)
+
+	if _, err := Encode(buf[:len(big)-1], BigEndian, &s); err == nil {
+		t.Errorf("Encode into short buffer: have nil, want error")
+	}
+	if _, err := Decode(buf[:len(big)-1], BigEndian, &s2); err == nil {
+		t.Errorf("Decode from short buffer: have nil, want error")
+	}
+	var x uint32
+	if _, err := Decode(buf[:3], BigEndian, &x); err == nil {
+		t.Errorf("Decode uint32 from short buffer: have nil, want error")
+	}
+	n, err = Decode(src, BigEndian, &x)
+	checkResult(t, "Decode", BigEndian, err, x, uint32(0x01020304))
+	if n != 4 {
+		t.Errorf("Decode uint32: have %d bytes, want 4", n)
+	}
+}
+
+func TestAppend(t *testing.T) {
+	prefix := []byte{0xff}
+	b, err := Append(prefix, LittleEndian, s)
+	checkResult(t, "Append", LittleEndian, err, b, append([]byte{0xff}, little...))
+
+	b, err = Append(b[:1], BigEndian, res)
+	checkResult(t, "Append", BigEndian, err, b, append([]byte{0xff}, src...))
+
+	b, err = Append(nil, BigEndian, uint16(0x0102))
+	checkResult(t, "Append", BigEndian, err, b, []byte{1, 2})
+
+	if _, err := Append(nil, BigEndian, T{}); err == nil {
+		t.Errorf("Append T: have nil, want error")
+	}
+}
+
+func TestInvalidData(t *testing.T) {
+	if err := Write(new(bytes.Buffer), BigEndian, nil); err == nil {
+		t.Errorf("Write nil: have nil, want error")
+	}
+	if err := Read(bytes.NewBuffer(src), BigEndian, (*Struct)(nil)); err == nil {
+		t.Errorf("Read into nil pointer: have nil, want error")
+	}
+	if err := Read(bytes.NewBuffer(src), BigEndian, Struct{}); err == nil {
+		t.Errorf("Read into non-pointer: have nil, want error")
+	}
+}
+
 type byteSliceReader struct {
 	remain []byte
 }
@@ -254,3 +397,42 @@ func BenchmarkWriteInts(b *testing.B) {
 		b.Fatalf("first half doesn't match: %x %x", buf.Bytes(), big[:30])
 	}
 }
+
+func BenchmarkReadHeader(b *testing.B) {
+	bsr := &byteSliceReader{}
+	var h Header
+	buf := make([]byte, Size(&h))
+	b.SetBytes(int64(len(buf)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bsr.remain = buf
+		Read(bsr, BigEndian, &h)
+	}
+}
+
+func BenchmarkDecodeStruct(b *testing.B) {
+	var t Struct
+	b.SetBytes(int64(len(big)))
+	for i := 0; i < b.N; i++ {
+		Decode(big, BigEndian, &t)
+	}
+}
+
+func BenchmarkAppendStruct(b *testing.B) {
+	buf := make([]byte, 0, len(big))
+	b.SetBytes(int64(len(big)))
+	for i := 0; i < b.N; i++ {
+		Append(buf[:0], BigEndian, &s)
+	}
+}
+
+func BenchmarkWriteSlice1000Float64s(b *testing.B) {
+	slice := make([]float64, 1000)
+	buf := new(bytes.Buffer)
+	b.SetBytes(int64(len(slice) * 8))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		Write(buf, LittleEndian, slice)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package binary
+
+import (
+	"reflect"
+	"sync"
+)
+
+// A typeCodec describes the layout of a fixed-size type.  Codecs are
+// computed once per type and cached, so that Read and Write need not
+// walk the type on every call.
+type typeCodec struct {
+	kind   reflect.Kind
+	size   int          // encoded size in bytes
+	elem   *typeCodec   // element of an array
+	bytes  bool         // array of uint8, which is copied in one step
+	fields []fieldCodec // fields of a struct
+}
+
+// A fieldCodec describes a struct field.
+type fieldCodec struct {
+	codec *typeCodec
+	order ByteOrder // byte order from the field's tag, or nil
+}
+
+var (
+	codecLock  sync.RWMutex
+	codecCache = make(map[reflect.Type]*typeCodec)
+)
+
+// codecFor returns the codec for t, or nil if t is not a fixed-size type.
+func codecFor(t reflect.Type) *typeCodec {
+	codecLock.RLock()
+	c, ok := codecCache[t]
+	codecLock.RUnlock()
+	if ok {
+		return c
+	}
+
+	c = newCodec(t)
+	codecLock.Lock()
+	codecCache[t] = c
+	codecLock.Unlock()
+	return c
+}
+
+// newCodec computes the codec for t, or returns nil if t is not a
+// fixed-size type.
+func newCodec(t reflect.Type) *typeCodec {
+	switch t.Kind() {
+	case reflect.Array:
+		elem := codecFor(t.Elem())
+		if elem == nil {
+			return nil
+		}
+		return &typeCodec{
+			kind:  reflect.Array,
+			size:  t.Len() * elem.size,
+			elem:  elem,
+			bytes: t.Elem() == reflect.TypeOf(uint8(0)),
+		}
+
+	case reflect.Struct:
+		c := &typeCodec{kind: reflect.Struct, fields: make([]fieldCodec, t.NumField())}
+		for i := range c.fields {
+			f := t.Field(i)
+			fc := codecFor(f.Type)
+			if fc == nil {
+				return nil
+			}
+			c.fields[i] = fieldCodec{fc, tagOrder(f.Tag.Get("binary"))}
+			c.size += fc.size
+		}
+		return c
+
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return &typeCodec{kind: t.Kind(), size: int(t.Size())}
+	}
+	return nil
+}
+
+// tagOrder returns the byte order named by the value of a "binary"
+// struct tag, or nil if it names none.
+func tagOrder(tag string) ByteOrder {
+	switch tag {
+	case "big":
+		return BigEndian
+	case "little":
+		return LittleEndian
+	}
+	return nil
+}
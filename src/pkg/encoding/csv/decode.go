@@ -0,0 +1,229 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package csv
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// A FieldError describes a CSV field that could not be stored
+// in a struct field of a specific Go type.
+type FieldError struct {
+	Column string       // Column name from the header
+	Value  string       // The text of the CSV field
+	Type   reflect.Type // Type of the struct field
+	Err    error        // The conversion error, if any
+}
+
+func (e *FieldError) Error() string {
+	s := fmt.Sprintf("cannot decode %q in column %q into Go value of type %s", e.Value, e.Column, e.Type)
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+// An UnsupportedTypeError is returned by Decode and Encode when a struct
+// field has a type that cannot be converted to or from a CSV field.
+type UnsupportedTypeError struct {
+	Type reflect.Type
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return "csv: unsupported type: " + e.Type.String()
+}
+
+var errDecodeArg = errors.New("csv: Decode requires a non-nil pointer to a struct")
+
+// A Decoder reads structs from a CSV-encoded file.
+//
+// The first record read by a Decoder is the header, which names the
+// columns.  Each following record is decoded into a struct by matching
+// the column names against the struct's exported fields.  The column
+// name of a field is the field name, or the value of its "csv" key
+// in the struct field's tag if present.  A field with tag "-" is
+// ignored.  Matching prefers an exact match but also accepts a
+// case-insensitive one.  Columns with no matching field are ignored,
+// as are fields with no matching column.
+//
+// The fields of an untagged anonymous struct field are treated as
+// if they were fields of the outer struct.
+//
+// Fields may be strings, booleans, integers, floating point numbers,
+// or pointers to any of these.  Values are converted as by the
+// strconv package.  An empty CSV field sets a pointer to nil and any
+// other type to its zero value.
+type Decoder struct {
+	r      *Reader
+	header []string
+	typ    reflect.Type
+	cols   []*field // field for each column, or nil
+	record []string
+}
+
+// NewDecoder returns a new Decoder that reads from r.
+// The Reader's settings are honored; it should not be read
+// from other than by the Decoder.
+func NewDecoder(r *Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// Header returns the column names, reading the header record
+// if it has not been read yet.
+func (d *Decoder) Header() ([]string, error) {
+	if d.header != nil {
+		return d.header, nil
+	}
+	header, err := d.r.readRecord(nil)
+	if err != nil {
+		return nil, err
+	}
+	d.header = header
+	return header, nil
+}
+
+// Decode reads the next record and stores it in the struct pointed to by v.
+// At the end of the input Decode returns io.EOF.  A field that cannot be
+// converted is reported as a *ParseError with the position of the field
+// and a *FieldError describing the conversion.
+func (d *Decoder) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errDecodeArg
+	}
+	if _, err := d.Header(); err != nil {
+		return err
+	}
+	record, err := d.r.readRecord(d.record)
+	if err != nil {
+		return err
+	}
+	d.record = record
+
+	sv := rv.Elem()
+	if sv.Type() != d.typ {
+		d.mapColumns(sv.Type())
+	}
+	for i, f := range d.cols {
+		if f == nil || i >= len(record) {
+			continue
+		}
+		fv := fieldByIndex(sv, f.index)
+		if err := setField(fv, record[i]); err != nil {
+			if _, ok := err.(*UnsupportedTypeError); ok {
+				return err
+			}
+			p := d.r.fieldPos[i]
+			return &ParseError{
+				Line:   p.line,
+				Column: p.column,
+				Err: &FieldError{
+					Column: d.header[i],
+					Value:  record[i],
+					Type:   f.typ,
+					Err:    err,
+				},
+			}
+		}
+	}
+	return nil
+}
+
+// mapColumns matches the header against the fields of struct type t.
+func (d *Decoder) mapColumns(t reflect.Type) {
+	fields := typeFields(t)
+	d.typ = t
+	d.cols = make([]*field, len(d.header))
+	used := make([]bool, len(fields))
+	for i, name := range d.header {
+		for j := range fields {
+			if !used[j] && fields[j].name == name {
+				d.cols[i] = &fields[j]
+				used[j] = true
+				break
+			}
+		}
+	}
+	for i, name := range d.header {
+		if d.cols[i] != nil {
+			continue
+		}
+		for j := range fields {
+			if !used[j] && strings.EqualFold(fields[j].name, name) {
+				d.cols[i] = &fields[j]
+				used[j] = true
+				break
+			}
+		}
+	}
+}
+
+// fieldByIndex returns the nested field of v for index,
+// allocating any nil embedded struct pointers along the way.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// setField stores the text s in v.
+func setField(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Ptr {
+		if s == "" {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if s == "" && isScalar(v.Type()) {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	default:
+		return &UnsupportedTypeError{v.Type()}
+	}
+	return nil
+}
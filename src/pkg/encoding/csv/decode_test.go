@@ -0,0 +1,136 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package csv
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type Base struct {
+	ID   int `csv:"id"`
+	Name string
+}
+
+type Record struct {
+	Base
+	Price  float64 `csv:"price"`
+	Count  *uint8  `csv:"count"`
+	Active bool    `csv:"active"`
+	Skip   string  `csv:"-"`
+	note   string
+}
+
+func uint8p(n uint8) *uint8 { return &n }
+
+func TestDecode(t *testing.T) {
+	const input = "name,id,extra,price,count,active\n" +
+		"apple,1,x,0.5,3,true\n" +
+		"\"pear, green\",2,,1e2,,false\n" +
+		",,,,,\"\"\n"
+	want := []Record{
+		{Base{1, "apple"}, 0.5, uint8p(3), true, "", ""},
+		{Base{2, "pear, green"}, 100, nil, false, "", ""},
+		{},
+	}
+	d := NewDecoder(NewReader(strings.NewReader(input)))
+	for i, w := range want {
+		r := Record{Skip: "keep"}
+		if err := d.Decode(&r); err != nil {
+			t.Fatalf("#%d: Decode: %v", i, err)
+		}
+		w.Skip = "keep"
+		if !reflect.DeepEqual(r, w) {
+			t.Errorf("#%d: got %+v want %+v", i, r, w)
+		}
+	}
+	var r Record
+	if err := d.Decode(&r); err != io.EOF {
+		t.Errorf("Decode at end: got %v want io.EOF", err)
+	}
+	header, err := d.Header()
+	if err != nil || len(header) != 6 || header[2] != "extra" {
+		t.Errorf("Header: got %q, %v", header, err)
+	}
+}
+
+func TestDecodeEmbeddedPointer(t *testing.T) {
+	type T struct {
+		*Base
+		X int
+	}
+	d := NewDecoder(NewReader(strings.NewReader("ID,x,Name\n7,8,a\n")))
+	var v T
+	if err := d.Decode(&v); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if v.Base == nil || v.ID != 7 || v.Name != "a" || v.X != 8 {
+		t.Errorf("got %+v, %+v", v, v.Base)
+	}
+}
+
+var decodeErrorTests = []struct {
+	Input  string
+	Line   int
+	Column int
+	Field  string
+}{
+	{"id,price\n1,2\nx,3\n", 3, 0, "id"},
+	{"id,price\n1,2\n3, abc\n", 3, 2, "price"},
+	{"count,id\n\"300\",1\n", 2, 0, "count"},
+	{"active\n\"multi\nline\"\n", 2, 0, "active"},
+}
+
+func TestDecodeError(t *testing.T) {
+	for i, tt := range decodeErrorTests {
+		d := NewDecoder(NewReader(strings.NewReader(tt.Input)))
+		var err error
+		for err == nil {
+			var r Record
+			err = d.Decode(&r)
+		}
+		perr, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("#%d: got error %v, want *ParseError", i, err)
+			continue
+		}
+		if perr.Line != tt.Line || perr.Column != tt.Column {
+			t.Errorf("#%d: error at %d:%d expected %d:%d", i, perr.Line, perr.Column, tt.Line, tt.Column)
+		}
+		ferr, ok := perr.Err.(*FieldError)
+		if !ok || ferr.Column != tt.Field {
+			t.Errorf("#%d: got %v, want *FieldError for column %q", i, perr.Err, tt.Field)
+		}
+	}
+}
+
+func TestDecodeBadArgs(t *testing.T) {
+	d := NewDecoder(NewReader(strings.NewReader("a\n1\n")))
+	var r Record
+	for _, v := range []interface{}{nil, r, (*Record)(nil), new(int)} {
+		if err := d.Decode(v); err != errDecodeArg {
+			t.Errorf("Decode(%T): got %v want %v", v, err, errDecodeArg)
+		}
+	}
+	var u struct{ A []int }
+	d = NewDecoder(NewReader(strings.NewReader("A\n1\n")))
+	if _, ok := d.Decode(&u).(*UnsupportedTypeError); !ok {
+		t.Errorf("Decode of slice field: want *UnsupportedTypeError")
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	const row = "apple,1,x,0.5,3,true\n"
+	input := "name,id,extra,price,count,active\n" + strings.Repeat(row, 100)
+	b.SetBytes(int64(len(input)))
+	for i := 0; i < b.N; i++ {
+		d := NewDecoder(NewReader(strings.NewReader(input)))
+		var r Record
+		for d.Decode(&r) == nil {
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package csv
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+)
+
+var errEncodeArg = errors.New("csv: Encode requires a struct or a non-nil pointer to a struct")
+
+// An Encoder writes structs to a CSV-encoded file.
+//
+// The first call to Encode writes a header record naming the columns,
+// followed by the record for the value.  Every later call writes one
+// record and must be passed a value of the same type.  Columns are
+// named and ordered as described for Decoder; fields of an embedded
+// struct pointer that is nil and pointer fields that are nil are
+// written as empty fields.
+type Encoder struct {
+	w      *Writer
+	typ    reflect.Type
+	fields []field
+	record []string
+}
+
+// NewEncoder returns a new Encoder that writes to w.
+func NewEncoder(w *Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes the record for the struct v, or for the struct
+// pointed to by v, to the underlying Writer, preceded by the header
+// if this is the first call.  As with Writer, output is buffered;
+// call Flush to ensure it is written.
+func (e *Encoder) Encode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return errEncodeArg
+	}
+	if e.typ == nil {
+		fields := typeFields(rv.Type())
+		header := make([]string, len(fields))
+		for i, f := range fields {
+			t := f.typ
+			if t.Kind() == reflect.Ptr {
+				t = t.Elem()
+			}
+			if !isScalar(t) {
+				return &UnsupportedTypeError{f.typ}
+			}
+			header[i] = f.name
+		}
+		if err := e.w.Write(header); err != nil {
+			return err
+		}
+		e.typ = rv.Type()
+		e.fields = fields
+		e.record = header
+	} else if rv.Type() != e.typ {
+		return errors.New("csv: Encode of type " + rv.Type().String() + " after type " + e.typ.String())
+	}
+
+	for i, f := range e.fields {
+		e.record[i] = formatField(rv, f.index)
+	}
+	return e.w.Write(e.record)
+}
+
+// Flush writes any buffered data to the underlying io.Writer.
+func (e *Encoder) Flush() {
+	e.w.Flush()
+}
+
+// formatField returns the text of the nested field of v for index.
+func formatField(v reflect.Value, index []int) string {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return ""
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+	}
+	panic("csv: unexpected kind " + v.Kind().String())
+}
@@ -0,0 +1,63 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package csv
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	records := []Record{
+		{Base{1, "apple"}, 0.5, uint8p(3), true, "skip", "note"},
+		{Base{2, "pear, green"}, 100, nil, false, "", ""},
+	}
+	var b bytes.Buffer
+	e := NewEncoder(NewWriter(&b))
+	for i := range records {
+		if err := e.Encode(&records[i]); err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+	}
+	e.Flush()
+	const want = "id,Name,price,count,active\n" +
+		"1,apple,0.5,3,true\n" +
+		"2,\"pear, green\",100,\"\",false\n"
+	if b.String() != want {
+		t.Errorf("got %q want %q", b.String(), want)
+	}
+
+	if err := e.Encode(Base{}); err == nil {
+		t.Errorf("Encode of a different type succeeded")
+	}
+	if err := e.Encode(1); err != errEncodeArg {
+		t.Errorf("Encode(1): got %v want %v", err, errEncodeArg)
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	var b bytes.Buffer
+	e := NewEncoder(NewWriter(&b))
+	in := Record{Base: Base{-5, " x\"y\nz"}, Price: 1.25, Count: uint8p(255)}
+	if err := e.Encode(in); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	e.Flush()
+	var out Record
+	if err := NewDecoder(NewReader(&b)).Decode(&out); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("got %+v want %+v", out, in)
+	}
+}
+
+func TestEncodeUnsupported(t *testing.T) {
+	e := NewEncoder(NewWriter(new(bytes.Buffer)))
+	if _, ok := e.Encode(struct{ M map[int]int }{}).(*UnsupportedTypeError); !ok {
+		t.Errorf("Encode of map field: want *UnsupportedTypeError")
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package csv
+
+import (
+	"reflect"
+	"sync"
+)
+
+// A field describes how a struct field maps to a CSV column.
+type field struct {
+	name  string       // column name
+	index []int        // index sequence for reflect's FieldByIndex
+	typ   reflect.Type // type of the struct field
+}
+
+var (
+	fieldCacheLock sync.RWMutex
+	fieldCache     = make(map[reflect.Type][]field)
+)
+
+// typeFields returns the fields that map to CSV columns for the
+// given struct type, in the order in which they are encoded.
+func typeFields(t reflect.Type) []field {
+	fieldCacheLock.RLock()
+	fs, ok := fieldCache[t]
+	fieldCacheLock.RUnlock()
+	if ok {
+		return fs
+	}
+
+	fieldCacheLock.Lock()
+	defer fieldCacheLock.Unlock()
+	fs, ok = fieldCache[t]
+	if ok {
+		return fs
+	}
+
+	var all []field
+	var depth []int
+	collectFields(t, nil, 0, &all, &depth)
+
+	// A name may be used only once.  The field at the shallowest
+	// depth wins; at equal depths the first one declared wins.
+	seen := make(map[string]int)
+	for i, f := range all {
+		j, ok := seen[f.name]
+		if !ok {
+			seen[f.name] = i
+			continue
+		}
+		if depth[i] < depth[j] {
+			seen[f.name] = i
+		}
+	}
+	for i, f := range all {
+		if seen[f.name] == i {
+			fs = append(fs, f)
+		}
+	}
+	fieldCache[t] = fs
+	return fs
+}
+
+// collectFields appends the fields of struct type t to fs, flattening
+// untagged anonymous struct fields.  The nesting depth of each field is
+// appended to depth.
+func collectFields(t reflect.Type, index []int, d int, fs *[]field, depth *[]int) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+		tag := sf.Tag.Get("csv")
+		if tag == "-" {
+			continue
+		}
+		idx := make([]int, len(index)+1)
+		copy(idx, index)
+		idx[len(index)] = i
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && tag == "" && ft.Kind() == reflect.Struct {
+			collectFields(ft, idx, d+1, fs, depth)
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		name := sf.Name
+		if tag != "" {
+			name = tag
+		}
+		*fs = append(*fs, field{name: name, index: idx, typ: sf.Type})
+		*depth = append(*depth, d)
+	}
+}
+
+// isScalar reports whether values of type t can be
+// converted to and from a single CSV field.
+func isScalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
@@ -100,6 +100,11 @@ var (
 // If TrailingComma is true, the last field may be an unquoted empty field.
 //
 // If TrimLeadingSpace is true, leading white space in a field is ignored.
+//
+// If ReuseRecord is true, calls to Read may return a slice sharing the
+// backing array of the previous call's returned slice, for performance.
+// By default, each call to Read returns newly allocated memory owned by
+// the caller.
 type Reader struct {
 	Comma            rune // Field delimiter (set to ',' by NewReader)
 	Comment          rune // Comment character for start of line
@@ -107,10 +112,24 @@ type Reader struct {
 	LazyQuotes       bool // Allow lazy quotes
 	TrailingComma    bool // Allow trailing comma
 	TrimLeadingSpace bool // Trim leading space
+	ReuseRecord      bool // Reuse the record slice between calls to Read
 	line             int
 	column           int
 	r                *bufio.Reader
-	field            bytes.Buffer
+
+	// field holds the unescaped fields of the current record,
+	// one after another.  fieldEnd holds the index in field
+	// just past the end of each one, and fieldPos the position
+	// at which each one started.
+	field      bytes.Buffer
+	fieldEnd   []int
+	fieldPos   []position
+	lastRecord []string
+}
+
+// position is a line and column within the input.
+type position struct {
+	line, column int
 }
 
 // NewReader returns a new Reader that reads from r.
@@ -133,8 +152,19 @@ func (r *Reader) error(err error) error {
 // Read reads one record from r.  The record is a slice of strings with each
 // string representing one field.
 func (r *Reader) Read() (record []string, err error) {
+	if r.ReuseRecord {
+		record, err = r.readRecord(r.lastRecord)
+		r.lastRecord = record
+	} else {
+		record, err = r.readRecord(nil)
+	}
+	return record, err
+}
+
+// readRecord reads one record from r, appending its fields to dst[:0].
+func (r *Reader) readRecord(dst []string) (record []string, err error) {
 	for {
-		record, err = r.parseRecord()
+		record, err = r.parseRecord(dst)
 		if record != nil {
 			break
 		}
@@ -215,13 +245,17 @@ func (r *Reader) skip(delim rune) error {
 	panic("unreachable")
 }
 
-// parseRecord reads and parses a single csv record from r.
-func (r *Reader) parseRecord() (fields []string, err error) {
+// parseRecord reads and parses a single csv record from r, appending
+// its fields to dst[:0].  It returns a nil slice if no fields were read.
+func (r *Reader) parseRecord(dst []string) (fields []string, err error) {
 	// Each record starts on a new line.  We increment our line
 	// number (lines start at 1, not 0) and set column to -1
 	// so as we increment in readRune it points to the character we read.
 	r.line++
 	r.column = -1
+	r.field.Reset()
+	r.fieldEnd = r.fieldEnd[:0]
+	r.fieldPos = r.fieldPos[:0]
 
 	// Peek at the first rune.  If it is an error we are done.
 	// If we are support comments and it is the comment character
@@ -239,12 +273,16 @@ func (r *Reader) parseRecord() (fields []string, err error) {
 
 	// At this point we have at least one field.
 	for {
+		start := r.field.Len()
 		haveField, delim, err := r.parseField()
 		if haveField {
-			fields = append(fields, r.field.String())
+			r.fieldEnd = append(r.fieldEnd, r.field.Len())
+		} else {
+			r.field.Truncate(start)
+			r.fieldPos = r.fieldPos[:len(r.fieldEnd)]
 		}
 		if delim == '\n' || err == io.EOF {
-			return fields, err
+			return r.fields(dst), err
 		} else if err != nil {
 			return nil, err
 		}
@@ -252,18 +290,33 @@ func (r *Reader) parseRecord() (fields []string, err error) {
 	panic("unreachable")
 }
 
+// fields slices the fields of the current record out of a single string
+// and appends them to dst[:0].  It returns nil if the record is empty.
+func (r *Reader) fields(dst []string) []string {
+	if len(r.fieldEnd) == 0 {
+		return nil
+	}
+	str := r.field.String()
+	dst = dst[:0]
+	start := 0
+	for _, end := range r.fieldEnd {
+		dst = append(dst, str[start:end])
+		start = end
+	}
+	return dst
+}
+
 // parseField parses the next field in the record.  The read field is
-// located in r.field.  Delim is the first character not part of the field
-// (r.Comma or '\n').
+// appended to r.field and its starting position to r.fieldPos.  Delim is
+// the first character not part of the field (r.Comma or '\n').
 func (r *Reader) parseField() (haveField bool, delim rune, err error) {
-	r.field.Reset()
-
 	r1, err := r.readRune()
 	if err != nil {
 		// If we have EOF and are not at the start of a line
 		// then we return the empty field.  We have already
 		// checked for trailing commas if needed.
 		if err == io.EOF && r.column != 0 {
+			r.fieldPos = append(r.fieldPos, position{r.line, r.column})
 			return true, 0, err
 		}
 		return false, 0, err
@@ -277,6 +330,7 @@ func (r *Reader) parseField() (haveField bool, delim rune, err error) {
 			}
 		}
 	}
+	r.fieldPos = append(r.fieldPos, position{r.line, r.column})
 
 	switch r1 {
 	case r.Comma:
@@ -279,3 +279,41 @@ func TestRead(t *testing.T) {
 		}
 	}
 }
+
+func TestReuseRecord(t *testing.T) {
+	r := NewReader(strings.NewReader("a,b\nc,d\n"))
+	r.ReuseRecord = true
+	first, err := r.Read()
+	if err != nil || !reflect.DeepEqual(first, []string{"a", "b"}) {
+		t.Fatalf("Read: got %q, %v", first, err)
+	}
+	second, err := r.Read()
+	if err != nil || !reflect.DeepEqual(second, []string{"c", "d"}) {
+		t.Fatalf("Read: got %q, %v", second, err)
+	}
+	if &first[0] != &second[0] {
+		t.Errorf("record slice was not reused")
+	}
+}
+
+func BenchmarkRead(b *testing.B) {
+	benchmarkRead(b, false)
+}
+
+func BenchmarkReadReuseRecord(b *testing.B) {
+	benchmarkRead(b, true)
+}
+
+func benchmarkRead(b *testing.B, reuse bool) {
+	input := strings.Repeat("x,y,z,w\nxx,yy,zz,ww\nxxx,yyy,zzz,www\n", 100)
+	b.SetBytes(int64(len(input)))
+	for i := 0; i < b.N; i++ {
+		r := NewReader(strings.NewReader(input))
+		r.ReuseRecord = reuse
+		for {
+			if _, err := r.Read(); err != nil {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,430 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gob
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// A Kind represents the kind of type described by a TypeDesc.
+type Kind int
+
+const (
+	InvalidKind Kind = iota
+	BoolKind
+	IntKind
+	UintKind
+	FloatKind
+	BytesKind
+	StringKind
+	ComplexKind
+	InterfaceKind
+	ArrayKind
+	SliceKind
+	MapKind
+	StructKind
+	GobEncoderKind
+)
+
+var kindNames = []string{
+	InvalidKind:    "invalid",
+	BoolKind:       "bool",
+	IntKind:        "int",
+	UintKind:       "uint",
+	FloatKind:      "float",
+	BytesKind:      "bytes",
+	StringKind:     "string",
+	ComplexKind:    "complex",
+	InterfaceKind:  "interface",
+	ArrayKind:      "array",
+	SliceKind:      "slice",
+	MapKind:        "map",
+	StructKind:     "struct",
+	GobEncoderKind: "GobEncoder",
+}
+
+// String returns the name of k.
+func (k Kind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("kind%d", int(k))
+}
+
+// basicKinds maps the ids of the predefined types to their kinds.
+var basicKinds = map[typeId]Kind{
+	tBool:      BoolKind,
+	tInt:       IntKind,
+	tUint:      UintKind,
+	tFloat:     FloatKind,
+	tBytes:     BytesKind,
+	tString:    StringKind,
+	tComplex:   ComplexKind,
+	tInterface: InterfaceKind,
+}
+
+// A TypeDesc describes a type as it is represented in a gob stream.
+// Go types that the encoding does not distinguish, such as int8 and
+// int64 or T and *T, have identical descriptions.  Descriptions of
+// recursive types contain cycles.
+type TypeDesc struct {
+	Kind   Kind
+	Name   string      // name of a struct or GobEncoder type
+	Len    int         // length of an array
+	Key    *TypeDesc   // key type of a map
+	Elem   *TypeDesc   // element type of an array, slice or map
+	Fields []FieldDesc // fields of a struct, in transmission order
+}
+
+// A FieldDesc describes a field of a struct in a gob stream.
+type FieldDesc struct {
+	Name string
+	Type *TypeDesc
+}
+
+// String returns the Go-like type expression for t.  Struct and
+// GobEncoder types are represented by their names.
+func (t *TypeDesc) String() string {
+	switch t.Kind {
+	case ArrayKind:
+		return fmt.Sprintf("[%d]%s", t.Len, t.Elem)
+	case SliceKind:
+		return "[]" + t.Elem.String()
+	case MapKind:
+		return fmt.Sprintf("map[%s]%s", t.Key, t.Elem)
+	case StructKind, GobEncoderKind:
+		if t.Name != "" {
+			return t.Name
+		}
+		if t.Kind == StructKind {
+			s := "struct {"
+			for i, f := range t.Fields {
+				if i > 0 {
+					s += ";"
+				}
+				s += " " + f.Name + " " + f.Type.String()
+			}
+			return s + " }"
+		}
+	}
+	return t.Kind.String()
+}
+
+// describer builds TypeDescs from the type ids of a gob stream or of
+// the local type registry.  It panics with a gobError if it meets an
+// id it cannot resolve.
+type describer struct {
+	lookup func(typeId) gobType
+	descs  map[typeId]*TypeDesc
+}
+
+func newDescriber(lookup func(typeId) gobType) *describer {
+	return &describer{lookup, make(map[typeId]*TypeDesc)}
+}
+
+func (d *describer) describe(id typeId) *TypeDesc {
+	if t := d.descs[id]; t != nil {
+		return t
+	}
+	t := new(TypeDesc)
+	if k, ok := basicKinds[id]; ok {
+		t.Kind = k
+		d.descs[id] = t
+		return t
+	}
+	gt := d.lookup(id)
+	if gt == nil {
+		errorf("unknown type id %d", id)
+	}
+	// Record the description before the components, for recursive types.
+	d.descs[id] = t
+	switch gt := gt.(type) {
+	case *arrayType:
+		t.Kind = ArrayKind
+		t.Len = gt.Len
+		t.Elem = d.describe(gt.Elem)
+	case *sliceType:
+		t.Kind = SliceKind
+		t.Elem = d.describe(gt.Elem)
+	case *mapType:
+		t.Kind = MapKind
+		t.Key = d.describe(gt.Key)
+		t.Elem = d.describe(gt.Elem)
+	case *structType:
+		t.Kind = StructKind
+		t.Name = gt.Name
+		for _, f := range gt.Field {
+			t.Fields = append(t.Fields, FieldDesc{f.Name, d.describe(f.Id)})
+		}
+	case *gobEncoderType:
+		t.Kind = GobEncoderKind
+		t.Name = gt.Name
+	default:
+		errorf("cannot describe type id %d", id)
+	}
+	return t
+}
+
+// wireGobType returns the gobType held in w, or nil if w is nil or empty.
+func wireGobType(w *wireType) gobType {
+	switch {
+	case w == nil:
+		return nil
+	case w.ArrayT != nil:
+		return w.ArrayT
+	case w.SliceT != nil:
+		return w.SliceT
+	case w.StructT != nil:
+		return w.StructT
+	case w.MapT != nil:
+		return w.MapT
+	case w.GobEncoderT != nil:
+		return w.GobEncoderT
+	}
+	return nil
+}
+
+// DescribeType returns the description of the type that values of the
+// same type as value are transmitted as.
+func DescribeType(value interface{}) (t *TypeDesc, err error) {
+	ut, err := validUserType(reflect.TypeOf(value))
+	if err != nil {
+		return nil, err
+	}
+	typeLock.Lock()
+	defer typeLock.Unlock()
+	defer catchError(&err)
+	info, err := getTypeInfo(ut)
+	if err != nil {
+		return nil, err
+	}
+	d := newDescriber(typeId.gobType)
+	if gt := wireGobType(info.wire); gt != nil {
+		return d.describe(gt.id()), nil
+	}
+	return d.describe(info.id), nil
+}
+
+// ReadTypes reads the gob stream from r to its end, discarding the
+// values, and returns descriptions of the types the stream defines,
+// ordered by their ids in the stream.  Predefined types such as int and
+// string are not defined by a stream and so are only present as
+// components of other types.
+func ReadTypes(r io.Reader) (types []*TypeDesc, err error) {
+	dec := NewDecoder(bufio.NewReader(r))
+	for {
+		if err = dec.Decode(nil); err != nil {
+			break
+		}
+	}
+	if err != io.EOF {
+		return nil, err
+	}
+	err = nil
+	defer catchError(&err)
+	d := newDescriber(func(id typeId) gobType {
+		if gt, ok := builtinIdToType[id]; ok {
+			return gt
+		}
+		return wireGobType(dec.wireType[id])
+	})
+	ids := make([]int, 0, len(dec.wireType))
+	for id := range dec.wireType {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		types = append(types, d.describe(typeId(id)))
+	}
+	return types, nil
+}
+
+// WriteSchema writes to w a definition of each struct and GobEncoder
+// type reachable from types, in order of first appearance.  Types are
+// described as they are transmitted, so the output is unaffected by
+// changes that do not alter the encoding and can be stored and
+// compared to detect changes that do.
+func WriteSchema(w io.Writer, types ...*TypeDesc) error {
+	bw := bufio.NewWriter(w)
+	seen := make(map[*TypeDesc]bool)
+	var walk func(t *TypeDesc)
+	walk = func(t *TypeDesc) {
+		if t == nil || seen[t] {
+			return
+		}
+		seen[t] = true
+		switch t.Kind {
+		case StructKind:
+			if t.Name != "" {
+				fmt.Fprintf(bw, "type %s struct {\n", t.Name)
+				for _, f := range t.Fields {
+					fmt.Fprintf(bw, "\t%s %s\n", f.Name, f.Type)
+				}
+				fmt.Fprintf(bw, "}\n")
+			}
+			for _, f := range t.Fields {
+				walk(f.Type)
+			}
+		case GobEncoderKind:
+			fmt.Fprintf(bw, "type %s GobEncoder\n", t.Name)
+		default:
+			walk(t.Key)
+			walk(t.Elem)
+		}
+	}
+	for _, t := range types {
+		walk(t)
+	}
+	return bw.Flush()
+}
+
+// A ChangeKind identifies the kind of a Change.
+type ChangeKind int
+
+const (
+	// FieldAdded is a field present only in the new type.
+	// Decoding old data leaves it unchanged.
+	FieldAdded ChangeKind = iota
+	// FieldDropped is a field present only in the old type.
+	// Decoding old data silently discards its value.
+	FieldDropped
+	// Retyped is a struct or GobEncoder type whose name changed
+	// while its encoding remained compatible.
+	Retyped
+	// Incompatible is a type that cannot be decoded from the old
+	// type.  Decoding old data fails with an error.
+	Incompatible
+)
+
+var changeKindNames = []string{
+	FieldAdded:   "field added",
+	FieldDropped: "field dropped",
+	Retyped:      "retyped",
+	Incompatible: "incompatible",
+}
+
+func (k ChangeKind) String() string {
+	if int(k) < len(changeKindNames) {
+		return changeKindNames[k]
+	}
+	return fmt.Sprintf("ChangeKind%d", int(k))
+}
+
+// A Change describes one difference between two types that affects
+// decoding data of the old type into values of the new type.
+type Change struct {
+	Kind ChangeKind
+	Path string    // path from the top-level type, such as "Items[].Price"
+	Old  *TypeDesc // nil for FieldAdded
+	New  *TypeDesc // nil for FieldDropped
+}
+
+func (c Change) String() string {
+	path := c.Path
+	if path == "" {
+		path = "top-level value"
+	}
+	switch c.Kind {
+	case FieldAdded:
+		return fmt.Sprintf("%s: %s %s", path, c.Kind, c.New)
+	case FieldDropped:
+		return fmt.Sprintf("%s: %s %s", path, c.Kind, c.Old)
+	}
+	return fmt.Sprintf("%s: %s %s to %s", path, c.Kind, c.Old, c.New)
+}
+
+// CheckCompatibility compares the old and new descriptions of a type,
+// as returned by DescribeType or ReadTypes, and reports the changes
+// that affect decoding data encoded from the old type into values of
+// the new type.  The data is decodable unless a change has kind
+// Incompatible.  The names of old and new themselves are not compared,
+// as the Decoder ignores them.
+func CheckCompatibility(old, new *TypeDesc) []Change {
+	c := &checker{seen: make(map[[2]*TypeDesc]bool)}
+	c.check("", old, new, true)
+	return c.changes
+}
+
+type checker struct {
+	seen    map[[2]*TypeDesc]bool
+	changes []Change
+}
+
+func (c *checker) add(kind ChangeKind, path string, old, new *TypeDesc) {
+	c.changes = append(c.changes, Change{kind, path, old, new})
+}
+
+// check compares old and new at path, following the rules used by
+// the Decoder to decide whether a wire type fits a local one.
+func (c *checker) check(path string, old, new *TypeDesc, top bool) {
+	pair := [2]*TypeDesc{old, new}
+	if c.seen[pair] {
+		return
+	}
+	c.seen[pair] = true
+	if old.Kind != new.Kind {
+		c.add(Incompatible, path, old, new)
+		return
+	}
+	switch old.Kind {
+	case ArrayKind:
+		if old.Len != new.Len {
+			c.add(Incompatible, path, old, new)
+			return
+		}
+		c.check(path+"[]", old.Elem, new.Elem, false)
+	case SliceKind:
+		c.check(path+"[]", old.Elem, new.Elem, false)
+	case MapKind:
+		c.check(path+"[key]", old.Key, new.Key, false)
+		c.check(path+"[]", old.Elem, new.Elem, false)
+	case GobEncoderKind:
+		if old.Name != new.Name {
+			c.add(Retyped, path, old, new)
+		}
+	case StructKind:
+		if !top && old.Name != new.Name {
+			c.add(Retyped, path, old, new)
+		}
+		prefix := path
+		if prefix != "" {
+			prefix += "."
+		}
+		matched := false
+		for _, of := range old.Fields {
+			nf := fieldNamed(new, of.Name)
+			if nf == nil {
+				c.add(FieldDropped, prefix+of.Name, of.Type, nil)
+				continue
+			}
+			matched = true
+			c.check(prefix+of.Name, of.Type, nf.Type, false)
+		}
+		for _, nf := range new.Fields {
+			if fieldNamed(old, nf.Name) == nil {
+				c.add(FieldAdded, prefix+nf.Name, nil, nf.Type)
+			}
+		}
+		// The Decoder rejects a top-level struct sharing no fields
+		// with the one transmitted.
+		if top && !matched && len(old.Fields) > 0 && len(new.Fields) > 0 {
+			c.add(Incompatible, path, old, new)
+		}
+	}
+}
+
+// fieldNamed returns the field of t with the given name, or nil.
+func fieldNamed(t *TypeDesc, name string) *FieldDesc {
+	for i := range t.Fields {
+		if t.Fields[i].Name == name {
+			return &t.Fields[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gob
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+type SchemaPoint struct {
+	X, Y int32
+}
+
+type SchemaShape struct {
+	Name   string
+	Points []SchemaPoint
+	Tags   map[string]bool
+	Box    [2]SchemaPoint
+	Data   []byte
+	Any    interface{}
+	Kids   []*SchemaShape
+	secret int
+}
+
+const schemaShapeText = `type SchemaShape struct {
+	Name string
+	Points []SchemaPoint
+	Tags map[string]bool
+	Box [2]SchemaPoint
+	Data bytes
+	Any interface
+	Kids []SchemaShape
+}
+type SchemaPoint struct {
+	X int
+	Y int
+}
+`
+
+func TestDescribeType(t *testing.T) {
+	for _, v := range []interface{}{SchemaShape{}, &SchemaShape{}} {
+		desc, err := DescribeType(v)
+		if err != nil {
+			t.Fatal("DescribeType:", err)
+		}
+		if desc.Kind != StructKind || desc.Name != "SchemaShape" || len(desc.Fields) != 7 {
+			t.Fatalf("DescribeType(%T): got %+v", v, desc)
+		}
+		if kid := desc.Fields[6].Type.Elem; kid != desc {
+			t.Errorf("recursive type not described by the same TypeDesc")
+		}
+		var b bytes.Buffer
+		if err := WriteSchema(&b, desc); err != nil {
+			t.Fatal("WriteSchema:", err)
+		}
+		if b.String() != schemaShapeText {
+			t.Errorf("WriteSchema: got\n%s\nwant\n%s", b.String(), schemaShapeText)
+		}
+	}
+
+	desc, err := DescribeType(map[int][]float32{})
+	if err != nil {
+		t.Fatal("DescribeType:", err)
+	}
+	if s := desc.String(); s != "map[int][]float" {
+		t.Errorf("String: got %q", s)
+	}
+	if _, err := DescribeType(make(chan int)); err == nil {
+		t.Errorf("DescribeType of chan succeeded")
+	}
+}
+
+func TestReadTypes(t *testing.T) {
+	var b bytes.Buffer
+	enc := NewEncoder(&b)
+	shape := &SchemaShape{Name: "a", Kids: []*SchemaShape{{Name: "b"}}, Any: SchemaPoint{1, 2}}
+	Register(SchemaPoint{})
+	for _, v := range []interface{}{7, shape, shape, []string{"x"}} {
+		if err := enc.Encode(v); err != nil {
+			t.Fatal("Encode:", err)
+		}
+	}
+	types, err := ReadTypes(&b)
+	if err != nil {
+		t.Fatal("ReadTypes:", err)
+	}
+	// Type ids depend on the order in which the encoding side first
+	// met the types, so compare the set of names.
+	var names []string
+	var shapeDesc *TypeDesc
+	for _, typ := range types {
+		names = append(names, typ.String())
+		if typ.Name == "SchemaShape" {
+			shapeDesc = typ
+		}
+	}
+	sort.Strings(names)
+	want := []string{
+		"SchemaPoint",
+		"SchemaShape",
+		"[2]SchemaPoint",
+		"[]SchemaPoint",
+		"[]SchemaShape",
+		"[]string",
+		"map[string]bool",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("ReadTypes: got %q want %q", names, want)
+	}
+	var out bytes.Buffer
+	WriteSchema(&out, shapeDesc)
+	if out.String() != schemaShapeText {
+		t.Errorf("WriteSchema: got\n%s\nwant\n%s", out.String(), schemaShapeText)
+	}
+
+	if _, err := ReadTypes(bytes.NewBufferString("\x05garbage")); err == nil {
+		t.Errorf("ReadTypes of bad data succeeded")
+	}
+}
+
+type CompatInner struct {
+	A int
+}
+
+type CompatInner2 struct {
+	A uint8
+}
+
+type CompatV1 struct {
+	Id    int
+	Name  string
+	List  []int
+	Inner CompatInner
+	Arr   [2]int
+}
+
+type CompatV2 struct {
+	Id    int64
+	List  []string
+	Inner CompatInner2
+	Arr   [3]int
+	Price float64
+}
+
+type CompatV3 struct {
+	Id    *int16
+	Name  string
+	Inner CompatInner
+	Extra int
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	v1, _ := DescribeType(CompatV1{})
+	v2, _ := DescribeType(CompatV2{})
+	v3, _ := DescribeType(CompatV3{})
+
+	changes := CheckCompatibility(v1, v2)
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.String())
+	}
+	want := []string{
+		"Name: field dropped string",
+		"List[]: incompatible int to string",
+		"Inner: retyped CompatInner to CompatInner2",
+		"Inner.A: incompatible int to uint",
+		"Arr: incompatible [2]int to [3]int",
+		"Price: field added float",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CheckCompatibility(v1, v2):\ngot  %q\nwant %q", got, want)
+	}
+
+	changes = CheckCompatibility(v1, v3)
+	for _, c := range changes {
+		if c.Kind == Incompatible || c.Kind == Retyped {
+			t.Errorf("CheckCompatibility(v1, v3): unexpected change %s", c)
+		}
+	}
+
+	// Confirm the verdicts against the Decoder.
+	var b bytes.Buffer
+	NewEncoder(&b).Encode(CompatV1{1, "x", []int{1}, CompatInner{1}, [2]int{1, 2}})
+	data := b.Bytes()
+	if err := NewDecoder(bytes.NewBuffer(data)).Decode(new(CompatV2)); err == nil {
+		t.Errorf("decoding CompatV1 into CompatV2 succeeded")
+	}
+	if err := NewDecoder(bytes.NewBuffer(data)).Decode(new(CompatV3)); err != nil {
+		t.Errorf("decoding CompatV1 into CompatV3: %v", err)
+	}
+
+	type Disjoint struct{ Z int }
+	d, _ := DescribeType(Disjoint{})
+	changes = CheckCompatibility(v1, d)
+	if last := changes[len(changes)-1]; last.Kind != Incompatible || last.Path != "" {
+		t.Errorf("CheckCompatibility of disjoint structs: got %v", changes)
+	}
+	i, _ := DescribeType(0)
+	if changes := CheckCompatibility(v1, i); len(changes) != 1 || changes[0].Kind != Incompatible {
+		t.Errorf("CheckCompatibility(struct, int): got %v", changes)
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protobuf
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// Unmarshal parses the wire-format message in data and stores the result
+// in the struct pointed to by v, which is first reset to its zero value.
+//
+// Records for field numbers with no matching struct field are skipped.
+// When a non-repeated field appears more than once, the last value wins,
+// except that embedded messages are merged.  Repeated number fields are
+// accepted in both packed and unpacked form, whatever their tags say.
+func Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return StructuralError{"Unmarshal requires a non-nil pointer to a struct"}
+	}
+	rv = rv.Elem()
+	rv.Set(reflect.Zero(rv.Type()))
+	return unmarshalMessage(data, rv)
+}
+
+// unmarshalMessage merges the records in data into the struct v.
+func unmarshalMessage(data []byte, v reflect.Value) error {
+	ti := getTypeInfo(v.Type())
+	if ti.err != nil {
+		return ti.err
+	}
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return SyntaxError{"malformed key"}
+		}
+		data = data[n:]
+		num, wt := key>>3, int(key&7)
+		if num == 0 || num > maxFieldNumber {
+			return SyntaxError{"invalid field number " + strconv.FormatUint(num, 10)}
+		}
+
+		// Split off the contents of the record.
+		var rec []byte
+		switch wt {
+		case wireVarint:
+			_, n = binary.Uvarint(data)
+			if n <= 0 {
+				return SyntaxError{"malformed varint"}
+			}
+			rec = data[:n]
+		case wireFixed64, wireFixed32:
+			n = 8
+			if wt == wireFixed32 {
+				n = 4
+			}
+			if len(data) < n {
+				return SyntaxError{"truncated fixed-size value"}
+			}
+			rec = data[:n]
+		case wireBytes:
+			l, ln := binary.Uvarint(data)
+			if ln <= 0 || l > uint64(len(data)-ln) {
+				return SyntaxError{"truncated length-delimited record"}
+			}
+			n = ln + int(l)
+			rec = data[ln:n]
+		case wireStart, wireEnd:
+			return SyntaxError{"groups are not supported"}
+		default:
+			return SyntaxError{"invalid wire type " + strconv.Itoa(wt)}
+		}
+		data = data[n:]
+
+		f := ti.byNum[int(num)]
+		if f == nil {
+			continue
+		}
+		if err := unmarshalField(rec, wt, v.Field(f.index), f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unmarshalField stores the contents rec of a record with wire type wt
+// in the value v of field f.
+func unmarshalField(rec []byte, wt int, v reflect.Value, f *field) error {
+	if f.repeated && wt == wireBytes && f.wireType() != wireBytes {
+		// A packed repeated field.
+		for len(rec) > 0 {
+			n, err := valueLen(rec, f.wireType())
+			if err != nil {
+				return err
+			}
+			if err := unmarshalField(rec[:n], f.wireType(), v, f); err != nil {
+				return err
+			}
+			rec = rec[n:]
+		}
+		return nil
+	}
+	if wt != f.wireType() {
+		return SyntaxError{"field " + strconv.Itoa(f.num) + " has wire type " + strconv.Itoa(wt) +
+			", want " + strconv.Itoa(f.wireType())}
+	}
+
+	if f.repeated {
+		n := v.Len()
+		v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+		v = v.Index(n)
+	}
+	if f.ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(f.typ))
+		}
+		v = v.Elem()
+	}
+	return unmarshalValue(rec, v, f)
+}
+
+// valueLen returns the length of the value of wire type wt at the start
+// of a packed record.
+func valueLen(rec []byte, wt int) (int, error) {
+	switch wt {
+	case wireVarint:
+		_, n := binary.Uvarint(rec)
+		if n <= 0 {
+			return 0, SyntaxError{"malformed varint in packed field"}
+		}
+		return n, nil
+	case wireFixed32:
+		if len(rec) < 4 {
+			return 0, SyntaxError{"truncated packed field"}
+		}
+		return 4, nil
+	}
+	if len(rec) < 8 {
+		return 0, SyntaxError{"truncated packed field"}
+	}
+	return 8, nil
+}
+
+// unmarshalValue stores the contents rec of a single value in v.
+func unmarshalValue(rec []byte, v reflect.Value, f *field) error {
+	switch f.enc {
+	case encVarint:
+		x, _ := binary.Uvarint(rec)
+		switch v.Kind() {
+		case reflect.Bool:
+			v.SetBool(x != 0)
+		// Values too large for 32 bits are truncated, as in other
+		// implementations.
+		case reflect.Int32:
+			v.SetInt(int64(int32(x)))
+		case reflect.Int, reflect.Int64:
+			v.SetInt(int64(x))
+		case reflect.Uint32:
+			v.SetUint(uint64(uint32(x)))
+		default:
+			v.SetUint(x)
+		}
+
+	case encZigzag:
+		x, _ := binary.Uvarint(rec)
+		i := int64(x>>1) ^ -int64(x&1)
+		if v.Kind() == reflect.Int32 {
+			i = int64(int32(i))
+		}
+		v.SetInt(i)
+
+	case encFixed32:
+		x := binary.LittleEndian.Uint32(rec)
+		switch v.Kind() {
+		case reflect.Int32:
+			v.SetInt(int64(int32(x)))
+		case reflect.Uint32:
+			v.SetUint(uint64(x))
+		default:
+			v.SetFloat(float64(math.Float32frombits(x)))
+		}
+
+	case encFixed64:
+		x := binary.LittleEndian.Uint64(rec)
+		switch v.Kind() {
+		case reflect.Int, reflect.Int64:
+			v.SetInt(int64(x))
+		case reflect.Uint, reflect.Uint64:
+			v.SetUint(x)
+		default:
+			v.SetFloat(math.Float64frombits(x))
+		}
+
+	case encBytes:
+		if v.Kind() == reflect.String {
+			v.SetString(string(rec))
+		} else {
+			v.SetBytes(append([]byte(nil), rec...))
+		}
+
+	case encMessage:
+		return unmarshalMessage(rec, v)
+	}
+	return nil
+}
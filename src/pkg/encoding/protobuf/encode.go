@@ -0,0 +1,190 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protobuf
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+)
+
+// Marshal returns the wire-format encoding of the message v, which must be
+// a struct or a pointer to a struct.  Fields are encoded in field number
+// order.
+func Marshal(v interface{}) ([]byte, error) {
+	return Append(nil, v)
+}
+
+// Append appends the wire-format encoding of the message v to buf and
+// returns the extended buffer.
+func Append(buf []byte, v interface{}) ([]byte, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil, StructuralError{"Marshal requires a struct or a non-nil pointer to a struct"}
+	}
+	return appendMessage(buf, rv)
+}
+
+// appendMessage appends the encoding of the fields of the struct v.
+func appendMessage(buf []byte, v reflect.Value) ([]byte, error) {
+	ti := getTypeInfo(v.Type())
+	if ti.err != nil {
+		return nil, ti.err
+	}
+	var err error
+	for i := range ti.fields {
+		f := &ti.fields[i]
+		fv := v.Field(f.index)
+		if !f.repeated {
+			if isEmpty(fv) {
+				continue
+			}
+			buf = appendKey(buf, f.num, f.wireType())
+			if buf, err = appendValue(buf, fv, f); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		n := fv.Len()
+		if n == 0 {
+			continue
+		}
+		if f.packed {
+			buf = appendKey(buf, f.num, wireBytes)
+			start := len(buf)
+			for j := 0; j < n; j++ {
+				if buf, err = appendValue(buf, fv.Index(j), f); err != nil {
+					return nil, err
+				}
+			}
+			buf = insertLength(buf, start)
+			continue
+		}
+		for j := 0; j < n; j++ {
+			buf = appendKey(buf, f.num, f.wireType())
+			if buf, err = appendValue(buf, fv.Index(j), f); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return buf, nil
+}
+
+// isEmpty returns true iff the non-repeated field value v is not encoded.
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr:
+		return v.IsNil()
+	case reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		// Negative zero differs from the default value.
+		return v.Float() == 0 && !math.Signbit(v.Float())
+	}
+	return false
+}
+
+// appendValue appends the encoding of a single value v of field f,
+// without its key.
+func appendValue(buf []byte, v reflect.Value, f *field) ([]byte, error) {
+	if f.ptr {
+		if v.IsNil() {
+			return nil, StructuralError{"nil element in repeated field"}
+		}
+		v = v.Elem()
+	}
+	switch f.enc {
+	case encVarint:
+		switch v.Kind() {
+		case reflect.Bool:
+			if v.Bool() {
+				return append(buf, 1), nil
+			}
+			return append(buf, 0), nil
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			// Negative numbers take ten bytes, as in other implementations.
+			return appendVarint(buf, uint64(v.Int())), nil
+		}
+		return appendVarint(buf, v.Uint()), nil
+
+	case encZigzag:
+		x := v.Int()
+		return appendVarint(buf, uint64(x<<1)^uint64(x>>63)), nil
+
+	case encFixed32:
+		var x uint32
+		switch v.Kind() {
+		case reflect.Int32:
+			x = uint32(v.Int())
+		case reflect.Uint32:
+			x = uint32(v.Uint())
+		default:
+			x = math.Float32bits(float32(v.Float()))
+		}
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], x)
+		return append(buf, b[:]...), nil
+
+	case encFixed64:
+		var x uint64
+		switch v.Kind() {
+		case reflect.Int, reflect.Int64:
+			x = uint64(v.Int())
+		case reflect.Uint, reflect.Uint64:
+			x = v.Uint()
+		default:
+			x = math.Float64bits(v.Float())
+		}
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], x)
+		return append(buf, b[:]...), nil
+
+	case encBytes:
+		if v.Kind() == reflect.String {
+			buf = appendVarint(buf, uint64(v.Len()))
+			return append(buf, v.String()...), nil
+		}
+		buf = appendVarint(buf, uint64(v.Len()))
+		return append(buf, v.Bytes()...), nil
+
+	case encMessage:
+		start := len(buf)
+		buf, err := appendMessage(buf, v)
+		if err != nil {
+			return nil, err
+		}
+		return insertLength(buf, start), nil
+	}
+	panic("unreachable")
+}
+
+// appendKey appends the key of a record of field num with wire type wt.
+func appendKey(buf []byte, num, wt int) []byte {
+	return appendVarint(buf, uint64(num)<<3|uint64(wt))
+}
+
+func appendVarint(buf []byte, x uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], x)
+	return append(buf, b[:n]...)
+}
+
+// insertLength inserts before buf[start:] its length as a varint, which
+// turns it into a length-delimited record.
+func insertLength(buf []byte, start int) []byte {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], uint64(len(buf)-start))
+	buf = append(buf, b[:n]...)
+	copy(buf[start+n:], buf[start:len(buf)-n])
+	copy(buf[start:], b[:n])
+	return buf
+}
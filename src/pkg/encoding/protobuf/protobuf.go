@@ -0,0 +1,289 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package protobuf implements encoding and decoding of Protocol Buffers
+// messages in the binary wire format, using struct tags in place of
+// generated code.
+//
+// See https://developers.google.com/protocol-buffers/docs/encoding
+// for a description of the wire format.
+//
+// A message is represented by a struct.  Only fields whose tag has the
+// "protobuf" key take part in encoding; the value of the key is the
+// field number, optionally followed by a comma and options:
+//
+//	zigzag	encodes a signed integer as a ZigZag varint (sint32, sint64)
+//	fixed32	encodes a 32-bit number as four bytes (fixed32, sfixed32)
+//	fixed64	encodes a 64-bit number as eight bytes (fixed64, sfixed64)
+//	packed	encodes a repeated number field as one length-delimited record
+//
+// For example:
+//
+//	type Person struct {
+//		Name   string   `protobuf:"1"`
+//		Id     int32    `protobuf:"2,zigzag"`
+//		Email  *string  `protobuf:"3"`
+//		Phones []*Phone `protobuf:"4"`
+//		Scores []uint32 `protobuf:"5,packed"`
+//	}
+//
+// Go types map to Protocol Buffers types as follows:
+//
+//	bool			bool
+//	int32, int64, int	int32, int64 (sint or sfixed with an option)
+//	uint32, uint64, uint	uint32, uint64 (fixed with an option)
+//	float32, float64	float, double
+//	string			string
+//	[]byte			bytes
+//	struct, *struct		embedded message
+//	slice			repeated field of the element type
+//
+// Enumerations may be represented by any integer type.
+// A non-repeated field that is nil, zero or empty is not encoded, so
+// a pointer is needed to distinguish an optional field that is absent
+// from one that holds the zero value.  A struct that is not a pointer
+// is always encoded.
+package protobuf
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireStart   = 3 // start of a group, which is unsupported
+	wireEnd     = 4 // end of a group
+	wireFixed32 = 5
+)
+
+// Encodings of a field's values.
+const (
+	encVarint = iota
+	encZigzag
+	encFixed32
+	encFixed64
+	encBytes
+	encMessage
+)
+
+// maxFieldNumber is the largest valid field number.
+const maxFieldNumber = 1<<29 - 1
+
+// A StructuralError suggests that a Go type cannot be encoded or decoded:
+// its tags are malformed or a field's type does not suit its encoding.
+type StructuralError struct {
+	Msg string
+}
+
+func (e StructuralError) Error() string { return "protobuf: structure error: " + e.Msg }
+
+// A SyntaxError suggests that the data is not a valid encoding of a message
+// of the given type.
+type SyntaxError struct {
+	Msg string
+}
+
+func (e SyntaxError) Error() string { return "protobuf: syntax error: " + e.Msg }
+
+// A field describes how a struct field maps to a message field.
+type field struct {
+	num      int          // field number
+	index    int          // index of the struct field
+	enc      int          // encoding of each value
+	repeated bool         // slice holding a repeated field
+	packed   bool         // repeated field encoded in one record
+	ptr      bool         // pointer to the value or message
+	typ      reflect.Type // type of a value, without slice or pointer
+}
+
+// wireType returns the wire type of a single value of f.
+func (f *field) wireType() int {
+	switch f.enc {
+	case encFixed32:
+		return wireFixed32
+	case encFixed64:
+		return wireFixed64
+	case encBytes, encMessage:
+		return wireBytes
+	}
+	return wireVarint
+}
+
+// A typeInfo describes the fields of a struct type.
+type typeInfo struct {
+	fields []field // in field number order
+	byNum  map[int]*field
+	err    error // set if the type cannot be encoded
+}
+
+var (
+	typeCacheLock sync.RWMutex
+	typeCache     = make(map[reflect.Type]*typeInfo)
+)
+
+// getTypeInfo returns the fields of struct type t.  The fields of
+// embedded messages are checked when they are first encoded or decoded,
+// which allows recursive message types.
+func getTypeInfo(t reflect.Type) *typeInfo {
+	typeCacheLock.RLock()
+	ti, ok := typeCache[t]
+	typeCacheLock.RUnlock()
+	if ok {
+		return ti
+	}
+
+	ti = newTypeInfo(t)
+	typeCacheLock.Lock()
+	typeCache[t] = ti
+	typeCacheLock.Unlock()
+	return ti
+}
+
+func newTypeInfo(t reflect.Type) *typeInfo {
+	ti := &typeInfo{byNum: make(map[int]*field)}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("protobuf")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		if sf.PkgPath != "" {
+			ti.err = StructuralError{"unexported field " + t.String() + "." + sf.Name + " has protobuf tag"}
+			return ti
+		}
+		f, err := parseField(sf, tag)
+		if err != nil {
+			ti.err = StructuralError{t.String() + "." + sf.Name + ": " + err.Error()}
+			return ti
+		}
+		f.index = i
+		if ti.byNum[f.num] != nil {
+			ti.err = StructuralError{"duplicate field number " + strconv.Itoa(f.num) + " in " + t.String()}
+			return ti
+		}
+		ti.byNum[f.num] = &f
+		ti.fields = append(ti.fields, f)
+	}
+	// Encode in field number order, as the specification recommends.
+	for i := 1; i < len(ti.fields); i++ {
+		for j := i; j > 0 && ti.fields[j].num < ti.fields[j-1].num; j-- {
+			ti.fields[j], ti.fields[j-1] = ti.fields[j-1], ti.fields[j]
+		}
+	}
+	for i := range ti.fields {
+		ti.byNum[ti.fields[i].num] = &ti.fields[i]
+	}
+	return ti
+}
+
+// parseField parses the tag of the struct field sf and checks that the
+// field's type suits the encoding.
+func parseField(sf reflect.StructField, tag string) (f field, err error) {
+	parts := strings.Split(tag, ",")
+	f.num, err = strconv.Atoi(parts[0])
+	if err != nil || f.num < 1 || f.num > maxFieldNumber {
+		return f, tagError("invalid field number " + strconv.Quote(parts[0]))
+	}
+
+	t := sf.Type
+	if t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8 {
+		f.repeated = true
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Ptr {
+		f.ptr = true
+		t = t.Elem()
+	}
+	f.typ = t
+
+	f.enc = -1
+	for _, opt := range parts[1:] {
+		enc := -1
+		switch opt {
+		case "zigzag":
+			enc = encZigzag
+		case "fixed32":
+			enc = encFixed32
+		case "fixed64":
+			enc = encFixed64
+		case "packed":
+			f.packed = true
+			continue
+		default:
+			return f, tagError("unknown option " + strconv.Quote(opt))
+		}
+		if f.enc >= 0 {
+			return f, tagError("more than one encoding")
+		}
+		f.enc = enc
+	}
+
+	def, ok := defaultEncoding(t)
+	if !ok {
+		return f, tagError("unsupported type " + sf.Type.String())
+	}
+	if f.enc < 0 {
+		f.enc = def
+	}
+	if !validEncoding(t, f.enc) {
+		return f, tagError("encoding does not suit type " + sf.Type.String())
+	}
+	if f.repeated && f.ptr && f.enc != encMessage {
+		return f, tagError("repeated field of pointers to " + t.String())
+	}
+	if f.packed && (!f.repeated || f.wireType() == wireBytes) {
+		return f, tagError("packed option on field of type " + sf.Type.String())
+	}
+	return f, nil
+}
+
+type tagError string
+
+func (e tagError) Error() string { return string(e) }
+
+// defaultEncoding returns the encoding used for values of type t when
+// the tag names none.
+func defaultEncoding(t reflect.Type) (enc int, ok bool) {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int32, reflect.Int64, reflect.Int,
+		reflect.Uint32, reflect.Uint64, reflect.Uint:
+		return encVarint, true
+	case reflect.Float32:
+		return encFixed32, true
+	case reflect.Float64:
+		return encFixed64, true
+	case reflect.String:
+		return encBytes, true
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return encBytes, true
+		}
+	case reflect.Struct:
+		return encMessage, true
+	}
+	return 0, false
+}
+
+// validEncoding returns true iff values of type t can use encoding enc.
+func validEncoding(t reflect.Type, enc int) bool {
+	def, _ := defaultEncoding(t)
+	switch k := t.Kind(); enc {
+	case encVarint:
+		return def == encVarint
+	case encZigzag:
+		return k == reflect.Int32 || k == reflect.Int64 || k == reflect.Int
+	case encFixed32:
+		return k == reflect.Int32 || k == reflect.Uint32 || k == reflect.Float32
+	case encFixed64:
+		return k == reflect.Int64 || k == reflect.Uint64 || k == reflect.Int ||
+			k == reflect.Uint || k == reflect.Float64
+	}
+	return enc == def
+}
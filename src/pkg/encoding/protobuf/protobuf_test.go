@@ -0,0 +1,364 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protobuf
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// The first four types are the examples from the encoding documentation.
+
+type Test1 struct {
+	A int32 `protobuf:"1"`
+}
+
+type Test2 struct {
+	B string `protobuf:"2"`
+}
+
+type Test3 struct {
+	C Test1 `protobuf:"3"`
+}
+
+type Test4 struct {
+	D []int32 `protobuf:"4,packed"`
+}
+
+type Scalars struct {
+	Bool     bool    `protobuf:"1"`
+	Int32    int32   `protobuf:"2"`
+	Int64    int64   `protobuf:"3"`
+	Uint32   uint32  `protobuf:"4"`
+	Uint64   uint64  `protobuf:"5"`
+	Sint32   int32   `protobuf:"6,zigzag"`
+	Sint64   int64   `protobuf:"7,zigzag"`
+	Fixed32  uint32  `protobuf:"8,fixed32"`
+	Fixed64  uint64  `protobuf:"9,fixed64"`
+	Sfixed32 int32   `protobuf:"10,fixed32"`
+	Sfixed64 int64   `protobuf:"11,fixed64"`
+	Float    float32 `protobuf:"12"`
+	Double   float64 `protobuf:"13"`
+	String   string  `protobuf:"14"`
+	Bytes    []byte  `protobuf:"15"`
+	Ignored  int
+}
+
+type Optional struct {
+	Int    *int32  `protobuf:"1"`
+	String *string `protobuf:"2"`
+	Msg    *Test1  `protobuf:"3"`
+}
+
+type Repeated struct {
+	Ints    []int32   `protobuf:"1"`
+	Strings []string  `protobuf:"2"`
+	Msgs    []*Test1  `protobuf:"3"`
+	Fixed   []float32 `protobuf:"4,packed"`
+	Zigzag  []int64   `protobuf:"5,zigzag,packed"`
+	Values  []Test1   `protobuf:"6"`
+}
+
+// Out of order field numbers are encoded in field number order.
+type Reordered struct {
+	B int32 `protobuf:"2"`
+	A int32 `protobuf:"1"`
+}
+
+type Node struct {
+	Value    int32   `protobuf:"1"`
+	Children []*Node `protobuf:"2"`
+}
+
+func newInt32(x int32) *int32 { return &x }
+
+func newString(s string) *string { return &s }
+
+var marshalTests = []struct {
+	in  interface{}
+	out string // hex encoded
+}{
+	{&Test1{150}, "089601"},
+	{&Test2{"testing"}, "120774657374696e67"},
+	{&Test3{Test1{150}}, "1a03089601"},
+	{&Test4{[]int32{3, 270, 86942}}, "2206038e029ea705"},
+	{&Test3{}, "1a00"},
+	{&Test4{}, ""},
+	{&Scalars{}, ""},
+	{&Scalars{Bool: true}, "0801"},
+	{&Scalars{Int32: -1}, "10ffffffffffffffffff01"},
+	{&Scalars{Int64: 1 << 40}, "18808080808020"},
+	{&Scalars{Uint32: 300}, "20ac02"},
+	{&Scalars{Uint64: math.MaxUint64}, "28ffffffffffffffffff01"},
+	{&Scalars{Sint32: -1}, "3001"},
+	{&Scalars{Sint32: 1}, "3002"},
+	{&Scalars{Sint64: -2}, "3803"},
+	{&Scalars{Sint64: math.MinInt64}, "38ffffffffffffffffff01"},
+	{&Scalars{Fixed32: 1}, "4501000000"},
+	{&Scalars{Fixed64: 1}, "490100000000000000"},
+	{&Scalars{Sfixed32: -2}, "55feffffff"},
+	{&Scalars{Sfixed64: -2}, "59feffffffffffffff"},
+	{&Scalars{Float: 1}, "650000803f"},
+	{&Scalars{Double: 1}, "69000000000000f03f"},
+	{&Scalars{Double: math.Copysign(0, -1)}, "690000000000000080"},
+	{&Scalars{String: "hi"}, "72026869"},
+	{&Scalars{Bytes: []byte{1, 2}}, "7a020102"},
+	{&Scalars{Ignored: 5}, ""},
+	{&Optional{Int: newInt32(0)}, "0800"},
+	{&Optional{String: newString("")}, "1200"},
+	{&Optional{Msg: &Test1{}}, "1a00"},
+	{&Repeated{Ints: []int32{1, 2}}, "08010802"},
+	{&Repeated{Strings: []string{"a", ""}}, "120161" + "1200"},
+	{&Repeated{Msgs: []*Test1{{1}, {2}}}, "1a020801" + "1a020802"},
+	{&Repeated{Fixed: []float32{1, 2}}, "2208" + "0000803f" + "00000040"},
+	{&Repeated{Zigzag: []int64{-1, 1}}, "2a020102"},
+	{&Repeated{Values: []Test1{{1}}}, "32020801"},
+	{&Reordered{B: 2, A: 1}, "08011002"},
+	{Reordered{B: 2}, "1002"},
+	{&Node{1, []*Node{{2, nil}, {3, []*Node{{4, nil}}}}}, "0801" + "12020802" + "12060803" + "12020804"},
+}
+
+func TestMarshal(t *testing.T) {
+	for i, test := range marshalTests {
+		data, err := Marshal(test.in)
+		if err != nil {
+			t.Errorf("#%d: Marshal(%+v): %v", i, test.in, err)
+			continue
+		}
+		if out, _ := hex.DecodeString(test.out); !bytes.Equal(data, out) {
+			t.Errorf("#%d: Marshal(%+v) = %x, want %x", i, test.in, data, out)
+		}
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	for i, test := range marshalTests {
+		in, _ := hex.DecodeString(test.out)
+		want := reflect.New(reflect.Indirect(reflect.ValueOf(test.in)).Type())
+		want.Elem().Set(reflect.Indirect(reflect.ValueOf(test.in)))
+		got := reflect.New(want.Elem().Type())
+		if err := Unmarshal(in, got.Interface()); err != nil {
+			t.Errorf("#%d: Unmarshal(%x): %v", i, in, err)
+			continue
+		}
+		// Fields that are not encoded cannot be recovered.
+		if s, ok := want.Interface().(*Scalars); ok {
+			s.Ignored = 0
+			if len(s.Bytes) == 0 {
+				s.Bytes = nil
+			}
+		}
+		if !reflect.DeepEqual(got.Interface(), want.Interface()) {
+			t.Errorf("#%d: Unmarshal(%x) = %+v, want %+v", i, in, got.Interface(), want.Interface())
+		}
+	}
+}
+
+var unmarshalTests = []struct {
+	in  string // hex encoded
+	out interface{}
+}{
+	// Unknown fields of every wire type are skipped.
+	{"089601" + "1001" + "190000000000000000" + "22020102" + "2d00000000", &Test1{150}},
+	// The last value of a non-repeated field wins.
+	{"0801" + "0802", &Test1{2}},
+	// Embedded messages are merged.
+	{"1a020801" + "1a00", &Test3{Test1{1}}},
+	// Repeated number fields may be packed or not.
+	{"0a020102" + "0803", &Repeated{Ints: []int32{1, 2, 3}}},
+	{"250000803f" + "22040000803f", &Repeated{Fixed: []float32{1, 1}}},
+	// Varints too large for the field are truncated.
+	{"08ffffffff1f", &Test1{-1}},
+}
+
+func TestUnmarshalRecords(t *testing.T) {
+	for i, test := range unmarshalTests {
+		in, _ := hex.DecodeString(test.in)
+		got := reflect.New(reflect.TypeOf(test.out).Elem()).Interface()
+		if err := Unmarshal(in, got); err != nil {
+			t.Errorf("#%d: Unmarshal(%x): %v", i, in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.out) {
+			t.Errorf("#%d: Unmarshal(%x) = %+v, want %+v", i, in, got, test.out)
+		}
+	}
+}
+
+func TestUnmarshalResets(t *testing.T) {
+	r := &Repeated{Ints: []int32{7}, Strings: []string{"x"}}
+	if err := Unmarshal([]byte{0x08, 0x01}, r); err != nil {
+		t.Fatal(err)
+	}
+	if want := (&Repeated{Ints: []int32{1}}); !reflect.DeepEqual(r, want) {
+		t.Errorf("Unmarshal = %+v, want %+v", r, want)
+	}
+}
+
+var syntaxErrorTests = []string{
+	"08",                       // truncated varint
+	"08ffffffffffffffffffff01", // varint overflow
+	"0d010000",                 // truncated fixed32
+	"0901",                     // truncated fixed64
+	"0a05010203",               // truncated length-delimited record
+	"0b",                       // start group
+	"0c",                       // end group
+	"0e00",                     // wire type 6
+	"0001",                     // field number 0
+	"0a020102",                 // wire type 2 for a varint field
+	"0d01000000",               // wire type 5 for a varint field
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	for i, test := range syntaxErrorTests {
+		in, _ := hex.DecodeString(test)
+		var m Test1
+		err := Unmarshal(in, &m)
+		if _, ok := err.(SyntaxError); !ok {
+			t.Errorf("#%d: Unmarshal(%x) = %v, want SyntaxError", i, in, err)
+		}
+	}
+
+	// Packed fields must hold whole values.
+	var r Repeated
+	if err := Unmarshal([]byte{0x22, 0x03, 0, 0, 0}, &r); err == nil {
+		t.Errorf("Unmarshal of truncated packed field succeeded")
+	}
+	if err := Unmarshal([]byte{0x0a, 0x01, 0x80}, &r); err == nil {
+		t.Errorf("Unmarshal of truncated packed varint succeeded")
+	}
+}
+
+var structuralErrorTests = []interface{}{
+	struct {
+		A int32 `protobuf:"0"`
+	}{},
+	struct {
+		A int32 `protobuf:"x"`
+	}{},
+	struct {
+		A int32 `protobuf:"536870912"`
+	}{},
+	struct {
+		A int32 `protobuf:"1"`
+		B int32 `protobuf:"1"`
+	}{},
+	struct {
+		A int8 `protobuf:"1"`
+	}{},
+	struct {
+		A map[string]int `protobuf:"1"`
+	}{},
+	struct {
+		A string `protobuf:"1,zigzag"`
+	}{},
+	struct {
+		A uint32 `protobuf:"1,zigzag"`
+	}{},
+	struct {
+		A int64 `protobuf:"1,fixed32"`
+	}{},
+	struct {
+		A float64 `protobuf:"1,fixed32"`
+	}{},
+	struct {
+		A int32 `protobuf:"1,fixed32,fixed64"`
+	}{},
+	struct {
+		A int32 `protobuf:"1,bogus"`
+	}{},
+	struct {
+		A int32 `protobuf:"1,packed"`
+	}{},
+	struct {
+		A []string `protobuf:"1,packed"`
+	}{},
+	struct {
+		A []*int32 `protobuf:"1"`
+	}{},
+	struct {
+		a int32 `protobuf:"1"`
+	}{},
+	struct {
+		A struct {
+			B int8 `protobuf:"1"`
+		} `protobuf:"1"`
+	}{},
+}
+
+func TestStructuralErrors(t *testing.T) {
+	for i, test := range structuralErrorTests {
+		if _, err := Marshal(test); err == nil {
+			t.Errorf("#%d: Marshal(%T) succeeded", i, test)
+		} else if _, ok := err.(StructuralError); !ok {
+			t.Errorf("#%d: Marshal(%T) = %v, want StructuralError", i, test, err)
+		}
+		v := reflect.New(reflect.TypeOf(test)).Interface()
+		if err := Unmarshal([]byte{0x08, 0x01}, v); err == nil {
+			t.Errorf("#%d: Unmarshal into %T succeeded", i, test)
+		}
+	}
+
+	if _, err := Marshal(5); err == nil {
+		t.Errorf("Marshal of int succeeded")
+	}
+	if err := Unmarshal(nil, Test1{}); err == nil {
+		t.Errorf("Unmarshal into non-pointer succeeded")
+	}
+	if _, err := Marshal(&Repeated{Msgs: []*Test1{nil}}); err == nil {
+		t.Errorf("Marshal of nil repeated element succeeded")
+	}
+}
+
+func TestAppend(t *testing.T) {
+	buf, err := Append([]byte{0xff}, &Test1{150})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0xff, 0x08, 0x96, 0x01}; !bytes.Equal(buf, want) {
+		t.Errorf("Append = %x, want %x", buf, want)
+	}
+}
+
+func TestLongEmbeddedMessage(t *testing.T) {
+	// The length prefix of an embedded message takes two bytes.
+	s := &Test3{Test1{1}}
+	long := &Repeated{Strings: []string{string(make([]byte, 200))}}
+	data, err := Marshal(&struct {
+		S *Test3    `protobuf:"1"`
+		L *Repeated `protobuf:"2"`
+	}{s, long})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		S *Test3    `protobuf:"1"`
+		L *Repeated `protobuf:"2"`
+	}
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out.S, s) || !reflect.DeepEqual(out.L, long) {
+		t.Errorf("round trip of %x gave %+v", data, out)
+	}
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	n := &Node{1, []*Node{{2, nil}, {3, []*Node{{4, nil}}}}}
+	for i := 0; i < b.N; i++ {
+		Marshal(n)
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	data, _ := Marshal(&Node{1, []*Node{{2, nil}, {3, []*Node{{4, nil}}}}})
+	var n Node
+	for i := 0; i < b.N; i++ {
+		Unmarshal(data, &n)
+	}
+}
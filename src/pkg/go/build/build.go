@@ -55,6 +55,19 @@
 //
 //	// +build !linux !darwin !cgo
 //
+// The same constraints can be written as a boolean expression, using
+// the operators ||, && and ! and parentheses, on a line beginning
+// with the directive //go:build:
+//
+//	//go:build (linux && 386) || (darwin && !cgo)
+//
+// A file may have at most one //go:build line.  If it has one, that line
+// alone decides whether the file is built; any +build lines in the file
+// are then for older tools, and should be equivalent to it.  The
+// command 'go tool buildtag' converts between the two forms, and
+// 'go tool vet' reports constraint lines that are malformed, misplaced,
+// or disagree.
+//
 // Naming a file dns_windows.go will cause it to be included only when
 // building the package for Windows; similarly, math_386.s will be included
 // only when building the package for 32-bit x86.
@@ -88,6 +101,11 @@ type Context struct {
 	BuildTags   []string // additional tags to recognize in +build lines
 	UseAllFiles bool     // use files regardless of +build lines, file names
 
+	// Project, if non-nil, is the project tree that FindTree
+	// consults before the trees in Path.  Tools working inside
+	// a project set it to the result of FindProject.
+	Project *Tree
+
 	// By default, ScanDir uses the operating system's
 	// file system calls to read directories and files.
 	// Callers can override those calls to provide other
@@ -187,6 +205,9 @@ type DirInfo struct {
 	SFiles   []string // .s (and, when using cgo, .S files in dir)
 	CgoFiles []string // .go files that import "C"
 
+	// Binary objects
+	SysoFiles []string // .syso system object files to add to archive
+
 	// Cgo directives
 	CgoPkgConfig []string // Cgo pkg-config directives
 	CgoCFLAGS    []string // Cgo CFLAGS directives
@@ -251,6 +272,12 @@ func (ctxt *Context) ScanDir(dir string) (info *DirInfo, err error) {
 		switch ext {
 		case ".go", ".c", ".s", ".h", ".S":
 			// tentatively okay
+		case ".syso":
+			// binary objects to add to package archive;
+			// likely of the form foo_windows.syso, but
+			// the name was vetted above with goodOSArchFile.
+			di.SysoFiles = append(di.SysoFiles, name)
+			continue
 		default:
 			// skip
 			continue
@@ -410,6 +437,7 @@ var slashslash = []byte("//")
 //	// +build windows linux
 //
 // marks the file as applicable only on Windows and Linux.
+// A //go:build line in the run takes the place of the +build lines.
 //
 func (ctxt *Context) shouldBuild(content []byte) bool {
 	// Pass 1. Identify leading run of // comments and blank lines,
@@ -434,7 +462,30 @@ func (ctxt *Context) shouldBuild(content []byte) bool {
 	}
 	content = content[:end]
 
-	// Pass 2.  Process each line in the run.
+	// Pass 2.  A //go:build line, if any, decides alone;
+	// the +build lines beside it are for older tools.
+	p = content
+	var goBuild []string
+	for len(p) > 0 {
+		line := p
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line, p = line[:i], p[i+1:]
+		} else {
+			p = p[len(p):]
+		}
+		if IsGoBuild(string(line)) {
+			goBuild = append(goBuild, string(line))
+		}
+	}
+	if len(goBuild) > 0 {
+		c, err := ParseConstraint(goBuild...)
+		if err != nil {
+			return false // bad syntax, reject always
+		}
+		return c.Eval(func(s string) bool { return ctxt.match(s) })
+	}
+
+	// Pass 3.  Process each +build line in the run.
 	p = content
 	for len(p) > 0 {
 		line := p
@@ -106,3 +106,112 @@ func TestMatch(t *testing.T) {
 	match(runtime.GOOS + "," + runtime.GOARCH + ",!bar")
 	nomatch(runtime.GOOS + "," + runtime.GOARCH + ",bar")
 }
+
+var constraintTests = []struct {
+	lines []string
+	expr  string // String of the parsed constraint, or "" for an error
+}{
+	{[]string{"//go:build linux"}, "linux"},
+	{[]string{"//go:build linux && 386 || darwin && !cgo"}, "linux && 386 || darwin && !cgo"},
+	{[]string{"//go:build (linux || darwin) && !(arm || 386)"}, "(linux || darwin) && !(arm || 386)"},
+	{[]string{"//go:build !!ignore"}, "!!ignore"},
+	{[]string{"// +build linux,386 darwin,!cgo"}, "linux && 386 || darwin && !cgo"},
+	{[]string{"// +build linux darwin", "// +build !cgo"}, "(linux || darwin) && !cgo"},
+	{[]string{"//go:build"}, ""},
+	{[]string{"//go:build linux &&"}, ""},
+	{[]string{"//go:build (linux"}, ""},
+	{[]string{"//go:build linux & 386"}, ""},
+	{[]string{"//go:build linux-386"}, ""},
+	{[]string{"//go:build linux", "//go:build 386"}, ""},
+	{[]string{"// +build !!linux"}, ""},
+	{[]string{"// +build linux,"}, ""},
+	{[]string{"// +build"}, ""},
+}
+
+func TestParseConstraint(t *testing.T) {
+	for _, tt := range constraintTests {
+		c, err := ParseConstraint(tt.lines...)
+		if tt.expr == "" {
+			if err == nil {
+				t.Errorf("ParseConstraint(%q) = %s, want error", tt.lines, c)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseConstraint(%q): %v", tt.lines, err)
+			continue
+		}
+		if c.String() != tt.expr {
+			t.Errorf("ParseConstraint(%q) = %s, want %s", tt.lines, c, tt.expr)
+		}
+	}
+}
+
+// equivalent reports whether x and y agree for every
+// assignment of truth values to the tags they use.
+func equivalent(x, y Constraint) bool {
+	tags := Tags(x)
+	for _, tag := range Tags(y) {
+		tags = append(tags, tag)
+	}
+	for bits := 0; bits < 1<<uint(len(tags)); bits++ {
+		ok := func(tag string) bool {
+			for i, t := range tags {
+				if t == tag {
+					return bits&(1<<uint(i)) != 0
+				}
+			}
+			return false
+		}
+		if x.Eval(ok) != y.Eval(ok) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPlusBuildLines(t *testing.T) {
+	for _, tt := range constraintTests {
+		if tt.expr == "" {
+			continue
+		}
+		c, _ := ParseConstraint("//go:build " + tt.expr)
+		lines, err := PlusBuildLines(c)
+		if err != nil {
+			t.Errorf("PlusBuildLines(%s): %v", c, err)
+			continue
+		}
+		c1, err := ParseConstraint(lines...)
+		if err != nil {
+			t.Errorf("PlusBuildLines(%s) = %q: %v", c, lines, err)
+			continue
+		}
+		if !equivalent(c, c1) {
+			t.Errorf("PlusBuildLines(%s) = %q, not equivalent", c, lines)
+		}
+	}
+}
+
+func TestShouldBuildGoBuild(t *testing.T) {
+	ctxt := DefaultContext
+	ctxt.BuildTags = []string{"foo"}
+	tests := []struct {
+		content string
+		ok      bool
+	}{
+		{"//go:build foo && !bar\n\npackage p\n", true},
+		{"//go:build !foo || bar\n\npackage p\n", false},
+		// The //go:build line overrides the +build line.
+		{"//go:build foo\n// +build bar\n\npackage p\n", true},
+		{"//go:build bar\n// +build foo\n\npackage p\n", false},
+		// Malformed lines never match.
+		{"//go:build foo &&\n\npackage p\n", false},
+		// Without a blank line, it is the package doc comment.
+		{"//go:build bar\npackage p\n", true},
+	}
+	for _, tt := range tests {
+		if ok := ctxt.shouldBuild([]byte(tt.content)); ok != tt.ok {
+			t.Errorf("shouldBuild(%q) = %v, want %v", tt.content, ok, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package build
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// A Constraint is a parsed build constraint: a boolean formula over
+// build tags.  See the package documentation for the two forms a
+// constraint line can take.
+type Constraint interface {
+	// Eval reports whether the constraint is satisfied
+	// when the satisfied tags are those for which ok returns true.
+	Eval(ok func(tag string) bool) bool
+
+	// String returns the constraint in expression form,
+	// as written after //go:build.
+	String() string
+
+	isConstraint()
+}
+
+type tagConstraint string
+
+type notConstraint struct {
+	x Constraint
+}
+
+type andConstraint struct {
+	x, y Constraint
+}
+
+type orConstraint struct {
+	x, y Constraint
+}
+
+func (tagConstraint) isConstraint() {}
+func (notConstraint) isConstraint() {}
+func (andConstraint) isConstraint() {}
+func (orConstraint) isConstraint()  {}
+
+func (c tagConstraint) Eval(ok func(string) bool) bool { return ok(string(c)) }
+func (c notConstraint) Eval(ok func(string) bool) bool { return !c.x.Eval(ok) }
+func (c andConstraint) Eval(ok func(string) bool) bool { return c.x.Eval(ok) && c.y.Eval(ok) }
+func (c orConstraint) Eval(ok func(string) bool) bool  { return c.x.Eval(ok) || c.y.Eval(ok) }
+
+func (c tagConstraint) String() string { return string(c) }
+
+func (c notConstraint) String() string {
+	if _, ok := c.x.(tagConstraint); ok {
+		return "!" + c.x.String()
+	}
+	if _, ok := c.x.(notConstraint); ok {
+		return "!" + c.x.String()
+	}
+	return "!(" + c.x.String() + ")"
+}
+
+func (c andConstraint) String() string {
+	return andOperand(c.x) + " && " + andOperand(c.y)
+}
+
+func andOperand(c Constraint) string {
+	if _, ok := c.(orConstraint); ok {
+		return "(" + c.String() + ")"
+	}
+	return c.String()
+}
+
+func (c orConstraint) String() string {
+	return c.x.String() + " || " + c.y.String()
+}
+
+// IsGoBuild reports whether line is a //go:build constraint line.
+func IsGoBuild(line string) bool {
+	line = strings.TrimSpace(line)
+	return line == "//go:build" || strings.HasPrefix(line, "//go:build ") || strings.HasPrefix(line, "//go:build\t")
+}
+
+// IsPlusBuild reports whether line is a // +build constraint line.
+func IsPlusBuild(line string) bool {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "//") {
+		return false
+	}
+	f := strings.Fields(line[2:])
+	return len(f) > 0 && f[0] == "+build"
+}
+
+// ParseConstraint parses the build constraint given by lines:
+// either a single //go:build line or one or more // +build lines,
+// all of which must be satisfied.
+func ParseConstraint(lines ...string) (Constraint, error) {
+	if len(lines) == 0 {
+		return nil, errors.New("no build constraint")
+	}
+	if IsGoBuild(lines[0]) {
+		if len(lines) > 1 {
+			return nil, errors.New("more than one //go:build line")
+		}
+		line := strings.TrimSpace(lines[0])
+		return parseExpr(line[len("//go:build"):])
+	}
+	var c Constraint
+	for _, line := range lines {
+		if !IsPlusBuild(line) {
+			return nil, fmt.Errorf("not a build constraint: %q", line)
+		}
+		c1, err := parsePlusBuild(line)
+		if err != nil {
+			return nil, err
+		}
+		if c == nil {
+			c = c1
+		} else {
+			c = andConstraint{c, c1}
+		}
+	}
+	return c, nil
+}
+
+// parsePlusBuild parses a single // +build line.
+func parsePlusBuild(line string) (Constraint, error) {
+	f := strings.Fields(strings.TrimSpace(line)[2:])[1:]
+	if len(f) == 0 {
+		return nil, errors.New("empty +build line")
+	}
+	var c Constraint
+	for _, opt := range f {
+		var and Constraint
+		for _, term := range strings.Split(opt, ",") {
+			var t Constraint
+			switch {
+			case strings.HasPrefix(term, "!!"):
+				return nil, fmt.Errorf("double negation in +build term %q", term)
+			case strings.HasPrefix(term, "!"):
+				if !isTag(term[1:]) {
+					return nil, fmt.Errorf("invalid +build term %q", term)
+				}
+				t = notConstraint{tagConstraint(term[1:])}
+			default:
+				if !isTag(term) {
+					return nil, fmt.Errorf("invalid +build term %q", term)
+				}
+				t = tagConstraint(term)
+			}
+			if and == nil {
+				and = t
+			} else {
+				and = andConstraint{and, t}
+			}
+		}
+		if c == nil {
+			c = and
+		} else {
+			c = orConstraint{c, and}
+		}
+	}
+	return c, nil
+}
+
+// isTag reports whether s is a valid build tag:
+// letters, digits and underscores.  Unlike in Go
+// identifiers, all digits is fine (e.g., "386").
+func isTag(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// An exprParser parses the expression form of a build constraint:
+//
+//	expr = and { "||" and }
+//	and  = not { "&&" not }
+//	not  = "!" not | "(" expr ")" | tag
+type exprParser struct {
+	s   string
+	pos int
+	tok string // current token; "" at end of input
+}
+
+func parseExpr(s string) (c Constraint, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			if pe, ok := e.(exprError); ok {
+				c, err = nil, pe
+				return
+			}
+			panic(e)
+		}
+	}()
+	p := &exprParser{s: s}
+	p.next()
+	if p.tok == "" {
+		return nil, errors.New("empty //go:build expression")
+	}
+	c = p.or()
+	if p.tok != "" {
+		p.errorf("unexpected %q", p.tok)
+	}
+	return c, nil
+}
+
+// An exprError is an error in a //go:build expression,
+// used to unwind the parser.
+type exprError string
+
+func (e exprError) Error() string { return string(e) }
+
+func (p *exprParser) errorf(format string, args ...interface{}) {
+	panic(exprError("//go:build: " + fmt.Sprintf(format, args...)))
+}
+
+// next advances to the next token.
+func (p *exprParser) next() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+	if p.pos == len(p.s) {
+		p.tok = ""
+		return
+	}
+	start := p.pos
+	switch p.s[p.pos] {
+	case '(', ')', '!':
+		p.pos++
+	case '&', '|':
+		if p.pos+1 == len(p.s) || p.s[p.pos+1] != p.s[p.pos] {
+			p.errorf("invalid operator %q", p.s[p.pos:p.pos+1])
+		}
+		p.pos += 2
+	default:
+		for p.pos < len(p.s) && !strings.ContainsRune(" \t()!&|", rune(p.s[p.pos])) {
+			p.pos++
+		}
+		if !isTag(p.s[start:p.pos]) {
+			p.errorf("invalid tag %q", p.s[start:p.pos])
+		}
+	}
+	p.tok = p.s[start:p.pos]
+}
+
+func (p *exprParser) or() Constraint {
+	c := p.and()
+	for p.tok == "||" {
+		p.next()
+		c = orConstraint{c, p.and()}
+	}
+	return c
+}
+
+func (p *exprParser) and() Constraint {
+	c := p.not()
+	for p.tok == "&&" {
+		p.next()
+		c = andConstraint{c, p.not()}
+	}
+	return c
+}
+
+func (p *exprParser) not() Constraint {
+	switch p.tok {
+	case "!":
+		p.next()
+		return notConstraint{p.not()}
+	case "(":
+		p.next()
+		c := p.or()
+		if p.tok != ")" {
+			p.errorf("missing )")
+		}
+		p.next()
+		return c
+	case "", ")", "&&", "||":
+		if p.tok == "" {
+			p.errorf("unexpected end of expression")
+		}
+		p.errorf("unexpected %q", p.tok)
+	}
+	c := tagConstraint(p.tok)
+	p.next()
+	return c
+}
+
+// maxPlusBuildTerms limits the size of the +build lines
+// that PlusBuildLines will write for one constraint.
+const maxPlusBuildTerms = 100
+
+// PlusBuildLines returns // +build lines equivalent to c.
+// Each conjunct of c becomes one line, written as the OR of
+// ANDs that the old form requires.  It returns an error if
+// that form of c would be unreasonably large.
+func PlusBuildLines(c Constraint) ([]string, error) {
+	var lines []string
+	for _, c1 := range conjuncts(c, nil) {
+		terms := dnf(c1, false)
+		if len(terms) > maxPlusBuildTerms {
+			return nil, fmt.Errorf("constraint %s is too complex for +build lines", c)
+		}
+		line := "// +build"
+		for _, term := range terms {
+			line += " " + strings.Join(term, ",")
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// conjuncts appends to list the operands of the top-level ANDs of c.
+func conjuncts(c Constraint, list []Constraint) []Constraint {
+	if and, ok := c.(andConstraint); ok {
+		return conjuncts(and.y, conjuncts(and.x, list))
+	}
+	return append(list, c)
+}
+
+// dnf returns c, or its negation if not is set, in disjunctive
+// normal form: a list of terms to OR, each a list of possibly
+// negated tags to AND.
+func dnf(c Constraint, not bool) [][]string {
+	switch c := c.(type) {
+	case tagConstraint:
+		if not {
+			return [][]string{{"!" + string(c)}}
+		}
+		return [][]string{{string(c)}}
+	case notConstraint:
+		return dnf(c.x, !not)
+	case andConstraint:
+		if not {
+			return append(dnf(c.x, true), dnf(c.y, true)...)
+		}
+		return product(dnf(c.x, false), dnf(c.y, false))
+	case orConstraint:
+		if not {
+			return product(dnf(c.x, true), dnf(c.y, true))
+		}
+		return append(dnf(c.x, false), dnf(c.y, false)...)
+	}
+	panic(fmt.Sprintf("build: unexpected constraint %T", c))
+}
+
+// product returns the AND of two formulas in disjunctive normal form.
+func product(x, y [][]string) [][]string {
+	var out [][]string
+	for _, tx := range x {
+		for _, ty := range y {
+			term := append(append([]string{}, tx...), ty...)
+			out = append(out, term)
+			if len(out) > maxPlusBuildTerms {
+				return out
+			}
+		}
+	}
+	return out
+}
+
+// Tags returns the tags c mentions, in order of first appearance.
+func Tags(c Constraint) []string {
+	var tags []string
+	have := map[string]bool{}
+	var walk func(Constraint)
+	walk = func(c Constraint) {
+		switch c := c.(type) {
+		case tagConstraint:
+			if !have[string(c)] {
+				have[string(c)] = true
+				tags = append(tags, string(c))
+			}
+		case notConstraint:
+			walk(c.x)
+		case andConstraint:
+			walk(c.x)
+			walk(c.y)
+		case orConstraint:
+			walk(c.x)
+			walk(c.y)
+		}
+	}
+	walk(c)
+	return tags
+}
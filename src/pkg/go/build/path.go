@@ -7,20 +7,31 @@ package build
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 )
 
 // Path is a validated list of Trees derived from $GOROOT and $GOPATH at init.
 var Path []*Tree
 
-// Tree describes a Go source tree, either $GOROOT or one from $GOPATH.
+// Tree describes a Go source tree: $GOROOT, one from $GOPATH,
+// or a project tree found by FindProject.
 type Tree struct {
 	Path   string
 	Goroot bool
+	Prefix string // import path prefix of a project tree; "" otherwise
 }
 
+// ProjectFile is the name of the file marking the root of a project tree.
+// Its one line, ignoring blank lines and lines beginning with #, is the
+// import path prefix of the tree: the package in the root directory has
+// that import path, and the package in its subdirectory x/y has the
+// import path prefix/x/y.
+const ProjectFile = "go.project"
+
 func newTree(p string) (*Tree, error) {
 	if !filepath.IsAbs(p) {
 		return nil, errors.New("must be absolute")
@@ -33,7 +44,12 @@ func newTree(p string) (*Tree, error) {
 }
 
 // SrcDir returns the tree's package source directory.
+// For a project tree, that is the root directory itself,
+// which holds the package with import path t.Prefix.
 func (t *Tree) SrcDir() string {
+	if t.Prefix != "" {
+		return t.Path
+	}
 	if t.Goroot {
 		return filepath.Join(t.Path, "src", "pkg")
 	}
@@ -62,10 +78,49 @@ func (t *Tree) BinDir() string {
 	return filepath.Join(t.Path, "bin")
 }
 
+// PkgSrcDir returns the directory holding the source of the package
+// with the given import path in this Tree, or "" if the import path
+// is outside the prefix of a project tree.
+func (t *Tree) PkgSrcDir(pkg string) string {
+	if t.Prefix != "" {
+		if pkg == t.Prefix {
+			return t.Path
+		}
+		if !strings.HasPrefix(pkg, t.Prefix+"/") {
+			return ""
+		}
+		pkg = pkg[len(t.Prefix)+1:]
+	}
+	return filepath.Join(t.SrcDir(), filepath.FromSlash(pkg))
+}
+
+// ImportPath returns the import path of the package in directory dir,
+// which must be absolute, and whether dir is inside this Tree.
+func (t *Tree) ImportPath(dir string) (pkg string, ok bool) {
+	dir = filepath.Clean(dir)
+	src := t.SrcDir()
+	if t.Prefix != "" && dir == src {
+		return t.Prefix, true
+	}
+	src += string(filepath.Separator)
+	if !filepath.HasPrefix(dir, src) {
+		return "", false
+	}
+	pkg = filepath.ToSlash(dir[len(src):])
+	if t.Prefix != "" {
+		pkg = t.Prefix + "/" + pkg
+	}
+	return pkg, true
+}
+
 // HasSrc returns whether the given package's
 // source can be found inside this Tree.
 func (t *Tree) HasSrc(pkg string) bool {
-	fi, err := os.Stat(filepath.Join(t.SrcDir(), pkg))
+	dir := t.PkgSrcDir(pkg)
+	if dir == "" {
+		return false
+	}
+	fi, err := os.Stat(dir)
 	if err != nil {
 		return false
 	}
@@ -87,9 +142,16 @@ var (
 	ErrTreeNotFound = errors.New("no valid GOROOT or GOPATH could be found")
 )
 
+// FindTree calls DefaultContext.FindTree.
+func FindTree(path string) (tree *Tree, pkg string, err error) {
+	return DefaultContext.FindTree(path)
+}
+
 // FindTree takes an import or filesystem path and returns the
 // tree where the package source should be and the package import path.
-func FindTree(path string) (tree *Tree, pkg string, err error) {
+// The project tree ctxt.Project, if any, is consulted before the
+// trees in Path.
+func (ctxt *Context) FindTree(path string) (tree *Tree, pkg string, err error) {
 	if isLocalPath(path) {
 		if path, err = filepath.Abs(path); err != nil {
 			return
@@ -97,6 +159,11 @@ func FindTree(path string) (tree *Tree, pkg string, err error) {
 		if path, err = filepath.EvalSymlinks(path); err != nil {
 			return
 		}
+		if t := ctxt.Project; t != nil {
+			if pkg, ok := t.ImportPath(path); ok {
+				return t, pkg, nil
+			}
+		}
 		for _, t := range Path {
 			tpath := t.SrcDir() + string(filepath.Separator)
 			if !filepath.HasPrefix(path, tpath) {
@@ -106,11 +173,19 @@ func FindTree(path string) (tree *Tree, pkg string, err error) {
 			pkg = filepath.ToSlash(path[len(tpath):])
 			return
 		}
-		err = fmt.Errorf("path %q not inside a GOPATH", path)
+		err = fmt.Errorf("path %q not inside a GOPATH or project", path)
 		return
 	}
-	tree = defaultTree
 	pkg = filepath.ToSlash(path)
+	if t := ctxt.Project; t != nil && t.PkgSrcDir(pkg) != "" {
+		// The project owns every import path under its prefix.
+		tree = t
+		if !t.HasSrc(pkg) {
+			err = ErrNotFound
+		}
+		return
+	}
+	tree = defaultTree
 	for _, t := range Path {
 		if t.HasSrc(pkg) {
 			tree = t
@@ -125,6 +200,63 @@ func FindTree(path string) (tree *Tree, pkg string, err error) {
 	return
 }
 
+// FindProject returns the project tree containing the directory dir:
+// the one rooted at dir or the nearest of its parents holding a
+// ProjectFile.  It returns a nil Tree if there is none.
+func (ctxt *Context) FindProject(dir string) (*Tree, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		return nil, err
+	}
+	for {
+		file := filepath.Join(dir, ProjectFile)
+		if fi, err := os.Stat(file); err == nil && !fi.IsDir() {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			prefix, err := parseProject(file, data)
+			if err != nil {
+				return nil, err
+			}
+			return &Tree{Path: dir, Prefix: prefix}, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+	panic("unreachable")
+}
+
+// parseProject returns the import path prefix declared
+// by the contents of a ProjectFile.
+func parseProject(file string, data []byte) (string, error) {
+	prefix := ""
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if prefix != "" {
+			return "", fmt.Errorf("%s:%d: more than one import path prefix", file, i+1)
+		}
+		if isLocalPath(line) || filepath.IsAbs(line) || strings.ContainsAny(line, " \t\\") ||
+			strings.HasSuffix(line, "/") || strings.Contains("/"+line+"/", "/../") {
+			return "", fmt.Errorf("%s:%d: invalid import path prefix %q", file, i+1, line)
+		}
+		prefix = line
+	}
+	if prefix == "" {
+		return "", fmt.Errorf("%s: no import path prefix", file)
+	}
+	return prefix, nil
+}
+
 var (
 	// argument lists used by the build's gc and ld methods
 	gcImportArgs []string
@@ -0,0 +1,177 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	gopathTree  = &Tree{Path: filepath.FromSlash("/gopath")}
+	projectTree = &Tree{Path: filepath.FromSlash("/proj"), Prefix: "example.com/p"}
+)
+
+var pkgSrcDirTests = []struct {
+	tree *Tree
+	pkg  string
+	dir  string // "" if pkg is not in tree
+}{
+	{gopathTree, "a", "/gopath/src/a"},
+	{gopathTree, "example.com/p/a", "/gopath/src/example.com/p/a"},
+	{projectTree, "example.com/p", "/proj"},
+	{projectTree, "example.com/p/a", "/proj/a"},
+	{projectTree, "example.com/p/a/b", "/proj/a/b"},
+	{projectTree, "example.com/pq", ""},
+	{projectTree, "example.com", ""},
+	{projectTree, "a", ""},
+}
+
+func TestPkgSrcDir(t *testing.T) {
+	for _, tt := range pkgSrcDirTests {
+		want := filepath.FromSlash(tt.dir)
+		if dir := tt.tree.PkgSrcDir(tt.pkg); dir != want {
+			t.Errorf("Tree{%q, %q}.PkgSrcDir(%q) = %q, want %q", tt.tree.Path, tt.tree.Prefix, tt.pkg, dir, want)
+		}
+	}
+}
+
+var importPathTests = []struct {
+	tree *Tree
+	dir  string
+	pkg  string // "" if dir is not in tree
+}{
+	{gopathTree, "/gopath/src/a", "a"},
+	{gopathTree, "/gopath/src/a/b/", "a/b"},
+	{gopathTree, "/gopath/src", ""},
+	{gopathTree, "/gopath/srcx/a", ""},
+	{gopathTree, "/proj/a", ""},
+	{projectTree, "/proj", "example.com/p"},
+	{projectTree, "/proj/", "example.com/p"},
+	{projectTree, "/proj/a", "example.com/p/a"},
+	{projectTree, "/proj/a/b", "example.com/p/a/b"},
+	{projectTree, "/projx/a", ""},
+	{projectTree, "/", ""},
+}
+
+func TestImportPath(t *testing.T) {
+	for _, tt := range importPathTests {
+		dir := filepath.FromSlash(tt.dir)
+		wantOK := tt.pkg != ""
+		pkg, ok := tt.tree.ImportPath(dir)
+		if pkg != tt.pkg || ok != wantOK {
+			t.Errorf("Tree{%q, %q}.ImportPath(%q) = %q, %v, want %q, %v", tt.tree.Path, tt.tree.Prefix, dir, pkg, ok, tt.pkg, wantOK)
+		}
+	}
+}
+
+// tempProject creates a project tree in a temporary directory, with
+// a go.project file holding data, unless data is "", and the
+// directories dirs.  It returns the root of the tree, with symbolic
+// links evaluated.
+func tempProject(t *testing.T, data string, dirs ...string) string {
+	root, err := ioutil.TempDir("", "go-build-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		t.Fatal(err)
+	}
+	if data != "" {
+		if err := ioutil.WriteFile(filepath.Join(root, ProjectFile), []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(filepath.Join(root, filepath.FromSlash(dir)), 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestFindProject(t *testing.T) {
+	root := tempProject(t, "# the project\n\nexample.com/p\n", "a/b")
+	defer os.RemoveAll(root)
+
+	for _, dir := range []string{root, filepath.Join(root, "a"), filepath.Join(root, "a", "b")} {
+		tree, err := DefaultContext.FindProject(dir)
+		if err != nil {
+			t.Errorf("FindProject(%q): %v", dir, err)
+			continue
+		}
+		if tree == nil || tree.Path != root || tree.Prefix != "example.com/p" || tree.Goroot {
+			t.Errorf("FindProject(%q) = %+v, want project %q with prefix example.com/p", dir, tree, root)
+		}
+	}
+
+	// A directory outside any project has none.
+	none := tempProject(t, "")
+	defer os.RemoveAll(none)
+	if tree, err := DefaultContext.FindProject(none); tree != nil || err != nil {
+		t.Errorf("FindProject(%q) = %+v, %v, want nil, nil", none, tree, err)
+	}
+}
+
+var badProjects = []string{
+	"\n",
+	"# only a comment\n",
+	"example.com/p\nexample.com/q\n",
+	"./p\n",
+	"/p\n",
+	"example.com/p/\n",
+	"example.com/../p\n",
+	"example.com/my p\n",
+}
+
+func TestFindProjectBad(t *testing.T) {
+	for _, data := range badProjects {
+		root := tempProject(t, data)
+		if tree, err := DefaultContext.FindProject(root); err == nil {
+			t.Errorf("FindProject with %s %q = %+v, want error", ProjectFile, data, tree)
+		}
+		os.RemoveAll(root)
+	}
+}
+
+func TestFindTree(t *testing.T) {
+	root := tempProject(t, "example.com/p\n", "a")
+	defer os.RemoveAll(root)
+	proj := &Tree{Path: root, Prefix: "example.com/p"}
+	ctxt := DefaultContext
+	ctxt.Project = proj
+
+	tests := []struct {
+		path string
+		pkg  string
+		err  error
+	}{
+		{"example.com/p", "example.com/p", nil},
+		{"example.com/p/a", "example.com/p/a", nil},
+		{"example.com/p/missing", "example.com/p/missing", ErrNotFound},
+		{root, "example.com/p", nil},
+		{filepath.Join(root, "a"), "example.com/p/a", nil},
+	}
+	for _, tt := range tests {
+		tree, pkg, err := ctxt.FindTree(tt.path)
+		if tree != proj || pkg != tt.pkg || err != tt.err {
+			t.Errorf("FindTree(%q) = %+v, %q, %v, want the project, %q, %v", tt.path, tree, pkg, err, tt.pkg, tt.err)
+		}
+	}
+
+	// Without the project, its packages are not found,
+	// and the standard library still is.
+	if tree, _, err := DefaultContext.FindTree("example.com/p/a"); tree == proj || err != ErrNotFound {
+		t.Errorf("DefaultContext.FindTree(example.com/p/a) = %+v, %v, want ErrNotFound", tree, err)
+	}
+	for _, c := range []*Context{&ctxt, &DefaultContext} {
+		tree, pkg, err := c.FindTree("go/build")
+		if tree != Path[0] || pkg != "go/build" || err != nil {
+			t.Errorf("FindTree(go/build) = %+v, %q, %v, want GOROOT, go/build, nil", tree, pkg, err)
+		}
+	}
+}
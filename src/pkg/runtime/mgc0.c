@@ -8,6 +8,7 @@
 #include "arch_GOARCH.h"
 #include "malloc.h"
 #include "stack.h"
+#include "race.h"
 
 enum {
 	Debug = 0,
@@ -795,6 +796,9 @@ sweep(void)
 			// Mark freed; restore block boundary bit.
 			*bitp = (*bitp & ~(bitMask<<shift)) | (bitBlockBoundary<<shift);
 
+			if(raceenabled)
+				runtime·racefree(p);
+
 			c = m->mcache;
 			if(s->sizeclass == 0) {
 				// Free large span.
@@ -1037,6 +1041,9 @@ runfinq(void)
 	byte *frame;
 	uint32 framesz, framecap, i;
 
+	if(raceenabled)
+		runtime·racefingo();
+
 	frame = nil;
 	framecap = 0;
 	for(;;) {
@@ -8,6 +8,7 @@
 #include "malloc.h"
 #include "os_GOOS.h"
 #include "stack.h"
+#include "race.h"
 
 bool	runtime·iscgo;
 
@@ -185,6 +186,9 @@ runtime·schedinit(void)
 	runtime·mallocinit();
 	mcommoninit(m);
 
+	if(raceenabled)
+		g->racectx = runtime·raceinit();
+
 	runtime·goargs();
 	runtime·goenvs();
 
@@ -234,6 +238,8 @@ runtime·main(void)
 		runtime·UnlockOSThread();
 
 	main·main();
+	if(raceenabled)
+		runtime·racefini();
 	runtime·exit(0);
 	for(;;)
 		*(int32*)runtime·main = 0;
@@ -262,6 +268,8 @@ schedunlock(void)
 void
 runtime·goexit(void)
 {
+	if(raceenabled)
+		runtime·racegoend();
 	g->status = Gmoribund;
 	runtime·gosched();
 }
@@ -1254,6 +1262,8 @@ runtime·newproc1(byte *fn, byte *argp, int32 narg, int32 nret, void *callerpc)
 	runtime·sched.gcount++;
 	runtime·sched.goidgen++;
 	newg->goid = runtime·sched.goidgen;
+	if(raceenabled)
+		newg->racectx = runtime·racegostart(callerpc);
 
 	newprocreadylocked(newg);
 	schedunlock();
@@ -0,0 +1,54 @@
+#!/usr/bin/env bash
+# Copyright 2012 The Go Authors. All rights reserved.
+# Use of this source code is governed by a BSD-style
+# license that can be found in the LICENSE file.
+
+# mkrace.bash builds the race detector runtime for the current
+# $GOOS/$GOARCH from a checkout of LLVM compiler-rt and installs it
+# in this directory as race_$GOOS_$GOARCH.syso.
+#
+# Usage: ./mkrace.bash path/to/compiler-rt
+#
+# The checkout must provide the ThreadSanitizer Go interface that
+# race.go calls; the script fails if any of those functions is
+# missing from the object it builds.
+
+set -e
+
+if [ $# != 1 ]; then
+	echo 'usage: ./mkrace.bash path/to/compiler-rt' 1>&2
+	exit 2
+fi
+if [ ! -x "$1/lib/tsan/go/buildgo.sh" ]; then
+	echo "mkrace: $1/lib/tsan/go/buildgo.sh not found; is $1 a compiler-rt checkout?" 1>&2
+	exit 1
+fi
+rt="$(cd "$1" && pwd)"
+
+cd "$(dirname "$0")"
+eval $(go tool dist env)
+case "${GOOS}_$GOARCH" in
+linux_amd64 | darwin_amd64 | windows_amd64)
+	;;
+*)
+	echo "mkrace: the race detector does not support $GOOS/$GOARCH" 1>&2
+	exit 1
+esac
+syso=race_${GOOS}_$GOARCH.syso
+
+(cd "$rt/lib/tsan/go" && ./buildgo.sh)
+
+# Check that the runtime defines every function race.go declares.
+missing=""
+for f in $(sed -n 's/^void \(__tsan_[a-z_]*\)(.*/\1/p' race.go); do
+	if ! nm "$rt/lib/tsan/go/$syso" | grep -q " T _*$f\$"; then
+		missing="$missing $f"
+	fi
+done
+if [ -n "$missing" ]; then
+	echo "mkrace: $rt/lib/tsan/go/$syso does not define:$missing" 1>&2
+	exit 1
+fi
+
+cp "$rt/lib/tsan/go/$syso" $syso
+echo "installed $syso"
@@ -14,6 +14,10 @@ import (
 
 var matchBenchmarks = flag.String("test.bench", "", "regular expression to select benchmarks to run")
 var benchTime = flag.Float64("test.benchtime", 1, "approximate run time for each benchmark, in seconds")
+var benchmarkMemory = flag.Bool("test.benchmem", false, "print memory allocations for benchmarks")
+
+// memStats is shared by the benchmarks, which run one at a time.
+var memStats runtime.MemStats
 
 // An internal type but exported because it is cross-package; part of the implementation
 // of the "go test" command.
@@ -26,11 +30,26 @@ type InternalBenchmark struct {
 // timing and to specify the number of iterations to run.
 type B struct {
 	common
+	context   *benchContext // nil for a benchmark run by Benchmark
 	N         int
-	benchmark InternalBenchmark
+	benchFunc func(b *B)
 	bytes     int64
 	timerOn   bool
 	result    BenchmarkResult
+
+	// The memory statistics when the timer was started, and the
+	// allocations made while it ran.
+	startAllocs uint64
+	startBytes  uint64
+	netAllocs   uint64
+	netBytes    uint64
+}
+
+// benchContext holds the state shared by a top-level benchmark and its
+// sub-benchmarks in a run of "go test".
+type benchContext struct {
+	match *matcher
+	procs int // GOMAXPROCS for the run, which suffixes printed names.
 }
 
 // StartTimer starts timing a test.  This function is called automatically
@@ -38,6 +57,9 @@ type B struct {
 // a call to StopTimer.
 func (b *B) StartTimer() {
 	if !b.timerOn {
+		runtime.ReadMemStats(&memStats)
+		b.startAllocs = memStats.Mallocs
+		b.startBytes = memStats.TotalAlloc
 		b.start = time.Now()
 		b.timerOn = true
 	}
@@ -49,17 +71,25 @@ func (b *B) StartTimer() {
 func (b *B) StopTimer() {
 	if b.timerOn {
 		b.duration += time.Now().Sub(b.start)
+		runtime.ReadMemStats(&memStats)
+		b.netAllocs += memStats.Mallocs - b.startAllocs
+		b.netBytes += memStats.TotalAlloc - b.startBytes
 		b.timerOn = false
 	}
 }
 
-// ResetTimer sets the elapsed benchmark time to zero.
-// It does not affect whether the timer is running.
+// ResetTimer sets the elapsed benchmark time and memory allocation
+// counters to zero.  It does not affect whether the timer is running.
 func (b *B) ResetTimer() {
 	if b.timerOn {
+		runtime.ReadMemStats(&memStats)
+		b.startAllocs = memStats.Mallocs
+		b.startBytes = memStats.TotalAlloc
 		b.start = time.Now()
 	}
 	b.duration = 0
+	b.netAllocs = 0
+	b.netBytes = 0
 }
 
 // SetBytes records the number of bytes processed in a single operation.
@@ -79,9 +109,10 @@ func (b *B) runN(n int) {
 	// by clearing garbage from previous runs.
 	runtime.GC()
 	b.N = n
+	defer b.runCleanup()
 	b.ResetTimer()
 	b.StartTimer()
-	b.benchmark.F(b)
+	b.benchFunc(b)
 	b.StopTimer()
 }
 
@@ -127,32 +158,116 @@ func roundUp(n int) int {
 	return 10 * base
 }
 
-// run times the benchmark function in a separate goroutine.
+// run1 runs the benchmark function for a single iteration, in case it's
+// expensive, in a separate goroutine.  It reports whether the benchmark
+// is to be timed: it hasn't failed or been skipped and has no
+// sub-benchmarks, which are timed instead.
+func (b *B) run1() bool {
+	go func() {
+		// Signal that we're done whether we return normally
+		// or by FailNow's runtime.Goexit.
+		defer func() {
+			b.signal <- true
+		}()
+
+		b.runN(1)
+	}()
+	<-b.signal
+	return !b.hasSub && !b.Failed() && !b.Skipped()
+}
+
+// run times the benchmark function in a separate goroutine, printing
+// the result if the benchmark is part of a "go test" run.
 func (b *B) run() BenchmarkResult {
+	if b.context != nil {
+		name := b.context.displayName(b.name)
+		if *jsonOutput {
+			emit(&event{Action: actionRun, Test: name})
+		} else {
+			fmt.Printf("%s\t", name)
+		}
+	}
 	go b.launch()
 	<-b.signal
+	if b.context != nil {
+		if !b.Failed() {
+			result := b.result.String()
+			if *benchmarkMemory {
+				result += "\t" + b.result.MemString()
+			}
+			if *jsonOutput {
+				emit(&event{Action: actionBench, Test: b.context.displayName(b.name), Output: result + "\n", Bench: &b.result})
+			} else {
+				fmt.Printf("%s\n", result)
+			}
+		}
+		b.printOutput()
+	}
 	return b.result
 }
 
+// printOutput prints the output of a benchmark that has finished: all
+// of it if the benchmark failed or was skipped, and a trimmed version
+// otherwise.
+func (b *B) printOutput() {
+	name := b.context.displayName(b.name)
+	if b.Failed() {
+		// The output could be very long here, but probably isn't.
+		// We print it all, regardless, because we don't want to trim the reason
+		// the benchmark failed.
+		if *jsonOutput {
+			emitResult(name, actionFail, b.duration, b.output)
+		} else {
+			fmt.Printf("--- FAIL: %s\n%s", name, b.output)
+		}
+		return
+	}
+	if b.Skipped() {
+		if *jsonOutput {
+			emitResult(name, actionSkip, b.duration, b.output)
+		} else {
+			fmt.Printf("--- SKIP: %s\n%s", name, b.output)
+		}
+		return
+	}
+	// Unlike with tests, we ignore the -chatty flag and always print output for
+	// benchmarks since the output generation time will skew the results.
+	if len(b.output) > 0 {
+		b.trimOutput()
+		if *jsonOutput {
+			emitOutput(name, b.output)
+		} else {
+			fmt.Printf("--- BENCH: %s\n%s", name, b.output)
+		}
+	}
+}
+
+// displayName returns the printed name of the benchmark called name.
+func (ctx *benchContext) displayName(name string) string {
+	if ctx.procs != 1 {
+		return fmt.Sprintf("%s-%d", name, ctx.procs)
+	}
+	return name
+}
+
 // launch launches the benchmark function.  It gradually increases the number
 // of benchmark iterations until the benchmark runs for a second in order
 // to get a reasonable measurement.  It prints timing information in this form
 //		testing.BenchmarkHello	100000		19 ns/op
-// launch is run by the fun function as a separate goroutine.
+// launch is run by the run function as a separate goroutine, after run1
+// has run the benchmark for a single iteration.
 func (b *B) launch() {
-	// Run the benchmark for a single iteration in case it's expensive.
 	n := 1
 
 	// Signal that we're done whether we return normally
 	// or by FailNow's runtime.Goexit.
 	defer func() {
-		b.signal <- b
+		b.signal <- true
 	}()
 
-	b.runN(n)
 	// Run the benchmark for at least the specified amount of time.
 	d := time.Duration(*benchTime * float64(time.Second))
-	for !b.failed && b.duration < d && n < 1e9 {
+	for !b.Failed() && b.duration < d && n < 1e9 {
 		last := n
 		// Predict iterations/sec.
 		if b.nsPerOp() == 0 {
@@ -168,14 +283,16 @@ func (b *B) launch() {
 		n = roundUp(n)
 		b.runN(n)
 	}
-	b.result = BenchmarkResult{b.N, b.duration, b.bytes}
+	b.result = BenchmarkResult{b.N, b.duration, b.bytes, b.netAllocs, b.netBytes}
 }
 
 // The results of a benchmark run.
 type BenchmarkResult struct {
-	N     int           // The number of iterations.
-	T     time.Duration // The total time taken.
-	Bytes int64         // Bytes processed in one iteration.
+	N         int           // The number of iterations.
+	T         time.Duration // The total time taken.
+	Bytes     int64         // Bytes processed in one iteration.
+	MemAllocs uint64        // The total number of memory allocations.
+	MemBytes  uint64        // The total number of bytes allocated.
 }
 
 func (r BenchmarkResult) NsPerOp() int64 {
@@ -185,6 +302,22 @@ func (r BenchmarkResult) NsPerOp() int64 {
 	return r.T.Nanoseconds() / int64(r.N)
 }
 
+// AllocsPerOp returns the number of memory allocations per iteration.
+func (r BenchmarkResult) AllocsPerOp() int64 {
+	if r.N <= 0 {
+		return 0
+	}
+	return int64(r.MemAllocs) / int64(r.N)
+}
+
+// AllocedBytesPerOp returns the number of bytes allocated per iteration.
+func (r BenchmarkResult) AllocedBytesPerOp() int64 {
+	if r.N <= 0 {
+		return 0
+	}
+	return int64(r.MemBytes) / int64(r.N)
+}
+
 func (r BenchmarkResult) mbPerSec() float64 {
 	if r.Bytes <= 0 || r.T <= 0 || r.N <= 0 {
 		return 0
@@ -212,6 +345,12 @@ func (r BenchmarkResult) String() string {
 	return fmt.Sprintf("%8d\t%s%s", r.N, ns, mb)
 }
 
+// MemString returns the allocations per iteration in the form printed
+// by the -test.benchmem flag.
+func (r BenchmarkResult) MemString() string {
+	return fmt.Sprintf("%8d B/op\t%8d allocs/op", r.AllocedBytesPerOp(), r.AllocsPerOp())
+}
+
 // An internal function but exported because it is cross-package; part of the implementation
 // of the "go test" command.
 func RunBenchmarks(matchString func(pat, str string) (bool, error), benchmarks []InternalBenchmark) {
@@ -220,49 +359,79 @@ func RunBenchmarks(matchString func(pat, str string) (bool, error), benchmarks [
 		return
 	}
 	for _, Benchmark := range benchmarks {
-		matched, err := matchString(*matchBenchmarks, Benchmark.Name)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "testing: invalid regexp for -test.bench: %s\n", err)
-			os.Exit(1)
-		}
-		if !matched {
-			continue
-		}
 		for _, procs := range cpuList {
 			runtime.GOMAXPROCS(procs)
-			b := &B{
+			ctx := &benchContext{
+				match: newMatcher(matchString, *matchBenchmarks, "-test.bench"),
+				procs: procs,
+			}
+			// The top-level benchmark is a sub-benchmark of a root
+			// that is neither timed nor printed.
+			bench := Benchmark
+			root := &B{
 				common: common{
-					signal: make(chan interface{}),
+					signal: make(chan bool),
+				},
+				context: ctx,
+				benchFunc: func(b *B) {
+					b.Run(bench.Name, bench.F)
 				},
-				benchmark: Benchmark,
-			}
-			benchName := Benchmark.Name
-			if procs != 1 {
-				benchName = fmt.Sprintf("%s-%d", Benchmark.Name, procs)
-			}
-			fmt.Printf("%s\t", benchName)
-			r := b.run()
-			if b.failed {
-				// The output could be very long here, but probably isn't.
-				// We print it all, regardless, because we don't want to trim the reason
-				// the benchmark failed.
-				fmt.Printf("--- FAIL: %s\n%s", benchName, b.output)
-				continue
-			}
-			fmt.Printf("%v\n", r)
-			// Unlike with tests, we ignore the -chatty flag and always print output for
-			// benchmarks since the output generation time will skew the results.
-			if len(b.output) > 0 {
-				b.trimOutput()
-				fmt.Printf("--- BENCH: %s\n%s", benchName, b.output)
 			}
+			root.run1()
 			if p := runtime.GOMAXPROCS(-1); p != procs {
-				fmt.Fprintf(os.Stderr, "testing: %s left GOMAXPROCS set to %d\n", benchName, p)
+				fmt.Fprintf(os.Stderr, "testing: %s left GOMAXPROCS set to %d\n", ctx.displayName(Benchmark.Name), p)
 			}
 		}
 	}
 }
 
+// Run benchmarks f as a sub-benchmark of b called name, and reports
+// whether it succeeded.  A benchmark that calls Run is not timed itself:
+// each of its sub-benchmarks is, separately.  A sub-benchmark whose name
+// the -test.bench pattern does not select is not run and counts as a
+// success.
+func (b *B) Run(name string, f func(b *B)) bool {
+	b.hasSub = true
+	benchName, ok := name, true
+	if b.context != nil {
+		benchName, ok = b.context.match.fullName(&b.common, name)
+		if !ok {
+			return true
+		}
+	} else if b.level > 0 {
+		benchName = b.name + "/" + name
+	}
+	sub := &B{
+		common: common{
+			signal: make(chan bool),
+			name:   benchName,
+			parent: &b.common,
+			level:  b.level + 1,
+		},
+		context:   b.context,
+		benchFunc: f,
+	}
+	if sub.run1() {
+		sub.run()
+	} else if sub.context != nil {
+		sub.printOutput()
+	}
+	b.add(sub.result)
+	return !sub.Failed()
+}
+
+// add records the result of a sub-benchmark in the result of b, as if
+// the sub-benchmarks ran in sequence as a single iteration of b.  This
+// gives Benchmark a meaningful result for a function that calls Run.
+func (b *B) add(other BenchmarkResult) {
+	r := &b.result
+	r.N = 1
+	r.T += time.Duration(other.NsPerOp())
+	r.Bytes += other.Bytes
+	r.MemAllocs += uint64(other.AllocsPerOp())
+	r.MemBytes += uint64(other.AllocedBytesPerOp())
+}
+
 // trimOutput shortens the output from a benchmark, which can be very long.
 func (b *B) trimOutput() {
 	// The output is likely to appear multiple times because the benchmark
@@ -285,9 +454,12 @@ func (b *B) trimOutput() {
 func Benchmark(f func(b *B)) BenchmarkResult {
 	b := &B{
 		common: common{
-			signal: make(chan interface{}),
+			signal: make(chan bool),
 		},
-		benchmark: InternalBenchmark{"", f},
+		benchFunc: f,
+	}
+	if !b.run1() {
+		return b.result
 	}
 	return b.run()
 }
@@ -0,0 +1,65 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testing
+
+import (
+	"io/ioutil"
+	"os"
+	"regexp"
+)
+
+// captureStdout returns what f writes to standard output.
+func captureStdout(t *T, f func()) string {
+	file, err := ioutil.TempFile("", "testing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	func() {
+		defer func(stdout *os.File) { os.Stdout = stdout }(os.Stdout)
+		os.Stdout = file
+		f()
+	}()
+	data, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestMemString(t *T) {
+	r := BenchmarkResult{N: 10, T: 1000, MemAllocs: 20, MemBytes: 640}
+	if s, want := r.MemString(), "      64 B/op\t       2 allocs/op"; s != want {
+		t.Errorf("MemString() = %q, want %q", s, want)
+	}
+}
+
+var benchSink []byte
+
+func TestBenchmem(t *T) {
+	defer setReport(false, false)()
+	defer func(mem bool, d float64) { *benchmarkMemory, *benchTime = mem, d }(*benchmarkMemory, *benchTime)
+	*benchmarkMemory, *benchTime = true, 0.01
+
+	out := captureStdout(t, func() {
+		root := &B{
+			common:  common{signal: make(chan bool)},
+			context: &benchContext{match: newMatcher(regexp.MatchString, "", "-test.bench"), procs: 1},
+			benchFunc: func(b *B) {
+				b.Run("BenchmarkAlloc", func(b *B) {
+					for i := 0; i < b.N; i++ {
+						benchSink = make([]byte, 64)
+					}
+				})
+			},
+		}
+		root.run1()
+	})
+	line := `^BenchmarkAlloc\t *[0-9]+\t *[0-9.]+ ns/op\t *64 B/op\t *1 allocs/op\n$`
+	if !regexp.MustCompile(line).MatchString(out) {
+		t.Errorf("benchmark printed %q, want match for %q", out, line)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Support for test coverage.
+
+package testing
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+var coverProfile = flag.String("test.coverprofile", "", "write a coverage profile to the named file after execution")
+
+// CoverBlock records the coverage data for a single basic block.
+// NOTE: This struct is internal to the testing infrastructure and may change.
+// It is not covered (yet) by the Go 1 compatibility guidelines.
+type CoverBlock struct {
+	Line0 uint32
+	Col0  uint16
+	Line1 uint32
+	Col1  uint16
+	Stmts uint16
+}
+
+var cover Cover
+
+// Cover records information about test coverage checking.
+// NOTE: This struct is internal to the testing infrastructure and may change.
+// It is not covered (yet) by the Go 1 compatibility guidelines.
+type Cover struct {
+	Mode     string
+	Counters map[string][]uint32
+	Blocks   map[string][]CoverBlock
+}
+
+// RegisterCover records the coverage data accumulators for the tests.
+// NOTE: This function is internal to the testing infrastructure and may change.
+// It is not covered (yet) by the Go 1 compatibility guidelines.
+func RegisterCover(c Cover) {
+	cover = c
+}
+
+// coverReport reports the coverage percentage and writes a coverage profile if requested.
+func coverReport() {
+	var f *os.File
+	var w *bufio.Writer
+	if *coverProfile != "" {
+		var err error
+		f, err = os.Create(*coverProfile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "testing: %s\n", err)
+			return
+		}
+		defer f.Close()
+		w = bufio.NewWriter(f)
+		defer w.Flush()
+		fmt.Fprintf(w, "mode: %s\n", cover.Mode)
+	}
+
+	var active, total int64
+	for name, counts := range cover.Counters {
+		blocks := cover.Blocks[name]
+		for i := range counts {
+			stmts := int64(blocks[i].Stmts)
+			total += stmts
+			count := atomic.LoadUint32(&counts[i]) // For -mode=atomic.
+			if count > 0 {
+				active += stmts
+			}
+			if w != nil {
+				fmt.Fprintf(w, "%s:%d.%d,%d.%d %d %d\n", name,
+					blocks[i].Line0, blocks[i].Col0,
+					blocks[i].Line1, blocks[i].Col1,
+					stmts,
+					count)
+			}
+		}
+	}
+	if total == 0 {
+		total = 1
+	}
+	line := fmt.Sprintf("coverage: %.1f%% of statements\n", 100*float64(active)/float64(total))
+	if *jsonOutput {
+		emitOutput("", []byte(line))
+	} else {
+		fmt.Print(line)
+	}
+}
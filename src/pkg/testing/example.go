@@ -26,16 +26,14 @@ func RunExamples(matchString func(pat, str string) (bool, error), examples []Int
 
 	stdout, stderr := os.Stdout, os.Stderr
 
+	m := newMatcher(matchString, *match, "-test.run")
 	for _, eg = range examples {
-		matched, err := matchString(*match, eg.Name)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "testing: invalid regexp for -test.run: %s\n", err)
-			os.Exit(1)
-		}
-		if !matched {
+		if _, matched := m.fullName(nil, eg.Name); !matched {
 			continue
 		}
-		if *chatty {
+		if *jsonOutput {
+			emit(&event{Action: actionRun, Test: eg.Name})
+		} else if *chatty {
 			fmt.Printf("=== RUN: %s\n", eg.Name)
 		}
 
@@ -69,10 +67,20 @@ func RunExamples(matchString func(pat, str string) (bool, error), examples []Int
 
 		// report any errors
 		tstr := fmt.Sprintf("(%.2f seconds)", dt.Seconds())
-		if g, e := strings.TrimSpace(out), strings.TrimSpace(eg.Output); g != e {
+		g, e := strings.TrimSpace(out), strings.TrimSpace(eg.Output)
+		if g != e {
+			ok = false
+		}
+		if *jsonOutput {
+			action, output := actionPass, []byte(nil)
+			if g != e {
+				action = actionFail
+				output = []byte(fmt.Sprintf("got:\n%s\nwant:\n%s\n", g, e))
+			}
+			emitResult(eg.Name, action, dt, output)
+		} else if g != e {
 			fmt.Printf("--- FAIL: %s %s\ngot:\n%s\nwant:\n%s\n",
 				eg.Name, tstr, g, e)
-			ok = false
 		} else if *chatty {
 			fmt.Printf("--- PASS: %s %s\n", eg.Name, tstr)
 		}
@@ -0,0 +1,153 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testing
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// jsonOutput selects the machine-readable output: one JSON object per
+// line for each event of the run, in place of the usual report.  An
+// event has these fields, which are omitted when empty:
+//
+//	Time     time of the event, in RFC 3339 format
+//	Action   what happened: see below
+//	Test     name of the test, example or benchmark; empty for the whole binary
+//	Elapsed  seconds taken by a test or by the binary that passed or failed
+//	Output   a line of output, with its newline; for bench, the result
+//
+// The actions are run (a test starts), output (a test or the binary
+// printed a line), pass and fail (a test or the binary finished), skip
+// (a test or benchmark was skipped), and
+// bench (a benchmark finished, whose event also has the fields N,
+// NsPerOp, MBPerSec, AllocsPerOp and AllocedBytesPerOp of its result).
+//
+// The go test command adds a Package field holding the import path of
+// the package under test.  Output that the tests write to standard
+// output themselves is not converted, so a program reading the stream
+// from a test binary must accept lines that aren't JSON.
+var jsonOutput = flag.Bool("test.json", false, "print a JSON event for each test action instead of a report")
+
+// Actions of the events printed under -test.json.
+const (
+	actionRun    = "run"
+	actionOutput = "output"
+	actionPass   = "pass"
+	actionFail   = "fail"
+	actionSkip   = "skip"
+	actionBench  = "bench"
+)
+
+// An event is an action of a test to print under -test.json.
+type event struct {
+	Action     string
+	Test       string
+	Elapsed    time.Duration
+	HasElapsed bool // Elapsed is printed even if zero.
+	Output     string
+	Bench      *BenchmarkResult
+}
+
+var jsonMu sync.Mutex // Serializes the events of parallel tests.
+
+// emit prints e as a line of JSON on standard output.
+func emit(e *event) {
+	b := []byte(`{"Time":`)
+	b = appendJSONString(b, time.Now().Format(time.RFC3339Nano))
+	b = append(b, `,"Action":`...)
+	b = appendJSONString(b, e.Action)
+	if e.Test != "" {
+		b = append(b, `,"Test":`...)
+		b = appendJSONString(b, e.Test)
+	}
+	if e.HasElapsed {
+		b = append(b, `,"Elapsed":`...)
+		b = strconv.AppendFloat(b, e.Elapsed.Seconds(), 'f', 3, 64)
+	}
+	if e.Output != "" {
+		b = append(b, `,"Output":`...)
+		b = appendJSONString(b, e.Output)
+	}
+	if r := e.Bench; r != nil {
+		b = append(b, `,"N":`...)
+		b = strconv.AppendInt(b, int64(r.N), 10)
+		b = append(b, `,"NsPerOp":`...)
+		b = strconv.AppendInt(b, r.NsPerOp(), 10)
+		b = append(b, `,"MBPerSec":`...)
+		b = strconv.AppendFloat(b, r.mbPerSec(), 'f', 2, 64)
+		b = append(b, `,"AllocsPerOp":`...)
+		b = strconv.AppendInt(b, r.AllocsPerOp(), 10)
+		b = append(b, `,"AllocedBytesPerOp":`...)
+		b = strconv.AppendInt(b, r.AllocedBytesPerOp(), 10)
+	}
+	b = append(b, "}\n"...)
+
+	jsonMu.Lock()
+	os.Stdout.Write(b)
+	jsonMu.Unlock()
+}
+
+// emitOutput prints an output event for each line of the output of
+// the test called name.
+func emitOutput(name string, output []byte) {
+	for len(output) > 0 {
+		i := bytes.IndexByte(output, '\n') + 1
+		if i == 0 {
+			i = len(output)
+		}
+		emit(&event{Action: actionOutput, Test: name, Output: string(output[:i])})
+		output = output[i:]
+	}
+}
+
+// emitResult prints the output of the finished test called name
+// followed by the event of the given action: pass, fail or skip.
+func emitResult(name, action string, d time.Duration, output []byte) {
+	emitOutput(name, output)
+	emit(&event{Action: action, Test: name, Elapsed: d, HasElapsed: true})
+}
+
+const hex = "0123456789abcdef"
+
+// appendJSONString appends s to b as a JSON string, replacing invalid
+// UTF-8 with the replacement character.
+func appendJSONString(b []byte, s string) []byte {
+	b = append(b, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				b = append(b, '\\', c)
+			case c == '\n':
+				b = append(b, '\\', 'n')
+			case c == '\t':
+				b = append(b, '\\', 't')
+			case c == '\r':
+				b = append(b, '\\', 'r')
+			case c < 0x20 || c == '<' || c == '>' || c == '&':
+				b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+			default:
+				b = append(b, c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, "\ufffd"...)
+		} else {
+			b = append(b, s[i:i+size]...)
+		}
+		i += size
+	}
+	return append(b, '"')
+}
@@ -0,0 +1,84 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testing
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+func TestAppendJSONString(t *T) {
+	s := string(appendJSONString(nil, "a\"b\\\n\t<\x01\xffé"))
+	if want := `"a\"b\\\n\t\u003c\u0001` + "\ufffdé\""; s != want {
+		t.Errorf("appendJSONString = %s, want %s", s, want)
+	}
+	var back string
+	if err := json.Unmarshal([]byte(s), &back); err != nil {
+		t.Errorf("appendJSONString wrote invalid JSON %s: %v", s, err)
+	}
+}
+
+func TestJSONEvents(t *T) {
+	defer setReport(false, true)()
+	out := captureStdout(t, func() {
+		p := newTestParent("")
+		p.Run("group", func(t *T) {
+			t.Log("hello")
+			t.Run("skip", func(t *T) {
+				t.Skip("not now")
+			})
+			t.Run("fail", func(t *T) {
+				t.Fail()
+			})
+		})
+	})
+
+	type event struct {
+		Time    string
+		Action  string
+		Test    string
+		Elapsed *float64
+		Output  string
+	}
+	var got []string
+	for _, line := range strings.SplitAfter(out, "\n") {
+		if line == "" {
+			continue
+		}
+		var e event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("invalid event %q: %v", line, err)
+		}
+		if _, err := time.Parse(time.RFC3339, e.Time); err != nil {
+			t.Errorf("event %q: bad time: %v", line, err)
+		}
+		switch e.Action {
+		case "pass", "fail", "skip":
+			if e.Elapsed == nil {
+				t.Errorf("event %q has no Elapsed", line)
+			}
+		}
+		s := e.Action + " " + e.Test
+		if e.Output != "" {
+			// Leave out the file and line.
+			s += " " + e.Output[strings.LastIndex(e.Output, ": ")+2:]
+		}
+		got = append(got, s)
+	}
+	want := []string{
+		"run Parent/group",
+		"run Parent/group/skip",
+		"output Parent/group/skip not now\n",
+		"skip Parent/group/skip",
+		"run Parent/group/fail",
+		"fail Parent/group/fail",
+		"output Parent/group hello\n",
+		"fail Parent/group",
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("events:\n\t%q\nwant:\n\t%q", got, want)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testing
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// matcher selects the tests or benchmarks to run by name.  A pattern
+// holds a regular expression for each level of the slash-separated
+// names, which must all match; levels beyond the last element of the
+// pattern match anything.
+type matcher struct {
+	filter      []string
+	matchString func(pat, str string) (bool, error)
+
+	mu       sync.Mutex
+	subNames map[string]int // number of subtests of each name run so far
+}
+
+// newMatcher returns a matcher for pattern, exiting if pattern has an
+// invalid element.  flagName names the flag that set it, for messages.
+func newMatcher(matchString func(pat, str string) (bool, error), pattern, flagName string) *matcher {
+	var filter []string
+	if pattern != "" {
+		filter = splitRegexp(pattern)
+		for _, elem := range filter {
+			if _, err := matchString(elem, "non-empty"); err != nil {
+				fmt.Fprintf(os.Stderr, "testing: invalid regexp for element %q of %s: %s\n", elem, flagName, err)
+				os.Exit(1)
+			}
+		}
+	}
+	return &matcher{
+		filter:      filter,
+		matchString: matchString,
+		subNames:    make(map[string]int),
+	}
+}
+
+// fullName returns the name of the child of c named subname, and whether
+// it is selected.  A nil c is the root of the tests and benchmarks.
+// Subtests of the same parent with the same name get numbered suffixes.
+func (m *matcher) fullName(c *common, subname string) (name string, ok bool) {
+	name = rewrite(subname)
+	level := 0
+	if c != nil && c.level > 0 {
+		name = c.name + "/" + name
+		level = c.level
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if n, seen := m.subNames[name]; seen {
+		for {
+			n++
+			unique := fmt.Sprintf("%s#%02d", name, n)
+			if _, seen := m.subNames[unique]; !seen {
+				m.subNames[name] = n
+				name = unique
+				break
+			}
+		}
+	}
+	m.subNames[name] = 0
+
+	if level >= len(m.filter) {
+		return name, true
+	}
+	// Only this level is left to match: the parent matched the others.
+	elem := name[strings.LastIndex(name, "/")+1:]
+	ok, _ = m.matchString(m.filter[level], elem)
+	return name, ok
+}
+
+// splitRegexp splits pattern at the slashes that are not inside
+// brackets or parentheses and not escaped.
+func splitRegexp(pattern string) []string {
+	var elems []string
+	cs, ps := 0, 0 // depths of brackets and parentheses
+	start := 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '[':
+			cs++
+		case ']':
+			if cs--; cs < 0 { // An unmatched ']' is legal.
+				cs = 0
+			}
+		case '(':
+			if cs == 0 {
+				ps++
+			}
+		case ')':
+			if cs == 0 {
+				ps--
+			}
+		case '\\':
+			i++
+		case '/':
+			if cs == 0 && ps == 0 {
+				elems = append(elems, pattern[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(elems, pattern[start:])
+}
+
+// rewrite makes a name usable in a pattern: spaces become underscores
+// and other unprintable characters are escaped.
+func rewrite(s string) string {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case unicode.IsSpace(r):
+			b = append(b, '_')
+		case !unicode.IsPrint(r):
+			q := strconv.QuoteRune(r)
+			b = append(b, q[1:len(q)-1]...)
+		default:
+			b = append(b, string(r)...)
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,179 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testing
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// newTestParent returns a test, outside the run of this package's own
+// tests, under which to run subtests.  Their failures stop at it, and
+// their results go into its output rather than to standard output.
+func newTestParent(pattern string) *T {
+	return &T{
+		common: common{
+			signal:  make(chan bool),
+			barrier: make(chan bool),
+			name:    "Parent",
+			parent:  &common{},
+			level:   1,
+		},
+		context: &testContext{
+			match:         newMatcher(regexp.MatchString, pattern, "-test.run"),
+			procs:         1,
+			startParallel: make(chan bool),
+			running:       1,
+			maxParallel:   4,
+		},
+	}
+}
+
+// setReport sets the -test.v and -test.json flags for the reports of
+// the subtests run under a test parent, and returns a function that
+// restores them.
+func setReport(v, json bool) func() {
+	oldV, oldJSON := *chatty, *jsonOutput
+	*chatty, *jsonOutput = v, json
+	return func() { *chatty, *jsonOutput = oldV, oldJSON }
+}
+
+func TestSplitRegexp(t *T) {
+	for _, tc := range []struct {
+		pattern string
+		want    []string
+	}{
+		{"a", []string{"a"}},
+		{"a/b", []string{"a", "b"}},
+		{"/b", []string{"", "b"}},
+		{"a[/]b/c", []string{"a[/]b", "c"}},
+		{"(a/b)/c", []string{"(a/b)", "c"}},
+		{`a\/b`, []string{`a\/b`}},
+		{"a]/b", []string{"a]", "b"}},
+	} {
+		if got := splitRegexp(tc.pattern); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("splitRegexp(%q) = %q, want %q", tc.pattern, got, tc.want)
+		}
+	}
+}
+
+func TestSubtestNames(t *T) {
+	m := newMatcher(regexp.MatchString, "", "-test.run")
+	parent := &common{name: "TestX", level: 1}
+	for _, tc := range []struct {
+		sub, want string
+	}{
+		{"a", "TestX/a"},
+		{"a", "TestX/a#01"},
+		{"a", "TestX/a#02"},
+		{"a#01", "TestX/a#01#01"},
+		{"b c", "TestX/b_c"},
+		{"\x00", `TestX/\x00`},
+	} {
+		if name, _ := m.fullName(parent, tc.sub); name != tc.want {
+			t.Errorf("subtest %q of TestX named %q, want %q", tc.sub, name, tc.want)
+		}
+	}
+	if name, _ := m.fullName(nil, "TestY"); name != "TestY" {
+		t.Errorf("top-level test TestY named %q", name)
+	}
+}
+
+func TestRunMatch(t *T) {
+	for _, tc := range []struct {
+		pattern, test, sub string
+		ok                 bool
+	}{
+		{"", "TestFoo", "A=1", true},
+		{"Foo", "TestFoo", "A=1", true},
+		{"Foo/A=", "TestFoo", "A=1", true},
+		{"Foo/A=", "TestFoo", "B=1", false},
+		{"/A=1", "TestBar", "A=1", true},
+		{"/A=1", "TestBar", "A=2", false},
+		{"Foo/A=1/", "TestFoo", "A=1", true},
+	} {
+		m := newMatcher(regexp.MatchString, tc.pattern, "-test.run")
+		if _, ok := m.fullName(nil, tc.test); !ok {
+			t.Errorf("-run %q does not select %s", tc.pattern, tc.test)
+			continue
+		}
+		parent := &common{name: tc.test, level: 1}
+		if _, ok := m.fullName(parent, tc.sub); ok != tc.ok {
+			t.Errorf("-run %q selects %s/%s = %v, want %v", tc.pattern, tc.test, tc.sub, ok, tc.ok)
+		}
+	}
+}
+
+func TestRunSubtests(t *T) {
+	defer setReport(false, false)()
+	p := newTestParent("Parent/group/^(pass|fail)$")
+	var ran []string
+	ok := p.Run("group", func(t *T) {
+		for _, name := range []string{"pass", "fail", "other"} {
+			t.Run(name, func(t *T) {
+				ran = append(ran, t.name)
+				if strings.HasSuffix(t.name, "fail") {
+					t.Error("oops")
+				}
+			})
+		}
+	})
+	if ok || !p.Failed() {
+		t.Errorf("Run = %v, parent failed = %v, want false, true", ok, p.Failed())
+	}
+	if want := []string{"Parent/group/pass", "Parent/group/fail"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("ran %q, want %q", ran, want)
+	}
+	out := string(p.output)
+	for _, want := range []string{
+		"    --- FAIL: Parent/group (",
+		"        --- FAIL: Parent/group/fail (",
+		": oops\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "pass") {
+		t.Errorf("output reports the passing subtest:\n%s", out)
+	}
+}
+
+func TestParallelSubtests(t *T) {
+	defer setReport(false, false)()
+	p := newTestParent("")
+	var mu sync.Mutex
+	done := 0
+	a, b := make(chan bool), make(chan bool)
+	p.Run("group", func(g *T) {
+		// Each subtest waits for the other to start.
+		g.Run("a", func(t *T) {
+			t.Parallel()
+			close(a)
+			<-b
+			mu.Lock()
+			done++
+			mu.Unlock()
+		})
+		g.Run("b", func(t *T) {
+			t.Parallel()
+			close(b)
+			<-a
+			mu.Lock()
+			done++
+			mu.Unlock()
+		})
+		mu.Lock()
+		if done != 0 {
+			t.Errorf("parallel subtests ran before their parent returned")
+		}
+		mu.Unlock()
+	})
+	if done != 2 {
+		t.Errorf("Run returned after %d of 2 parallel subtests finished", done)
+	}
+}
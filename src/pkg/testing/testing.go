@@ -76,9 +76,62 @@
 // The entire test file is presented as the example when it contains a single
 // example function, at least one other function, type, variable, or constant
 // declaration, and no test or benchmark functions.
+//
+// Tests and benchmarks may be skipped if not applicable, with a call to
+// the Skip method of T or B, which is reported as SKIP:
+//
+//     func TestTimeConsuming(t *testing.T) {
+//         if testing.Short() {
+//             t.Skip("skipping test in short mode.")
+//         }
+//         ...
+//     }
+//
+// The Cleanup method registers a function to call when the test and
+// its subtests have finished, and the Helper method marks a function
+// as a test helper, so that the file and line of the messages it logs
+// are those of its caller.
+//
+// The Run methods of T and B run subtests and sub-benchmarks, which
+// allows table-driven tests and benchmarks to report each case and
+// to share setup code:
+//
+//     func TestGroup(t *testing.T) {
+//         // <setup code>
+//         t.Run("A=1", func(t *testing.T) { ... })
+//         t.Run("A=2", func(t *testing.T) { ... })
+//         t.Run("B=1", func(t *testing.T) { ... })
+//         // <tear-down code>
+//     }
+//
+// A subtest is named by its parent's name and its own, separated by a
+// slash, as in TestGroup/A=1.  The -test.run and -test.bench patterns
+// are split at the slashes that are not inside brackets or parentheses,
+// and each element must match the name at its level:
+//
+//     go test -run ''      # Run all tests.
+//     go test -run Foo     # Run top-level tests matching "Foo".
+//     go test -run Foo/A=  # Run subtests of tests matching "Foo" whose names match "A=".
+//     go test -run /A=1    # Run all subtests named "A=1".
+//
+// A subtest that calls Parallel runs in parallel with the other
+// parallel subtests of its parent once the parent's test function
+// returns, and the parent does not finish until they do, so a parent
+// can wait for a group of parallel subtests:
+//
+//     func TestGroupedParallel(t *testing.T) {
+//         for _, tc := range tests {
+//             tc := tc // capture range variable
+//             t.Run(tc.Name, func(t *testing.T) {
+//                 t.Parallel()
+//                 ...
+//             })
+//         }
+//     }
 package testing
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"os"
@@ -86,6 +139,7 @@ import (
 	"runtime/pprof"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -101,24 +155,36 @@ var (
 	chatty         = flag.Bool("test.v", false, "verbose: print additional output")
 	match          = flag.String("test.run", "", "regular expression to select tests and examples to run")
 	memProfile     = flag.String("test.memprofile", "", "write a memory profile to the named file after execution")
-	memProfileRate = flag.Int("test.memprofilerate", 0, "if >=0, sets runtime.MemProfileRate")
+	memProfileRate = flag.Int("test.memprofilerate", 0, "if >0, sets runtime.MemProfileRate")
 	cpuProfile     = flag.String("test.cpuprofile", "", "write a cpu profile to the named file during execution")
 	timeout        = flag.Duration("test.timeout", 0, "if positive, sets an aggregate time limit for all tests")
 	cpuListStr     = flag.String("test.cpu", "", "comma-separated list of number of CPUs to use for each test")
 	parallel       = flag.Int("test.parallel", runtime.GOMAXPROCS(0), "maximum test parallelism")
 
 	cpuList []int
+
+	cpuProfileFile *os.File // The file the CPU profile is being written to.
 )
 
 // common holds the elements common between T and B and
 // captures common methods such as Errorf.
 type common struct {
-	output   []byte    // Output generated by test or benchmark.
-	failed   bool      // Test or benchmark has failed.
-	start    time.Time // Time test or benchmark started
+	mu       sync.RWMutex    // Guards output, failed, skipped, cleanups and helpers.
+	output   []byte          // Output generated by test or benchmark.
+	failed   bool            // Test or benchmark has failed.
+	skipped  bool            // Test or benchmark has been skipped.
+	cleanups []func()        // Functions to call when the test or benchmark finishes.
+	helpers  map[string]bool // Names of the functions marked by Helper.
+	start    time.Time       // Time test or benchmark started
 	duration time.Duration
-	self     interface{}      // To be sent on signal channel when done.
-	signal   chan interface{} // Output for serial tests.
+	signal   chan bool // To signal that a test or benchmark is done.
+
+	name    string    // Name of test or benchmark.
+	parent  *common   // Test or benchmark that ran this one; nil for the root.
+	level   int       // Nesting depth: top-level tests and benchmarks are at 1.
+	hasSub  bool      // Run has been called.
+	sub     []*T      // Parallel subtests waiting for this test to return.
+	barrier chan bool // Closed when this test returns, to start the parallel subtests.
 }
 
 // Short reports whether the -test.short flag is set.
@@ -126,52 +192,99 @@ func Short() bool {
 	return *short
 }
 
-// decorate inserts the final newline if needed and indentation tabs for formatting.
-// If addFileLine is true, it also prefixes the string with the file and line of the call site.
-func decorate(s string, addFileLine bool) string {
-	if addFileLine {
-		_, file, line, ok := runtime.Caller(3) // decorate + log + public function.
-		if ok {
-			// Truncate file name at last file name separator.
-			if index := strings.LastIndex(file, "/"); index >= 0 {
-				file = file[index+1:]
-			} else if index = strings.LastIndex(file, "\\"); index >= 0 {
-				file = file[index+1:]
-			}
-		} else {
-			file = "???"
-			line = 1
-		}
-		s = fmt.Sprintf("%s:%d: %s", file, line, s)
+// decorate prefixes the string with the file and line of the call site
+// and inserts the final newline if needed and indentation tabs for formatting.
+func (c *common) decorate(s string) string {
+	file, line := c.frame()
+	// Truncate file name at last file name separator.
+	if index := strings.LastIndex(file, "/"); index >= 0 {
+		file = file[index+1:]
+	} else if index = strings.LastIndex(file, "\\"); index >= 0 {
+		file = file[index+1:]
 	}
-	s = "\t" + s // Every line is indented at least one tab.
-	n := len(s)
-	if n > 0 && s[n-1] != '\n' {
-		s += "\n"
-		n++
+	buf := new(bytes.Buffer)
+	buf.WriteByte('\t') // Every line is indented at least one tab.
+	fmt.Fprintf(buf, "%s:%d: ", file, line)
+	lines := strings.Split(s, "\n")
+	if l := len(lines); l > 1 && lines[l-1] == "" {
+		lines = lines[:l-1]
 	}
-	for i := 0; i < n-1; i++ { // -1 to avoid final newline
-		if s[i] == '\n' {
+	for i, line := range lines {
+		if i > 0 {
 			// Second and subsequent lines are indented an extra tab.
-			return s[0:i+1] + "\t" + decorate(s[i+1:n], false)
+			buf.WriteString("\n\t\t")
 		}
+		buf.WriteString(line)
 	}
-	return s
+	buf.WriteByte('\n')
+	return buf.String()
+}
+
+// frame returns the file and line of the call site of the public
+// function that called log, skipping the functions marked by Helper.
+// A test function that marks itself is reported anyway.
+func (c *common) frame() (file string, line int) {
+	file, line = "???", 1
+	for skip := 4; ; skip++ { // frame + decorate + log + public function.
+		pc, f, l, ok := runtime.Caller(skip)
+		if !ok {
+			return
+		}
+		fn := runtime.FuncForPC(pc)
+		if fn == nil {
+			return f, l
+		}
+		name := fn.Name()
+		if name == "testing.tRunner" {
+			return
+		}
+		file, line = f, l
+		if !c.isHelper(name) {
+			return
+		}
+	}
+	panic("unreachable")
+}
+
+// isHelper reports whether the function called name was marked by
+// Helper in this test or benchmark or one that ran it.
+func (c *common) isHelper(name string) bool {
+	for ; c != nil; c = c.parent {
+		c.mu.RLock()
+		ok := c.helpers[name]
+		c.mu.RUnlock()
+		if ok {
+			return true
+		}
+	}
+	return false
 }
 
 // T is a type passed to Test functions to manage test state and support formatted test logs.
 // Logs are accumulated during execution and dumped to standard error when done.
 type T struct {
 	common
-	name          string    // Name of test.
-	startParallel chan bool // Parallel tests will wait on this.
+	context    *testContext
+	isParallel bool
 }
 
 // Fail marks the function as having failed but continues execution.
-func (c *common) Fail() { c.failed = true }
+// The tests or benchmarks that ran it with Run fail too.
+func (c *common) Fail() {
+	c.mu.Lock()
+	c.failed = true
+	c.mu.Unlock()
+	if c.parent != nil {
+		c.parent.Fail()
+	}
+}
 
 // Failed returns whether the function has failed.
-func (c *common) Failed() bool { return c.failed }
+func (c *common) Failed() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.failed
+}
 
 // FailNow marks the function as having failed and stops its execution.
 // Execution will continue at the next test or benchmark.
@@ -202,7 +315,10 @@ func (c *common) FailNow() {
 
 // log generates the output. It's always at the same stack depth.
 func (c *common) log(s string) {
-	c.output = append(c.output, decorate(s, true)...)
+	s = c.decorate(s)
+	c.mu.Lock()
+	c.output = append(c.output, s...)
+	c.mu.Unlock()
 }
 
 // Log formats its arguments using default formatting, analogous to Println(),
@@ -237,11 +353,181 @@ func (c *common) Fatalf(format string, args ...interface{}) {
 	c.FailNow()
 }
 
-// Parallel signals that this test is to be run in parallel with (and only with) 
-// other parallel tests in this CPU group.
+// Skip is equivalent to Log() followed by SkipNow().
+func (c *common) Skip(args ...interface{}) {
+	c.log(fmt.Sprintln(args...))
+	c.SkipNow()
+}
+
+// Skipf is equivalent to Logf() followed by SkipNow().
+func (c *common) Skipf(format string, args ...interface{}) {
+	c.log(fmt.Sprintf(format, args...))
+	c.SkipNow()
+}
+
+// SkipNow marks the function as having been skipped and stops its
+// execution, like FailNow.  A skipped test is reported as SKIP rather
+// than PASS, but unless it also failed, it counts as a success.
+// SkipNow must be called from the goroutine running the test or
+// benchmark, not from other goroutines created during the test.
+func (c *common) SkipNow() {
+	c.mu.Lock()
+	c.skipped = true
+	c.mu.Unlock()
+	runtime.Goexit()
+}
+
+// Skipped returns whether the function was skipped.
+func (c *common) Skipped() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.skipped
+}
+
+// Cleanup registers f to be called when the function finishes.  The
+// functions are called last registered first, after the parallel
+// subtests of a test have finished too, and before the result is
+// reported, so they may still log and fail.  A benchmark's functions
+// are called each time the benchmark function returns.
+func (c *common) Cleanup(f func()) {
+	c.mu.Lock()
+	c.cleanups = append(c.cleanups, f)
+	c.mu.Unlock()
+}
+
+// runCleanup calls the functions registered with Cleanup, last first.
+// Each runs in a goroutine of its own, so that one that calls FailNow
+// stops only itself.
+func (c *common) runCleanup() {
+	for {
+		c.mu.Lock()
+		n := len(c.cleanups)
+		if n == 0 {
+			c.mu.Unlock()
+			return
+		}
+		f := c.cleanups[n-1]
+		c.cleanups = c.cleanups[:n-1]
+		c.mu.Unlock()
+
+		done := make(chan bool)
+		go func() {
+			defer close(done)
+			f()
+		}()
+		<-done
+	}
+}
+
+// Helper marks the calling function as a test helper function.  The
+// file and line printed with the output of Log, Error, Skip and the
+// like then point at the call of the helper rather than at the helper
+// itself.  Helper may be called from several goroutines at once.
+func (c *common) Helper() {
+	pc, _, _, ok := runtime.Caller(1)
+	if !ok {
+		return
+	}
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return
+	}
+	c.mu.Lock()
+	if c.helpers == nil {
+		c.helpers = make(map[string]bool)
+	}
+	c.helpers[fn.Name()] = true
+	c.mu.Unlock()
+}
+
+// Parallel signals that this test is to be run in parallel with (and only with)
+// other parallel tests in this CPU group.  It returns once the test that
+// ran this one has returned; the parallel subtests of a top-level test,
+// and the parallel top-level tests, run together.
 func (t *T) Parallel() {
-	t.signal <- (*T)(nil) // Release main testing loop
-	<-t.startParallel     // Wait for serial tests to finish
+	if t.isParallel {
+		panic("testing: t.Parallel called multiple times")
+	}
+	t.isParallel = true
+	t.duration += time.Now().Sub(t.start)
+	t.parent.sub = append(t.parent.sub, t)
+	t.signal <- true   // Release the calling test.
+	<-t.parent.barrier // Wait for the calling test to return.
+	t.context.waitParallel()
+	t.start = time.Now()
+}
+
+// Run runs f as a subtest of t called name, in a separate goroutine,
+// and blocks until f returns or calls t.Parallel.  It reports whether f
+// succeeded, or at least had not failed before calling t.Parallel.
+// A subtest whose name the -test.run pattern does not select is not
+// run and counts as a success.
+func (t *T) Run(name string, f func(t *T)) bool {
+	t.hasSub = true
+	testName, ok := t.context.match.fullName(&t.common, name)
+	if !ok {
+		return true
+	}
+	if t.level == 0 && t.context.procs != 1 {
+		testName = fmt.Sprintf("%s-%d", testName, t.context.procs)
+	}
+	sub := &T{
+		common: common{
+			signal:  make(chan bool),
+			barrier: make(chan bool),
+			name:    testName,
+			parent:  &t.common,
+			level:   t.level + 1,
+		},
+		context: t.context,
+	}
+	if *jsonOutput {
+		emit(&event{Action: actionRun, Test: sub.name})
+	} else if *chatty {
+		fmt.Printf("=== RUN %s\n", sub.name)
+	}
+	go tRunner(sub, f)
+	<-sub.signal
+	return !sub.Failed()
+}
+
+// testContext holds the state shared by the tests of a run.
+type testContext struct {
+	match *matcher
+	procs int // GOMAXPROCS for the run, which suffixes top-level names.
+
+	mu            sync.Mutex
+	startParallel chan bool // Parallel tests wait on this for a free slot.
+	running       int       // Number of tests running, counting the sequential ones as one.
+	numWaiting    int       // Number of parallel tests waiting for a slot.
+	maxParallel   int
+}
+
+// waitParallel blocks until a parallel test may start.
+func (c *testContext) waitParallel() {
+	c.mu.Lock()
+	if c.running < c.maxParallel {
+		c.running++
+		c.mu.Unlock()
+		return
+	}
+	c.numWaiting++
+	c.mu.Unlock()
+	<-c.startParallel
+}
+
+// release frees the slot of a test that has finished running,
+// passing it to a waiting parallel test if there is one.
+func (c *testContext) release() {
+	c.mu.Lock()
+	if c.numWaiting == 0 {
+		c.running--
+		c.mu.Unlock()
+		return
+	}
+	c.numWaiting--
+	c.mu.Unlock()
+	c.startParallel <- true // Pass the slot on.
 }
 
 // An internal type but exported because it is cross-package; part of the implementation
@@ -251,24 +537,48 @@ type InternalTest struct {
 	F    func(*T)
 }
 
-func tRunner(t *T, test *InternalTest) {
+func tRunner(t *T, fn func(t *T)) {
 	t.start = time.Now()
 
-	// When this goroutine is done, either because test.F(t)
-	// returned normally or because a test failure triggered 
-	// a call to runtime.Goexit, record the duration and send
-	// a signal saying that the test is done.
+	// When this goroutine is done, either because fn(t)
+	// returned normally or because a test failure triggered
+	// a call to runtime.Goexit, wait for the parallel subtests,
+	// record the duration and send a signal saying that the
+	// test is done.
 	defer func() {
-		t.duration = time.Now().Sub(t.start)
-		// If the test panicked, print any test output before dying.
+		// If the test panicked, print any test output before dying,
+		// along with that of the tests that ran it.
 		if err := recover(); err != nil {
-			t.report()
+			t.duration += time.Now().Sub(t.start)
+			t.Fail()
+			t.runCleanup()
+			for c := &t.common; c.parent != nil; c = c.parent {
+				c.report()
+			}
 			panic(err)
 		}
-		t.signal <- t
+		if len(t.sub) > 0 {
+			// Give up this test's slot while its parallel
+			// subtests run, then take it back if the tests
+			// after this one are waiting for it.
+			t.context.release()
+			close(t.barrier)
+			for _, sub := range t.sub {
+				<-sub.signal
+			}
+			if !t.isParallel {
+				t.context.waitParallel()
+			}
+		} else if t.isParallel {
+			t.context.release()
+		}
+		t.runCleanup()
+		t.duration += time.Now().Sub(t.start)
+		t.report()
+		t.signal <- true
 	}()
 
-	test.F(t)
+	fn(t)
 }
 
 // An internal function but exported because it is cross-package; part of the implementation
@@ -278,27 +588,90 @@ func Main(matchString func(pat, str string) (bool, error), tests []InternalTest,
 	parseCpuList()
 
 	before()
+	start := time.Now()
 	startAlarm()
 	testOk := RunTests(matchString, tests)
 	exampleOk := RunExamples(matchString, examples)
 	if !testOk || !exampleOk {
-		fmt.Println("FAIL")
+		if cover.Mode != "" {
+			coverReport()
+		}
+		if *jsonOutput {
+			emit(&event{Action: actionFail, Elapsed: time.Now().Sub(start), HasElapsed: true})
+		} else {
+			fmt.Println("FAIL")
+		}
+		after()
 		os.Exit(1)
 	}
-	fmt.Println("PASS")
+	if !*jsonOutput {
+		fmt.Println("PASS")
+	}
 	stopAlarm()
 	RunBenchmarks(matchString, benchmarks)
+	if cover.Mode != "" {
+		coverReport()
+	}
+	if *jsonOutput {
+		emit(&event{Action: actionPass, Elapsed: time.Now().Sub(start), HasElapsed: true})
+	}
 	after()
 }
 
-func (t *T) report() {
-	tstr := fmt.Sprintf("(%.2f seconds)", t.duration.Seconds())
+// report prints the result and output of a test that has finished: a
+// top-level test's to standard output, and a subtest's, indented, into
+// the output of its parent.
+func (c *common) report() {
+	if c.parent == nil {
+		return
+	}
+	if *jsonOutput {
+		c.mu.RLock()
+		emitResult(c.name, c.action(), c.duration, c.output)
+		c.mu.RUnlock()
+		return
+	}
+	tstr := fmt.Sprintf("(%.2f seconds)", c.duration.Seconds())
 	format := "--- %s: %s %s\n%s"
-	if t.failed {
-		fmt.Printf(format, "FAIL", t.name, tstr, t.output)
+	c.mu.RLock()
+	var s string
+	if c.failed {
+		s = fmt.Sprintf(format, "FAIL", c.name, tstr, c.output)
+	} else if c.skipped {
+		if *chatty {
+			s = fmt.Sprintf(format, "SKIP", c.name, tstr, c.output)
+		}
 	} else if *chatty {
-		fmt.Printf(format, "PASS", t.name, tstr, t.output)
+		s = fmt.Sprintf(format, "PASS", c.name, tstr, c.output)
 	}
+	c.mu.RUnlock()
+	if s == "" {
+		return
+	}
+	p := c.parent
+	if p.parent == nil {
+		fmt.Print(s)
+		return
+	}
+	p.mu.Lock()
+	for _, line := range strings.SplitAfter(s, "\n") {
+		if line != "" {
+			p.output = append(p.output, "    "+line...)
+		}
+	}
+	p.mu.Unlock()
+}
+
+// action returns the action of the JSON event reporting the result of
+// the test or benchmark.  The caller must hold c.mu.
+func (c *common) action() string {
+	switch {
+	case c.failed:
+		return actionFail
+	case c.skipped:
+		return actionSkip
+	}
+	return actionPass
 }
 
 func RunTests(matchString func(pat, str string) (bool, error), tests []InternalTest) (ok bool) {
@@ -309,66 +682,30 @@ func RunTests(matchString func(pat, str string) (bool, error), tests []InternalT
 	}
 	for _, procs := range cpuList {
 		runtime.GOMAXPROCS(procs)
-		// We build a new channel tree for each run of the loop.
-		// collector merges in one channel all the upstream signals from parallel tests.
-		// If all tests pump to the same channel, a bug can occur where a test
-		// kicks off a goroutine that Fails, yet the test still delivers a completion signal,
-		// which skews the counting.
-		var collector = make(chan interface{})
-
-		numParallel := 0
-		startParallel := make(chan bool)
-
-		for i := 0; i < len(tests); i++ {
-			matched, err := matchString(*match, tests[i].Name)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "testing: invalid regexp for -test.run: %s\n", err)
-				os.Exit(1)
-			}
-			if !matched {
-				continue
-			}
-			testName := tests[i].Name
-			if procs != 1 {
-				testName = fmt.Sprintf("%s-%d", tests[i].Name, procs)
-			}
-			t := &T{
-				common: common{
-					signal: make(chan interface{}),
-				},
-				name:          testName,
-				startParallel: startParallel,
-			}
-			t.self = t
-			if *chatty {
-				fmt.Printf("=== RUN %s\n", t.name)
-			}
-			go tRunner(t, &tests[i])
-			out := (<-t.signal).(*T)
-			if out == nil { // Parallel run.
-				go func() {
-					collector <- <-t.signal
-				}()
-				numParallel++
-				continue
-			}
-			t.report()
-			ok = ok && !out.failed
+		// Each run of the loop has its own context, so that parallel
+		// tests don't wait on tests of another CPU group.
+		ctx := &testContext{
+			match:         newMatcher(matchString, *match, "-test.run"),
+			procs:         procs,
+			startParallel: make(chan bool),
+			running:       1, // The sequential tests.
+			maxParallel:   *parallel,
 		}
-
-		running := 0
-		for numParallel+running > 0 {
-			if running < *parallel && numParallel > 0 {
-				startParallel <- true
-				running++
-				numParallel--
-				continue
-			}
-			t := (<-collector).(*T)
-			t.report()
-			ok = ok && !t.failed
-			running--
+		// The top-level tests are subtests of a root that reports nothing.
+		root := &T{
+			common: common{
+				signal:  make(chan bool),
+				barrier: make(chan bool),
+			},
+			context: ctx,
 		}
+		go tRunner(root, func(t *T) {
+			for i := range tests {
+				t.Run(tests[i].Name, tests[i].F)
+			}
+		})
+		<-root.signal
+		ok = ok && !root.Failed()
 	}
 	return
 }
@@ -381,32 +718,35 @@ func before() {
 	if *cpuProfile != "" {
 		f, err := os.Create(*cpuProfile)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "testing: %s", err)
+			fmt.Fprintf(os.Stderr, "testing: %s\n", err)
 			return
 		}
 		if err := pprof.StartCPUProfile(f); err != nil {
-			fmt.Fprintf(os.Stderr, "testing: can't start cpu profile: %s", err)
+			fmt.Fprintf(os.Stderr, "testing: can't start cpu profile: %s\n", err)
 			f.Close()
 			return
 		}
-		// Could save f so after can call f.Close; not worth the effort.
+		cpuProfileFile = f
 	}
-
 }
 
-// after runs after all testing.
+// after runs after all testing, whether or not the tests passed, and
+// writes the profiles of the tests and benchmarks that ran.
 func after() {
-	if *cpuProfile != "" {
+	if cpuProfileFile != nil {
 		pprof.StopCPUProfile() // flushes profile to disk
+		cpuProfileFile.Close()
+		cpuProfileFile = nil
 	}
 	if *memProfile != "" {
 		f, err := os.Create(*memProfile)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "testing: %s", err)
+			fmt.Fprintf(os.Stderr, "testing: %s\n", err)
 			return
 		}
+		runtime.GC() // materialize all statistics
 		if err = pprof.WriteHeapProfile(f); err != nil {
-			fmt.Fprintf(os.Stderr, "testing: can't write %s: %s", *memProfile, err)
+			fmt.Fprintf(os.Stderr, "testing: can't write %s: %s\n", *memProfile, err)
 		}
 		f.Close()
 	}
@@ -0,0 +1,108 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testing
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+func TestSkip(t *T) {
+	defer setReport(true, false)()
+	p := newTestParent("")
+	var sub *T
+	ran, ok := false, false
+	run := captureStdout(t, func() {
+		ok = p.Run("skip", func(t *T) {
+			sub = t
+			t.Skip("not now")
+			ran = true
+		})
+	})
+	if run != "=== RUN Parent/skip\n" {
+		t.Errorf("Run printed %q under -test.v", run)
+	}
+	if !ok || p.Failed() || !sub.Skipped() || ran {
+		t.Errorf("Run = %v, failed = %v, skipped = %v, ran on = %v, want true, false, true, false", ok, p.Failed(), sub.Skipped(), ran)
+	}
+	out := string(p.output)
+	if !strings.HasPrefix(out, "    --- SKIP: Parent/skip (") || !strings.HasSuffix(out, ": not now\n") {
+		t.Errorf("output of skipped test:\n%s", out)
+	}
+
+	// Without -test.v, a skipped test is not reported.
+	*chatty = false
+	p = newTestParent("")
+	p.Run("skip", func(t *T) { t.SkipNow() })
+	if len(p.output) > 0 {
+		t.Errorf("output of skipped test without -test.v:\n%s", p.output)
+	}
+}
+
+func TestCleanup(t *T) {
+	defer setReport(false, false)()
+	p := newTestParent("")
+	var order []string
+	ok := p.Run("cleanup", func(t *T) {
+		t.Cleanup(func() { order = append(order, "first") })
+		t.Cleanup(func() {
+			order = append(order, "second")
+			t.Error("failed in cleanup")
+		})
+		t.Run("sub", func(t *T) {
+			t.Parallel()
+			order = append(order, "sub")
+		})
+		order = append(order, "body")
+	})
+	if want := []string{"body", "sub", "second", "first"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("ran %q, want %q", order, want)
+	}
+	if ok || !strings.Contains(string(p.output), "failed in cleanup") {
+		t.Errorf("Run = %v with output:\n%s\nwant false and the error of the cleanup", ok, p.output)
+	}
+}
+
+func helperError(t *T, msg string) {
+	t.Helper()
+	t.Error(msg)
+}
+
+func nestedHelperError(t *T, msg string) {
+	t.Helper()
+	helperError(t, msg)
+}
+
+// notHelperError reports msg and returns the line that reports it.
+func notHelperError(t *T, msg string) int {
+	_, _, line, _ := runtime.Caller(0)
+	t.Error(msg)
+	return line + 1
+}
+
+func TestHelper(t *T) {
+	defer setReport(false, false)()
+	p := newTestParent("")
+	var want []string
+	p.Run("helper", func(t *T) {
+		_, file, line, _ := runtime.Caller(0)
+		file = filepath.Base(file)
+		helperError(t, "marked")
+		want = append(want, fmt.Sprintf("%s:%d: marked", file, line+2))
+		nestedHelperError(t, "nested")
+		want = append(want, fmt.Sprintf("%s:%d: nested", file, line+4))
+		line = notHelperError(t, "unmarked")
+		want = append(want, fmt.Sprintf("%s:%d: unmarked", file, line))
+	})
+	out := string(p.output)
+	for _, w := range want {
+		if !strings.Contains(out, w) {
+			t.Errorf("output does not contain %q:\n%s", w, out)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// $G -b -S $D/$F.go >$F.s &&
+// grep -q 'CALL.*,runtime\.racefuncenter' $F.s &&
+// grep -q 'CALL.*,runtime\.racefuncexit' $F.s &&
+// grep -v racefunc $F.s | sed -n 's/.*:\([0-9]*\)) CALL.*,runtime\.race.*/\1/p' | sort -nu >$F.got &&
+// grep -n '// instrumented$' $D/$F.go | sed 's/:.*//' >$F.want &&
+// cmp -s $F.got $F.want || echo BUG: racewalk
+// rm -f $F.s $F.got $F.want
+
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Test that the race detector instrumentation (-b) reads and writes
+// memory that other goroutines can reach, and leaves local variables
+// alone.  The marked lines, and only those, must be instrumented.
+// Compiles but does not run.
+
+package p
+
+var g int
+var a [10]int
+var s []int
+
+type T struct {
+	x, y int
+}
+
+func f(p *int, t *T, i int) int {
+	x := 1
+	x++
+	g = x    // instrumented
+	x = *p   // instrumented
+	t.y = x  // instrumented
+	a[i] = 2 // instrumented
+	s[i]++   // instrumented
+	return x
+}
+
+func local(i int) int {
+	var b [10]int
+	b[i] = i
+	return b[0] + i
+}